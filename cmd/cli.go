@@ -21,8 +21,13 @@ var helpCommands = [][]string{
 	{"BITPOS", "key bit [start] [end]", "KV"},
 	{"BLPOP", "key [key ...] timeout", "List"},
 	{"BRPOP", "key [key ...] timeout", "List"},
+	{"CLIENT DURABILITY", "[SYNC numreplicas timeout|ASYNC]", "Replication"},
+	{"CLIENT LASTLOGID", "-", "Replication"},
+	{"CLIENT LOGID", "ON|OFF", "Replication"},
 	{"CONFIG GET", "parameter", "Server"},
 	{"CONFIG REWRITE", "-", "Server"},
+	{"COPY", "source destination [DB destination-db] [REPLACE]", "Server"},
+	{"DBSIZE", "-", "Server"},
 	{"DECR", "key", "KV"},
 	{"DECRBY", "key decrement", "KV"},
 	{"DEL", "key [key ...]", "KV"},
@@ -33,9 +38,9 @@ var helpCommands = [][]string{
 	{"EXISTS", "key", "KV"},
 	{"EXPIRE", "key seconds", "KV"},
 	{"EXPIREAT", "key timestamp", "KV"},
-	{"FLUSHALL", "-", "Server"},
-	{"FLUSHDB", "-", "Server"},
-	{"FULLSYNC", "[NEW]", "Replication"},
+	{"FLUSHALL", "[ASYNC|SYNC]", "Server"},
+	{"FLUSHDB", "[ASYNC|SYNC]", "Server"},
+	{"FULLSYNC", "[NEW] [CHECKPOINT store]", "Replication"},
 	{"GET", "key", "KV"},
 	{"GETBIT", "key offset", "KV"},
 	{"GETRANGE", "key start end", "KV"},
@@ -63,6 +68,7 @@ var helpCommands = [][]string{
 	{"INCR", "key", "KV"},
 	{"INCRBY", "key increment", "KV"},
 	{"INFO", "[section]", "Server"},
+	{"KEYS", "pattern", "Server"},
 	{"LCLEAR", "key", "List"},
 	{"LDUMP", "key", "List"},
 	{"LEXPIRE", "key seconds", "List"},
@@ -77,15 +83,29 @@ var helpCommands = [][]string{
 	{"LRANGE", "key start stop", "List"},
 	{"LSET", "key index value", "List"},
 	{"LTTL", "key", "List"},
+	{"MEMORY USAGE", "key [SAMPLES count]", "Server"},
 	{"MGET", "key [key ...]", "KV"},
+	{"MOVE", "key db", "Server"},
 	{"MSET", "key value [key value ...]", "KV"},
 	{"PERSIST", "key", "KV"},
 	{"PING", "-", "Server"},
+	{"RAFT JOIN", "addr raft_addr", "Replication"},
+	{"RAFT LEADER", "-", "Replication"},
+	{"RAFT NODES", "-", "Replication"},
+	{"RAFT REMOVE", "addr", "Replication"},
+	{"RANDOMKEY", "-", "Server"},
+	{"RENAME", "key newkey", "Server"},
+	{"RENAMENX", "key newkey", "Server"},
+	{"REPAIRKEYCOUNT", "-", "Server"},
+	{"REPLICATION PAUSE", "[logid]", "Replication"},
+	{"REPLICATION RESUME", "-", "Replication"},
+	{"REPLICATION SKIPTO", "logid", "Replication"},
 	{"RESTORE", "key ttl value", "Server"},
 	{"ROLE", "-", "Server"},
 	{"RPOP", "key", "List"},
 	{"RPUSH", "key value [value ...]", "List"},
 	{"SADD", "key member [member ...]", "Set"},
+	{"SCAN", "cursor [MATCH match] [COUNT count] [TYPE type]", "Server"},
 	{"SCARD", "key", "Set"},
 	{"SCLEAR", "key", "Set"},
 	{"SCRIPT EXISTS", "script [script ...]", "Script"},
@@ -109,6 +129,7 @@ var helpCommands = [][]string{
 	{"SLAVEOF", "host port [RESTART] [READONLY]", "Replication"},
 	{"SMCLEAR", "key [key ...]", "Set"},
 	{"SMEMBERS", "key", "Set"},
+	{"SMISMEMBER", "key member [member ...]", "Set"},
 	{"SPERSIST", "key", "Set"},
 	{"SREM", "key member [member ...]", "Set"},
 	{"SSCAN", "key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Set"},
@@ -116,9 +137,12 @@ var helpCommands = [][]string{
 	{"STTL", "key", "Set"},
 	{"SUNION", "key [key ...]", "Set"},
 	{"SUNIONSTORE", "destination key [key ...]", "Set"},
+	{"SWAPDB", "index1 index2", "Server"},
 	{"SYNC", "logid", "Replication"},
 	{"TIME", "-", "Server"},
 	{"TTL", "key", "KV"},
+	{"WAIT", "numreplicas timeout", "Replication"},
+	{"WAITCOMMIT", "logid timeout", "Replication"},
 	{"XHSCAN", "key cursor [MATCH match] [COUNT count] [ASC|DESC]", "Hash"},
 	{"XLSORT", "key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]", "List"},
 	{"XSCAN", "type cursor [MATCH match] [COUNT count] [ASC|DESC]", "Server"},
@@ -19,7 +19,9 @@ var (
 		{"repair", "Repair ledis storage directory"},
 		{"dump", "Create a snapshort of ledis"},
 		{"load", "Load data from a snapshort"},
+		{"restore", "Restore data at a moment from the archive"},
 		{"benchmark", "Run the benchmarks with ledis"},
+		{"sentinel", "Run ledis sentinel to monitor masters and failover"},
 		{"repair-ttl", "Repair a very serious bug for key expiration and TTL before v0.4"},
 	}
 )
@@ -34,6 +36,11 @@ func printCmd(cmd, description string) {
 	fmt.Printf("%s\t- %s\n", cmd, description)
 }
 
+// shiftSubCmd drops the sub command from the args, so its flags following it are parsed.
+func shiftSubCmd() {
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+}
+
 func main() {
 	fmt.Printf("Version %s", version)
 	if len(buildTag) > 0 {
@@ -56,8 +63,14 @@ func main() {
 		cmd.Cli()
 	case "dump":
 		cmd.Dump()
+	case "restore":
+		shiftSubCmd()
+		cmd.Restore()
 	case "repair-ttl":
 		cmd.RepairTTL()
+	case "sentinel":
+		shiftSubCmd()
+		cmd.Sentinel()
 	case "help":
 		printSubCmds()
 	case "server":
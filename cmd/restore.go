@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
+)
+
+// Restore restores the data at a moment from the archived dumps and logs.
+func Restore() {
+	var configPath = flag.String("config", "", "ledisdb config file, the data is restored to its data dir")
+	var archivePath = flag.String("archive", "", "archive path, the archive path in the config if not set")
+	var until = flag.String("until", "", `restore up to a log id, or a local time like "2006-01-02 15:04:05"`)
+	var replID = flag.String("repl_id", "", "replication id of the log id, the newest if not set")
+
+	flag.Parse()
+
+	if len(*configPath) == 0 {
+		println("need ledis config file")
+		return
+	}
+
+	cfg, err := config.NewConfigWithFile(*configPath)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+
+	if len(*archivePath) == 0 {
+		*archivePath = cfg.Archive.Path
+	}
+
+	if len(*archivePath) == 0 {
+		println("need archive path")
+		return
+	}
+
+	target, err := parseRestoreTarget(*until)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	target.ReplID = *replID
+
+	if len(cfg.DataDir) == 0 {
+		println("must set data dir")
+		return
+	}
+
+	if fs, _ := ioutil.ReadDir(cfg.DataDir); len(fs) > 0 {
+		println("data dir must be empty")
+		return
+	}
+
+	// the restored data starts a new replication
+	cfg.UseReplication = false
+	cfg.Archive.Path = ""
+
+	ldb, err := ledis.Open(cfg)
+	if err != nil {
+		println("ledis open error ", err.Error())
+		return
+	}
+
+	id, logID, err := ldb.RestoreArchive(*archivePath, target)
+	ldb.Close()
+
+	if err != nil {
+		println(err.Error())
+		return
+	}
+
+	fmt.Printf("Restore OK to log %d of replication %s\n", logID, id)
+}
+
+func parseRestoreTarget(until string) (ledis.ArchiveTarget, error) {
+	var target ledis.ArchiveTarget
+
+	if len(until) == 0 {
+		// the newest archived log
+		target.Time = time.Now()
+		return target, nil
+	}
+
+	if logID, err := strconv.ParseUint(until, 10, 64); err == nil {
+		target.LogID = logID
+		return target, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, until, time.Local); err == nil {
+			target.Time = t
+			return target, nil
+		}
+	}
+
+	return target, fmt.Errorf("invalid until %s, must be a log id or a time", until)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/sentinel"
+)
+
+func Sentinel() {
+	var configFile = flag.String("config", "", "ledisdb sentinel config file")
+	var master = flag.String("master", "", "monitor a master, name:host:port, overwrite the config's masters")
+	var quorum = flag.Int("quorum", 0, "the number of the sentinels agreeing the master is down")
+	var sentinels = flag.String("sentinels", "", "the other sentinel addresses separated by comma, overwrite the config's sentinels")
+
+	flag.Parse()
+
+	var cfg *config.SentinelConfig
+	var err error
+
+	if len(*configFile) == 0 {
+		println("no config set, using default config")
+		cfg = config.NewSentinelConfigDefault()
+	} else {
+		cfg, err = config.NewSentinelConfigWithFile(*configFile)
+	}
+
+	if err != nil {
+		println(err.Error())
+		return
+	}
+
+	if len(*addr) > 0 {
+		cfg.Addr = *addr
+	}
+
+	if len(*sentinels) > 0 {
+		cfg.Sentinels = strings.Split(*sentinels, ",")
+	}
+
+	if len(*master) > 0 {
+		seps := strings.SplitN(*master, ":", 2)
+		if len(seps) != 2 {
+			println("invalid master, must be name:host:port")
+			return
+		}
+
+		cfg.Masters = []config.SentinelMasterConfig{{Name: seps[0], Addr: seps[1], Quorum: *quorum}}
+	}
+
+	cfg.Adjust()
+
+	if len(cfg.Masters) == 0 {
+		println("no master to monitor")
+		return
+	}
+
+	s, err := sentinel.NewSentinel(cfg)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc,
+		os.Kill,
+		os.Interrupt,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+
+	go s.Run()
+
+	<-sc
+
+	println("ledis-sentinel is closing")
+	s.Close()
+	println("ledis-sentinel is closed")
+}
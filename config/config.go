@@ -2,6 +2,8 @@ package config
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -66,6 +68,18 @@ type RocksDBConfig struct {
 	MaxManifestFileSize            int  `toml:"max_manifest_file_size"`
 }
 
+type PebbleConfig struct {
+	Compression           int `toml:"compression"`
+	BlockSize             int `toml:"block_size"`
+	MemTableSize          int `toml:"memtable_size"`
+	CacheSize             int `toml:"cache_size"`
+	MaxOpenFiles          int `toml:"max_open_files"`
+	L0CompactionThreshold int `toml:"l0_compaction_threshold"`
+	L0StopWritesThreshold int `toml:"l0_stop_writes_threshold"`
+	LBaseMaxBytes         int `toml:"lbase_max_bytes"`
+	BloomFilterBits       int `toml:"bloom_filter_bits"`
+}
+
 type LMDBConfig struct {
 	MapSize int  `toml:"map_size"`
 	NoSync  bool `toml:"nosync"`
@@ -84,6 +98,72 @@ type ReplicationConfig struct {
 	Compression      bool   `toml:"compression"`
 	UseMmap          bool   `toml:"use_mmap"`
 	MasterPassword   string `toml:"master_password"`
+
+	// the slave applies the logs after they are so many seconds old, 0 for no delay
+	ApplyDelay int `toml:"apply_delay"`
+
+	// the slave only receives the databases and the keys with the prefixes, all if empty
+	FilterDBs      []int    `toml:"filter_dbs,omitempty"`
+	FilterPrefixes []string `toml:"filter_prefixes,omitempty"`
+
+	TLS ReplicationTLS `toml:"tls"`
+}
+
+// ReplicationTLS is the TLS of the slave connecting to the master, and the sentinel connecting
+// to the instances. The server certificate is verified with the CA bundle, or the system roots
+// if not set, and the server name, which is the host of the address if not set. The client
+// certificate is sent if the server requires it.
+type ReplicationTLS struct {
+	Enabled     bool   `toml:"enabled"`
+	CAFile      string `toml:"ca_file"`
+	Certificate string `toml:"certificate"`
+	Key         string `toml:"key"`
+	ServerName  string `toml:"server_name"`
+}
+
+// ClientConfig returns the TLS config of the client, the server name is set by the
+// address in dialing if not configured.
+func (c *ReplicationTLS) ClientConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: c.ServerName}
+
+	if len(c.CAFile) > 0 {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate in CA file %s", c.CAFile)
+		}
+	}
+
+	if len(c.Certificate) > 0 {
+		crt, err := tls.LoadX509KeyPair(c.Certificate, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{crt}
+	}
+
+	return tlsCfg, nil
+}
+
+// RaftConfig is the raft mode, every write is committed by the majority of the group before it
+// is applied, Addr is the raft address of this node, and empty to disable. Peers are the initial
+// voters to bootstrap a new group with this node, the other nodes join by RAFT JOIN on the leader.
+type RaftConfig struct {
+	Addr              string     `toml:"addr"`
+	Path              string     `toml:"path"`
+	Peers             []RaftPeer `toml:"peers"`
+	HeartbeatTimeout  int        `toml:"heartbeat_timeout"`
+	SnapshotThreshold int        `toml:"snapshot_threshold"`
+}
+
+// RaftPeer is a node of the raft group, Addr is its server address, which is the node ID too.
+type RaftPeer struct {
+	Addr     string `toml:"addr"`
+	RaftAddr string `toml:"raft_addr"`
 }
 
 type SnapshotConfig struct {
@@ -91,6 +171,32 @@ type SnapshotConfig struct {
 	MaxNum int    `toml:"max_num"`
 }
 
+// ArchiveConfig archives the replication logs and the dumps to Path for the point in time
+// recovery by ledis restore, empty to disable. A new dump is archived every DumpInterval hours,
+// and the logs are sealed into a new segment file every SegmentInterval seconds.
+type ArchiveConfig struct {
+	Path            string `toml:"path"`
+	DumpInterval    int    `toml:"dump_interval"`
+	SegmentInterval int    `toml:"segment_interval"`
+}
+
+// EncryptionConfig is the encryption at rest, used by the encrypted store like "encrypted:goleveldb",
+// and the replication logs and the dumps are encrypted too if the key file is set.
+type EncryptionConfig struct {
+	KeyFile     string `toml:"key_file"`
+	EncryptKeys bool   `toml:"encrypt_keys"`
+}
+
+// CompressionConfig is the value compression with zstd, Types maps the data types "kv", "hash"
+// and "list" to the min value size to compress, and the dictionary of every type is trained
+// from its first DictSamples compressed values.
+type CompressionConfig struct {
+	Types       map[string]int `toml:"types"`
+	Level       int            `toml:"level"`
+	DictSize    int            `toml:"dict_size"`
+	DictSamples int            `toml:"dict_samples"`
+}
+
 type TLS struct {
 	Enabled     bool   `toml:"enabled"`
 	Certificate string `toml:"certificate"`
@@ -127,9 +233,13 @@ type Config struct {
 	DBName       string `toml:"db_name"`
 	DBPath       string `toml:"db_path"`
 	DBSyncCommit int    `toml:"db_sync_commit"`
+	MergeCounter bool   `toml:"merge_counter"`
+
+	ReadCacheSize int `toml:"read_cache_size"`
 
 	LevelDB LevelDBConfig `toml:"leveldb"`
 	RocksDB RocksDBConfig `toml:"rocksdb"`
+	Pebble  PebbleConfig  `toml:"pebble"`
 
 	LMDB LMDBConfig `toml:"lmdb"`
 
@@ -138,8 +248,16 @@ type Config struct {
 	UseReplication bool              `toml:"use_replication"`
 	Replication    ReplicationConfig `toml:"replication"`
 
+	Raft RaftConfig `toml:"raft"`
+
 	Snapshot SnapshotConfig `toml:"snapshot"`
 
+	Archive ArchiveConfig `toml:"archive"`
+
+	Encryption EncryptionConfig `toml:"encryption"`
+
+	Compression CompressionConfig `toml:"compression"`
+
 	ConnReadBufferSize    int `toml:"conn_read_buffer_size"`
 	ConnWriteBufferSize   int `toml:"conn_write_buffer_size"`
 	ConnKeepaliveInterval int `toml:"conn_keepalive_interval"`
@@ -172,6 +290,11 @@ func NewConfigWithData(data []byte) (*Config, error) {
 		return nil, fmt.Errorf("newConfigwithData: unmarashal: %s", err)
 	}
 
+	// the unmarshal replaces the whole struct with the unexported lock
+	if cfg.m == nil {
+		cfg.m = new(sync.RWMutex)
+	}
+
 	cfg.adjust()
 
 	return cfg, nil
@@ -234,8 +357,16 @@ func (cfg *Config) adjust() {
 
 	cfg.RocksDB.adjust()
 
+	cfg.Pebble.adjust()
+
+	cfg.Compression.adjust()
+
 	cfg.Replication.ExpiredLogDays = getDefault(7, cfg.Replication.ExpiredLogDays)
 	cfg.Replication.MaxLogFileNum = getDefault(50, cfg.Replication.MaxLogFileNum)
+	cfg.Raft.HeartbeatTimeout = getDefault(1000, cfg.Raft.HeartbeatTimeout)
+	cfg.Raft.SnapshotThreshold = getDefault(8192, cfg.Raft.SnapshotThreshold)
+	cfg.Archive.DumpInterval = getDefault(24, cfg.Archive.DumpInterval)
+	cfg.Archive.SegmentInterval = getDefault(60, cfg.Archive.SegmentInterval)
 	cfg.ConnReadBufferSize = getDefault(4*KB, cfg.ConnReadBufferSize)
 	cfg.ConnWriteBufferSize = getDefault(4*KB, cfg.ConnWriteBufferSize)
 	cfg.TTLCheckInterval = getDefault(1, cfg.TTLCheckInterval)
@@ -250,6 +381,12 @@ func (cfg *LevelDBConfig) adjust() {
 	cfg.MaxFileSize = getDefault(32*MB, cfg.MaxFileSize)
 }
 
+func (cfg *CompressionConfig) adjust() {
+	cfg.Level = getDefault(3, cfg.Level)
+	cfg.DictSize = getDefault(16*KB, cfg.DictSize)
+	cfg.DictSamples = getDefault(1000, cfg.DictSamples)
+}
+
 func (cfg *RocksDBConfig) adjust() {
 	cfg.CacheSize = getDefault(4*MB, cfg.CacheSize)
 	cfg.BlockSize = getDefault(4*KB, cfg.BlockSize)
@@ -273,6 +410,17 @@ func (cfg *RocksDBConfig) adjust() {
 	cfg.MaxManifestFileSize = getDefault(20*MB, cfg.MaxManifestFileSize)
 }
 
+func (cfg *PebbleConfig) adjust() {
+	cfg.CacheSize = getDefault(4*MB, cfg.CacheSize)
+	cfg.BlockSize = getDefault(4*KB, cfg.BlockSize)
+	cfg.MemTableSize = getDefault(4*MB, cfg.MemTableSize)
+	cfg.MaxOpenFiles = getDefault(1024, cfg.MaxOpenFiles)
+	cfg.L0CompactionThreshold = getDefault(4, cfg.L0CompactionThreshold)
+	cfg.L0StopWritesThreshold = getDefault(12, cfg.L0StopWritesThreshold)
+	cfg.LBaseMaxBytes = getDefault(64*MB, cfg.LBaseMaxBytes)
+	cfg.BloomFilterBits = getDefault(10, cfg.BloomFilterBits)
+}
+
 func (cfg *Config) Dump(w io.Writer) error {
 	data, err := toml.Marshal(*cfg)
 	if err != nil {
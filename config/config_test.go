@@ -40,3 +40,25 @@ func TestConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestSentinelConfig(t *testing.T) {
+	cfg, err := NewSentinelConfigWithFile("./sentinel.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Sentinels) != 2 || len(cfg.Masters) != 1 {
+		t.Fatalf("invalid config %v", cfg)
+	} else if m := cfg.Masters[0]; m.Name != "mymaster" || m.Addr != "127.0.0.1:6380" || m.Quorum != 2 {
+		t.Fatalf("invalid master %v", m)
+	} else if cfg.DownAfter != 5000 || cfg.FailoverTimeout != 15000 {
+		t.Fatalf("invalid timeouts %d %d", cfg.DownAfter, cfg.FailoverTimeout)
+	}
+
+	// the quorum is the majority of all the sentinels by default
+	if cfg, err = NewSentinelConfigWithData([]byte("sentinels = [\"a\", \"b\", \"c\", \"d\"]\n[[masters]]\nname = \"m\"\naddr = \"127.0.0.1:6380\"\n")); err != nil {
+		t.Fatal(err)
+	} else if cfg.Masters[0].Quorum != 3 {
+		t.Fatalf("invalid quorum %d", cfg.Masters[0].Quorum)
+	}
+}
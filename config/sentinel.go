@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pelletier/go-toml"
+)
+
+const DefaultSentinelAddr string = "127.0.0.1:6390"
+
+// SentinelMasterConfig is a master monitored by the sentinel, its slaves are discovered by ROLE.
+type SentinelMasterConfig struct {
+	Name string `toml:"name"`
+	Addr string `toml:"addr"`
+
+	// the number of the sentinels which must agree the master is down before the failover
+	Quorum int `toml:"quorum"`
+
+	// the password and the TLS of the master and its slaves, like the replication
+	Password string         `toml:"password"`
+	TLS      ReplicationTLS `toml:"tls"`
+}
+
+type SentinelConfig struct {
+	Addr string `toml:"addr"`
+
+	// the addresses of the other sentinels monitoring the same masters
+	Sentinels []string `toml:"sentinels"`
+
+	Masters []SentinelMasterConfig `toml:"masters"`
+
+	// in milliseconds, the period to check the instances, also the timeout of every check
+	CheckInterval int `toml:"check_interval"`
+
+	// in milliseconds, the instance which does not reply in this time is down
+	DownAfter int `toml:"down_after"`
+
+	// in milliseconds, a failover is not retried for the same master in this time
+	FailoverTimeout int `toml:"failover_timeout"`
+}
+
+func NewSentinelConfigWithFile(fileName string) (*SentinelConfig, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSentinelConfigWithData(data)
+}
+
+func NewSentinelConfigWithData(data []byte) (*SentinelConfig, error) {
+	cfg := NewSentinelConfigDefault()
+
+	if err := toml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("newSentinelConfigWithData: unmarashal: %s", err)
+	}
+
+	cfg.Adjust()
+
+	return cfg, nil
+}
+
+func NewSentinelConfigDefault() *SentinelConfig {
+	cfg := new(SentinelConfig)
+
+	cfg.Addr = DefaultSentinelAddr
+
+	cfg.Adjust()
+
+	return cfg
+}
+
+// Adjust sets the defaults, after the config is changed like by the flags.
+func (cfg *SentinelConfig) Adjust() {
+	cfg.CheckInterval = getDefault(1000, cfg.CheckInterval)
+	cfg.DownAfter = getDefault(5000, cfg.DownAfter)
+	cfg.FailoverTimeout = getDefault(3*cfg.DownAfter, cfg.FailoverTimeout)
+
+	for i := range cfg.Masters {
+		cfg.Masters[i].Quorum = getDefault((len(cfg.Sentinels)+1)/2+1, cfg.Masters[i].Quorum)
+	}
+}
@@ -0,0 +1,579 @@
+package ledis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledisdb/ledisdb/rpl"
+	"github.com/ledisdb/ledisdb/store/encrypted"
+	"github.com/siddontang/go/log"
+)
+
+/*
+The replication logs and the dumps are archived for the point in time recovery. The log IDs
+start again after FLUSHALL with a new replication ID, so the archive has a directory for
+every replication ID:
+
+	dump-<commit ID>-<unix time>.dmp    the dump of the data at the commit ID
+	log-<first log ID>.log              the encoded logs, encrypted like the dumps
+
+A new dump is archived when the directory is created, the logs are purged before they are
+archived, or after the dump interval. The logs are written to a temporary segment file, which
+is renamed after it is sealed, so the logs not sealed are archived again after the restart.
+
+The restore loads the newest dump before the target, and replays the archived logs after it
+up to the target log ID, or up to the last log created before the target time.
+*/
+
+const (
+	archiveDumpPrefix = "dump-"
+	archiveLogPrefix  = "log-"
+	archiveTmpExt     = ".tmp"
+
+	maxArchiveSegmentSize = 64 * 1024 * 1024
+)
+
+var errArchiveStop = errors.New("archive stop")
+
+// ArchiveTarget is the moment restored from the archive, the log LogID of the replication
+// ReplID, the newest replication if ReplID is empty, or the time Time if LogID is 0.
+type ArchiveTarget struct {
+	ReplID string
+	LogID  uint64
+	Time   time.Time
+}
+
+// archiveDump is an archived dump of the data at the commit ID.
+type archiveDump struct {
+	name     string
+	commitID uint64
+	time     time.Time
+}
+
+func archiveDumpName(commitID uint64, t time.Time) string {
+	return fmt.Sprintf("%s%020d-%d.dmp", archiveDumpPrefix, commitID, t.Unix())
+}
+
+func archiveSegmentName(firstID uint64) string {
+	return fmt.Sprintf("%s%020d.log", archiveLogPrefix, firstID)
+}
+
+// listArchive returns the dumps sorted by the commit ID and the first log IDs of
+// the segments in order in the directory of a replication ID.
+func listArchive(dir string) ([]archiveDump, []uint64, error) {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dumps []archiveDump
+	var segments []uint64
+
+	for _, f := range fs {
+		name := f.Name()
+		if f.IsDir() || strings.HasSuffix(name, archiveTmpExt) {
+			continue
+		}
+
+		if strings.HasPrefix(name, archiveDumpPrefix) {
+			d := archiveDump{name: name}
+			var sec int64
+			if _, err := fmt.Sscanf(name, archiveDumpPrefix+"%d-%d.dmp", &d.commitID, &sec); err != nil {
+				log.Errorf("invalid archived dump %s", path.Join(dir, name))
+				continue
+			}
+			d.time = time.Unix(sec, 0)
+			dumps = append(dumps, d)
+		} else if strings.HasPrefix(name, archiveLogPrefix) {
+			var firstID uint64
+			if _, err := fmt.Sscanf(name, archiveLogPrefix+"%d.log", &firstID); err != nil {
+				log.Errorf("invalid archived logs %s", path.Join(dir, name))
+				continue
+			}
+			segments = append(segments, firstID)
+		}
+	}
+
+	sort.Slice(dumps, func(i, j int) bool {
+		if dumps[i].commitID != dumps[j].commitID {
+			return dumps[i].commitID < dumps[j].commitID
+		}
+		return dumps[i].time.Before(dumps[j].time)
+	})
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	return dumps, segments, nil
+}
+
+// readArchiveSegment calls f with the logs in the segment file in order until f returns an error.
+func (l *Ledis) readArchiveSegment(name string, f func(rl *rpl.Log) error) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	rb := bufio.NewReaderSize(fd, 4096)
+	if magic, _ := rb.Peek(len(encrypted.StreamMagic)); encrypted.IsStream(magic) {
+		if l.ks == nil {
+			return errDumpEncrypted
+		}
+		rb = bufio.NewReaderSize(encrypted.NewReader(rb, l.ks), 4096)
+	}
+
+	rl := new(rpl.Log)
+	for {
+		if err = rl.Decode(rb); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read archived logs %s error %s", name, err.Error())
+		}
+
+		if err = f(rl); err != nil {
+			return err
+		}
+	}
+}
+
+// archiver archives the logs and the dumps to the directory of the current replication ID.
+type archiver struct {
+	l *Ledis
+
+	replID string
+	dir    string
+
+	// the ID of the next log to archive
+	nextID   uint64
+	lastDump time.Time
+
+	// the temporary segment file being written
+	seg      *os.File
+	segW     io.Writer
+	segEnc   io.WriteCloser
+	segFirst uint64
+	segSize  int
+	segTime  time.Time
+}
+
+func (l *Ledis) onArchive() {
+	defer l.wg.Done()
+
+	a := &archiver{l: l}
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		if err := a.archive(l.quit); err != nil {
+			log.Errorf("archive to %s error %s", l.cfg.Archive.Path, err.Error())
+			a.dropSegment()
+		}
+
+		select {
+		case <-t.C:
+		case <-l.quit:
+			// archive the last logs before closing
+			if err := a.archive(nil); err != nil {
+				log.Errorf("archive to %s error %s", l.cfg.Archive.Path, err.Error())
+				a.dropSegment()
+			}
+			if a.seg != nil {
+				if err := a.sealSegment(); err != nil {
+					log.Errorf("seal archived logs error %s", err.Error())
+				}
+			}
+			return
+		}
+	}
+}
+
+// archive archives the logs until the last one or quit, nil quit for all the logs.
+func (a *archiver) archive(quit <-chan struct{}) error {
+	replID := a.l.r.ID().ID
+	if replID != a.replID {
+		if a.seg != nil {
+			if err := a.sealSegment(); err != nil {
+				return err
+			}
+		}
+
+		if err := a.open(replID); err != nil {
+			// open again in the next round
+			a.replID = ""
+			return err
+		}
+	}
+
+	if time.Since(a.lastDump) >= time.Duration(a.l.cfg.Archive.DumpInterval)*time.Hour {
+		// the logs before the dump are still archived, the older dumps need them
+		if _, err := a.dump(); err != nil {
+			return err
+		}
+	}
+
+	// ReadLogsTo reads about maxReplLogSize once, read until the last log not to fall behind
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		n, nextID, err := a.l.ReadLogsTo(a.nextID, &buf)
+		if err == ErrLogMissed {
+			log.Errorf("logs from %d are purged before archived, archive a new dump", a.nextID)
+
+			commitID, err := a.dump()
+			if err != nil {
+				return err
+			}
+			a.nextID = commitID + 1
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// the logs may be cleared by FLUSHALL after the replication ID is got
+		if a.l.r.ID().ID != replID {
+			return nil
+		}
+
+		if n > 0 {
+			if a.seg == nil {
+				if err = a.openSegment(); err != nil {
+					return err
+				}
+			}
+
+			if _, err = a.segW.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			a.segSize += n
+			a.nextID = nextID
+		}
+
+		if a.seg != nil && (a.segSize >= maxArchiveSegmentSize ||
+			time.Since(a.segTime) >= time.Duration(a.l.cfg.Archive.SegmentInterval)*time.Second) {
+			if err = a.sealSegment(); err != nil {
+				return err
+			}
+		}
+
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+	}
+}
+
+// open opens the directory of the replication ID, and continues after the archived logs.
+func (a *archiver) open(replID string) error {
+	dir := path.Join(a.l.cfg.Archive.Path, replID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// the files not finished before the restart
+	tmps, err := filepath.Glob(path.Join(dir, "*"+archiveTmpExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range tmps {
+		os.Remove(name)
+	}
+
+	dumps, segments, err := listArchive(dir)
+	if err != nil {
+		return err
+	}
+
+	a.replID = replID
+	a.dir = dir
+	a.nextID = 0
+	a.lastDump = time.Time{}
+
+	if len(dumps) == 0 {
+		commitID, err := a.dump()
+		if err != nil {
+			return err
+		}
+		a.nextID = commitID + 1
+		return nil
+	}
+
+	last := dumps[len(dumps)-1]
+	for _, d := range dumps {
+		if d.time.After(a.lastDump) {
+			a.lastDump = d.time
+		}
+	}
+	a.nextID = last.commitID + 1
+
+	if len(segments) > 0 {
+		name := path.Join(dir, archiveSegmentName(segments[len(segments)-1]))
+		err = a.l.readArchiveSegment(name, func(rl *rpl.Log) error {
+			if rl.ID >= a.nextID {
+				a.nextID = rl.ID + 1
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dump archives a dump and returns its commit ID.
+func (a *archiver) dump() (uint64, error) {
+	name := path.Join(a.dir, "dump"+archiveTmpExt)
+
+	f, err := os.Create(name)
+	if err != nil {
+		return 0, err
+	}
+
+	// the data of the dump is not older than the start
+	now := time.Now()
+
+	commitID, err := a.l.dump(f, nil)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(name, path.Join(a.dir, archiveDumpName(commitID, now)))
+	}
+	if err != nil {
+		os.Remove(name)
+		return 0, err
+	}
+
+	a.lastDump = now
+	return commitID, nil
+}
+
+func (a *archiver) openSegment() error {
+	f, err := os.Create(path.Join(a.dir, archiveSegmentName(a.nextID)+archiveTmpExt))
+	if err != nil {
+		return err
+	}
+
+	a.seg = f
+	a.segW = f
+	a.segEnc = nil
+	if a.l.ks != nil {
+		a.segEnc = encrypted.NewWriter(f, a.l.ks)
+		a.segW = a.segEnc
+	}
+
+	a.segFirst = a.nextID
+	a.segSize = 0
+	a.segTime = time.Now()
+	return nil
+}
+
+// sealSegment syncs the segment file and renames it to the archived logs,
+// the logs in it are archived again if failed.
+func (a *archiver) sealSegment() error {
+	var err error
+	if a.segEnc != nil {
+		err = a.segEnc.Close()
+	}
+	if err == nil {
+		err = a.seg.Sync()
+	}
+	if cerr := a.seg.Close(); err == nil {
+		err = cerr
+	}
+
+	name := a.seg.Name()
+	a.seg = nil
+
+	if err == nil {
+		err = os.Rename(name, strings.TrimSuffix(name, archiveTmpExt))
+	}
+	if err != nil {
+		os.Remove(name)
+		a.nextID = a.segFirst
+	}
+	return err
+}
+
+// dropSegment removes the segment file after an error, the logs in it are archived again.
+func (a *archiver) dropSegment() {
+	if a.seg == nil {
+		return
+	}
+
+	a.seg.Close()
+	os.Remove(a.seg.Name())
+	a.seg = nil
+	a.nextID = a.segFirst
+}
+
+// RestoreArchive clears all data and restores the data at the target from the archive in dir,
+// it loads the newest archived dump before the target and replays the archived logs after it.
+// It returns the replication ID and the ID of the last restored log.
+func (l *Ledis) RestoreArchive(dir string, t ArchiveTarget) (string, uint64, error) {
+	if l.r != nil {
+		return "", 0, errors.New("restore the archive without replication")
+	}
+
+	replID, d, err := findArchiveDump(dir, t)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dir = path.Join(dir, replID)
+	if _, err = l.LoadDumpFile(path.Join(dir, d.name)); err != nil {
+		return "", 0, err
+	}
+
+	lastID, err := l.replayArchive(dir, d.commitID, t)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return replID, lastID, nil
+}
+
+// findArchiveDump returns the newest dump before the target and its replication ID.
+func findArchiveDump(dir string, t ArchiveTarget) (string, archiveDump, error) {
+	var found archiveDump
+	var foundID string
+
+	replIDs := []string{t.ReplID}
+	if len(replIDs[0]) == 0 {
+		fs, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return "", found, err
+		}
+
+		replIDs = replIDs[:0]
+		for _, f := range fs {
+			if f.IsDir() {
+				replIDs = append(replIDs, f.Name())
+			}
+		}
+	}
+
+	// the newest replication has the newest dump
+	var newest time.Time
+
+	for _, replID := range replIDs {
+		dumps, _, err := listArchive(path.Join(dir, replID))
+		if err != nil {
+			return "", found, err
+		}
+
+		if t.LogID > 0 {
+			if len(dumps) == 0 || dumps[len(dumps)-1].time.Before(newest) {
+				continue
+			}
+			newest = dumps[len(dumps)-1].time
+
+			foundID = replID
+			found = archiveDump{}
+			for _, d := range dumps {
+				if d.commitID <= t.LogID {
+					found = d
+				}
+			}
+			continue
+		}
+
+		for _, d := range dumps {
+			if !d.time.After(t.Time) && (len(found.name) == 0 || d.time.After(found.time)) {
+				foundID = replID
+				found = d
+			}
+		}
+	}
+
+	if len(found.name) > 0 {
+		return foundID, found, nil
+	} else if t.LogID > 0 {
+		return "", found, fmt.Errorf("no archived dump before log %d", t.LogID)
+	}
+	return "", found, fmt.Errorf("no archived dump before %s", t.Time.Format(time.RFC3339))
+}
+
+// replayArchive replays the archived logs after the commit ID up to the target,
+// and returns the ID of the last replayed log.
+func (l *Ledis) replayArchive(dir string, commitID uint64, t ArchiveTarget) (uint64, error) {
+	_, segments, err := listArchive(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	lastID := commitID
+
+	// the databases mapping changed by all the replayed logs
+	sr := newDBSlotReplay(wb)
+
+	replay := func(rl *rpl.Log) error {
+		if rl.ID <= lastID {
+			// the logs before the dump, or archived again after the restart
+			return nil
+		} else if rl.ID > lastID+1 {
+			return fmt.Errorf("log %d is not archived", lastID+1)
+		} else if t.LogID > 0 && rl.ID > t.LogID {
+			return errArchiveStop
+		} else if t.LogID == 0 && time.Unix(int64(rl.CreateTime), 0).After(t.Time) {
+			return errArchiveStop
+		}
+
+		wb.Rollback()
+		if err := replayLog(sr, rl); err != nil {
+			return err
+		} else if err = wb.Commit(); err != nil {
+			return err
+		}
+
+		lastID = rl.ID
+		return nil
+	}
+
+	for i, firstID := range segments {
+		if i+1 < len(segments) && segments[i+1] <= lastID+1 {
+			// all the logs are before the replayed logs
+			continue
+		}
+
+		err = l.readArchiveSegment(path.Join(dir, archiveSegmentName(firstID)), replay)
+		if err == errArchiveStop {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	l.replayDBSlots(sr)
+
+	if t.LogID > 0 && lastID < t.LogID {
+		return 0, fmt.Errorf("the logs after %d are not archived", lastID)
+	}
+
+	return lastID, nil
+}
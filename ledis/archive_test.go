@@ -0,0 +1,183 @@
+package ledis
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/rpl"
+)
+
+func TestArchiveRestore(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_archive/master"
+	cfg.UseReplication = true
+	cfg.Archive.Path = "/tmp/test_archive/archive"
+
+	os.RemoveAll("/tmp/test_archive")
+
+	master, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := master.Select(0)
+
+	if err = db.Set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	logID, err := master.r.LastLogID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	until := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+
+	if err = db.Set([]byte("a"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("b"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	lastID, err := master.r.LastLogID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replID := master.r.ID().ID
+
+	// the logs are sealed after closing
+	master.Close()
+
+	restore := func(target ArchiveTarget) (*Ledis, uint64) {
+		cfg := config.NewConfigDefault()
+		cfg.DataDir = "/tmp/test_archive/restore"
+
+		os.RemoveAll(cfg.DataDir)
+
+		l, err := Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, logID, err := l.RestoreArchive("/tmp/test_archive/archive", target)
+		if err != nil {
+			l.Close()
+			t.Fatal(err)
+		} else if id != replID {
+			t.Fatalf("invalid replication id %s != %s", id, replID)
+		}
+		return l, logID
+	}
+
+	check := func(l *Ledis, key string, value string) {
+		db, _ := l.Select(0)
+		if v, err := db.Get([]byte(key)); err != nil {
+			t.Fatal(err)
+		} else if string(v) != value {
+			t.Fatalf("invalid %s value %q != %q", key, v, value)
+		}
+	}
+
+	l, id := restore(ArchiveTarget{LogID: logID})
+	if id != logID {
+		t.Fatalf("invalid restored log id %d != %d", id, logID)
+	}
+	check(l, "a", "1")
+	check(l, "b", "")
+	l.Close()
+
+	l, id = restore(ArchiveTarget{Time: until})
+	if id != logID {
+		t.Fatalf("invalid restored log id %d != %d", id, logID)
+	}
+	check(l, "a", "1")
+	check(l, "b", "")
+	l.Close()
+
+	l, id = restore(ArchiveTarget{ReplID: replID, LogID: lastID})
+	if id != lastID {
+		t.Fatalf("invalid restored log id %d != %d", id, lastID)
+	}
+	check(l, "a", "2")
+	check(l, "b", "1")
+
+	if _, _, err = l.RestoreArchive("/tmp/test_archive/archive", ArchiveTarget{LogID: lastID + 1}); err == nil {
+		t.Fatal("must error for the log not archived")
+	}
+	l.Close()
+}
+
+func TestArchiveCatchUp(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_archive_catch_up/master"
+	cfg.UseReplication = true
+	cfg.Archive.Path = "/tmp/test_archive_catch_up/archive"
+	cfg.Archive.SegmentInterval = 1
+
+	os.RemoveAll("/tmp/test_archive_catch_up")
+
+	master, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	db, _ := master.Select(0)
+
+	// more than maxReplLogSize between the ticks, not compressed
+	value := make([]byte, 16*1024)
+	for i := 0; i < 5*maxReplLogSize/len(value); i++ {
+		rand.Read(value)
+		if err = db.Set([]byte(fmt.Sprintf("key_%d", i)), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lastID, err := master.r.LastLogID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := path.Join(cfg.Archive.Path, master.r.ID().ID)
+
+	// the archived logs are sealed after the segment interval
+	var archivedID uint64
+	for i := 0; i < 50 && archivedID < lastID; i++ {
+		time.Sleep(100 * time.Millisecond)
+
+		dumps, segments, err := listArchive(dir)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(dumps) == 0 {
+			continue
+		}
+
+		archivedID = dumps[0].commitID
+		for _, firstID := range segments {
+			err = master.readArchiveSegment(path.Join(dir, archiveSegmentName(firstID)), func(rl *rpl.Log) error {
+				if rl.ID > archivedID+1 {
+					return fmt.Errorf("log %d is not archived", archivedID+1)
+				} else if rl.ID == archivedID+1 {
+					archivedID = rl.ID
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if archivedID != lastID {
+		t.Fatalf("archived log id %d != %d", archivedID, lastID)
+	}
+}
@@ -15,6 +15,23 @@ type batch struct {
 
 	sync.Locker
 
+	// keys created or deleted in this batch which change the key counters,
+	// true for put and false for delete
+	counted map[string]bool
+
+	// whether the counted keys existed before this batch, read by the command,
+	// the other counted keys are read at commit
+	existed map[string]bool
+
+	// the database slots which have new garbage keys in this batch
+	gcSlots []int
+
+	// the generations allocated in this batch, see newGen
+	gens map[string]uint64
+
+	// the database handle whose mapping is checked at commit, nil if not checked
+	db *DB
+
 	//	tx *Tx
 }
 
@@ -23,6 +40,47 @@ func (b *batch) Commit() error {
 		return ErrWriteInROnly
 	}
 
+	if b.db != nil {
+		if err := b.db.checkSlot(); err != nil {
+			return err
+		}
+	}
+
+	logID, err := b.commit()
+	if err == nil {
+		if len(b.gcSlots) > 0 {
+			b.l.notifyGC(b.gcSlots...)
+		}
+		if b.db != nil {
+			b.db.committed(logID)
+		}
+	}
+	b.gcSlots = b.gcSlots[0:0]
+
+	return err
+}
+
+func (b *batch) commit() (uint64, error) {
+	if len(b.counted) == 0 {
+		return b.l.handleCommit(b.WriteBatch, b.WriteBatch)
+	}
+
+	defer b.resetCounted()
+
+	// the keys of the data type can't be changed by others while the batch is locked,
+	// so only the counters are updated with keyCountLock held
+	deltas, err := b.keyCountDeltas()
+	if err != nil {
+		return 0, err
+	}
+
+	b.l.keyCountLock.Lock()
+	defer b.l.keyCountLock.Unlock()
+
+	if err := b.updateKeyCount(deltas); err != nil {
+		return 0, err
+	}
+
 	return b.l.handleCommit(b.WriteBatch, b.WriteBatch)
 
 	// if b.tx == nil {
@@ -43,19 +101,55 @@ func (b *batch) Lock() {
 
 func (b *batch) Unlock() {
 	b.WriteBatch.Rollback()
+	b.resetCounted()
+	b.gcSlots = b.gcSlots[0:0]
+	for k := range b.gens {
+		delete(b.gens, k)
+	}
 	b.Locker.Unlock()
 }
 
 func (b *batch) Put(key []byte, value []byte) {
 	b.WriteBatch.Put(key, value)
+	b.count(key, true)
 }
 
 func (b *batch) Delete(key []byte) {
 	b.WriteBatch.Delete(key)
+	b.count(key, false)
+}
+
+func (b *batch) count(key []byte, put bool) {
+	if decodeCountedKey(key) == nil {
+		return
+	}
+
+	if b.counted == nil {
+		b.counted = make(map[string]bool)
+	}
+	b.counted[string(key)] = put
+}
+
+// exists records whether the counted key existed before this batch,
+// so it is not read again at commit.
+func (b *batch) exists(key []byte, existed bool) {
+	if b.existed == nil {
+		b.existed = make(map[string]bool)
+	}
+	b.existed[string(key)] = existed
+}
+
+func (b *batch) resetCounted() {
+	for k := range b.counted {
+		delete(b.counted, k)
+	}
+	for k := range b.existed {
+		delete(b.existed, k)
+	}
 }
 
 type dbBatchLocker struct {
-	l      *sync.Mutex
+	l      *sync.RWMutex
 	wrLock *sync.RWMutex
 }
 
@@ -69,6 +163,18 @@ func (l *dbBatchLocker) Unlock() {
 	l.wrLock.RUnlock()
 }
 
+// RLock locks for the merges, they don't use the batch and can run together,
+// but not with the other writes of the data type.
+func (l *dbBatchLocker) RLock() {
+	l.wrLock.RLock()
+	l.l.RLock()
+}
+
+func (l *dbBatchLocker) RUnlock() {
+	l.l.RUnlock()
+	l.wrLock.RUnlock()
+}
+
 // type txBatchLocker struct {
 // }
 
@@ -81,6 +187,13 @@ func (l *dbBatchLocker) Unlock() {
 // func (l *multiBatchLocker) Lock()   {}
 // func (l *multiBatchLocker) Unlock() {}
 
+// bind returns a batch sharing the write batch and lock, which checks the mapping of db at commit.
+func (b *batch) bind(db *DB) *batch {
+	c := b.l.newBatch(b.WriteBatch, b.Locker)
+	c.db = db
+	return c
+}
+
 func (l *Ledis) newBatch(wb *store.WriteBatch, locker sync.Locker) *batch {
 	b := new(batch)
 	b.l = l
@@ -93,23 +206,33 @@ func (l *Ledis) newBatch(wb *store.WriteBatch, locker sync.Locker) *batch {
 
 type commiter interface {
 	Commit() error
+	Rollback() error
 }
 
 type commitDataGetter interface {
 	Data() []byte
 }
 
-func (l *Ledis) handleCommit(g commitDataGetter, c commiter) error {
+// handleCommit commits the batch, and returns the ID of its replication log, 0 if no replication.
+func (l *Ledis) handleCommit(g commitDataGetter, c commiter) (uint64, error) {
+	if l.consensus != nil {
+		// the batch is applied by ApplyConsensusLog after it is committed in order by the consensus
+		err := l.commitConsensus(g.Data())
+		c.Rollback()
+		return 0, err
+	}
+
 	l.commitLock.Lock()
 
 	var err error
+	var logID uint64
 	if l.r != nil {
 		var rl *rpl.Log
 		if rl, err = l.r.Log(g.Data()); err != nil {
 			l.commitLock.Unlock()
 
 			log.Fatalf("write wal error %s", err.Error())
-			return err
+			return 0, err
 		}
 
 		l.propagate(rl)
@@ -119,7 +242,7 @@ func (l *Ledis) handleCommit(g commitDataGetter, c commiter) error {
 
 			log.Fatalf("commit error %s", err.Error())
 			l.noticeReplication()
-			return err
+			return 0, err
 		}
 
 		if err = l.r.UpdateCommitID(rl.ID); err != nil {
@@ -127,13 +250,14 @@ func (l *Ledis) handleCommit(g commitDataGetter, c commiter) error {
 
 			log.Fatalf("update commit id error %s", err.Error())
 			l.noticeReplication()
-			return err
+			return 0, err
 		}
+		logID = rl.ID
 	} else {
 		err = c.Commit()
 	}
 
 	l.commitLock.Unlock()
 
-	return err
+	return logID, err
 }
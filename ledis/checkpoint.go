@@ -0,0 +1,113 @@
+package ledis
+
+import (
+	"os"
+	"path"
+
+	"github.com/ledisdb/ledisdb/store"
+	"github.com/siddontang/go/log"
+)
+
+/*
+A checkpoint is a directory with the copy of the store created by the driver,
+like hard linking the table files, so it is much cheaper than a dump:
+
+	head    the DumpHead with the commit ID
+	data/   the store, opened by the same driver
+*/
+const (
+	checkpointHeadName = "head"
+	checkpointDataName = "data"
+)
+
+// SupportCheckpoint returns whether the store can create checkpoints.
+func (l *Ledis) SupportCheckpoint() bool {
+	return l.ldb.SupportCheckpoint()
+}
+
+// Checkpoint creates a checkpoint in dir which must not exist.
+func (l *Ledis) Checkpoint(dir string) (*DumpHead, error) {
+	if !l.ldb.SupportCheckpoint() {
+		return nil, store.ErrCheckpointNotSupported
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// no write in the checkpoint, so it has the data of the commit ID
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	h := new(DumpHead)
+	if l.r != nil {
+		var err error
+		if h.CommitID, err = l.r.LastCommitID(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.ldb.Checkpoint(path.Join(dir, checkpointDataName)); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path.Join(dir, checkpointHeadName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err = h.Write(f); err != nil {
+		return nil, err
+	}
+
+	return h, f.Sync()
+}
+
+// LoadCheckpoint replaces all data with the checkpoint in dir, which must be created
+// by the same store. The store data is moved from dir, so the checkpoint can't be loaded again.
+func (l *Ledis) LoadCheckpoint(dir string) (*DumpHead, error) {
+	f, err := os.Open(path.Join(dir, checkpointHeadName))
+	if err != nil {
+		return nil, err
+	}
+
+	h := new(DumpHead)
+	err = h.Read(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	//the values in the checkpoint may be compressed
+	opts, err := l.codecOptions(true)
+	if err != nil {
+		return nil, err
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	if err = l.ldb.Reopen(path.Join(dir, checkpointDataName), opts); err != nil {
+		log.Fatalf("load checkpoint reopen store error: %s", err.Error())
+		return nil, err
+	}
+
+	if l.r != nil {
+		if err = l.r.Clear(); err != nil {
+			log.Fatalf("load checkpoint replication clear error: %s", err.Error())
+			return nil, err
+		}
+	}
+
+	//the checkpoint may have the databases mapping
+	l.reloadDBSlots()
+
+	if l.r != nil {
+		if err := l.r.UpdateCommitID(h.CommitID); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
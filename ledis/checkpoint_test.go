@@ -0,0 +1,107 @@
+package ledis
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ledisdb/ledisdb/config"
+)
+
+func TestCheckpoint(t *testing.T) {
+	for _, name := range []string{"goleveldb", "pebble"} {
+		testCheckpoint(t, name, false)
+		testCheckpoint(t, name, true)
+	}
+}
+
+func testCheckpoint(t *testing.T, name string, compress bool) {
+	base := path.Join("/tmp/test_ledis_checkpoint", name)
+	os.RemoveAll(base)
+	defer os.RemoveAll(base)
+
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = path.Join(base, "master")
+	cfgM.DBName = name
+	cfgM.UseReplication = true
+	if compress {
+		cfgM.Compression.Types = map[string]int{"kv": 0}
+	}
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = path.Join(base, "slave")
+	cfgS.DBName = name
+	cfgS.UseReplication = true
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	if !master.SupportCheckpoint() {
+		t.Fatalf("%s must support checkpoint", name)
+	}
+
+	db, _ := master.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+	db.HSet([]byte("b"), []byte("f"), []byte("2"))
+	db.ZAdd([]byte("c"), ScorePair{3, []byte("m")})
+	db.Set([]byte("f"), []byte(strings.Repeat("checkpoint", 10)))
+
+	// the data only in the slave is cleared
+	sdb, _ := slave.Select(1)
+	sdb.Set([]byte("d"), []byte("4"))
+
+	dir := path.Join(base, "checkpoint")
+	h, err := master.Checkpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commitID, _ := master.r.LastCommitID()
+	if h.CommitID != commitID {
+		t.Fatalf("%d != %d", h.CommitID, commitID)
+	}
+
+	// the write after the checkpoint is not in it
+	db.Set([]byte("e"), []byte("5"))
+
+	if _, err = master.Checkpoint(dir); err == nil {
+		t.Fatal("must error for the existing checkpoint")
+	}
+
+	if h, err = slave.LoadCheckpoint(dir); err != nil {
+		t.Fatal(err)
+	} else if h.CommitID != commitID {
+		t.Fatalf("%d != %d", h.CommitID, commitID)
+	}
+
+	if id, _ := slave.r.LastCommitID(); id != commitID {
+		t.Fatalf("%d != %d", id, commitID)
+	}
+
+	if v, _ := sdb.Get([]byte("d")); v != nil {
+		t.Fatal("must be cleared")
+	}
+
+	db.Del([]byte("e"))
+	// the slave has no codec meta of the master
+	if !compress {
+		if err = checkLedisEqual(master, slave); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the compressed values are decoded from the checkpoint
+	if err = checkLedisEqual(slave, master); err != nil {
+		t.Fatal(err)
+	}
+}
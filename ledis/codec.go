@@ -0,0 +1,109 @@
+package ledis
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledisdb/ledisdb/store"
+)
+
+/*
+The values of the data types in the compression config are compressed by the store codec,
+which is transparent to the commands, the dumps and the replication.
+
+The codec meta is saved in the unused slot maxDBSlots, so FLUSHDB and SWAPDB never touch it:
+
+	maxDBSlots + MetaType + codecMeta -> empty, the mark that the values may be compressed
+	maxDBSlots + MetaType + codecMeta + dictionary ID -> data type + dictionary
+
+The codec is enabled if any data type is compressed or the mark exists, so the values
+compressed before can always be read.
+*/
+const (
+	codecMeta byte = 5
+
+	// the integers are never compressed, so they can be merged by the store
+	minCompressSize int = 32
+)
+
+var codecTypes = map[string]byte{
+	"kv":   KVType,
+	"hash": HashType,
+	"list": ListType,
+}
+
+func encodeCodecMetaKey() []byte {
+	indexVarBuf := encodeDBIndex(maxDBSlots)
+
+	buf := make([]byte, len(indexVarBuf)+2)
+	pos := copy(buf, indexVarBuf)
+	buf[pos] = MetaType
+	buf[pos+1] = codecMeta
+	return buf
+}
+
+func isCodecMetaKey(key []byte) bool {
+	return bytes.HasPrefix(key, encodeCodecMetaKey())
+}
+
+// codecClass returns the data type of the store key whose value may be compressed.
+func codecClass(key []byte) (byte, bool) {
+	_, pos, err := decodeDBIndex(key)
+	if err != nil || pos >= len(key) {
+		return 0, false
+	}
+
+	switch t := key[pos]; t {
+	case KVType, HashType, ListType:
+		return t, true
+	default:
+		return 0, false
+	}
+}
+
+// codecOptions returns the codec options of the compression config, the values are
+// only decoded if compress is false.
+func (l *Ledis) codecOptions(compress bool) (*store.CodecOptions, error) {
+	opts := &store.CodecOptions{
+		Class:       codecClass,
+		MinSize:     make(map[byte]int),
+		Level:       l.cfg.Compression.Level,
+		DictSize:    l.cfg.Compression.DictSize,
+		DictSamples: l.cfg.Compression.DictSamples,
+		MetaKey:     encodeCodecMetaKey(),
+	}
+
+	if compress {
+		for name, size := range l.cfg.Compression.Types {
+			t, ok := codecTypes[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid compression type %s", name)
+			}
+
+			if size < minCompressSize {
+				size = minCompressSize
+			}
+			opts.MinSize[t] = size
+		}
+	}
+
+	return opts, nil
+}
+
+// setCodec enables the codec of the store with the compression config.
+func (l *Ledis) setCodec(db *store.DB) error {
+	opts, err := l.codecOptions(true)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.MinSize) == 0 {
+		if v, err := db.Get(opts.MetaKey); err != nil {
+			return err
+		} else if v == nil {
+			return nil
+		}
+	}
+
+	return db.SetCodec(opts)
+}
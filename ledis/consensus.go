@@ -0,0 +1,178 @@
+package ledis
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ledisdb/ledisdb/rpl"
+	"github.com/ledisdb/ledisdb/store"
+	"github.com/siddontang/go/log"
+)
+
+/*
+In the consensus mode, like raft, the rpl.Log of every write batch is committed by the
+consensus group instead of the batch, and every node applies the committed logs in order
+by ApplyConsensusLog, including the node committing it.
+
+The index of the last applied log is saved with the data in the unused slot maxDBSlots,
+so the logs replayed after restarting are skipped, and it is in the snapshots too:
+
+	maxDBSlots + MetaType + consensusMeta -> the index of the last applied log
+*/
+const consensusMeta byte = 6
+
+// the kinds of the consensus logs
+const (
+	consensusBatch byte = iota + 1
+	consensusFlushAll
+)
+
+// ErrConsensusWithReplication is returned if the consensus is used with the replication.
+var ErrConsensusWithReplication = errors.New("consensus can not be used with replication")
+
+// Consensus commits the logs through a consensus group like raft.
+type Consensus interface {
+	// Commit returns after the data is committed, and applied by ApplyConsensusLog on this node.
+	Commit(data []byte) error
+}
+
+func encodeConsensusMetaKey() []byte {
+	indexVarBuf := encodeDBIndex(maxDBSlots)
+
+	buf := make([]byte, len(indexVarBuf)+2)
+	pos := copy(buf, indexVarBuf)
+	buf[pos] = MetaType
+	buf[pos+1] = consensusMeta
+	return buf
+}
+
+// SetConsensus commits the writes through the consensus, it must be set before any write.
+func (l *Ledis) SetConsensus(c Consensus) error {
+	if l.r != nil {
+		return ErrConsensusWithReplication
+	}
+
+	if err := l.loadAppliedIndex(); err != nil {
+		return err
+	}
+
+	l.cbatch = l.ldb.NewWriteBatch()
+	l.consensus = c
+	return nil
+}
+
+// ConsensusUsed returns whether the writes are committed through the consensus.
+func (l *Ledis) ConsensusUsed() bool {
+	return l.consensus != nil
+}
+
+// AppliedIndex returns the index of the last applied consensus log.
+func (l *Ledis) AppliedIndex() uint64 {
+	return uint64(l.appliedIndex.Get())
+}
+
+func (l *Ledis) loadAppliedIndex() error {
+	index, err := Int64(l.ldb.Get(encodeConsensusMetaKey()))
+	if err != nil {
+		return err
+	}
+
+	l.appliedIndex.Set(index)
+	return nil
+}
+
+// commitConsensus commits the write batch as the rpl.Log.
+func (l *Ledis) commitConsensus(data []byte) error {
+	rl := &rpl.Log{CreateTime: uint32(time.Now().Unix()), Data: data}
+
+	buf, err := rl.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return l.consensus.Commit(append([]byte{consensusBatch}, buf...))
+}
+
+// ApplyConsensusLog applies the committed log with the index, the logs must be applied in order.
+// local is true if the log is committed by this process, which updates the databases mapping itself.
+func (l *Ledis) ApplyConsensusLog(index uint64, data []byte, local bool) error {
+	if index <= l.AppliedIndex() {
+		return nil
+	} else if len(data) == 0 {
+		return errors.New("invalid consensus log")
+	}
+
+	switch data[0] {
+	case consensusBatch:
+		rl := new(rpl.Log)
+		if err := rl.Unmarshal(data[1:]); err != nil {
+			return err
+		}
+
+		l.cbatch.Rollback()
+
+		sr := newDBSlotReplay(l.cbatch)
+		err := replayLog(sr, rl)
+		if err != nil {
+			return err
+		}
+
+		l.cbatch.Put(encodeConsensusMetaKey(), PutInt64(int64(index)))
+		if err = l.cbatch.Commit(); err != nil {
+			log.Errorf("commit consensus log %d error %s", index, err.Error())
+			return err
+		}
+
+		if !local {
+			l.replayDBSlots(sr)
+		}
+	case consensusFlushAll:
+		if err := l.flushAll(); err != nil {
+			return err
+		}
+
+		if err := l.ldb.Put(encodeConsensusMetaKey(), PutInt64(int64(index))); err != nil {
+			return err
+		}
+	default:
+		return errors.New("invalid consensus log")
+	}
+
+	l.appliedIndex.Set(int64(index))
+	return nil
+}
+
+// ConsensusSnapshot is the snapshot of the data with the applied consensus logs.
+type ConsensusSnapshot struct {
+	l    *Ledis
+	snap *store.Snapshot
+}
+
+// NewConsensusSnapshot takes the snapshot, it must be called between applying the logs.
+func (l *Ledis) NewConsensusSnapshot() (*ConsensusSnapshot, error) {
+	snap, err := l.ldb.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConsensusSnapshot{l: l, snap: snap}, nil
+}
+
+// Dump dumps the snapshot to the Writer in the dump format.
+func (s *ConsensusSnapshot) Dump(w io.Writer) error {
+	return s.l.dumpSnapshot(s.snap, 0, w, nil)
+}
+
+func (s *ConsensusSnapshot) Close() {
+	s.snap.Close()
+}
+
+// RestoreConsensusSnapshot clears all data and loads the dumped snapshot with its applied index.
+func (l *Ledis) RestoreConsensusSnapshot(r io.Reader) error {
+	if _, err := l.LoadDump(r); err != nil {
+		return err
+	}
+
+	return l.loadAppliedIndex()
+}
@@ -0,0 +1,130 @@
+package ledis
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ledisdb/ledisdb/config"
+)
+
+// testConsensus commits the logs in order and applies them to the followers directly.
+type testConsensus struct {
+	l         *Ledis
+	followers []*Ledis
+
+	index uint64
+}
+
+func (c *testConsensus) Commit(data []byte) error {
+	c.index++
+
+	if err := c.l.ApplyConsensusLog(c.index, data, true); err != nil {
+		return err
+	}
+
+	for _, f := range c.followers {
+		if err := f.ApplyConsensusLog(c.index, data, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openConsensusTestLedis(t *testing.T, dir string) *Ledis {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = dir
+
+	os.RemoveAll(dir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestConsensus(t *testing.T) {
+	leader := openConsensusTestLedis(t, "/tmp/test_consensus/leader")
+	defer leader.Close()
+
+	follower := openConsensusTestLedis(t, "/tmp/test_consensus/follower")
+	defer follower.Close()
+
+	c := &testConsensus{l: leader, followers: []*Ledis{follower}}
+	if err := leader.SetConsensus(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.SetConsensus(&testConsensus{l: follower}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := leader.Select(0)
+	if err := db.Set([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	} else if _, err = db.HSet([]byte("h"), []byte("f"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the databases mapping of the follower is reloaded
+	if err := leader.SwapDB(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	fdb, _ := follower.Select(1)
+	if v, err := fdb.Get([]byte("a")); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	}
+
+	if err := checkLedisEqual(leader, follower); err != nil {
+		t.Fatal(err)
+	} else if follower.AppliedIndex() != c.index || leader.AppliedIndex() != c.index {
+		t.Fatalf("applied index %d %d != %d", leader.AppliedIndex(), follower.AppliedIndex(), c.index)
+	}
+
+	// the applied logs are skipped
+	index := c.index
+	if err := follower.ApplyConsensusLog(index, []byte{consensusFlushAll}, false); err != nil {
+		t.Fatal(err)
+	} else if v, _ := fdb.Get([]byte("a")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	}
+
+	// the snapshot is restored with its applied index
+	snap, err := leader.NewConsensusSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = snap.Dump(&buf)
+	snap.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := openConsensusTestLedis(t, "/tmp/test_consensus/restored")
+	defer restored.Close()
+
+	if err = restored.SetConsensus(&testConsensus{l: restored}); err != nil {
+		t.Fatal(err)
+	} else if err = restored.RestoreConsensusSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	} else if restored.AppliedIndex() != index {
+		t.Fatalf("applied index %d != %d", restored.AppliedIndex(), index)
+	} else if err = checkLedisEqual(leader, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = leader.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := fdb.Get([]byte("a")); v != nil {
+		t.Fatalf("%q is not flushed", v)
+	} else if follower.AppliedIndex() != index+1 {
+		t.Fatalf("applied index %d != %d", follower.AppliedIndex(), index+1)
+	}
+}
@@ -71,6 +71,9 @@ const (
 	ExpMetaType         byte = 102
 	ExpTimeType         byte = 103
 
+	// the stale data of the cleared hash, list, set and zset
+	GCType byte = 104
+
 	MetaType byte = 201
 )
 
@@ -90,6 +93,7 @@ var TypeName = map[byte]string{
 	SSizeType:   "ssize",
 	ExpTimeType: "exptime",
 	ExpMetaType: "expmeta",
+	GCType:      "gc",
 }
 
 const (
@@ -133,6 +137,8 @@ var (
 	ErrWriteInROnly  = errors.New("write not support in readonly mode")
 	ErrRplInRDWR     = errors.New("replication not support in read write mode")
 	ErrRplNotSupport = errors.New("replication not support")
+	ErrNoSuchKey     = errors.New("no such key")
+	ErrSameObject    = errors.New("source and destination objects are the same")
 )
 
 // const (
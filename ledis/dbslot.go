@@ -0,0 +1,591 @@
+package ledis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledisdb/ledisdb/store"
+	"github.com/siddontang/go/log"
+)
+
+/*
+Every database index is mapped to a slot, and the slot is the varint prefix
+of all the keys of the database. SWAPDB swaps the slots of two databases,
+FLUSHDB ASYNC maps the database to an empty slot, and the old slot is
+reclaimed in background.
+
+The mapping is saved in every used slot:
+
+	slot + MetaType + dbSlotMeta -> database index, or -1 if the slot is being reclaimed
+
+A slot without the key is mapped to the database with the same index by default.
+*/
+const (
+	dbSlotMeta byte = 3
+
+	// the slots above MaxDatabases are used by the async flushed databases
+	maxDBSlots int = 2 * MaxDatabases
+
+	reclaimBatchSize int = 1024
+)
+
+var errNoFreeDBSlot = errors.New("no free database slot")
+
+// ErrDBSwapped is returned for the writes of a database handle selected before
+// the database is swapped or flushed asynchronously, the database must be selected again.
+var ErrDBSwapped = errors.New("database is swapped or flushed, select it again")
+
+func encodeDBSlotKey(slot int) []byte {
+	indexVarBuf := encodeDBIndex(slot)
+
+	buf := make([]byte, len(indexVarBuf)+2)
+	pos := copy(buf, indexVarBuf)
+	buf[pos] = MetaType
+	buf[pos+1] = dbSlotMeta
+	return buf
+}
+
+func isDBSlotKey(key []byte) bool {
+	_, pos, err := decodeDBIndex(key)
+	return err == nil && len(key) == pos+2 && key[pos] == MetaType && key[pos+1] == dbSlotMeta
+}
+
+// encodeDBSlotRange returns the range [min, max) of all the keys in the slot.
+func encodeDBSlotRange(slot int) ([]byte, []byte) {
+	min := encodeDBIndex(slot)
+	max := encodeDBIndex(slot)
+
+	// varint is prefix free, so all keys of the slot are less than
+	// the prefix with the last byte increased
+	max[len(max)-1]++
+	return min, max
+}
+
+// rangeHasDBSlotKey returns whether the range [start, end) may contain a database slot key.
+func rangeHasDBSlotKey(start []byte, end []byte) bool {
+	slot, _, err := decodeDBIndex(start)
+	if err != nil {
+		return true
+	}
+
+	// the range crosses slots
+	if _, max := encodeDBSlotRange(slot); bytes.Compare(end, max) > 0 {
+		return true
+	}
+
+	sk := encodeDBSlotKey(slot)
+	return bytes.Compare(start, sk) <= 0 && bytes.Compare(sk, end) < 0
+}
+
+func (l *Ledis) isDBSlotEmpty(slot int) bool {
+	min, max := encodeDBSlotRange(slot)
+
+	it := l.ldb.RangeLimitIterator(min, max, store.RangeROpen, 0, 1)
+	defer it.Close()
+
+	return !it.Valid()
+}
+
+// loadDBSlots loads the mapping of databases and slots, it must be called with dbLock held.
+func (l *Ledis) loadDBSlots() error {
+	slots := make([]int, l.cfg.Databases)
+	for i := range slots {
+		slots[i] = -1
+	}
+
+	used := make(map[int]bool)
+	reclaims := make(map[int]bool)
+
+	for slot := 0; slot < maxDBSlots; slot++ {
+		v, err := l.ldb.Get(encodeDBSlotKey(slot))
+		if err != nil {
+			return err
+		} else if v == nil {
+			continue
+		}
+
+		index, err := Int64(v, nil)
+		if err != nil {
+			return err
+		}
+
+		used[slot] = true
+		if index < 0 {
+			reclaims[slot] = true
+		} else if int(index) < len(slots) {
+			slots[index] = slot
+		}
+	}
+
+	var wb *store.WriteBatch
+	for index := range slots {
+		if slots[index] >= 0 {
+			continue
+		} else if !used[index] {
+			slots[index] = index
+			used[index] = true
+			continue
+		}
+
+		// the default slot is used by another database, maybe the databases number is changed
+		slot, err := l.freeDBSlot(used)
+		if err != nil {
+			return err
+		}
+
+		slots[index] = slot
+		used[slot] = true
+
+		if wb == nil {
+			wb = l.ldb.NewWriteBatch()
+			defer wb.Close()
+		}
+		wb.Put(encodeDBSlotKey(slot), PutInt64(int64(index)))
+	}
+
+	if wb != nil {
+		if err := wb.Commit(); err != nil {
+			return err
+		}
+	}
+
+	l.setDBSlots(slots, reclaims)
+
+	return nil
+}
+
+// setDBSlots sets the mapping of databases and slots, and replaces the handles
+// of the remapped databases, it must be called with dbLock held.
+func (l *Ledis) setDBSlots(slots []int, reclaims map[int]bool) {
+	l.slots = slots
+	l.reclaimSlots = reclaims
+
+	indexes := make(map[int]int, len(slots))
+	for index, slot := range slots {
+		indexes[slot] = index
+	}
+
+	for slot, db := range l.dbs {
+		index, ok := indexes[slot]
+		if !ok {
+			index = -1
+		}
+
+		if db.index != index {
+			l.dbs[slot] = db.remap(index)
+		}
+	}
+
+	l.dbVersion.Add(1)
+}
+
+func (l *Ledis) reloadDBSlots() {
+	l.dbLock.Lock()
+	defer l.dbLock.Unlock()
+
+	if err := l.loadDBSlots(); err != nil {
+		log.Fatalf("load database slots error %s", err.Error())
+	}
+}
+
+// dbSlotReplay records the slot keys changed by the replicated logs.
+type dbSlotReplay struct {
+	*store.WriteBatch
+
+	// the value of the changed slot key, nil if deleted
+	slots map[int][]byte
+
+	// the changes can't be known, the mapping must be loaded again
+	reload bool
+
+	// the counted keys put or deleted, only recorded for the slave counting the keys itself
+	counted map[string]bool
+}
+
+func newDBSlotReplay(wb *store.WriteBatch) *dbSlotReplay {
+	return &dbSlotReplay{WriteBatch: wb}
+}
+
+func (r *dbSlotReplay) changed() bool {
+	return r.reload || len(r.slots) > 0
+}
+
+func (r *dbSlotReplay) set(slot int, value []byte) {
+	if r.slots == nil {
+		r.slots = make(map[int][]byte)
+	}
+	r.slots[slot] = value
+}
+
+func (r *dbSlotReplay) count(key []byte, put bool) {
+	if r.counted != nil && decodeCountedKey(key) != nil {
+		r.counted[string(key)] = put
+	}
+}
+
+func (r *dbSlotReplay) Put(key []byte, value []byte) {
+	if isDBSlotKey(key) {
+		slot, _, _ := decodeDBIndex(key)
+		r.set(slot, append([]byte{}, value...))
+	}
+	r.count(key, true)
+	r.WriteBatch.Put(key, value)
+}
+
+func (r *dbSlotReplay) Delete(key []byte) {
+	if isDBSlotKey(key) {
+		slot, _, _ := decodeDBIndex(key)
+		r.set(slot, nil)
+	}
+	r.count(key, false)
+	r.WriteBatch.Delete(key)
+}
+
+func (r *dbSlotReplay) DeleteRange(start []byte, end []byte) {
+	if rangeHasDBSlotKey(start, end) {
+		first, _, err1 := decodeDBIndex(start)
+		last, _, err2 := decodeDBIndex(end)
+		if err1 != nil || err2 != nil {
+			r.reload = true
+		} else {
+			for slot := first; slot <= last && slot < maxDBSlots; slot++ {
+				sk := encodeDBSlotKey(slot)
+				if bytes.Compare(start, sk) <= 0 && bytes.Compare(sk, end) < 0 {
+					r.set(slot, nil)
+				}
+			}
+		}
+	}
+	r.WriteBatch.DeleteRange(start, end)
+}
+
+// replayDBSlots updates the databases mapping by the replayed slot keys.
+func (l *Ledis) replayDBSlots(r *dbSlotReplay) {
+	if !r.changed() {
+		return
+	}
+
+	l.dbLock.Lock()
+	defer l.dbLock.Unlock()
+
+	var err error
+	if r.reload {
+		err = l.loadDBSlots()
+	} else {
+		err = l.updateDBSlots(r.slots)
+	}
+
+	if err != nil {
+		log.Fatalf("load database slots error %s", err.Error())
+	}
+}
+
+// updateDBSlots updates the mapping by the changed slot keys without reading all
+// the slots, it must be called with dbLock held.
+func (l *Ledis) updateDBSlots(changes map[int][]byte) error {
+	slots := append([]int{}, l.slots...)
+	reclaims := make(map[int]bool, len(l.reclaimSlots))
+	for slot := range l.reclaimSlots {
+		reclaims[slot] = true
+	}
+
+	for slot, v := range changes {
+		delete(reclaims, slot)
+		if v == nil {
+			continue
+		}
+
+		index, err := Int64(v, nil)
+		if err != nil {
+			return err
+		}
+
+		if index < 0 {
+			reclaims[slot] = true
+		} else if int(index) < len(slots) {
+			slots[index] = slot
+		}
+	}
+
+	// the mapping must be one to one, and a slot without the key is only used
+	// by the database with the same index, or the mapping is loaded again
+	mapped := make(map[int]int, len(slots))
+	for index, slot := range slots {
+		if _, ok := mapped[slot]; ok || reclaims[slot] {
+			return l.loadDBSlots()
+		}
+		mapped[slot] = index
+	}
+
+	for slot, v := range changes {
+		if index, ok := mapped[slot]; ok && v == nil && index != slot {
+			return l.loadDBSlots()
+		}
+	}
+
+	l.setDBSlots(slots, reclaims)
+	return nil
+}
+
+// usedDBSlots must be called with dbLock held.
+func (l *Ledis) usedDBSlots() map[int]bool {
+	used := make(map[int]bool, len(l.slots)+len(l.reclaimSlots))
+	for _, slot := range l.slots {
+		used[slot] = true
+	}
+
+	for slot := range l.reclaimSlots {
+		used[slot] = true
+	}
+
+	return used
+}
+
+func (l *Ledis) freeDBSlot(used map[int]bool) (int, error) {
+	for slot := 0; slot < maxDBSlots; slot++ {
+		if !used[slot] && l.isDBSlotEmpty(slot) {
+			return slot, nil
+		}
+	}
+
+	return 0, errNoFreeDBSlot
+}
+
+func (l *Ledis) dbSlot(index int) int {
+	l.dbLock.Lock()
+	slot := l.slots[index]
+	l.dbLock.Unlock()
+
+	return slot
+}
+
+func (l *Ledis) checkDBIndex(index int) error {
+	if index < 0 || index >= l.cfg.Databases {
+		return fmt.Errorf("invalid db index %d, must in [0, %d]", index, l.cfg.Databases-1)
+	}
+
+	return nil
+}
+
+// DBVersion returns the version of the databases mapping, it is changed
+// after SwapDB or async flushing, and the databases must be selected again.
+func (l *Ledis) DBVersion() int64 {
+	return l.dbVersion.Get()
+}
+
+// SwapDB swaps two databases, the clients see the data of the other database immediately,
+// the writes of the handles selected before fail with ErrDBSwapped.
+func (l *Ledis) SwapDB(index1 int, index2 int) error {
+	if err := l.checkDBIndex(index1); err != nil {
+		return err
+	} else if err := l.checkDBIndex(index2); err != nil {
+		return err
+	} else if l.IsReadOnly() {
+		return ErrWriteInROnly
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	l.dbLock.Lock()
+	defer l.dbLock.Unlock()
+
+	if index1 == index2 {
+		return nil
+	}
+
+	slot1 := l.slots[index1]
+	slot2 := l.slots[index2]
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	wb.Put(encodeDBSlotKey(slot1), PutInt64(int64(index2)))
+	wb.Put(encodeDBSlotKey(slot2), PutInt64(int64(index1)))
+
+	if _, err := l.handleCommit(wb, wb); err != nil {
+		return err
+	}
+
+	slots := append([]int{}, l.slots...)
+	slots[index1] = slot2
+	slots[index2] = slot1
+
+	l.setDBSlots(slots, l.reclaimSlots)
+
+	return nil
+}
+
+// FlushDBAsync clears the database immediately, the space is reclaimed in background.
+func (l *Ledis) FlushDBAsync(index int) error {
+	if err := l.checkDBIndex(index); err != nil {
+		return err
+	}
+
+	return l.flushAsync(index)
+}
+
+// FlushAllAsync clears all the databases immediately, the space is reclaimed in background.
+// Unlike FlushAll, the replication logs are not cleared.
+func (l *Ledis) FlushAllAsync() error {
+	indexes := make([]int, l.cfg.Databases)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	return l.flushAsync(indexes...)
+}
+
+func (l *Ledis) flushAsync(indexes ...int) error {
+	if l.IsReadOnly() {
+		return ErrWriteInROnly
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	l.dbLock.Lock()
+	defer l.dbLock.Unlock()
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	used := l.usedDBSlots()
+	slots := make([]int, len(indexes))
+
+	for i, index := range indexes {
+		old := l.slots[index]
+		if l.isDBSlotEmpty(old) {
+			slots[i] = old
+			continue
+		}
+
+		slot, err := l.freeDBSlot(used)
+		if err != nil {
+			return err
+		}
+		used[slot] = true
+		slots[i] = slot
+
+		wb.Put(encodeDBSlotKey(slot), PutInt64(int64(index)))
+		wb.Put(encodeDBSlotKey(old), PutInt64(-1))
+	}
+
+	if _, err := l.handleCommit(wb, wb); err != nil {
+		return err
+	}
+
+	mapping := append([]int{}, l.slots...)
+	for i, index := range indexes {
+		old := l.slots[index]
+		if old == slots[i] {
+			continue
+		}
+
+		mapping[index] = slots[i]
+		l.reclaimSlots[old] = true
+	}
+
+	l.setDBSlots(mapping, l.reclaimSlots)
+
+	AsyncNotify(l.reclaimCh)
+
+	return nil
+}
+
+func (l *Ledis) onReclaimDBSlots() {
+	defer l.wg.Done()
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-l.reclaimCh:
+		case <-t.C:
+		case <-l.quit:
+			return
+		}
+
+		l.reclaimDBSlots()
+	}
+}
+
+func (l *Ledis) reclaimDBSlots() {
+	l.dbLock.Lock()
+	slots := make([]int, 0, len(l.reclaimSlots))
+	for slot := range l.reclaimSlots {
+		slots = append(slots, slot)
+	}
+	l.dbLock.Unlock()
+
+	for _, slot := range slots {
+		for {
+			// the slave reclaims by the replication logs of the master
+			if l.IsReadOnly() {
+				return
+			}
+
+			select {
+			case <-l.quit:
+				return
+			default:
+			}
+
+			done, err := l.reclaimDBSlot(slot)
+			if err != nil {
+				log.Errorf("reclaim database slot %d error %s", slot, err.Error())
+				return
+			} else if done {
+				break
+			}
+		}
+	}
+}
+
+// reclaimDBSlot deletes a batch of keys in the slot, and frees the slot if all deleted.
+func (l *Ledis) reclaimDBSlot(slot int) (bool, error) {
+	l.wLock.RLock()
+	defer l.wLock.RUnlock()
+
+	min, max := encodeDBSlotRange(slot)
+	sk := encodeDBSlotKey(slot)
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	n := 0
+	if l.ldb.SupportDeleteRange() {
+		// the slot key is deleted with all the data in one commit
+		wb.DeleteRange(min, max)
+	} else {
+		it := l.ldb.RangeLimitIterator(min, max, store.RangeROpen, 0, reclaimBatchSize+1)
+		for ; it.Valid(); it.Next() {
+			if !bytes.Equal(it.RawKey(), sk) {
+				wb.Delete(it.Key())
+				n++
+			}
+		}
+		it.Close()
+
+		if n == 0 {
+			wb.Delete(sk)
+		}
+	}
+
+	if _, err := l.handleCommit(wb, wb); err != nil {
+		return false, err
+	}
+
+	if n > 0 {
+		return false, nil
+	}
+
+	l.dbLock.Lock()
+	delete(l.reclaimSlots, slot)
+	l.dbLock.Unlock()
+
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package ledis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+)
+
+func TestDBSlot(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_ledis_dbslot"
+	cfg.Databases = 4
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db0, _ := l.Select(0)
+	db1, _ := l.Select(1)
+
+	key := []byte("dbslot_a")
+	db0.Set(key, []byte("0"))
+	db1.Set(key, []byte("1"))
+	db1.HSet(key, []byte("f"), []byte("v"))
+
+	v := l.DBVersion()
+	if err := l.SwapDB(0, 1); err != nil {
+		t.Fatal(err)
+	} else if l.DBVersion() == v {
+		t.Fatal("version must be changed")
+	}
+
+	// the handles selected before the swap can't write any more
+	if db0.Index() != 0 || db1.Index() != 1 {
+		t.Fatal(db0.Index(), db1.Index())
+	} else if err := db0.Set(key, []byte("2")); err != ErrDBSwapped {
+		t.Fatal(err)
+	} else if _, err := db1.HSet(key, []byte("f"), []byte("2")); err != ErrDBSwapped {
+		t.Fatal(err)
+	}
+
+	db, _ := l.Select(0)
+	if db.Index() != 0 {
+		t.Fatal(db.Index())
+	}
+	if v, _ := db.Get(key); string(v) != "1" {
+		t.Fatal(string(v))
+	} else if n, _ := db.DBSize(); n != 2 {
+		t.Fatal(n)
+	} else if n, _, _ := l.KeyCount(0, HASH); n != 1 {
+		t.Fatal(n)
+	}
+
+	if err := l.FlushDBAsync(0); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ = l.Select(0)
+	if v, _ := db.Get(key); v != nil {
+		t.Fatal(string(v))
+	} else if n, _ := db.DBSize(); n != 0 {
+		t.Fatal(n)
+	}
+
+	// wait the old slot reclaimed
+	for i := 0; i < 50; i++ {
+		if l.isDBSlotEmpty(1) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !l.isDBSlotEmpty(1) {
+		t.Fatal("slot must be reclaimed")
+	}
+
+	db.Set(key, []byte("2"))
+	l.Close()
+
+	// the mapping is persisted
+	if l, err = Open(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ = l.Select(0)
+	if v, _ := db.Get(key); string(v) != "2" {
+		t.Fatal(string(v))
+	}
+
+	db, _ = l.Select(1)
+	if v, _ := db.Get(key); string(v) != "0" {
+		t.Fatal(string(v))
+	}
+
+	if err := l.FlushAllAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		db, _ = l.Select(i)
+		if n, _ := db.DBSize(); n != 0 {
+			t.Fatal(i, n)
+		}
+	}
+
+	if err := l.SwapDB(0, 4); err == nil {
+		t.Fatal("must error")
+	}
+
+	l.Close()
+}
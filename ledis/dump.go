@@ -4,13 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"os"
 
 	"github.com/ledisdb/ledisdb/store"
+	"github.com/ledisdb/ledisdb/store/encrypted"
 	"github.com/siddontang/go/snappy"
 )
 
+var errDumpEncrypted = errors.New("the dump is encrypted but no key file is set")
+
 // DumpHead is the head of a dump.
 type DumpHead struct {
 	CommitID uint64
@@ -37,8 +41,19 @@ func (l *Ledis) DumpFile(path string) error {
 	return l.Dump(f)
 }
 
-// Dump dumps data to the Writer.
+// Dump dumps data to the Writer, the dump is encrypted if the key file is set.
 func (l *Ledis) Dump(w io.Writer) error {
+	return l.DumpFiltered(w, nil)
+}
+
+// DumpFiltered dumps the data selected by the filter, nil for all, like the full sync of a slave.
+func (l *Ledis) DumpFiltered(w io.Writer, f *ReplicationFilter) error {
+	_, err := l.dump(w, f)
+	return err
+}
+
+// dump dumps the data selected by the filter, and returns the commit ID of the dump.
+func (l *Ledis) dump(w io.Writer, f *ReplicationFilter) (uint64, error) {
 	var err error
 
 	var commitID uint64
@@ -49,18 +64,34 @@ func (l *Ledis) Dump(w io.Writer) error {
 	if l.r != nil {
 		if commitID, err = l.r.LastCommitID(); err != nil {
 			l.wLock.Unlock()
-			return err
+			return 0, err
 		}
 	}
 
 	if snap, err = l.ldb.NewSnapshot(); err != nil {
 		l.wLock.Unlock()
-		return err
+		return 0, err
 	}
 	defer snap.Close()
 
+	kf := l.newKeyFilter(f)
+
 	l.wLock.Unlock()
 
+	return commitID, l.dumpSnapshot(snap, commitID, w, kf)
+}
+
+// dumpSnapshot dumps the data in the snapshot with the commit ID in the head,
+// only the keys matched by the filter are dumped if it is not nil.
+func (l *Ledis) dumpSnapshot(snap *store.Snapshot, commitID uint64, w io.Writer, kf *keyFilter) error {
+	var err error
+
+	var ew io.WriteCloser
+	if l.ks != nil {
+		ew = encrypted.NewWriter(w, l.ks)
+		w = ew
+	}
+
 	wb := bufio.NewWriterSize(w, 4096)
 
 	h := &DumpHead{commitID}
@@ -79,6 +110,9 @@ func (l *Ledis) Dump(w io.Writer) error {
 	var value []byte
 	for ; it.Valid(); it.Next() {
 		key = it.RawKey()
+		if isCodecMetaKey(key) || (kf != nil && !kf.match(key)) {
+			continue
+		}
 		value = it.RawValue()
 
 		if key, err = snappy.Encode(compressBuf, key); err != nil {
@@ -106,7 +140,14 @@ func (l *Ledis) Dump(w io.Writer) error {
 		}
 	}
 
-	return wb.Flush()
+	if err = wb.Flush(); err != nil {
+		return err
+	}
+
+	if ew != nil {
+		return ew.Close()
+	}
+	return nil
 }
 
 // LoadDumpFile clears all data and loads dump file to db
@@ -120,8 +161,19 @@ func (l *Ledis) LoadDumpFile(path string) (*DumpHead, error) {
 	return l.LoadDump(f)
 }
 
-// LoadDump clears all data and loads dump file to db
+// LoadDump clears all data and loads dump file to db, the encrypted dump is
+// decrypted with the keys in the key file.
 func (l *Ledis) LoadDump(r io.Reader) (*DumpHead, error) {
+	rb := bufio.NewReaderSize(r, 4096)
+
+	// check before clearing the data
+	if magic, _ := rb.Peek(len(encrypted.StreamMagic)); encrypted.IsStream(magic) {
+		if l.ks == nil {
+			return nil, errDumpEncrypted
+		}
+		rb = bufio.NewReaderSize(encrypted.NewReader(rb, l.ks), 4096)
+	}
+
 	l.wLock.Lock()
 	defer l.wLock.Unlock()
 
@@ -130,8 +182,6 @@ func (l *Ledis) LoadDump(r io.Reader) (*DumpHead, error) {
 		return nil, err
 	}
 
-	rb := bufio.NewReaderSize(r, 4096)
-
 	h := new(DumpHead)
 
 	if err = h.Read(rb); err != nil {
@@ -201,6 +251,9 @@ func (l *Ledis) LoadDump(r io.Reader) (*DumpHead, error) {
 		return nil, err
 	}
 
+	//the dump may have the databases mapping
+	l.reloadDBSlots()
+
 	if l.r != nil {
 		if err := l.r.UpdateCommitID(h.CommitID); err != nil {
 			return nil, err
@@ -2,7 +2,9 @@ package ledis
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/ledisdb/ledisdb/config"
@@ -55,3 +57,142 @@ func TestDump(t *testing.T) {
 		}
 	}
 }
+
+func TestEncryptedDump(t *testing.T) {
+	keyFile := "/tmp/test_ledis_dump.key"
+	if err := ioutil.WriteFile(keyFile, []byte(strings.Repeat("cd", 32)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile)
+
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_ledis_encrypted_master"
+	cfgM.DBName = "encrypted:goleveldb"
+	cfgM.Encryption.KeyFile = keyFile
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_ledis_encrypted_slave"
+	cfgS.Encryption.KeyFile = keyFile
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	cfgP := config.NewConfigDefault()
+	cfgP.DataDir = "/tmp/test_ledis_plain_slave"
+	os.RemoveAll(cfgP.DataDir)
+
+	plain, err := Open(cfgP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	db, _ := master.Select(0)
+	db.Set([]byte("a"), []byte("encrypted_dump_value"))
+	db.HSet([]byte("b"), []byte("f"), []byte("2"))
+
+	var buf bytes.Buffer
+	if err = master.Dump(&buf); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(buf.Bytes(), []byte("encrypted_dump_value")) {
+		t.Fatal("plain value in the dump")
+	}
+
+	if _, err = slave.LoadDump(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	} else if err = checkLedisEqual(master, slave); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data is kept if the dump can't be decrypted
+	pdb, _ := plain.Select(0)
+	pdb.Set([]byte("c"), []byte("3"))
+	if _, err = plain.LoadDump(bytes.NewReader(buf.Bytes())); err != errDumpEncrypted {
+		t.Fatal(err)
+	} else if v, _ := pdb.Get([]byte("c")); string(v) != "3" {
+		t.Fatal(string(v))
+	}
+}
+
+func TestCompressedDump(t *testing.T) {
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_ledis_compressed_master"
+	cfgM.Compression.Types = map[string]int{"kv": 0, "hash": 64}
+	cfgM.Compression.DictSamples = 100
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgP := config.NewConfigDefault()
+	cfgP.DataDir = "/tmp/test_ledis_compressed_plain"
+	os.RemoveAll(cfgP.DataDir)
+
+	plain, err := Open(cfgP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	value := []byte(strings.Repeat(`{"compressed":"dump_value"}`, 10))
+
+	db, _ := master.Select(0)
+	db.Set([]byte("a"), value)
+	db.Set([]byte("b"), []byte("1"))
+	db.HSet([]byte("c"), []byte("f"), value)
+	db.RPush([]byte("d"), value)
+
+	if n := master.StoreStat().CompressNum.Get(); n != 2 {
+		t.Fatalf("%d != 2", n)
+	}
+
+	var buf bytes.Buffer
+	if err = master.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = plain.LoadDump(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	} else if err = checkLedisEqual(plain, master); err != nil {
+		t.Fatal(err)
+	}
+
+	// the dump has the plain values and no codec meta
+	it := plain.ldb.NewIterator()
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if isCodecMetaKey(it.Key()) || bytes.HasPrefix(it.Value(), []byte{0xfe, 'z', 's', 't'}) {
+			t.Fatalf("not plain key %q value %q", it.Key(), it.Value())
+		}
+	}
+
+	// the codec meta is kept after flushing all
+	if err = master.FlushAll(); err != nil {
+		t.Fatal(err)
+	} else if v, err := master.ldb.Get(encodeCodecMetaKey()); err != nil || v == nil {
+		t.Fatal("codec meta is deleted", err)
+	}
+
+	cfgI := config.NewConfigDefault()
+	cfgI.DataDir = "/tmp/test_ledis_compressed_invalid"
+	cfgI.Compression.Types = map[string]int{"zset": 0}
+	os.RemoveAll(cfgI.DataDir)
+
+	if _, err = Open(cfgI); err == nil {
+		t.Fatal("must error for the invalid type")
+	}
+}
@@ -128,6 +128,17 @@ func formatEventKey(buf []byte, k []byte) ([]byte, error) {
 		buf = append(buf, TypeName[tp]...)
 		buf = append(buf, ' ')
 		buf = strconv.AppendQuote(buf, hack.String(key))
+	case GCType:
+		_, tp, key, gen, err := decodeGCKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, TypeName[tp]...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendQuote(buf, hack.String(key))
+		buf = append(buf, ' ')
+		buf = strconv.AppendUint(buf, gen, 10)
 	default:
 		return nil, errInvalidEvent
 	}
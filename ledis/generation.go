@@ -0,0 +1,405 @@
+package ledis
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/ledisdb/ledisdb/store"
+	"github.com/siddontang/go/log"
+)
+
+/*
+The data keys of hash, list, set and zset have a generation, so clearing
+a big key is O(1), it only deletes the meta key and saves a garbage key,
+and the stale data is deleted by the garbage collector in background.
+
+The generation is appended to the meta value (the size for hash, set and zset,
+the head and tail sequences for list), 0 is not saved:
+
+	meta value | generation(8 bytes big endian)
+
+The key in the data keys is encoded as:
+
+	key length(2 bytes) | key                                        for generation 0, the old format
+	key length | genKeyFlag(2 bytes) | key | generation(8 bytes)      for generation > 0
+
+The garbage key:
+
+	db index | GCType | data type | key length(2 bytes) | key | generation(8 bytes) -> nil
+
+The new generation is got from the generation counter of the data type, so it is
+always greater than the generations of the existing and cleared keys:
+
+	db index | MetaType | genMeta | data type -> last generation
+*/
+const (
+	genMeta byte = 4
+
+	genKeyFlag uint16 = 0x8000
+
+	// the max data keys deleted by the garbage collector in one commit
+	gcBatchSize int = 1024
+
+	// the garbage collector checks all the databases every gcSweepRounds rounds,
+	// for the garbage keys replicated from the old master or left by the last run
+	gcSweepRounds int = 60
+)
+
+var errGenKey = errors.New("invalid generation key")
+var errGCKey = errors.New("invalid gc key")
+
+func genKeyLen(key []byte, gen uint64) int {
+	if gen == 0 {
+		return 2 + len(key)
+	}
+	return 2 + len(key) + 8
+}
+
+// putGenKey puts the key with generation to buf, returns the put size.
+func putGenKey(buf []byte, key []byte, gen uint64) int {
+	if gen == 0 {
+		binary.BigEndian.PutUint16(buf, uint16(len(key)))
+		return 2 + copy(buf[2:], key)
+	}
+
+	binary.BigEndian.PutUint16(buf, uint16(len(key))|genKeyFlag)
+	pos := 2 + copy(buf[2:], key)
+	binary.BigEndian.PutUint64(buf[pos:], gen)
+	return pos + 8
+}
+
+// decodeGenKey decodes the key with generation at the beginning of buf, returns the decoded size.
+func decodeGenKey(buf []byte) ([]byte, int, error) {
+	if len(buf) < 2 {
+		return nil, 0, errGenKey
+	}
+
+	keyLen := binary.BigEndian.Uint16(buf)
+	n := 2 + int(keyLen&^genKeyFlag)
+	if keyLen&genKeyFlag != 0 {
+		n += 8
+	}
+
+	if n > len(buf) {
+		return nil, 0, errGenKey
+	}
+
+	return buf[2 : 2+int(keyLen&^genKeyFlag)], n, nil
+}
+
+func encodeGenMeta(v []byte, gen uint64) []byte {
+	if gen == 0 {
+		return v
+	}
+
+	buf := make([]byte, len(v)+8)
+	pos := copy(buf, v)
+	binary.BigEndian.PutUint64(buf[pos:], gen)
+	return buf
+}
+
+// decodeGenMeta splits the meta value and the generation.
+func decodeGenMeta(v []byte) ([]byte, uint64) {
+	if len(v) <= 8 {
+		return v, 0
+	}
+
+	return v[0:8], binary.BigEndian.Uint64(v[8:])
+}
+
+// getSize gets the size and generation from the size key of hash, set or zset.
+func (db *DB) getSize(sk []byte) (int64, uint64, error) {
+	v, err := db.bucket.Get(sk)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v, gen := decodeGenMeta(v)
+	size, err := Int64(v, nil)
+	return size, gen, err
+}
+
+// getWriteSize is like getSize, but returns a new generation if the key doesn't exist.
+func (db *DB) getWriteSize(t *batch, dataType byte, sk []byte) (int64, uint64, error) {
+	size, gen, err := db.getSize(sk)
+	if err == nil {
+		t.exists(sk, size > 0)
+	}
+	if err == nil && size == 0 {
+		gen, err = db.newGen(t, dataType)
+	}
+
+	return size, gen, err
+}
+
+func (db *DB) setSize(t *batch, dataType byte, sk []byte, key []byte, size int64, gen uint64) {
+	if size <= 0 {
+		t.Delete(sk)
+		db.rmExpire(t, dataType, key)
+	} else {
+		t.Put(sk, encodeGenMeta(PutInt64(size), gen))
+	}
+}
+
+// clearSize clears the hash, set or zset with the size key, returns the size.
+func (db *DB) clearSize(t *batch, dataType byte, sk []byte, key []byte) int64 {
+	v, err := db.bucket.Get(sk)
+	if err != nil || v == nil {
+		return 0
+	}
+
+	t.exists(sk, true)
+
+	v, gen := decodeGenMeta(v)
+	size, _ := Int64(v, nil)
+
+	db.clearGen(t, dataType, sk, key, gen)
+	return size
+}
+
+func (db *DB) encodeGCKey(dataType byte, key []byte, gen uint64) []byte {
+	buf := make([]byte, len(db.indexVarBuf)+2+2+len(key)+8)
+
+	pos := copy(buf, db.indexVarBuf)
+	buf[pos] = GCType
+	buf[pos+1] = dataType
+	pos += 2
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
+	pos += 2
+	pos += copy(buf[pos:], key)
+
+	binary.BigEndian.PutUint64(buf[pos:], gen)
+	return buf
+}
+
+func decodeGCKey(ek []byte) (indexVarBuf []byte, dataType byte, key []byte, gen uint64, err error) {
+	_, pos, err := decodeDBIndex(ek)
+	if err != nil {
+		return
+	}
+
+	if pos+4 > len(ek) || ek[pos] != GCType {
+		err = errGCKey
+		return
+	}
+
+	indexVarBuf = ek[0:pos]
+	dataType = ek[pos+1]
+	pos += 2
+
+	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
+	pos += 2
+
+	if pos+keyLen+8 != len(ek) {
+		err = errGCKey
+		return
+	}
+
+	key = ek[pos : pos+keyLen]
+	gen = binary.BigEndian.Uint64(ek[pos+keyLen:])
+	return
+}
+
+// newGen returns the generation for the new data of a key, it is greater than the
+// generations of all the existing and cleared keys, so a key can be cleared and
+// written again in one batch. It must be called with the batch lock of the data type held.
+func (db *DB) newGen(t *batch, dataType byte) (uint64, error) {
+	ck := encodeKeyCountKey(db.indexVarBuf, genMeta, dataType)
+
+	// the generation put before in this batch is not in the store yet
+	gen, ok := t.gens[string(ck)]
+	if !ok {
+		v, err := db.bucket.Get(ck)
+		if err != nil {
+			return 0, err
+		} else if v != nil {
+			if len(v) != 8 {
+				return 0, errGenKey
+			}
+			gen = binary.BigEndian.Uint64(v)
+		}
+	}
+	gen++
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, gen)
+	t.Put(ck, buf)
+
+	if t.gens == nil {
+		t.gens = make(map[string]uint64)
+	}
+	t.gens[string(ck)] = gen
+
+	return gen, nil
+}
+
+// clearGen deletes the meta key, and leaves the data of the generation to the garbage collector.
+func (db *DB) clearGen(t *batch, dataType byte, mk []byte, key []byte, gen uint64) {
+	t.Delete(mk)
+	t.Put(db.encodeGCKey(dataType, key, gen), nil)
+
+	slot, _, _ := decodeDBIndex(db.indexVarBuf)
+	t.gcSlots = append(t.gcSlots, slot)
+}
+
+// notifyGC wakes up the garbage collector for the database slots.
+func (l *Ledis) notifyGC(slots ...int) {
+	l.dbLock.Lock()
+	for _, slot := range slots {
+		l.gcSlots[slot] = true
+	}
+	l.dbLock.Unlock()
+
+	AsyncNotify(l.gcCh)
+}
+
+func prefixSuccessor(prefix []byte) []byte {
+	buf := append([]byte{}, prefix...)
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i]++
+		if buf[i] != 0 {
+			return buf[0 : i+1]
+		}
+	}
+
+	return nil
+}
+
+// gcDataRanges returns the ranges [min, max) of the data keys of the generation.
+func gcDataRanges(indexVarBuf []byte, dataType byte, key []byte, gen uint64) [][2][]byte {
+	var storeTypes []byte
+	switch dataType {
+	case ZSetType:
+		storeTypes = []byte{ZSetType, ZScoreType}
+	default:
+		storeTypes = []byte{dataType}
+	}
+
+	ranges := make([][2][]byte, 0, len(storeTypes))
+	for _, tp := range storeTypes {
+		prefix := make([]byte, len(indexVarBuf)+1+genKeyLen(key, gen))
+		pos := copy(prefix, indexVarBuf)
+		prefix[pos] = tp
+		putGenKey(prefix[pos+1:], key, gen)
+
+		ranges = append(ranges, [2][]byte{prefix, prefixSuccessor(prefix)})
+	}
+
+	return ranges
+}
+
+func (l *Ledis) onGC() {
+	defer l.wg.Done()
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for i := 0; ; i++ {
+		l.gcGenerations(i%gcSweepRounds == 0)
+
+		select {
+		case <-l.gcCh:
+		case <-t.C:
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// gcGenerations deletes the stale data of the notified databases, or all if all is true.
+func (l *Ledis) gcGenerations(all bool) {
+	l.dbLock.Lock()
+	var slots []int
+	if all {
+		slots = append(slots, l.slots...)
+	} else {
+		for slot := range l.gcSlots {
+			slots = append(slots, slot)
+		}
+	}
+	l.gcSlots = make(map[int]bool)
+	l.dbLock.Unlock()
+
+	for _, slot := range slots {
+		for {
+			// the slave deletes the stale data by the replication logs of the master
+			if l.IsReadOnly() {
+				return
+			}
+
+			select {
+			case <-l.quit:
+				return
+			default:
+			}
+
+			done, err := l.gcDBSlot(slot)
+			if err != nil {
+				log.Errorf("gc database slot %d error %s", slot, err.Error())
+				return
+			} else if done {
+				break
+			}
+		}
+	}
+}
+
+// gcDBSlot deletes a batch of the stale data of the garbage keys in the slot,
+// and the garbage keys whose data are all deleted, returns true if all done.
+func (l *Ledis) gcDBSlot(slot int) (bool, error) {
+	l.wLock.RLock()
+	defer l.wLock.RUnlock()
+
+	indexVarBuf := encodeDBIndex(slot)
+	min := append(append([]byte{}, indexVarBuf...), GCType)
+	max := append(append([]byte{}, indexVarBuf...), GCType+1)
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	// a range deletion is counted as one key if the store supports it natively
+	deleteRange := l.ldb.SupportDeleteRange()
+
+	n := 0
+	it := l.ldb.RangeIterator(min, max, store.RangeROpen)
+	for ; it.Valid() && n < gcBatchSize; it.Next() {
+		gk := it.Key()
+		_, dataType, key, gen, err := decodeGCKey(gk)
+		if err != nil {
+			it.Close()
+			return false, err
+		}
+
+		for _, r := range gcDataRanges(indexVarBuf, dataType, key, gen) {
+			if deleteRange {
+				wb.DeleteRange(r[0], r[1])
+				n++
+				continue
+			}
+
+			dit := l.ldb.RangeLimitIterator(r[0], r[1], store.RangeROpen, 0, gcBatchSize-n)
+			for ; dit.Valid(); dit.Next() {
+				wb.Delete(dit.Key())
+				n++
+			}
+			dit.Close()
+		}
+
+		if deleteRange || n < gcBatchSize {
+			wb.Delete(gk)
+			n++
+		}
+	}
+
+	done := !it.Valid()
+	it.Close()
+
+	if n == 0 {
+		return true, nil
+	}
+
+	_, err := l.handleCommit(wb, wb)
+	return done && n < gcBatchSize, err
+}
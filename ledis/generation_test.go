@@ -0,0 +1,176 @@
+package ledis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/store"
+)
+
+func TestGenKey(t *testing.T) {
+	db := getTestDB()
+
+	key := []byte("test_gen_key")
+	for _, gen := range []uint64{0, 1, 1 << 40} {
+		ek := db.hEncodeHashKey(key, gen, []byte("f"))
+		if k, f, err := db.hDecodeHashKey(ek); err != nil {
+			t.Fatal(err)
+		} else if string(k) != string(key) || string(f) != "f" {
+			t.Fatal(string(k), string(f))
+		}
+
+		ek = db.lEncodeListKey(key, gen, 1024)
+		if k, seq, err := db.lDecodeListKey(ek); err != nil {
+			t.Fatal(err)
+		} else if string(k) != string(key) || seq != 1024 {
+			t.Fatal(string(k), seq)
+		}
+
+		ek = db.zEncodeScoreKey(key, gen, []byte("m"), -100)
+		if k, m, s, err := db.zDecodeScoreKey(ek); err != nil {
+			t.Fatal(err)
+		} else if string(k) != string(key) || string(m) != "m" || s != -100 {
+			t.Fatal(string(k), string(m), s)
+		}
+
+		ek = db.encodeGCKey(ZSetType, key, gen)
+		if _, tp, k, g, err := decodeGCKey(ek); err != nil {
+			t.Fatal(err)
+		} else if tp != ZSetType || string(k) != string(key) || g != gen {
+			t.Fatal(tp, string(k), g)
+		}
+	}
+}
+
+func isGCDataEmpty(l *Ledis, db *DB, dataType byte, key []byte, gen uint64) bool {
+	for _, r := range gcDataRanges(db.indexVarBuf, dataType, key, gen) {
+		it := l.ldb.RangeLimitIterator(r[0], r[1], store.RangeROpen, 0, 1)
+		valid := it.Valid()
+		it.Close()
+
+		if valid {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestGeneration(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_ledis_generation"
+	cfg.Databases = 2
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db, _ := l.Select(0)
+
+	key := []byte("gen_a")
+	for i := 0; i < gcBatchSize+10; i++ {
+		db.HSet(key, []byte{byte(i >> 8), byte(i)}, []byte("v"))
+		db.ZAdd(key, ScorePair{Score: int64(i), Member: []byte{byte(i >> 8), byte(i)}})
+	}
+	db.RPush(key, []byte("1"), []byte("2"))
+	db.SAdd(key, []byte("1"))
+
+	if n, err := db.HClear(key); err != nil {
+		t.Fatal(err)
+	} else if n != int64(gcBatchSize+10) {
+		t.Fatal(n)
+	}
+
+	// the cleared hash is empty at once, and the new data uses a new generation
+	if v, _ := db.HGet(key, []byte{0, 1}); v != nil {
+		t.Fatal(string(v))
+	} else if n, _ := db.HLen(key); n != 0 {
+		t.Fatal(n)
+	}
+
+	db.HSet(key, []byte{0, 1}, []byte("v2"))
+	if _, gen, _ := db.getSize(db.hEncodeSizeKey(key)); gen == 0 {
+		t.Fatal("generation must be increased")
+	} else if vs, _ := db.HGetAll(key); len(vs) != 1 || string(vs[0].Value) != "v2" {
+		t.Fatal(vs)
+	}
+
+	// store to the existing zset
+	if n, err := db.ZUnionStore(key, [][]byte{[]byte("gen_missing")}, nil, AggregateSum); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	} else if n, _ := db.ZCount(key, MinScore, MaxScore); n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, _ := db.LClear(key); n != 2 {
+		t.Fatal(n)
+	} else if v, _ := db.LIndex(key, 0); v != nil {
+		t.Fatal(string(v))
+	}
+
+	if n, _ := db.SClear(key); n != 1 {
+		t.Fatal(n)
+	} else if n, _ := db.SIsMember(key, []byte("1")); n != 0 {
+		t.Fatal(n)
+	}
+
+	// wait the stale data collected
+	empty := func() bool {
+		for _, tp := range []byte{HashType, ZSetType, ListType, SetType} {
+			if !isGCDataEmpty(l, db, tp, key, 0) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < 50 && !empty(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !empty() {
+		t.Fatal("stale data must be collected")
+	}
+
+	if v, _ := db.HGet(key, []byte{0, 1}); string(v) != "v2" {
+		t.Fatal(string(v))
+	}
+}
+
+func TestNewGenInBatch(t *testing.T) {
+	db := getTestDB()
+
+	tx := db.zsetBatch
+	tx.Lock()
+	g1, err := db.newGen(tx, ZSetType)
+	if err != nil {
+		tx.Unlock()
+		t.Fatal(err)
+	}
+	g2, err := db.newGen(tx, ZSetType)
+	tx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	} else if g2 <= g1 {
+		t.Fatalf("generation %d must be greater than %d in one batch", g2, g1)
+	}
+
+	// the rolled back generations are allocated again
+	tx.Lock()
+	g3, err := db.newGen(tx, ZSetType)
+	tx.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	} else if g3 != g1 {
+		t.Fatalf("generation %d != %d after rollback", g3, g1)
+	}
+}
@@ -0,0 +1,361 @@
+package ledis
+
+import (
+	"encoding/binary"
+	"math/rand"
+
+	"github.com/ledisdb/ledisdb/store"
+)
+
+/*
+Key counters are saved under MetaType, one for every db and data type:
+
+	index + MetaType + keyCountMeta + type -> number of keys
+	index + MetaType + expCountMeta + type -> number of keys with a TTL
+
+type is the store type holding the key, like KVType, LMetaType, HSizeType, ...
+
+The counters are updated in the same write batch as the data, so they are
+also carried by replication logs.
+*/
+const (
+	keyCountMeta byte = 1
+	expCountMeta byte = 2
+)
+
+// map the data type saved in the expire keys to the store type holding the key
+var expCountTypes = map[byte]byte{
+	KVType:   KVType,
+	ListType: LMetaType,
+	HashType: HSizeType,
+	SetType:  SSizeType,
+	ZSetType: ZSizeType,
+}
+
+func encodeDBIndex(index int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(index))
+	return buf[0:n]
+}
+
+func encodeKeyCountKey(indexVarBuf []byte, kind byte, storeDataType byte) []byte {
+	buf := make([]byte, len(indexVarBuf)+3)
+	pos := copy(buf, indexVarBuf)
+	buf[pos] = MetaType
+	buf[pos+1] = kind
+	buf[pos+2] = storeDataType
+	return buf
+}
+
+func isKeyCountKey(key []byte) bool {
+	_, pos, err := decodeDBIndex(key)
+	return err == nil && len(key) == pos+3 && key[pos] == MetaType &&
+		(key[pos+1] == keyCountMeta || key[pos+1] == expCountMeta)
+}
+
+// decodeCountedKey returns the counter key which must be updated
+// when the key is created or deleted, or nil if the key is not counted.
+func decodeCountedKey(key []byte) []byte {
+	_, pos, err := decodeDBIndex(key)
+	if err != nil || pos+1 >= len(key) {
+		return nil
+	}
+
+	switch key[pos] {
+	case KVType, LMetaType, HSizeType, SSizeType, ZSizeType:
+		return encodeKeyCountKey(key[0:pos], keyCountMeta, key[pos])
+	case ExpMetaType:
+		if tp, ok := expCountTypes[key[pos+1]]; ok && pos+2 < len(key) {
+			return encodeKeyCountKey(key[0:pos], expCountMeta, tp)
+		}
+	}
+
+	return nil
+}
+
+// keyCountDeltas returns the changes of the key counters by the batch, the keys not
+// read by the command are read together here.
+func (b *batch) keyCountDeltas() (map[string]int64, error) {
+	deltas := make(map[string]int64)
+
+	var keys [][]byte
+	for key, put := range b.counted {
+		existed, ok := b.existed[key]
+		if !ok {
+			keys = append(keys, []byte(key))
+			continue
+		}
+
+		countKeyDelta(deltas, []byte(key), put, existed)
+	}
+
+	if len(keys) == 0 {
+		return deltas, nil
+	}
+
+	values, err := b.l.ldb.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		countKeyDelta(deltas, key, b.counted[string(key)], values[i] != nil)
+	}
+
+	return deltas, nil
+}
+
+func countKeyDelta(deltas map[string]int64, key []byte, put bool, existed bool) {
+	if put && !existed {
+		deltas[string(decodeCountedKey(key))]++
+	} else if !put && existed {
+		deltas[string(decodeCountedKey(key))]--
+	}
+}
+
+// updateKeyCount puts the new key counters into the batch,
+// it must be called with keyCountLock held.
+func (b *batch) updateKeyCount(deltas map[string]int64) error {
+	return b.l.updateKeyCount(b.WriteBatch, deltas)
+}
+
+func (l *Ledis) updateKeyCount(wb *store.WriteBatch, deltas map[string]int64) error {
+	for ck, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+
+		n, err := Int64(l.ldb.Get([]byte(ck)))
+		if err != nil {
+			return err
+		}
+
+		putKeyCount(wb, []byte(ck), n+delta)
+	}
+
+	return nil
+}
+
+// replayKeyCount puts the key counters changed by the replayed logs into the batch,
+// for the slave which counts the keys itself. The range deletions delete the counters
+// with all the keys of the slot, like FLUSHDB, so the keys in them are not counted.
+func (l *Ledis) replayKeyCount(r *dbSlotReplay) error {
+	if len(r.counted) == 0 {
+		return nil
+	}
+
+	keys := make([][]byte, 0, len(r.counted))
+	for key := range r.counted {
+		keys = append(keys, []byte(key))
+	}
+
+	values, err := l.ldb.MultiGet(keys)
+	if err != nil {
+		return err
+	}
+
+	deltas := make(map[string]int64)
+	for i, key := range keys {
+		countKeyDelta(deltas, key, r.counted[string(key)], values[i] != nil)
+	}
+
+	return l.updateKeyCount(r.WriteBatch, deltas)
+}
+
+func (l *Ledis) keyCount(indexVarBuf []byte, storeDataType byte) (keys int64, expires int64, err error) {
+	if keys, err = Int64(l.ldb.Get(encodeKeyCountKey(indexVarBuf, keyCountMeta, storeDataType))); err != nil {
+		return
+	}
+
+	expires, err = Int64(l.ldb.Get(encodeKeyCountKey(indexVarBuf, expCountMeta, storeDataType)))
+	return
+}
+
+// KeyCount returns the number of keys and the number of keys with a TTL
+// of the data type in the database index, without selecting it.
+func (l *Ledis) KeyCount(index int, dataType DataType) (keys int64, expires int64, err error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := l.checkDBIndex(index); err != nil {
+		return 0, 0, err
+	}
+
+	return l.keyCount(encodeDBIndex(l.dbSlot(index)), storeDataType)
+}
+
+// KeyCount returns the number of keys and the number of keys with a TTL of the data type.
+func (db *DB) KeyCount(dataType DataType) (keys int64, expires int64, err error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return db.l.keyCount(db.indexVarBuf, storeDataType)
+}
+
+// DBSize returns the number of keys of all data types.
+func (db *DB) DBSize() (int64, error) {
+	var size int64
+	for _, tp := range keyspaceScanTypes {
+		n, _, err := db.l.keyCount(db.indexVarBuf, tp)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+
+	return size, nil
+}
+
+// RandomKey returns a random key of any data type, or nil if the database is empty.
+// The data type is chosen by the number of its keys, and the key by seeking
+// to a random position, so it is not uniformly distributed.
+func (db *DB) RandomKey() ([]byte, error) {
+	counts := make([]int64, len(keyspaceScanTypes))
+
+	var total int64
+	for i, tp := range keyspaceScanTypes {
+		n, _, err := db.l.keyCount(db.indexVarBuf, tp)
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = n
+		total += n
+	}
+
+	if total == 0 {
+		return nil, nil
+	}
+
+	n := rand.Int63n(total)
+
+	start := 0
+	for ; start < len(counts)-1 && n >= counts[start]; start++ {
+		n -= counts[start]
+	}
+
+	seek := make([]byte, 8)
+	binary.BigEndian.PutUint64(seek, uint64(rand.Int63()))
+
+	// the counters may be stale, so try the other types if nothing found
+	for i := 0; i < len(keyspaceScanTypes); i++ {
+		tp := keyspaceScanTypes[(start+i)%len(keyspaceScanTypes)]
+
+		minKey, maxKey, err := db.buildScanKeyRange(tp, nil, false)
+		if err != nil {
+			return nil, err
+		}
+
+		seekKey, err := db.encodeScanKey(tp, seek)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := db.firstScanKey(tp, seekKey, maxKey)
+		if err != nil {
+			return nil, err
+		} else if key == nil {
+			key, err = db.firstScanKey(tp, minKey, maxKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (db *DB) firstScanKey(storeDataType byte, minKey []byte, maxKey []byte) ([]byte, error) {
+	it := db.bucket.RangeLimitIterator(minKey, maxKey, store.RangeROpen, 0, 1)
+	defer it.Close()
+
+	if !it.Valid() {
+		return nil, nil
+	}
+
+	key, err := db.decodeScanKey(storeDataType, it.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// RepairKeyCount rebuilds the key counters of all databases by scanning the keys.
+// It is needed for the data written by the old version without the counters.
+func (l *Ledis) RepairKeyCount() error {
+	if l.IsReadOnly() {
+		return ErrWriteInROnly
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Rollback()
+
+	l.countKeys(wb)
+
+	_, err := l.handleCommit(wb, wb)
+	return err
+}
+
+// recountKeys rebuilds the key counters of the slave which counts the keys itself
+// after the full data is loaded, the counters are not logged.
+func (l *Ledis) recountKeys() error {
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Rollback()
+
+	l.countKeys(wb)
+
+	return wb.Commit()
+}
+
+// countKeys puts the key counters of all databases counted by scanning the keys into the batch.
+func (l *Ledis) countKeys(wb *store.WriteBatch) {
+	for index := 0; index < l.cfg.Databases; index++ {
+		indexVarBuf := encodeDBIndex(l.dbSlot(index))
+
+		for _, tp := range keyspaceScanTypes {
+			n := l.countRange(indexVarBuf, []byte{tp}, []byte{tp + 1})
+			putKeyCount(wb, encodeKeyCountKey(indexVarBuf, keyCountMeta, tp), n)
+		}
+
+		for expTp, tp := range expCountTypes {
+			n := l.countRange(indexVarBuf, []byte{ExpMetaType, expTp}, []byte{ExpMetaType, expTp + 1})
+			putKeyCount(wb, encodeKeyCountKey(indexVarBuf, expCountMeta, tp), n)
+		}
+	}
+}
+
+func (l *Ledis) countRange(indexVarBuf []byte, min []byte, max []byte) int64 {
+	minKey := append(append([]byte{}, indexVarBuf...), min...)
+	maxKey := append(append([]byte{}, indexVarBuf...), max...)
+
+	var n int64
+	it := l.ldb.RangeIterator(minKey, maxKey, store.RangeROpen)
+	for ; it.Valid(); it.Next() {
+		n++
+	}
+	it.Close()
+
+	return n
+}
+
+func putKeyCount(wb *store.WriteBatch, key []byte, n int64) {
+	if n <= 0 {
+		wb.Delete(key)
+	} else {
+		wb.Put(key, PutInt64(n))
+	}
+}
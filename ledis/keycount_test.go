@@ -0,0 +1,152 @@
+package ledis
+
+import (
+	"testing"
+)
+
+func checkKeyCount(t *testing.T, db *DB, dataType DataType, keys int64, expires int64) {
+	if n, m, err := db.KeyCount(dataType); err != nil {
+		t.Fatal(err)
+	} else if n != keys || m != expires {
+		t.Fatalf("%s keys %d != %d or expires %d != %d", dataType, n, keys, m, expires)
+	}
+}
+
+func TestDBKeyCount(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(4)
+	db.FlushAll()
+
+	if key, err := db.RandomKey(); err != nil {
+		t.Fatal(err)
+	} else if key != nil {
+		t.Fatal(string(key))
+	}
+
+	db.Set([]byte("a"), []byte("1"))
+	db.Set([]byte("a"), []byte("2"))
+	db.MSet(KVPair{[]byte("b"), []byte("1")}, KVPair{[]byte("b"), []byte("2")})
+	db.Expire([]byte("a"), 100)
+	db.Expire([]byte("a"), 200)
+
+	db.LPush([]byte("a"), []byte("1"), []byte("2"))
+	db.HSet([]byte("a"), []byte("f1"), []byte("1"))
+	db.HSet([]byte("a"), []byte("f2"), []byte("1"))
+	db.SAdd([]byte("a"), []byte("1"))
+	db.ZAdd([]byte("a"), ScorePair{1, []byte("1")})
+	db.ZExpire([]byte("a"), 100)
+
+	checkKeyCount(t, db, KV, 2, 1)
+	checkKeyCount(t, db, LIST, 1, 0)
+	checkKeyCount(t, db, HASH, 1, 0)
+	checkKeyCount(t, db, SET, 1, 0)
+	checkKeyCount(t, db, ZSET, 1, 1)
+
+	if n, err := db.DBSize(); err != nil {
+		t.Fatal(err)
+	} else if n != 6 {
+		t.Fatal(n)
+	}
+
+	if key, err := db.RandomKey(); err != nil {
+		t.Fatal(err)
+	} else if string(key) != "a" && string(key) != "b" {
+		t.Fatal(string(key))
+	}
+
+	db.Del([]byte("a"), []byte("c"))
+	db.HDel([]byte("a"), []byte("f1"), []byte("f2"))
+	db.LPop([]byte("a"))
+	db.ZPersist([]byte("a"))
+
+	checkKeyCount(t, db, KV, 1, 0)
+	checkKeyCount(t, db, LIST, 1, 0)
+	checkKeyCount(t, db, HASH, 0, 0)
+	checkKeyCount(t, db, ZSET, 1, 0)
+
+	if n, _, err := testLedis.KeyCount(4, LIST); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	// drop the counters and rebuild them
+	db.Expire([]byte("b"), 100)
+	for _, tp := range keyspaceScanTypes {
+		testLedis.ldb.Delete(encodeKeyCountKey(db.indexVarBuf, keyCountMeta, tp))
+		testLedis.ldb.Delete(encodeKeyCountKey(db.indexVarBuf, expCountMeta, tp))
+	}
+
+	checkKeyCount(t, db, KV, 0, 0)
+
+	if err := testLedis.RepairKeyCount(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkKeyCount(t, db, KV, 1, 1)
+	checkKeyCount(t, db, LIST, 1, 0)
+	checkKeyCount(t, db, SET, 1, 0)
+	checkKeyCount(t, db, ZSET, 1, 0)
+
+	db.FlushAll()
+
+	if n, err := db.DBSize(); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	checkKeyCount(t, db, KV, 0, 0)
+}
+
+func TestKeyCountReadByCommand(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(5)
+	db.FlushAll()
+
+	// the commands which read the keys before writing them
+	db.Incr([]byte("a"))
+	checkKeyCount(t, db, KV, 1, 0)
+	db.Incr([]byte("a"))
+	checkKeyCount(t, db, KV, 1, 0)
+	db.GetSet([]byte("b"), []byte("1"))
+	db.SetNX([]byte("b"), []byte("2"))
+	db.SetNX([]byte("c"), []byte("2"))
+	db.Append([]byte("d"), []byte("1"))
+	db.SetRange([]byte("d"), 2, []byte("1"))
+	db.SetBit([]byte("e"), 3, 1)
+	db.Expire([]byte("a"), 100)
+	db.Persist([]byte("a"))
+	db.Expire([]byte("b"), 100)
+
+	db.RPush([]byte("a"), []byte("1"), []byte("2"))
+	db.LPop([]byte("a"))
+	db.LPop([]byte("a"))
+	db.RPush([]byte("b"), []byte("1"), []byte("2"))
+	db.LTrim([]byte("b"), 0, 0)
+	db.HSet([]byte("a"), []byte("f"), []byte("1"))
+	db.HIncrBy([]byte("b"), []byte("f"), 1)
+	db.HDel([]byte("a"), []byte("f"))
+	db.SAdd([]byte("a"), []byte("1"))
+	db.SRem([]byte("a"), []byte("1"))
+	db.SAdd([]byte("b"), []byte("1"))
+	db.ZAdd([]byte("a"), ScorePair{1, []byte("1")})
+	db.ZIncrBy([]byte("b"), 1, []byte("1"))
+	db.ZRem([]byte("a"), []byte("1"))
+
+	checkKeyCount(t, db, KV, 5, 1)
+	checkKeyCount(t, db, LIST, 1, 0)
+	checkKeyCount(t, db, HASH, 1, 0)
+	checkKeyCount(t, db, SET, 1, 0)
+	checkKeyCount(t, db, ZSET, 1, 0)
+
+	// the counters match the keys
+	for _, tp := range keyspaceScanTypes {
+		n := testLedis.countRange(db.indexVarBuf, []byte{tp}, []byte{tp + 1})
+		if m, _, err := testLedis.keyCount(db.indexVarBuf, tp); err != nil {
+			t.Fatal(err)
+		} else if n != m {
+			t.Fatalf("type %d keys %d != %d", tp, m, n)
+		}
+	}
+}
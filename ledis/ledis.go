@@ -1,6 +1,7 @@
 package ledis
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,8 +12,10 @@ import (
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/rpl"
 	"github.com/ledisdb/ledisdb/store"
+	"github.com/ledisdb/ledisdb/store/encrypted"
 	"github.com/siddontang/go/filelock"
 	"github.com/siddontang/go/log"
+	"github.com/siddontang/go/sync2"
 )
 
 // Ledis is the core structure to handle the database.
@@ -21,8 +24,21 @@ type Ledis struct {
 
 	ldb *store.DB
 
+	// the keys to encrypt the dumps, nil if no encryption
+	ks *encrypted.Keys
+
 	dbLock sync.Mutex
-	dbs    map[int]*DB
+	dbs    map[int]*DB //key is the slot of database
+
+	//for swapping and async flushing
+	slots        []int
+	reclaimSlots map[int]bool
+	reclaimCh    chan struct{}
+	dbVersion    sync2.AtomicInt64
+
+	//for the garbage collector of the cleared keys
+	gcCh    chan struct{}
+	gcSlots map[int]bool
 
 	quit chan struct{}
 	wg   sync.WaitGroup
@@ -34,9 +50,21 @@ type Ledis struct {
 	rDoneCh chan struct{}
 	rhs     []NewLogEventHandler
 
+	//for the delayed slave, rHeld is set if the next log is paused or not old enough
+	rHeld sync2.AtomicBool
+
+	//for consensus
+	consensus    Consensus
+	cbatch       *store.WriteBatch
+	appliedIndex sync2.AtomicInt64
+
 	wLock      sync.RWMutex //allow one write at same time
 	commitLock sync.Mutex   //allow one write commit at same time
 
+	keyCountLock sync.Mutex //serialize the key counters updating
+
+	mergeLocks [mergeLockNum]sync.Mutex //serialize the merges of the same key
+
 	lock io.Closer
 
 	ttlCheckers  []*ttlChecker
@@ -49,6 +77,11 @@ func Open(cfg *config.Config) (*Ledis, error) {
 		cfg.DataDir = config.DefaultDataDir
 	}
 
+	// the delayed logs must not expire before they are applied
+	if cfg.UseReplication && cfg.Replication.ApplyDelay > cfg.Replication.ExpiredLogDays*24*3600 {
+		return nil, fmt.Errorf("apply delay %ds is above the expired log days %d", cfg.Replication.ApplyDelay, cfg.Replication.ExpiredLogDays)
+	}
+
 	if cfg.Databases == 0 {
 		cfg.Databases = 16
 	} else if cfg.Databases > MaxDatabases {
@@ -67,11 +100,31 @@ func Open(cfg *config.Config) (*Ledis, error) {
 	}
 
 	l.quit = make(chan struct{})
+	l.reclaimCh = make(chan struct{}, 1)
+	l.gcCh = make(chan struct{}, 1)
+	l.gcSlots = make(map[int]bool)
+
+	if len(cfg.Encryption.KeyFile) > 0 {
+		if l.ks, err = encrypted.LoadKeys(cfg.Encryption.KeyFile); err != nil {
+			return nil, err
+		}
+	}
 
 	if l.ldb, err = store.Open(cfg); err != nil {
 		return nil, err
 	}
 
+	if err = l.setCodec(l.ldb); err != nil {
+		l.ldb.Close()
+		return nil, err
+	}
+
+	l.dbs = make(map[int]*DB, 16)
+
+	if err = l.loadDBSlots(); err != nil {
+		return nil, err
+	}
+
 	if cfg.UseReplication {
 		if l.r, err = rpl.NewReplication(cfg); err != nil {
 			return nil, err
@@ -91,10 +144,24 @@ func Open(cfg *config.Config) (*Ledis, error) {
 		l.r = nil
 	}
 
-	l.dbs = make(map[int]*DB, 16)
+	if len(cfg.Archive.Path) > 0 {
+		if l.r == nil {
+			l.Close()
+			return nil, errors.New("archive needs the replication")
+		}
+
+		l.wg.Add(1)
+		go l.onArchive()
+	}
 
 	l.checkTTL()
 
+	l.wg.Add(1)
+	go l.onReclaimDBSlots()
+
+	l.wg.Add(1)
+	go l.onGC()
+
 	return l, nil
 }
 
@@ -118,20 +185,21 @@ func (l *Ledis) Close() {
 
 // Select chooses a database.
 func (l *Ledis) Select(index int) (*DB, error) {
-	if index < 0 || index >= l.cfg.Databases {
-		return nil, fmt.Errorf("invalid db index %d, must in [0, %d]", index, l.cfg.Databases-1)
+	if err := l.checkDBIndex(index); err != nil {
+		return nil, err
 	}
 
 	l.dbLock.Lock()
 	defer l.dbLock.Unlock()
 
-	db, ok := l.dbs[index]
+	slot := l.slots[index]
+	db, ok := l.dbs[slot]
 	if ok {
 		return db, nil
 	}
 
-	db = l.newDB(index)
-	l.dbs[index] = db
+	db = l.newDB(index, slot)
+	l.dbs[slot] = db
 
 	go func(db *DB) {
 		l.ttlCheckerCh <- db.ttlChecker
@@ -145,24 +213,69 @@ func (l *Ledis) FlushAll() error {
 	l.wLock.Lock()
 	defer l.wLock.Unlock()
 
+	if l.consensus != nil {
+		return l.consensus.Commit([]byte{consensusFlushAll})
+	}
+
 	return l.flushAll()
 }
 
 func (l *Ledis) flushAll() error {
+	if err := l.deleteAllKeys(); err != nil {
+		log.Fatalf("flush all commit error: %s", err.Error())
+		return err
+	}
+
+	//the codec meta is deleted with all the keys
+	if err := l.ldb.SaveCodecMeta(); err != nil {
+		log.Fatalf("flush all save codec meta error: %s", err.Error())
+		return err
+	}
+
+	if l.r != nil {
+		if err := l.r.Clear(); err != nil {
+			log.Fatalf("flush all replication clear error: %s", err.Error())
+			return err
+		}
+	}
+
+	//all the databases are mapped to the default slots again
+	l.reloadDBSlots()
+
+	return nil
+}
+
+// deleteAllKeys deletes all the keys in the store, with one range deletion
+// if the store supports it natively.
+func (l *Ledis) deleteAllKeys() error {
 	it := l.ldb.NewIterator()
 	defer it.Close()
 
-	it.SeekToFirst()
-
 	w := l.ldb.NewWriteBatch()
 	defer w.Rollback()
 
+	if l.ldb.SupportDeleteRange() {
+		it.SeekToFirst()
+		if !it.Valid() {
+			return nil
+		}
+		start := it.Key()
+
+		it.SeekToLast()
+		// the end key is exclusive
+		end := append(it.Key(), 0)
+
+		w.DeleteRange(start, end)
+		return w.Commit()
+	}
+
+	it.SeekToFirst()
+
 	n := 0
 	for ; it.Valid(); it.Next() {
 		n++
 		if n == 10000 {
 			if err := w.Commit(); err != nil {
-				log.Fatalf("flush all commit error: %s", err.Error())
 				return err
 			}
 			n = 0
@@ -170,19 +283,7 @@ func (l *Ledis) flushAll() error {
 		w.Delete(it.RawKey())
 	}
 
-	if err := w.Commit(); err != nil {
-		log.Fatalf("flush all commit error: %s", err.Error())
-		return err
-	}
-
-	if l.r != nil {
-		if err := l.r.Clear(); err != nil {
-			log.Fatalf("flush all replication clear error: %s", err.Error())
-			return err
-		}
-	}
-
-	return nil
+	return w.Commit()
 }
 
 // IsReadOnly returns whether Ledis is read only or not.
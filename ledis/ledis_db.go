@@ -12,6 +12,7 @@ import (
 type ibucket interface {
 	Get(key []byte) ([]byte, error)
 	GetSlice(key []byte) (store.Slice, error)
+	MultiGet(keys [][]byte) ([][]byte, error)
 
 	Put(key []byte, value []byte) error
 	Delete(key []byte) error
@@ -34,9 +35,13 @@ type DB struct {
 
 	bucket ibucket
 
+	// the logical index, -1 if the slot is flushed asynchronously and not used
+	// any more. It never changes, the handle is replaced after swapping or async
+	// flushing, and the writes of the old handle fail with ErrDBSwapped.
 	index int
 
-	// buffer to store index varint
+	// the slot and the buffer to store slot varint, the slot never changes
+	slot        int
 	indexVarBuf []byte
 
 	kvBatch   *batch
@@ -51,9 +56,12 @@ type DB struct {
 	ttlChecker *ttlChecker
 
 	lbkeys *lBlockKeys
+
+	// called with the log ID of every commit of the handle, see Track
+	onCommit func(logID uint64)
 }
 
-func (l *Ledis) newDB(index int) *DB {
+func (l *Ledis) newDB(index int, slot int) *DB {
 	d := new(DB)
 
 	d.l = l
@@ -63,7 +71,9 @@ func (l *Ledis) newDB(index int) *DB {
 	d.bucket = d.sdb
 
 	//	d.status = DBAutoCommit
-	d.setIndex(index)
+	d.setIndex(slot)
+	d.index = index
+	d.slot = slot
 
 	d.kvBatch = d.newBatch()
 	d.listBatch = d.newBatch()
@@ -74,19 +84,81 @@ func (l *Ledis) newDB(index int) *DB {
 
 	d.lbkeys = newLBlockKeys()
 
+	// the expired keys are deleted in the slot whatever the database is
 	d.ttlChecker = d.newTTLChecker()
 
+	d.bindBatches()
+
+	return d
+}
+
+// remap returns a new handle of the slot which is mapped to the database index now.
+func (db *DB) remap(index int) *DB {
+	d := new(DB)
+	*d = *db
+	d.index = index
+
+	d.bindBatches()
+
+	return d
+}
+
+// Track returns the handle of the database which calls onCommit with the replication
+// log ID of every write committed by it, 0 if no replication, like the last write of
+// a connection.
+func (db *DB) Track(onCommit func(logID uint64)) *DB {
+	d := new(DB)
+	*d = *db
+	d.onCommit = onCommit
+
+	d.bindBatches()
+
 	return d
 }
 
+// committed calls onCommit with the log ID of the commit, 0 if no replication.
+func (db *DB) committed(logID uint64) {
+	if db.onCommit != nil {
+		db.onCommit(logID)
+	}
+}
+
+// bindBatches makes the batches of the handle check the databases mapping at commit,
+// they share the write batches and locks with the other handles of the slot.
+func (db *DB) bindBatches() {
+	db.kvBatch = db.kvBatch.bind(db)
+	db.listBatch = db.listBatch.bind(db)
+	db.hashBatch = db.hashBatch.bind(db)
+	db.zsetBatch = db.zsetBatch.bind(db)
+	db.setBatch = db.setBatch.bind(db)
+}
+
+// checkSlot returns ErrDBSwapped if the database of the handle is mapped to another slot,
+// it must be called with wLock held, so the mapping can't be changed until the commit.
+func (db *DB) checkSlot() error {
+	if db.index < 0 {
+		return ErrDBSwapped
+	}
+
+	db.l.dbLock.Lock()
+	slot := db.l.slots[db.index]
+	db.l.dbLock.Unlock()
+
+	if slot != db.slot {
+		return ErrDBSwapped
+	}
+
+	return nil
+}
+
 func decodeDBIndex(buf []byte) (int, int, error) {
 	index, n := binary.Uvarint(buf)
 	if n == 0 {
 		return 0, 0, fmt.Errorf("buf is too small to save index")
 	} else if n < 0 {
 		return 0, 0, fmt.Errorf("value larger than 64 bits")
-	} else if index > uint64(MaxDatabases) {
-		return 0, 0, fmt.Errorf("value %d is larger than max databases %d", index, MaxDatabases)
+	} else if index > uint64(maxDBSlots) {
+		return 0, 0, fmt.Errorf("value %d is larger than max database slots %d", index, maxDBSlots)
 	}
 	return int(index), n, nil
 }
@@ -128,12 +200,12 @@ func (db *DB) newTTLChecker() *ttlChecker {
 }
 
 func (db *DB) newBatch() *batch {
-	return db.l.newBatch(db.bucket.NewWriteBatch(), &dbBatchLocker{l: &sync.Mutex{}, wrLock: &db.l.wLock})
+	return db.l.newBatch(db.bucket.NewWriteBatch(), &dbBatchLocker{l: &sync.RWMutex{}, wrLock: &db.l.wLock})
 }
 
 // Index gets the index of database.
 func (db *DB) Index() int {
-	return int(db.index)
+	return db.index
 }
 
 // func (db *DB) IsAutoCommit() bool {
@@ -142,6 +214,10 @@ func (db *DB) Index() int {
 
 // FlushAll flushes the data.
 func (db *DB) FlushAll() (drop int64, err error) {
+	if db.l.ldb.SupportDeleteRange() {
+		return db.flushRange()
+	}
+
 	all := [...](func() (int64, error)){
 		db.flush,
 		db.lFlush,
@@ -162,6 +238,48 @@ func (db *DB) FlushAll() (drop int64, err error) {
 	return
 }
 
+// flushRange deletes all the keys of the database in one commit with the range
+// deletion, except the key mapping the database slot.
+func (db *DB) flushRange() (drop int64, err error) {
+	l := db.l
+	if l.IsReadOnly() {
+		return 0, ErrWriteInROnly
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	if err := db.checkSlot(); err != nil {
+		return 0, err
+	}
+
+	for _, tp := range []byte{KVType, LMetaType, HSizeType, ZSizeType, SSizeType} {
+		n, _, err := l.keyCount(db.indexVarBuf, tp)
+		if err != nil {
+			return 0, err
+		}
+		drop += n
+	}
+
+	slot, _, _ := decodeDBIndex(db.indexVarBuf)
+	min, max := encodeDBSlotRange(slot)
+	sk := encodeDBSlotKey(slot)
+
+	wb := l.ldb.NewWriteBatch()
+	defer wb.Close()
+
+	wb.DeleteRange(min, sk)
+	wb.DeleteRange(append(sk, 0), max)
+
+	logID, err := l.handleCommit(wb, wb)
+	if err != nil {
+		return 0, err
+	}
+	db.committed(logID)
+
+	return drop, nil
+}
+
 func (db *DB) flushType(t *batch, dataType byte) (drop int64, err error) {
 	var deleteFunc func(t *batch, key []byte) int64
 	var metaDataType byte
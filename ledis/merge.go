@@ -0,0 +1,99 @@
+package ledis
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/siddontang/go/num"
+)
+
+// mergeLockNum is the number of the locks for the merged keys, the keys with
+// the same hash share one lock.
+const mergeLockNum = 256
+
+/*
+If merge_counter is enabled and the store supports the merge operator, the increments of
+the existing integers are merged blindly instead of read, added and put under the batch lock:
+
+	the batch lock is held shared, so the merges run together, but not with the other
+	writes of the data type, so the key or the field can't be created, deleted or set
+	meanwhile, and whether it exists is checked before merging
+
+	the key or the field must exist, otherwise the key counter or the hash size must be
+	updated, so the caller increases it under the batch lock as before
+
+	the merge doesn't depend on the value, the value is read once after the merge is
+	committed for the reply, the key lock is held from merging to reading, so the reply
+	is the merged value of this increment, and a value not an integer is never changed
+	by the merge operator, it is replied with the error after the merge
+*/
+
+// mergeIncr increases the integer in the store key returned by encodeKey with the merge operator,
+// encodeKey is called with the batch lock held and returns nil if the key doesn't exist.
+// It returns false if the merge is not used, then the caller must increase it under the batch lock.
+func (db *DB) mergeIncr(t *batch, encodeKey func() ([]byte, error), delta int64) (int64, bool, error) {
+	if !db.l.cfg.MergeCounter || !db.l.ldb.SupportMerge() {
+		return 0, false, nil
+	}
+
+	locker, ok := t.Locker.(*dbBatchLocker)
+	if !ok {
+		return 0, false, nil
+	}
+
+	if db.l.cfg.GetReadonly() {
+		return 0, true, ErrWriteInROnly
+	}
+
+	locker.RLock()
+	defer locker.RUnlock()
+
+	if t.db != nil {
+		if err := t.db.checkSlot(); err != nil {
+			return 0, true, err
+		}
+	}
+
+	ek, err := encodeKey()
+	if err != nil {
+		return 0, true, err
+	} else if ek == nil {
+		return 0, false, nil
+	}
+
+	// only whether it exists, the value is not used
+	if v, err := db.bucket.GetSlice(ek); err != nil {
+		return 0, true, err
+	} else if v == nil {
+		return 0, false, nil
+	} else {
+		v.Free()
+	}
+
+	lock := db.l.mergeLock(ek)
+	lock.Lock()
+	defer lock.Unlock()
+
+	wb := db.bucket.NewWriteBatch()
+	defer wb.Close()
+
+	wb.Merge(ek, num.FormatInt64ToSlice(delta))
+	logID, err := db.l.handleCommit(wb, wb)
+	if err != nil {
+		return 0, true, err
+	}
+	db.committed(logID)
+
+	n, err := StrInt64(db.bucket.Get(ek))
+	if err != nil {
+		return 0, true, err
+	}
+	return n, true, nil
+}
+
+// mergeLock returns the lock of the merged store key.
+func (l *Ledis) mergeLock(ek []byte) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write(ek)
+	return &l.mergeLocks[h.Sum32()%mergeLockNum]
+}
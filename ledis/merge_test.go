@@ -0,0 +1,149 @@
+package ledis
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ledisdb/ledisdb/config"
+)
+
+func TestMergeCounter(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_ledis_merge/master"
+	cfg.DBName = "pebble"
+	cfg.MergeCounter = true
+	cfg.UseReplication = true
+
+	os.RemoveAll(cfg.DataDir)
+
+	l, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	db, _ := l.Select(0)
+
+	key := []byte("merge_counter_key")
+	hkey := []byte("merge_counter_hash")
+	field := []byte("field")
+
+	// the first increments create the key and the field without merging
+	if n, err := db.Incr(key); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := db.HIncrBy(hkey, field, 1); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	// the replies of the concurrent increments are unique
+	var replies sync.Map
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if n, err := db.IncrBy(key, 2); err != nil {
+					t.Error(err)
+					return
+				} else if _, ok := replies.LoadOrStore(n, true); ok {
+					t.Errorf("duplicated reply %d", n)
+					return
+				}
+				if _, err := db.HIncrBy(hkey, field, -1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, err := db.Get(key); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "2001" {
+		t.Fatal(string(v))
+	}
+
+	if n, err := db.HIncrBy(hkey, field, 0); err != nil {
+		t.Fatal(err)
+	} else if n != -999 {
+		t.Fatal(n)
+	}
+
+	if n := l.StoreStat().MergeNum.Get(); n < 2000 {
+		t.Fatal(n)
+	}
+
+	if n, err := db.HIncrBy(hkey, []byte("field2"), 1); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := db.HLen(hkey); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatal(n)
+	}
+
+	if n, err := db.DBSize(); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatal(n)
+	}
+
+	db.Set(key, []byte("abc"))
+	if _, err := db.Incr(key); err == nil {
+		t.Fatal("must error for the value not an integer")
+	}
+
+	// the merges are replayed in the slave without the merge operator
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_ledis_merge/slave"
+	cfgS.DBName = "goleveldb"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	var buf bytes.Buffer
+	var n int
+	var id uint64 = 1
+	for {
+		buf.Reset()
+		n, id, err = l.ReadLogsTo(id, &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			break
+		}
+
+		if err = slave.StoreLogsFromReader(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slave.WaitReplication()
+
+	if err = checkLedisEqual(l, slave); err != nil {
+		t.Fatal(err)
+	} else if err = checkLedisEqual(slave, l); err != nil {
+		t.Fatal(err)
+	}
+}
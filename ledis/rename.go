@@ -0,0 +1,286 @@
+package ledis
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ledisdb/ledisdb/store"
+)
+
+// the data types a key can exist in, as saved in the expire keys
+var keyDataTypes = []byte{KVType, ListType, HashType, ZSetType, SetType}
+
+func (db *DB) encodeKeyMetaKey(dataType byte, key []byte) []byte {
+	switch dataType {
+	case KVType:
+		return db.encodeKVKey(key)
+	case ListType:
+		return db.lEncodeMetaKey(key)
+	case HashType:
+		return db.hEncodeSizeKey(key)
+	case ZSetType:
+		return db.zEncodeSizeKey(key)
+	default:
+		return db.sEncodeSizeKey(key)
+	}
+}
+
+// existTypes returns the data types which the key exists in.
+func (db *DB) existTypes(key []byte) ([]byte, error) {
+	var types []byte
+	for _, tp := range keyDataTypes {
+		v, err := db.bucket.Get(db.encodeKeyMetaKey(tp, key))
+		if err != nil {
+			return nil, err
+		} else if v != nil {
+			types = append(types, tp)
+		}
+	}
+
+	return types, nil
+}
+
+func (db *DB) deleteKey(t *batch, dataType byte, key []byte) {
+	switch dataType {
+	case KVType:
+		db.delete(t, key)
+	case ListType:
+		db.lDelete(t, key)
+	case HashType:
+		db.hDelete(t, key)
+	case ZSetType:
+		db.zDelete(t, key)
+	case SetType:
+		db.sDelete(t, key)
+	}
+
+	db.rmExpire(t, dataType, key)
+}
+
+// copyKey re-encodes all the data of the key as newKey in the dst database,
+// the TTL is also copied.
+func (db *DB) copyKey(t *batch, dataType byte, dst *DB, key []byte, newKey []byte) error {
+	mk := db.encodeKeyMetaKey(dataType, key)
+	v, err := db.bucket.Get(mk)
+	if err != nil {
+		return err
+	}
+
+	if dataType == KVType {
+		t.Put(dst.encodeKeyMetaKey(dataType, newKey), v)
+	} else {
+		// the copied data uses a new generation of newKey, so it never mixes
+		// with the old data of newKey deleted in the same batch
+		dstGen, err := dst.newGen(t, dataType)
+		if err != nil {
+			return err
+		}
+
+		v, gen := decodeGenMeta(v)
+		t.Put(dst.encodeKeyMetaKey(dataType, newKey), encodeGenMeta(v, dstGen))
+
+		if err := db.copyKeyData(t, dataType, dst, key, gen, newKey, dstGen); err != nil {
+			return err
+		}
+	}
+
+	when, err := Int64(db.bucket.Get(db.expEncodeMetaKey(dataType, key)))
+	if err != nil {
+		return err
+	} else if when > 0 {
+		dst.expireAt(t, dataType, newKey, when)
+	}
+
+	return nil
+}
+
+// copyKeyData copies the data of key with generation gen as newKey with generation dstGen.
+func (db *DB) copyKeyData(t *batch, dataType byte, dst *DB, key []byte, gen uint64, newKey []byte, dstGen uint64) error {
+	switch dataType {
+	case ListType:
+		headSeq, tailSeq, _, _, err := db.lGetMeta(nil, db.lEncodeMetaKey(key))
+		if err != nil {
+			return err
+		}
+
+		it := db.bucket.RangeIterator(db.lEncodeListKey(key, gen, headSeq), db.lEncodeListKey(key, gen, tailSeq), store.RangeClose)
+		for ; it.Valid(); it.Next() {
+			_, seq, err := db.lDecodeListKey(it.Key())
+			if err != nil {
+				it.Close()
+				return err
+			}
+			t.Put(dst.lEncodeListKey(newKey, dstGen, seq), it.Value())
+		}
+		it.Close()
+	case HashType:
+		it := db.bucket.RangeIterator(db.hEncodeStartKey(key, gen), db.hEncodeStopKey(key, gen), store.RangeROpen)
+		for ; it.Valid(); it.Next() {
+			_, field, err := db.hDecodeHashKey(it.Key())
+			if err != nil {
+				it.Close()
+				return err
+			}
+			t.Put(dst.hEncodeHashKey(newKey, dstGen, field), it.Value())
+		}
+		it.Close()
+	case ZSetType:
+		it := db.bucket.RangeIterator(db.zEncodeStartSetKey(key, gen), db.zEncodeStopSetKey(key, gen), store.RangeROpen)
+		for ; it.Valid(); it.Next() {
+			_, member, err := db.zDecodeSetKey(it.Key())
+			if err != nil {
+				it.Close()
+				return err
+			}
+
+			score, err := Int64(it.Value(), nil)
+			if err != nil {
+				it.Close()
+				return err
+			}
+
+			t.Put(dst.zEncodeSetKey(newKey, dstGen, member), it.Value())
+			t.Put(dst.zEncodeScoreKey(newKey, dstGen, member, score), []byte{})
+		}
+		it.Close()
+	case SetType:
+		it := db.bucket.RangeIterator(db.sEncodeStartKey(key, gen), db.sEncodeStopKey(key, gen), store.RangeROpen)
+		for ; it.Valid(); it.Next() {
+			_, member, err := db.sDecodeSetKey(it.Key())
+			if err != nil {
+				it.Close()
+				return err
+			}
+			t.Put(dst.sEncodeSetKey(newKey, dstGen, member), it.Value())
+		}
+		it.Close()
+	}
+
+	return nil
+}
+
+// copyKeys copies the key of all data types as newKey in the dst database in one batch,
+// and deletes the key if del is true. If replace is false and newKey exists
+// in any data type, nothing is done and 0 is returned.
+func (db *DB) copyKeys(dst *DB, key []byte, newKey []byte, replace bool, del bool) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	} else if err := checkKeySize(newKey); err != nil {
+		return 0, err
+	}
+
+	// all the other writes must wait, because we change the keys of many data types
+	// and maybe in two databases.
+	db.l.wLock.Lock()
+	defer db.l.wLock.Unlock()
+
+	if err := db.checkSlot(); err != nil {
+		return 0, err
+	} else if err := dst.checkSlot(); err != nil {
+		return 0, err
+	}
+
+	types, err := db.existTypes(key)
+	if err != nil {
+		return 0, err
+	} else if len(types) == 0 {
+		return 0, ErrNoSuchKey
+	}
+
+	dstTypes, err := dst.existTypes(newKey)
+	if err != nil {
+		return 0, err
+	} else if len(dstTypes) > 0 && !replace {
+		return 0, nil
+	}
+
+	wb := db.bucket.NewWriteBatch()
+	defer wb.Close()
+
+	t := db.l.newBatch(wb, &sync.Mutex{})
+	t.db = db
+	t.Lock()
+	defer t.Unlock()
+
+	// delete first, so the new data put later will override the deleted
+	for _, tp := range dstTypes {
+		dst.deleteKey(t, tp, newKey)
+	}
+
+	for _, tp := range types {
+		if err := db.copyKey(t, tp, dst, key, newKey); err != nil {
+			return 0, err
+		}
+
+		if del {
+			db.deleteKey(t, tp, key)
+		}
+	}
+
+	if err := t.Commit(); err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+func (db *DB) isSameKey(dst *DB, key []byte, newKey []byte) bool {
+	return db == dst && bytes.Equal(key, newKey)
+}
+
+// Rename renames the key of all data types to newKey, newKey is overwritten if exists.
+func (db *DB) Rename(key []byte, newKey []byte) error {
+	if db.isSameKey(db, key, newKey) {
+		if types, err := db.existTypes(key); err != nil {
+			return err
+		} else if len(types) == 0 {
+			return ErrNoSuchKey
+		}
+		return nil
+	}
+
+	_, err := db.copyKeys(db, key, newKey, true, true)
+	return err
+}
+
+// RenameNX renames the key of all data types to newKey only if newKey does not exist.
+func (db *DB) RenameNX(key []byte, newKey []byte) (int64, error) {
+	if db.isSameKey(db, key, newKey) {
+		if types, err := db.existTypes(key); err != nil {
+			return 0, err
+		} else if len(types) == 0 {
+			return 0, ErrNoSuchKey
+		}
+		return 0, nil
+	}
+
+	return db.copyKeys(db, key, newKey, false, true)
+}
+
+// Copy copies the key of all data types as newKey in the dst database.
+// If replace is false and newKey exists, 0 is returned.
+func (db *DB) Copy(key []byte, dst *DB, newKey []byte, replace bool) (int64, error) {
+	if db.isSameKey(dst, key, newKey) {
+		return 0, ErrSameObject
+	}
+
+	n, err := db.copyKeys(dst, key, newKey, replace, false)
+	if err == ErrNoSuchKey {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Move moves the key of all data types to the dst database.
+// If the key exists in dst, 0 is returned.
+func (db *DB) Move(key []byte, dst *DB) (int64, error) {
+	if db == dst {
+		return 0, ErrSameObject
+	}
+
+	n, err := db.copyKeys(dst, key, key, false, true)
+	if err == ErrNoSuchKey {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,127 @@
+package ledis
+
+import (
+	"testing"
+)
+
+func TestDBRename(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(5)
+	db.FlushAll()
+
+	key := []byte("rename_a")
+	newKey := []byte("rename_b")
+
+	db.Set(key, []byte("1"))
+	db.Expire(key, 100)
+	db.RPush(key, []byte("1"), []byte("2"), []byte("3"))
+	db.LPop(key)
+	db.HSet(key, []byte("f"), []byte("v"))
+	db.ZAdd(key, ScorePair{1, []byte("m1")}, ScorePair{2, []byte("m2")})
+	db.ZExpire(key, 100)
+	db.SAdd(key, []byte("m"))
+
+	db.Set(newKey, []byte("old"))
+	db.HSet(newKey, []byte("old"), []byte("v"))
+
+	if err := db.Rename(key, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if types, _ := db.existTypes(key); len(types) != 0 {
+		t.Fatal(types)
+	}
+
+	if v, _ := db.Get(newKey); string(v) != "1" {
+		t.Fatal(string(v))
+	} else if n, _ := db.TTL(newKey); n <= 0 {
+		t.Fatal(n)
+	}
+
+	if v, _ := db.LRange(newKey, 0, -1); len(v) != 2 || string(v[0]) != "2" {
+		t.Fatal(v)
+	}
+
+	if v, _ := db.HGetAll(newKey); len(v) != 1 || string(v[0].Field) != "f" {
+		t.Fatal(v)
+	}
+
+	if v, _ := db.ZRangeByScore(newKey, 0, 10, 0, -1); len(v) != 2 || string(v[1].Member) != "m2" {
+		t.Fatal(v)
+	} else if n, _ := db.ZScore(newKey, []byte("m1")); n != 1 {
+		t.Fatal(n)
+	} else if n, _ := db.ZTTL(newKey); n <= 0 {
+		t.Fatal(n)
+	}
+
+	if n, _ := db.SIsMember(newKey, []byte("m")); n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, _ := db.DBSize(); n != 5 {
+		t.Fatal(n)
+	}
+
+	if err := db.Rename(key, newKey); err != ErrNoSuchKey {
+		t.Fatal(err)
+	}
+
+	if err := db.Rename(newKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Set(key, []byte("2"))
+	if n, err := db.RenameNX(key, newKey); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	db1, _ := testLedis.Select(6)
+	db1.FlushAll()
+
+	if n, err := db.Copy(newKey, db1, key, false); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, _ := db1.HLen(key); n != 1 {
+		t.Fatal(n)
+	} else if n, _ := db.HLen(newKey); n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := db.Copy(newKey, db1, key, false); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if _, err := db.Copy(newKey, db, newKey, true); err != ErrSameObject {
+		t.Fatal(err)
+	}
+
+	if n, err := db.Move(key, db1); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	db1.FlushAll()
+	if n, err := db.Move(key, db1); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if v, _ := db1.Get(key); string(v) != "2" {
+		t.Fatal(string(v))
+	} else if v, _ := db.Get(key); v != nil {
+		t.Fatal(string(v))
+	}
+
+	if n, _ := db1.DBSize(); n != 1 {
+		t.Fatal(n)
+	}
+}
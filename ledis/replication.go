@@ -3,6 +3,7 @@ package ledis
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -19,6 +20,8 @@ const (
 // For replication error.
 var (
 	ErrLogMissed = errors.New("log is pured in server")
+
+	ErrReplicationHeld = errors.New("the received logs are held by the apply delay or the pause")
 )
 
 // ReplicationUsed returns whether replication is used or not.
@@ -26,12 +29,22 @@ func (l *Ledis) ReplicationUsed() bool {
 	return l.r != nil
 }
 
-func (l *Ledis) handleReplication() error {
+// handleReplication applies the received logs, and returns the time to wait
+// if the next log is not old enough for the apply delay.
+func (l *Ledis) handleReplication() (time.Duration, error) {
 	l.wLock.Lock()
 	defer l.wLock.Unlock()
 
 	defer AsyncNotify(l.rDoneCh)
 
+	return l.applyReplication(false)
+}
+
+// applyReplication applies the received logs before the pause log ID, the logs not
+// old enough for the apply delay too if force is true. The wLock must be held.
+func (l *Ledis) applyReplication(force bool) (time.Duration, error) {
+	l.rHeld.Set(false)
+
 	rl := &rpl.Log{}
 
 	var err error
@@ -39,27 +52,33 @@ func (l *Ledis) handleReplication() error {
 		if err = l.r.NextNeedCommitLog(rl); err != nil {
 			if err != rpl.ErrNoBehindLog {
 				log.Errorf("get next commit log err, %s", err.Error())
-				return err
+				return 0, err
 			}
 
-			return nil
+			return 0, nil
+		}
+
+		if id := l.r.PauseID(); id > 0 && rl.ID >= id {
+			l.rHeld.Set(true)
+			return 0, nil
+		}
+
+		if d := l.applyDelay(rl); d > 0 && !force {
+			l.rHeld.Set(true)
+			return d, nil
 		}
 
 		l.rbatch.Rollback()
 
-		if rl.Compression == 1 {
-			//todo optimize
-			if rl.Data, err = snappy.Decode(nil, rl.Data); err != nil {
-				log.Errorf("decode log error %s", err.Error())
-				return err
-			}
+		sr := newDBSlotReplay(l.rbatch)
+		if l.slaveCountsKeys() {
+			sr.counted = make(map[string]bool)
 		}
 
-		if bd, err := store.NewBatchData(rl.Data); err != nil {
-			log.Errorf("decode batch log error %s", err.Error())
-			return err
-		} else if err = bd.Replay(l.rbatch); err != nil {
-			log.Errorf("replay batch log error %s", err.Error())
+		if err := replayLog(sr, rl); err != nil {
+			return 0, err
+		} else if err := l.replayKeyCount(sr); err != nil {
+			return 0, err
 		}
 
 		l.commitLock.Lock()
@@ -71,9 +90,43 @@ func (l *Ledis) handleReplication() error {
 
 		l.commitLock.Unlock()
 		if err != nil {
+			return 0, err
+		}
+
+		l.replayDBSlots(sr)
+	}
+}
+
+// applyDelay returns the time until the log is old enough to be applied by the delayed slave.
+func (l *Ledis) applyDelay(rl *rpl.Log) time.Duration {
+	if l.cfg.Replication.ApplyDelay <= 0 {
+		return 0
+	}
+
+	due := time.Unix(int64(rl.CreateTime), 0).Add(time.Duration(l.cfg.Replication.ApplyDelay) * time.Second)
+	return time.Until(due)
+}
+
+// replayLog replays the write batch of the log to sr, which records the changed databases mapping.
+func replayLog(sr *dbSlotReplay, rl *rpl.Log) error {
+	var err error
+	if rl.Compression == 1 {
+		//todo optimize
+		if rl.Data, err = snappy.Decode(nil, rl.Data); err != nil {
+			log.Errorf("decode log error %s", err.Error())
 			return err
 		}
 	}
+
+	if bd, err := store.NewBatchData(rl.Data); err != nil {
+		log.Errorf("decode batch log error %s", err.Error())
+		return err
+	} else if err = bd.Replay(sr); err != nil {
+		log.Errorf("replay batch log error %s", err.Error())
+		return err
+	}
+
+	return nil
 }
 
 func (l *Ledis) onReplication() {
@@ -81,17 +134,35 @@ func (l *Ledis) onReplication() {
 
 	l.noticeReplication()
 
+	// the timer to apply the delayed log
+	var t *time.Timer
+	var delayCh <-chan time.Time
+
 	for {
 		select {
 		case <-l.rc:
-			l.handleReplication()
+		case <-delayCh:
 		case <-l.quit:
+			if t != nil {
+				t.Stop()
+			}
 			return
 		}
+
+		if t != nil {
+			t.Stop()
+			t, delayCh = nil, nil
+		}
+
+		if d, _ := l.handleReplication(); d > 0 {
+			t = time.NewTimer(d)
+			delayCh = t.C
+		}
 	}
 }
 
-// WaitReplication waits replication done
+// WaitReplication waits replication done, it returns ErrReplicationHeld if the logs
+// are held by the apply delay or the pause, they are applied later or on the promotion.
 func (l *Ledis) WaitReplication() error {
 	if !l.ReplicationUsed() {
 		return ErrRplNotSupport
@@ -113,13 +184,131 @@ func (l *Ledis) WaitReplication() error {
 			return err
 		} else if !b {
 			return nil
+		} else if l.rHeld.Get() {
+			return ErrReplicationHeld
 		}
 	}
 
 	return errors.New("wait replication too many times")
 }
 
-// StoreLogsFromReader stores logs from the Reader
+// PauseReplication stops applying the received logs from logID, 0 for the next log,
+// so the delayed slave can stop short of a bad log of the master. The logs are still
+// received, and the pause is kept after the restart until ResumeReplication.
+func (l *Ledis) PauseReplication(logID uint64) error {
+	if !l.ReplicationUsed() {
+		return ErrRplNotSupport
+	}
+
+	// every log to apply is after the commit ID, which is at least 0
+	if logID == 0 {
+		logID = 1
+	}
+
+	return l.r.UpdatePauseID(logID)
+}
+
+// ReplicationPauseID returns the log ID from which the logs are not applied, 0 if not paused.
+func (l *Ledis) ReplicationPauseID() uint64 {
+	if !l.ReplicationUsed() {
+		return 0
+	}
+
+	return l.r.PauseID()
+}
+
+// ResumeReplication applies the received logs again after PauseReplication.
+func (l *Ledis) ResumeReplication() error {
+	if !l.ReplicationUsed() {
+		return ErrRplNotSupport
+	}
+
+	if err := l.r.UpdatePauseID(0); err != nil {
+		return err
+	}
+
+	l.noticeReplication()
+	return nil
+}
+
+// SkipReplication skips the received logs before logID without applying them, like the
+// bad logs of the master, the next applied log is logID. The data differs from the
+// master after skipping, the skipped logs are never applied.
+func (l *Ledis) SkipReplication(logID uint64) error {
+	if !l.ReplicationUsed() {
+		return ErrRplNotSupport
+	}
+
+	// no log is being applied
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	commitID, err := l.r.LastCommitID()
+	if err != nil {
+		return err
+	}
+
+	lastID, err := l.r.LastLogID()
+	if err != nil {
+		return err
+	}
+
+	if logID == 0 || logID-1 < commitID {
+		return fmt.Errorf("the logs before %d are applied, commit id is %d", logID, commitID)
+	} else if logID-1 > lastID {
+		return fmt.Errorf("the logs before %d are not received, last log id is %d", logID, lastID)
+	} else if logID-1 == commitID {
+		return nil
+	}
+
+	l.commitLock.Lock()
+	err = l.r.UpdateCommitID(logID - 1)
+	l.commitLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("skip the logs from %d to %d", commitID+1, logID-1)
+
+	l.noticeReplication()
+	return nil
+}
+
+// WaitCommitID waits until the commit ID reaches id or the timeout, no timeout if it is 0,
+// and returns the commit ID, so the slave can serve the reads after the writes with the log id.
+func (l *Ledis) WaitCommitID(id uint64, timeout time.Duration) (uint64, error) {
+	if !l.ReplicationUsed() {
+		return 0, ErrRplNotSupport
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+
+	for {
+		// get the channel before the commit ID, so no update is missed
+		ch := l.r.WaitCommit()
+
+		commitID, err := l.r.LastCommitID()
+		if err != nil || commitID >= id {
+			return commitID, err
+		}
+
+		select {
+		case <-ch:
+		case <-timeoutCh:
+			return commitID, nil
+		case <-l.quit:
+			return commitID, nil
+		}
+	}
+}
+
+// StoreLogsFromReader stores logs from the Reader, and publishes them
+// with the same IDs to the handlers like the slaves of this slave.
 func (l *Ledis) StoreLogsFromReader(rb io.Reader) error {
 	if !l.ReplicationUsed() {
 		return ErrRplNotSupport
@@ -142,6 +331,7 @@ func (l *Ledis) StoreLogsFromReader(rb io.Reader) error {
 			return err
 		}
 
+		l.propagate(log)
 	}
 
 	l.noticeReplication()
@@ -162,6 +352,12 @@ func (l *Ledis) StoreLogsFromData(data []byte) error {
 
 // ReadLogsTo reads logs and write to the Writer.
 func (l *Ledis) ReadLogsTo(startLogID uint64, w io.Writer) (n int, nextLogID uint64, err error) {
+	return l.ReadFilteredLogsTo(startLogID, w, nil)
+}
+
+// ReadFilteredLogsTo reads logs and write to the Writer with the records selected by
+// the filter, nil for all.
+func (l *Ledis) ReadFilteredLogsTo(startLogID uint64, w io.Writer, f *ReplicationFilter) (n int, nextLogID uint64, err error) {
 	if !l.ReplicationUsed() {
 		// no replication log
 		nextLogID = 0
@@ -188,20 +384,33 @@ func (l *Ledis) ReadLogsTo(startLogID uint64, w io.Writer) (n int, nextLogID uin
 
 	nextLogID = startLogID
 
+	kf := l.newKeyFilter(f)
+
 	log := &rpl.Log{}
 	for i := startLogID; i <= lastID; i++ {
 		if err = l.r.GetLog(i, log); err != nil {
 			return
 		}
 
+		// the size before filtering limits the logs read once
+		n += log.Size()
+
+		if kf != nil {
+			if err = kf.filterLog(log); err == ErrReplicationResync && i > startLogID {
+				// send the logs before, the slave gets the error in the next read
+				err = nil
+				break
+			} else if err != nil {
+				return
+			}
+		}
+
 		if err = log.Encode(w); err != nil {
 			return
 		}
 
 		nextLogID = i + 1
 
-		n += log.Size()
-
 		if n > maxReplLogSize {
 			break
 		}
@@ -213,7 +422,12 @@ func (l *Ledis) ReadLogsTo(startLogID uint64, w io.Writer) (n int, nextLogID uin
 // ReadLogsToTimeout tries to read events, if no events read,
 // tres to wait the new event singal until timeout seconds
 func (l *Ledis) ReadLogsToTimeout(startLogID uint64, w io.Writer, timeout int, quitCh chan struct{}) (n int, nextLogID uint64, err error) {
-	n, nextLogID, err = l.ReadLogsTo(startLogID, w)
+	return l.ReadFilteredLogsToTimeout(startLogID, w, timeout, quitCh, nil)
+}
+
+// ReadFilteredLogsToTimeout is ReadLogsToTimeout with the records selected by the filter.
+func (l *Ledis) ReadFilteredLogsToTimeout(startLogID uint64, w io.Writer, timeout int, quitCh chan struct{}, f *ReplicationFilter) (n int, nextLogID uint64, err error) {
+	n, nextLogID, err = l.ReadFilteredLogsTo(startLogID, w, f)
 	if err != nil {
 		return
 	} else if n != 0 {
@@ -226,7 +440,7 @@ func (l *Ledis) ReadLogsToTimeout(startLogID uint64, w io.Writer, timeout int, q
 	case <-quitCh:
 		return
 	}
-	return l.ReadLogsTo(startLogID, w)
+	return l.ReadFilteredLogsTo(startLogID, w, f)
 }
 
 func (l *Ledis) propagate(rl *rpl.Log) {
@@ -257,3 +471,93 @@ func (l *Ledis) ReplicationStat() (*rpl.Stat, error) {
 
 	return l.r.Stat()
 }
+
+// ReplicationID returns the replication ID, the lineage of the logs.
+func (l *Ledis) ReplicationID() (rpl.ID, error) {
+	if !l.ReplicationUsed() {
+		return rpl.ID{}, ErrRplNotSupport
+	}
+
+	return l.r.ID(), nil
+}
+
+// PromoteReplication starts a new replication ID after the slave is promoted to a master.
+// The logs held by the apply delay are applied first, and the logs from the pause log ID
+// are dropped without applying, with all the logs before, so the slaves must load the
+// full data, they may have applied the dropped logs. Replication must be stopped before.
+func (l *Ledis) PromoteReplication() error {
+	if !l.ReplicationUsed() {
+		return ErrRplNotSupport
+	}
+
+	l.wLock.Lock()
+	defer l.wLock.Unlock()
+
+	defer AsyncNotify(l.rDoneCh)
+
+	if _, err := l.applyReplication(true); err != nil {
+		return err
+	}
+
+	if err := l.r.UpdatePauseID(0); err != nil {
+		return err
+	}
+	l.rHeld.Set(false)
+
+	b, err := l.r.CommitIDBehind()
+	if err != nil {
+		return err
+	} else if !b {
+		return l.r.Promote()
+	}
+
+	commitID, err := l.r.LastCommitID()
+	if err != nil {
+		return err
+	}
+
+	lastID, err := l.r.LastLogID()
+	if err != nil {
+		return err
+	}
+
+	// the writes fail with ErrCommitIDBehind until the logs not applied are dropped
+	l.commitLock.Lock()
+	err = l.r.ClearWithCommitID(commitID)
+	l.commitLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("drop the paused logs from %d to %d on the promotion", commitID+1, lastID)
+	return nil
+}
+
+// FollowReplication takes the replication ID of the master, if full is true,
+// the full data of the master selected by the replication filter is loaded and
+// the old ID is dropped.
+func (l *Ledis) FollowReplication(id string, full bool) error {
+	if !l.ReplicationUsed() {
+		return ErrRplNotSupport
+	} else if full {
+		// the key counts of the master are not loaded
+		if l.slaveCountsKeys() {
+			if err := l.recountKeys(); err != nil {
+				return err
+			}
+		}
+		return l.r.Reset(id, l.replicationFilter().String())
+	}
+
+	return l.r.Follow(id)
+}
+
+// CanContinueReplication returns whether the slave with the replication ID and the last
+// log ID can sync the logs after it, otherwise it must load the full data.
+func (l *Ledis) CanContinueReplication(id rpl.ID, lastLogID uint64) (bool, error) {
+	if !l.ReplicationUsed() {
+		return false, ErrRplNotSupport
+	}
+
+	return l.r.CanContinue(id, lastLogID)
+}
@@ -0,0 +1,265 @@
+package ledis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledisdb/ledisdb/rpl"
+	"github.com/ledisdb/ledisdb/store"
+	"github.com/siddontang/go/snappy"
+)
+
+/*
+A slave can receive a part of the data by the replication filter, the master filters
+the logs and the full sync data sent to the slave:
+
+	the puts of the keys in the databases and with the prefixes are kept
+	the deletions are always kept, deleting the keys the slave doesn't have is harmless,
+	and the slots of the async flushed databases are reclaimed on the slave by them
+	the other meta keys of a slot are kept if the slot is of the databases, except the key
+	counts with the prefixes, the slave counts the keys it has itself
+
+The databases are mapped to the slots when the logs are read, so the logs changing the
+mapping, like SWAPDB, can't be filtered, and the slave must load the full data again.
+The slave with a different filter from its last full sync loads the full data too.
+*/
+
+// ErrReplicationResync is returned for the logs which can't be filtered for the slave,
+// the slave must load the full data again.
+var ErrReplicationResync = errors.New("the databases mapping is changed, the filtered slave needs a full sync")
+
+var errFilterKey = errors.New("invalid filter key")
+
+// ReplicationFilter selects the data sent to a slave, the keys must be in one of the
+// databases and have one of the prefixes, any database or key if empty.
+type ReplicationFilter struct {
+	DBs      []int
+	Prefixes [][]byte
+}
+
+// String returns the same text for the filters selecting the same data, empty for all.
+func (f *ReplicationFilter) String() string {
+	if f == nil || (len(f.DBs) == 0 && len(f.Prefixes) == 0) {
+		return ""
+	}
+
+	dbs := make([]string, len(f.DBs))
+	for i, index := range f.DBs {
+		dbs[i] = strconv.Itoa(index)
+	}
+	sort.Strings(dbs)
+
+	prefixes := make([]string, len(f.Prefixes))
+	for i, prefix := range f.Prefixes {
+		prefixes[i] = strconv.Quote(string(prefix))
+	}
+	sort.Strings(prefixes)
+
+	return fmt.Sprintf("dbs=%s prefixes=%s", strings.Join(dbs, ","), strings.Join(prefixes, ","))
+}
+
+// replicationFilter returns the filter of the data received from the master, nil for all.
+func (l *Ledis) replicationFilter() *ReplicationFilter {
+	cfg := &l.cfg.Replication
+	if len(cfg.FilterDBs) == 0 && len(cfg.FilterPrefixes) == 0 {
+		return nil
+	}
+
+	f := &ReplicationFilter{DBs: cfg.FilterDBs}
+	for _, prefix := range cfg.FilterPrefixes {
+		f.Prefixes = append(f.Prefixes, []byte(prefix))
+	}
+	return f
+}
+
+// ReplicationFilterChanged returns whether the replication filter in the config is
+// different from the one of the last full sync, the slave must load the full data again.
+func (l *Ledis) ReplicationFilterChanged() (bool, error) {
+	if !l.ReplicationUsed() {
+		return false, ErrRplNotSupport
+	}
+
+	return l.r.ID().Filter != l.replicationFilter().String(), nil
+}
+
+// slaveCountsKeys returns whether the slave counts the keys itself,
+// the key counts of the master are not replicated with the prefixes.
+func (l *Ledis) slaveCountsKeys() bool {
+	return len(l.cfg.Replication.FilterPrefixes) > 0
+}
+
+// keyFilter is the replication filter with the slots of the databases.
+type keyFilter struct {
+	slots    map[int]bool
+	prefixes [][]byte
+}
+
+// newKeyFilter returns nil if the filter selects all the data.
+func (l *Ledis) newKeyFilter(f *ReplicationFilter) *keyFilter {
+	if f == nil || (len(f.DBs) == 0 && len(f.Prefixes) == 0) {
+		return nil
+	}
+
+	kf := &keyFilter{prefixes: f.Prefixes}
+
+	if len(f.DBs) > 0 {
+		kf.slots = make(map[int]bool, len(f.DBs))
+
+		l.dbLock.Lock()
+		for _, index := range f.DBs {
+			if index >= 0 && index < len(l.slots) {
+				kf.slots[l.slots[index]] = true
+			}
+		}
+		l.dbLock.Unlock()
+	}
+
+	return kf
+}
+
+// match returns whether the key is sent to the slave.
+func (f *keyFilter) match(key []byte) bool {
+	if isDBSlotKey(key) {
+		return true
+	}
+
+	slot, userKey, err := decodeUserKey(key)
+	if err != nil {
+		// keep the unknown keys
+		return true
+	} else if slot >= maxDBSlots {
+		// the meta keys of the whole store, like the codec
+		return true
+	} else if f.slots != nil && !f.slots[slot] {
+		return false
+	} else if len(f.prefixes) == 0 {
+		return true
+	} else if userKey == nil {
+		// the key counts of the master count the keys not sent
+		return !isKeyCountKey(key)
+	}
+
+	for _, prefix := range f.prefixes {
+		if bytes.HasPrefix(userKey, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLog rewrites the batch of the log with the records sent to the slave,
+// the log is kept even if it is empty, so the slave gets all the log IDs.
+// It returns ErrReplicationResync if the log changes the databases mapping.
+func (f *keyFilter) filterLog(rl *rpl.Log) error {
+	var err error
+
+	data := rl.Data
+	if rl.Compression == 1 {
+		if data, err = snappy.Decode(nil, data); err != nil {
+			return err
+		}
+	}
+
+	bd, err := store.NewBatchData(data)
+	if err != nil {
+		return err
+	}
+
+	r := &keyFilterReplay{BatchData: new(store.BatchData), f: f}
+	if err = bd.Replay(r); err != nil {
+		return err
+	} else if r.resync {
+		return ErrReplicationResync
+	}
+
+	data = r.Data()
+	if rl.Compression == 1 {
+		if data, err = snappy.Encode(nil, data); err != nil {
+			return err
+		}
+	}
+
+	rl.Data = data
+	return nil
+}
+
+// keyFilterReplay keeps the deletions and the matched puts of the batch.
+type keyFilterReplay struct {
+	*store.BatchData
+
+	f *keyFilter
+
+	// the databases mapping is changed
+	resync bool
+}
+
+func (r *keyFilterReplay) Put(key []byte, value []byte) {
+	if isDBSlotKey(key) {
+		r.resync = true
+	}
+
+	if r.f.match(key) {
+		r.BatchData.Put(key, value)
+	}
+}
+
+func (r *keyFilterReplay) Merge(key []byte, value []byte) {
+	if r.f.match(key) {
+		r.BatchData.Merge(key, value)
+	}
+}
+
+// decodeUserKey returns the slot of the store key and the user key in it,
+// the user key is nil for the meta keys of the slot.
+func decodeUserKey(k []byte) (int, []byte, error) {
+	slot, pos, err := decodeDBIndex(k)
+	if err != nil {
+		return 0, nil, err
+	} else if pos >= len(k) {
+		return 0, nil, errFilterKey
+	}
+
+	db := new(DB)
+	db.setIndex(slot)
+
+	var key []byte
+
+	switch k[pos] {
+	case MetaType:
+		return slot, nil, nil
+	case KVType:
+		key, err = db.decodeKVKey(k)
+	case HashType:
+		key, _, err = db.hDecodeHashKey(k)
+	case HSizeType:
+		key, err = db.hDecodeSizeKey(k)
+	case ListType:
+		key, _, err = db.lDecodeListKey(k)
+	case LMetaType:
+		key, err = db.lDecodeMetaKey(k)
+	case ZSetType:
+		key, _, err = db.zDecodeSetKey(k)
+	case ZSizeType:
+		key, err = db.zDecodeSizeKey(k)
+	case ZScoreType:
+		key, _, _, err = db.zDecodeScoreKey(k)
+	case SetType:
+		key, _, err = db.sDecodeSetKey(k)
+	case SSizeType:
+		key, err = db.sDecodeSizeKey(k)
+	case ExpTimeType:
+		_, key, _, err = db.expDecodeTimeKey(k)
+	case ExpMetaType:
+		_, key, err = db.expDecodeMetaKey(k)
+	case GCType:
+		_, _, key, _, err = decodeGCKey(k)
+	default:
+		return 0, nil, errFilterKey
+	}
+
+	return slot, key, err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/store"
@@ -106,3 +107,465 @@ func TestReplication(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReplicationDeleteRange(t *testing.T) {
+	// the master deletes ranges natively, and the slave deletes the keys one by one
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_repl_range/master"
+	cfgM.DBName = "pebble"
+	cfgM.UseReplication = true
+
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_repl_range/slave"
+	cfgS.DBName = "goleveldb"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	if !master.ldb.SupportDeleteRange() || slave.ldb.SupportDeleteRange() {
+		t.Fatal("must only support range deletion in master")
+	}
+
+	for i := 0; i < 3; i++ {
+		db, _ := master.Select(i)
+		for j := 0; j < 10; j++ {
+			key := []byte(fmt.Sprintf("key_%d", j))
+			db.Set(key, []byte("value"))
+			db.HSet(key, []byte("field"), []byte("value"))
+		}
+	}
+
+	db0, _ := master.Select(0)
+	db0.HClear([]byte("key_0"))
+	master.gcGenerations(true)
+
+	db1, _ := master.Select(1)
+	if n, err := db1.FlushAll(); err != nil {
+		t.Fatal(err)
+	} else if n != 20 {
+		t.Fatal(n)
+	}
+
+	if err = master.FlushDBAsync(2); err != nil {
+		t.Fatal(err)
+	}
+	master.reclaimDBSlots()
+
+	var buf bytes.Buffer
+	var n int
+	var id uint64 = 1
+	for {
+		buf.Reset()
+		n, id, err = master.ReadLogsTo(id, &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			break
+		}
+
+		if err = slave.StoreLogsFromReader(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slave.WaitReplication()
+
+	if err = checkLedisEqual(master, slave); err != nil {
+		t.Fatal(err)
+	} else if err = checkLedisEqual(slave, master); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []int64{19, 0, 0} {
+		db, _ := slave.Select(i)
+		if n, err := db.DBSize(); err != nil {
+			t.Fatal(err)
+		} else if n != expected {
+			t.Fatalf("db %d size %d != %d", i, n, expected)
+		}
+	}
+}
+
+func TestReplicationFilter(t *testing.T) {
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_repl_filter/master"
+	cfgM.UseReplication = true
+	cfgM.Replication.Compression = true
+
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_repl_filter/slave"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	for _, i := range []int{0, 3, 5} {
+		db, _ := master.Select(i)
+		db.Set([]byte("cfg:a"), []byte("value"))
+		db.Set([]byte("b"), []byte("value"))
+		db.HSet([]byte("cfg:h"), []byte("f"), []byte("value"))
+		db.HSet([]byte("h"), []byte("f"), []byte("value"))
+		db.Expire([]byte("cfg:a"), 100)
+	}
+
+	// the deletions are always replicated
+	db0, _ := master.Select(0)
+	db0.Del([]byte("cfg:a"))
+
+	f := &ReplicationFilter{DBs: []int{0, 3}, Prefixes: [][]byte{[]byte("cfg:")}}
+
+	var buf bytes.Buffer
+	var n int
+	var id uint64 = 1
+	for {
+		buf.Reset()
+		n, id, err = master.ReadFilteredLogsTo(id, &buf, f)
+		if err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			break
+		}
+
+		if err = slave.StoreLogsFromReader(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slave.WaitReplication()
+
+	// all the log IDs are replicated
+	if stat, _ := slave.ReplicationStat(); stat.LastID != id-1 {
+		t.Fatalf("last log id %d != %d", stat.LastID, id-1)
+	}
+
+	check := func(l *Ledis) {
+		t.Helper()
+
+		for _, i := range []int{0, 3, 5} {
+			db, _ := l.Select(i)
+
+			a, _ := db.Get([]byte("cfg:a"))
+			hv, _ := db.HGet([]byte("cfg:h"), []byte("f"))
+			ttl, _ := db.TTL([]byte("cfg:a"))
+			if i == 3 {
+				if string(a) != "value" || string(hv) != "value" || ttl <= 0 {
+					t.Fatalf("db %d cfg keys %q %q %d are not replicated", i, a, hv, ttl)
+				}
+			} else if i == 0 && (a != nil || string(hv) != "value") {
+				t.Fatalf("db %d cfg keys %q %q are not replicated", i, a, hv)
+			} else if i == 5 && (a != nil || hv != nil) {
+				t.Fatalf("db %d cfg keys %q %q must be filtered", i, a, hv)
+			}
+
+			b, _ := db.Get([]byte("b"))
+			hv, _ = db.HGet([]byte("h"), []byte("f"))
+			if b != nil || hv != nil {
+				t.Fatalf("db %d keys %q %q must be filtered", i, b, hv)
+			}
+		}
+	}
+
+	check(slave)
+
+	// the full sync has the same filter
+	buf.Reset()
+	if err = master.DumpFiltered(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgL := config.NewConfigDefault()
+	cfgL.DataDir = "/tmp/test_repl_filter/load"
+
+	os.RemoveAll(cfgL.DataDir)
+
+	loaded, err := Open(cfgL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	if _, err = loaded.LoadDump(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	check(loaded)
+}
+
+func TestReplicationDelay(t *testing.T) {
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_repl_delay/master"
+	cfgM.UseReplication = true
+
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_repl_delay/slave"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+	cfgS.Replication.ApplyDelay = 2
+
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	var id uint64 = 1
+	syncLogs := func() {
+		var buf bytes.Buffer
+		for {
+			buf.Reset()
+			n, nextID, err := master.ReadLogsTo(id, &buf)
+			if err != nil {
+				t.Fatal(err)
+			} else if n == 0 {
+				return
+			}
+
+			id = nextID
+			if err = slave.StoreLogsFromReader(&buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	db, _ := master.Select(0)
+	sdb, _ := slave.Select(0)
+
+	// the log is applied after it is old enough
+	db.Set([]byte("a"), []byte("1"))
+	syncLogs()
+
+	if err = slave.WaitReplication(); err != ErrReplicationHeld {
+		t.Fatalf("wait replication err %v", err)
+	} else if v, _ := sdb.Get([]byte("a")); v != nil {
+		t.Fatalf("%q is applied before the delay", v)
+	}
+
+	if commitID, _ := slave.WaitCommitID(id-1, 5*time.Second); commitID != id-1 {
+		t.Fatalf("commit id %d != %d", commitID, id-1)
+	} else if v, _ := sdb.Get([]byte("a")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	}
+
+	// stop short of the bad log and skip it
+	slave.cfg.Replication.ApplyDelay = 0
+
+	db.Set([]byte("b"), []byte("1"))
+	badID := id + 1
+	if err = slave.PauseReplication(badID); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Del([]byte("a"))
+	db.Set([]byte("c"), []byte("1"))
+	syncLogs()
+
+	if commitID, _ := slave.WaitCommitID(badID, 500*time.Millisecond); commitID != badID-1 {
+		t.Fatalf("commit id %d != %d", commitID, badID-1)
+	} else if v, _ := sdb.Get([]byte("b")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	} else if v, _ := sdb.Get([]byte("c")); v != nil {
+		t.Fatalf("%q is applied after paused", v)
+	}
+
+	if err = slave.SkipReplication(badID - 1); err == nil {
+		t.Fatal("the applied logs must not be skipped")
+	} else if err = slave.SkipReplication(id + 1); err == nil {
+		t.Fatal("the logs not received must not be skipped")
+	} else if err = slave.SkipReplication(badID + 1); err != nil {
+		t.Fatal(err)
+	} else if err = slave.ResumeReplication(); err != nil {
+		t.Fatal(err)
+	}
+
+	if commitID, _ := slave.WaitCommitID(id-1, 5*time.Second); commitID != id-1 {
+		t.Fatalf("commit id %d != %d", commitID, id-1)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if v, _ := sdb.Get([]byte(key)); string(v) != "1" {
+			t.Fatalf("%s %q != 1", key, v)
+		}
+	}
+}
+
+func TestReplicationPromote(t *testing.T) {
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_repl_promote/master"
+	cfgM.UseReplication = true
+
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_repl_promote/slave"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+	cfgS.Replication.ApplyDelay = cfgS.Replication.ExpiredLogDays*24*3600 + 1
+
+	os.RemoveAll(cfgS.DataDir)
+
+	if _, err = Open(cfgS); err == nil {
+		t.Fatal("the apply delay above the expired log days must fail")
+	}
+
+	cfgS.Replication.ApplyDelay = 3600
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	db, _ := master.Select(0)
+	sdb, _ := slave.Select(0)
+
+	db.Set([]byte("a"), []byte("1"))
+	db.Set([]byte("b"), []byte("1"))
+
+	var buf bytes.Buffer
+	if _, _, err = master.ReadLogsTo(1, &buf); err != nil {
+		t.Fatal(err)
+	} else if err = slave.PauseReplication(2); err != nil {
+		t.Fatal(err)
+	} else if err = slave.StoreLogsFromReader(&buf); err != nil {
+		t.Fatal(err)
+	} else if err = slave.WaitReplication(); err != ErrReplicationHeld {
+		t.Fatalf("wait replication err %v", err)
+	}
+
+	// the delayed log is applied and the paused one is dropped
+	if err = slave.PromoteReplication(); err != nil {
+		t.Fatal(err)
+	} else if v, _ := sdb.Get([]byte("a")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	} else if v, _ := sdb.Get([]byte("b")); v != nil {
+		t.Fatalf("%q is applied after paused", v)
+	} else if id, _ := slave.ReplicationID(); len(id.PrevID) > 0 {
+		t.Fatalf("the slaves must load the full data, prev id %s", id.PrevID)
+	} else if slave.ReplicationPauseID() != 0 {
+		t.Fatal("the pause must be cleared")
+	}
+
+	slave.cfg.SetReadonly(false)
+
+	if slave.IsReadOnly() {
+		t.Fatal("the promoted slave must be writable")
+	} else if err = sdb.Set([]byte("c"), []byte("1")); err != nil {
+		t.Fatal(err)
+	} else if stat, _ := slave.ReplicationStat(); stat.LastID != 2 {
+		t.Fatalf("last log id %d != 2", stat.LastID)
+	}
+}
+
+func TestReplicationPauseRestart(t *testing.T) {
+	cfgM := config.NewConfigDefault()
+	cfgM.DataDir = "/tmp/test_repl_pause_restart/master"
+	cfgM.UseReplication = true
+
+	os.RemoveAll(cfgM.DataDir)
+
+	master, err := Open(cfgM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	cfgS := config.NewConfigDefault()
+	cfgS.DataDir = "/tmp/test_repl_pause_restart/slave"
+	cfgS.UseReplication = true
+	cfgS.Readonly = true
+
+	os.RemoveAll(cfgS.DataDir)
+
+	slave, err := Open(cfgS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ := master.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+	db.Set([]byte("b"), []byte("1"))
+
+	var buf bytes.Buffer
+	if _, _, err = master.ReadLogsTo(1, &buf); err != nil {
+		t.Fatal(err)
+	} else if err = slave.PauseReplication(2); err != nil {
+		t.Fatal(err)
+	} else if err = slave.StoreLogsFromReader(&buf); err != nil {
+		t.Fatal(err)
+	} else if err = slave.WaitReplication(); err != ErrReplicationHeld {
+		t.Fatalf("wait replication err %v", err)
+	}
+
+	slave.Close()
+
+	// the paused log is not applied after the restart
+	if slave, err = Open(cfgS); err != nil {
+		t.Fatal(err)
+	}
+	defer slave.Close()
+
+	sdb, _ := slave.Select(0)
+
+	if id := slave.ReplicationPauseID(); id != 2 {
+		t.Fatalf("pause id %d != 2", id)
+	} else if err = slave.WaitReplication(); err != ErrReplicationHeld {
+		t.Fatalf("wait replication err %v", err)
+	} else if v, _ := sdb.Get([]byte("a")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	} else if v, _ := sdb.Get([]byte("b")); v != nil {
+		t.Fatalf("%q is applied after paused", v)
+	}
+
+	if err = slave.ResumeReplication(); err != nil {
+		t.Fatal(err)
+	} else if commitID, _ := slave.WaitCommitID(2, 5*time.Second); commitID != 2 {
+		t.Fatalf("commit id %d != 2", commitID)
+	} else if v, _ := sdb.Get([]byte("b")); string(v) != "1" {
+		t.Fatalf("%q != 1", v)
+	}
+}
@@ -1,6 +1,7 @@
 package ledis
 
 import (
+	"encoding/base64"
 	"errors"
 	"regexp"
 
@@ -199,35 +200,35 @@ func (db *DB) decodeScanKey(storeDataType byte, ek []byte) (key []byte, err erro
 
 // for special data scan
 
-func (db *DB) buildDataScanKeyRange(storeDataType byte, key []byte, cursor []byte, reverse bool) (minKey []byte, maxKey []byte, err error) {
+func (db *DB) buildDataScanKeyRange(storeDataType byte, key []byte, gen uint64, cursor []byte, reverse bool) (minKey []byte, maxKey []byte, err error) {
 	if !reverse {
-		if minKey, err = db.encodeDataScanMinKey(storeDataType, key, cursor); err != nil {
+		if minKey, err = db.encodeDataScanMinKey(storeDataType, key, gen, cursor); err != nil {
 			return
 		}
-		if maxKey, err = db.encodeDataScanMaxKey(storeDataType, key, nil); err != nil {
+		if maxKey, err = db.encodeDataScanMaxKey(storeDataType, key, gen, nil); err != nil {
 			return
 		}
 	} else {
-		if minKey, err = db.encodeDataScanMinKey(storeDataType, key, nil); err != nil {
+		if minKey, err = db.encodeDataScanMinKey(storeDataType, key, gen, nil); err != nil {
 			return
 		}
-		if maxKey, err = db.encodeDataScanMaxKey(storeDataType, key, cursor); err != nil {
+		if maxKey, err = db.encodeDataScanMaxKey(storeDataType, key, gen, cursor); err != nil {
 			return
 		}
 	}
 	return
 }
 
-func (db *DB) encodeDataScanMinKey(storeDataType byte, key []byte, cursor []byte) ([]byte, error) {
-	return db.encodeDataScanKey(storeDataType, key, cursor)
+func (db *DB) encodeDataScanMinKey(storeDataType byte, key []byte, gen uint64, cursor []byte) ([]byte, error) {
+	return db.encodeDataScanKey(storeDataType, key, gen, cursor)
 }
 
-func (db *DB) encodeDataScanMaxKey(storeDataType byte, key []byte, cursor []byte) ([]byte, error) {
+func (db *DB) encodeDataScanMaxKey(storeDataType byte, key []byte, gen uint64, cursor []byte) ([]byte, error) {
 	if len(cursor) > 0 {
-		return db.encodeDataScanKey(storeDataType, key, cursor)
+		return db.encodeDataScanKey(storeDataType, key, gen, cursor)
 	}
 
-	k, err := db.encodeDataScanKey(storeDataType, key, nil)
+	k, err := db.encodeDataScanKey(storeDataType, key, gen, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -237,14 +238,14 @@ func (db *DB) encodeDataScanMaxKey(storeDataType byte, key []byte, cursor []byte
 	return k, nil
 }
 
-func (db *DB) encodeDataScanKey(storeDataType byte, key []byte, cursor []byte) ([]byte, error) {
+func (db *DB) encodeDataScanKey(storeDataType byte, key []byte, gen uint64, cursor []byte) ([]byte, error) {
 	switch storeDataType {
 	case HashType:
-		return db.hEncodeHashKey(key, cursor), nil
+		return db.hEncodeHashKey(key, gen, cursor), nil
 	case ZSetType:
-		return db.zEncodeSetKey(key, cursor), nil
+		return db.zEncodeSetKey(key, gen, cursor), nil
 	case SetType:
-		return db.sEncodeSetKey(key, cursor), nil
+		return db.sEncodeSetKey(key, gen, cursor), nil
 	default:
 		return nil, errDataType
 	}
@@ -257,7 +258,13 @@ func (db *DB) buildDataScanIterator(storeDataType byte, key []byte, cursor []byt
 		return nil, err
 	}
 
-	minKey, maxKey, err := db.buildDataScanKeyRange(storeDataType, key, cursor, reverse)
+	// the data of a missing key may be the stale data not collected yet
+	size, gen, err := db.getSize(db.encodeKeyMetaKey(storeDataType, key))
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	minKey, maxKey, err := db.buildDataScanKeyRange(storeDataType, key, gen, cursor, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -278,8 +285,8 @@ func (db *DB) hScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 	v := make([]FVPair, 0, count)
 
 	it, err := db.buildDataScanIterator(HashType, key, cursor, count, inclusive, reverse)
-	if err != nil {
-		return nil, err
+	if err != nil || it == nil {
+		return v, err
 	}
 
 	defer it.Close()
@@ -321,8 +328,8 @@ func (db *DB) sScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 	v := make([][]byte, 0, count)
 
 	it, err := db.buildDataScanIterator(SetType, key, cursor, count, inclusive, reverse)
-	if err != nil {
-		return nil, err
+	if err != nil || it == nil {
+		return v, err
 	}
 
 	defer it.Close()
@@ -364,8 +371,8 @@ func (db *DB) zScanGeneric(key []byte, cursor []byte, count int, inclusive bool,
 	v := make([]ScorePair, 0, count)
 
 	it, err := db.buildDataScanIterator(ZSetType, key, cursor, count, inclusive, reverse)
-	if err != nil {
-		return nil, err
+	if err != nil || it == nil {
+		return v, err
 	}
 
 	defer it.Close()
@@ -400,3 +407,178 @@ func (db *DB) ZScan(key []byte, cursor []byte, count int, inclusive bool, match
 func (db *DB) ZRevScan(key []byte, cursor []byte, count int, inclusive bool, match string) ([]ScorePair, error) {
 	return db.zScanGeneric(key, cursor, count, inclusive, match, true)
 }
+
+// for keyspace scan over all data types
+
+const (
+	scanCursorVersion byte = 1
+
+	// keys examined in one step when KEYS walks the whole keyspace
+	keysScanCount int = 1024
+)
+
+var errScanCursor = errors.New("invalid scan cursor")
+
+// keyspaceScanTypes is the order in which KeyScan walks the meta keys.
+var keyspaceScanTypes = []byte{KVType, LMetaType, HSizeType, SSizeType, ZSizeType}
+
+func keyspaceScanOrder(storeDataType byte) int {
+	for i, tp := range keyspaceScanTypes {
+		if tp == storeDataType {
+			return i
+		}
+	}
+	return -1
+}
+
+// encodeScanCursor builds an opaque cursor from the last scanned meta key.
+// The cursor only depends on the stored data, so it stays valid across restarts.
+func encodeScanCursor(storeDataType byte, key []byte) []byte {
+	buf := make([]byte, len(key)+2)
+	buf[0] = scanCursorVersion
+	buf[1] = storeDataType
+	copy(buf[2:], key)
+
+	cursor := make([]byte, base64.RawURLEncoding.EncodedLen(len(buf)))
+	base64.RawURLEncoding.Encode(cursor, buf)
+	return cursor
+}
+
+func decodeScanCursor(cursor []byte) (byte, []byte, error) {
+	buf := make([]byte, base64.RawURLEncoding.DecodedLen(len(cursor)))
+	n, err := base64.RawURLEncoding.Decode(buf, cursor)
+	if err != nil {
+		return 0, nil, errScanCursor
+	}
+
+	buf = buf[0:n]
+	if len(buf) < 2 || buf[0] != scanCursorVersion || keyspaceScanOrder(buf[1]) < 0 {
+		return 0, nil, errScanCursor
+	}
+
+	return buf[1], buf[2:], nil
+}
+
+func getKeyspaceScanTypes(dataTypes []DataType) ([]byte, error) {
+	if len(dataTypes) == 0 {
+		return keyspaceScanTypes, nil
+	}
+
+	types := make([]byte, 0, len(keyspaceScanTypes))
+	for _, tp := range keyspaceScanTypes {
+		for _, dataType := range dataTypes {
+			storeDataType, err := getDataStoreType(dataType)
+			if err != nil {
+				return nil, err
+			}
+
+			if storeDataType == tp {
+				types = append(types, tp)
+				break
+			}
+		}
+	}
+
+	return types, nil
+}
+
+// KeyScan scans the keys of all data types in one pass, or only the keys of dataTypes if given.
+// cursor is the opaque value returned by the previous call, nil starts a new iteration.
+// count is the number of keys examined, so less keys may be returned if match is used.
+// The returned cursor is nil when the iteration is finished.
+func (db *DB) KeyScan(cursor []byte, count int, match string, dataTypes ...DataType) ([]byte, [][]byte, error) {
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	types, err := getKeyspaceScanTypes(dataTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db.keyScan(cursor, checkScanCount(count), r, types)
+}
+
+func (db *DB) keyScan(cursor []byte, count int, r *regexp.Regexp, types []byte) ([]byte, [][]byte, error) {
+	var startType byte
+	var startKey []byte
+	var err error
+
+	if len(cursor) > 0 {
+		if startType, startKey, err = decodeScanCursor(cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	v := make([][]byte, 0, count)
+	n := 0
+
+	for _, tp := range types {
+		var key []byte
+		if len(cursor) > 0 {
+			if keyspaceScanOrder(tp) < keyspaceScanOrder(startType) {
+				continue
+			} else if tp == startType {
+				key = startKey
+			}
+		}
+
+		minKey, maxKey, err := db.buildScanKeyRange(tp, key, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		it := db.buildScanIterator(minKey, maxKey, false, false)
+
+		for ; it.Valid(); it.Next() {
+			k, err := db.decodeScanKey(tp, it.Key())
+			if err != nil {
+				continue
+			}
+
+			if r == nil || r.Match(k) {
+				v = append(v, k)
+			}
+
+			n++
+			if n >= count {
+				it.Close()
+				return encodeScanCursor(tp, k), v, nil
+			}
+		}
+		it.Close()
+	}
+
+	return nil, v, nil
+}
+
+// Keys returns all the keys matching match in all data types, or only in dataTypes if given.
+// A key existing in several data types is returned once for every type.
+func (db *DB) Keys(match string, dataTypes ...DataType) ([][]byte, error) {
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := getKeyspaceScanTypes(dataTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor []byte
+	keys := make([][]byte, 0, 16)
+
+	for {
+		var v [][]byte
+		if cursor, v, err = db.keyScan(cursor, keysScanCount, r, types); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, v...)
+
+		if cursor == nil {
+			return keys, nil
+		}
+	}
+}
@@ -400,3 +400,63 @@ func TestDBZScan(t *testing.T) {
 	}
 
 }
+
+func TestDBKeyScan(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(3)
+
+	db.FlushAll()
+
+	db.Set([]byte("a"), []byte{})
+	db.LPush([]byte("b"), []byte("1"))
+	db.HSet([]byte("c"), []byte("1"), []byte{})
+	db.SAdd([]byte("d"), []byte("1"))
+	db.ZAdd([]byte("e"), ScorePair{1, []byte("1")})
+	db.Set([]byte("f"), []byte{})
+
+	var cursor []byte
+	var keys [][]byte
+	for {
+		next, v, err := db.KeyScan(cursor, 2, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, v...)
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	checkTestScan(t, keys, "a", "f", "b", "c", "d", "e")
+
+	if _, v, err := db.KeyScan(nil, 10, "", HASH, ZSET); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "c", "e")
+	}
+
+	if next, v, err := db.KeyScan(nil, 3, "^[a-c]$"); err != nil {
+		t.Fatal(err)
+	} else if next == nil {
+		t.Fatal("cursor must not be nil")
+	} else {
+		checkTestScan(t, v, "a", "b")
+	}
+
+	if _, _, err := db.KeyScan([]byte("invalid cursor"), 10, ""); err == nil {
+		t.Fatal("must error")
+	}
+
+	if v, err := db.Keys("^[b-d]$"); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "b", "c", "d")
+	}
+
+	if v, err := db.Keys("", KV); err != nil {
+		t.Fatal(err)
+	} else {
+		checkTestScan(t, v, "a", "f")
+	}
+}
@@ -1,7 +1,6 @@
 package ledis
 
 import (
-	"encoding/binary"
 	"errors"
 	"time"
 
@@ -61,8 +60,8 @@ func (db *DB) hDecodeSizeKey(ek []byte) ([]byte, error) {
 	return ek[pos:], nil
 }
 
-func (db *DB) hEncodeHashKey(key []byte, field []byte) []byte {
-	buf := make([]byte, len(key)+len(field)+1+1+2+len(db.indexVarBuf))
+func (db *DB) hEncodeHashKey(key []byte, gen uint64, field []byte) []byte {
+	buf := make([]byte, genKeyLen(key, gen)+len(field)+1+1+len(db.indexVarBuf))
 
 	pos := 0
 	n := copy(buf, db.indexVarBuf)
@@ -71,11 +70,7 @@ func (db *DB) hEncodeHashKey(key []byte, field []byte) []byte {
 	buf[pos] = HashType
 	pos++
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
-	pos += 2
-
-	copy(buf[pos:], key)
-	pos += len(key)
+	pos += putGenKey(buf[pos:], key, gen)
 
 	buf[pos] = hashStartSep
 	pos++
@@ -95,21 +90,13 @@ func (db *DB) hDecodeHashKey(ek []byte) ([]byte, []byte, error) {
 	}
 	pos++
 
-	if pos+2 > len(ek) {
-		return nil, nil, errHashKey
-	}
-
-	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	pos += 2
-
-	if keyLen+pos > len(ek) {
+	key, n, err := decodeGenKey(ek[pos:])
+	if err != nil {
 		return nil, nil, errHashKey
 	}
+	pos += n
 
-	key := ek[pos : pos+keyLen]
-	pos += keyLen
-
-	if ek[pos] != hashStartSep {
+	if pos >= len(ek) || ek[pos] != hashStartSep {
 		return nil, nil, errHashKey
 	}
 
@@ -118,28 +105,28 @@ func (db *DB) hDecodeHashKey(ek []byte) ([]byte, []byte, error) {
 	return key, field, nil
 }
 
-func (db *DB) hEncodeStartKey(key []byte) []byte {
-	return db.hEncodeHashKey(key, nil)
+func (db *DB) hEncodeStartKey(key []byte, gen uint64) []byte {
+	return db.hEncodeHashKey(key, gen, nil)
 }
 
-func (db *DB) hEncodeStopKey(key []byte) []byte {
-	k := db.hEncodeHashKey(key, nil)
+func (db *DB) hEncodeStopKey(key []byte, gen uint64) []byte {
+	k := db.hEncodeHashKey(key, gen, nil)
 
 	k[len(k)-1] = hashStopSep
 
 	return k
 }
 
-func (db *DB) hSetItem(key []byte, field []byte, value []byte) (int64, error) {
+func (db *DB) hSetItem(key []byte, gen uint64, field []byte, value []byte) (int64, error) {
 	t := db.hashBatch
 
-	ek := db.hEncodeHashKey(key, field)
+	ek := db.hEncodeHashKey(key, gen, field)
 
 	var n int64 = 1
 	if v, _ := db.bucket.Get(ek); v != nil {
 		n = 0
 	} else {
-		if _, err := db.hIncrSize(key, 1); err != nil {
+		if _, err := db.hIncrSize(key, gen, 1); err != nil {
 			return 0, err
 		}
 	}
@@ -151,20 +138,7 @@ func (db *DB) hSetItem(key []byte, field []byte, value []byte) (int64, error) {
 //	ps : here just focus on deleting the hash data,
 //		 any other likes expire is ignore.
 func (db *DB) hDelete(t *batch, key []byte) int64 {
-	sk := db.hEncodeSizeKey(key)
-	start := db.hEncodeStartKey(key)
-	stop := db.hEncodeStopKey(key)
-
-	var num int64
-	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
-	for ; it.Valid(); it.Next() {
-		t.Delete(it.Key())
-		num++
-	}
-	it.Close()
-
-	t.Delete(sk)
-	return num
+	return db.clearSize(t, HashType, db.hEncodeSizeKey(key), key)
 }
 
 func (db *DB) hExpireAt(key []byte, when int64) (int64, error) {
@@ -190,7 +164,8 @@ func (db *DB) HLen(key []byte) (int64, error) {
 		return 0, err
 	}
 
-	return Int64(db.bucket.Get(db.hEncodeSizeKey(key)))
+	size, _, err := db.getSize(db.hEncodeSizeKey(key))
+	return size, err
 }
 
 // HSet sets the field with value of key.
@@ -205,7 +180,12 @@ func (db *DB) HSet(key []byte, field []byte, value []byte) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
-	n, err := db.hSetItem(key, field, value)
+	_, gen, err := db.getWriteSize(t, HashType, db.hEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := db.hSetItem(key, gen, field, value)
 	if err != nil {
 		return 0, err
 	}
@@ -220,7 +200,12 @@ func (db *DB) HGet(key []byte, field []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return db.bucket.Get(db.hEncodeHashKey(key, field))
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	return db.bucket.Get(db.hEncodeHashKey(key, gen, field))
 }
 
 // HMset sets multi field-values.
@@ -229,7 +214,11 @@ func (db *DB) HMset(key []byte, args ...FVPair) error {
 	t.Lock()
 	defer t.Unlock()
 
-	var err error
+	_, gen, err := db.getWriteSize(t, HashType, db.hEncodeSizeKey(key))
+	if err != nil {
+		return err
+	}
+
 	var ek []byte
 	var num int64
 	for i := 0; i < len(args); i++ {
@@ -239,7 +228,7 @@ func (db *DB) HMset(key []byte, args ...FVPair) error {
 			return err
 		}
 
-		ek = db.hEncodeHashKey(key, args[i].Field)
+		ek = db.hEncodeHashKey(key, gen, args[i].Field)
 
 		if v, err := db.bucket.Get(ek); err != nil {
 			return err
@@ -250,7 +239,7 @@ func (db *DB) HMset(key []byte, args ...FVPair) error {
 		t.Put(ek, args[i].Value)
 	}
 
-	if _, err = db.hIncrSize(key, num); err != nil {
+	if _, err = db.hIncrSize(key, gen, num); err != nil {
 		return err
 	}
 
@@ -261,23 +250,25 @@ func (db *DB) HMset(key []byte, args ...FVPair) error {
 
 // HMget gets multi values of fields
 func (db *DB) HMget(key []byte, args ...[]byte) ([][]byte, error) {
-	var ek []byte
-
-	it := db.bucket.NewIterator()
-	defer it.Close()
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil {
+		return nil, err
+	}
 
-	r := make([][]byte, len(args))
+	eks := make([][]byte, len(args))
 	for i := 0; i < len(args); i++ {
 		if err := checkHashKFSize(key, args[i]); err != nil {
 			return nil, err
 		}
 
-		ek = db.hEncodeHashKey(key, args[i])
+		eks[i] = db.hEncodeHashKey(key, gen, args[i])
+	}
 
-		r[i] = it.Find(ek)
+	if size == 0 {
+		return make([][]byte, len(args)), nil
 	}
 
-	return r, nil
+	return db.bucket.MultiGet(eks)
 }
 
 // HDel deletes the fields.
@@ -291,6 +282,11 @@ func (db *DB) HDel(key []byte, args ...[]byte) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
 	it := db.bucket.NewIterator()
 	defer it.Close()
 
@@ -298,9 +294,11 @@ func (db *DB) HDel(key []byte, args ...[]byte) (int64, error) {
 	for i := 0; i < len(args); i++ {
 		if err := checkHashKFSize(key, args[i]); err != nil {
 			return 0, err
+		} else if size == 0 {
+			continue
 		}
 
-		ek = db.hEncodeHashKey(key, args[i])
+		ek = db.hEncodeHashKey(key, gen, args[i])
 
 		v = it.RawFind(ek)
 		if v == nil {
@@ -311,7 +309,7 @@ func (db *DB) HDel(key []byte, args ...[]byte) (int64, error) {
 		}
 	}
 
-	if _, err = db.hIncrSize(key, -num); err != nil {
+	if _, err = db.hIncrSize(key, gen, -num); err != nil {
 		return 0, err
 	}
 
@@ -320,24 +318,21 @@ func (db *DB) HDel(key []byte, args ...[]byte) (int64, error) {
 	return num, err
 }
 
-func (db *DB) hIncrSize(key []byte, delta int64) (int64, error) {
+func (db *DB) hIncrSize(key []byte, gen uint64, delta int64) (int64, error) {
 	t := db.hashBatch
 	sk := db.hEncodeSizeKey(key)
 
-	var err error
-	var size int64
-	if size, err = Int64(db.bucket.Get(sk)); err != nil {
+	size, _, err := db.getSize(sk)
+	if err != nil {
 		return 0, err
 	}
+	t.exists(sk, size > 0)
 
 	size += delta
 	if size <= 0 {
 		size = 0
-		t.Delete(sk)
-		db.rmExpire(t, HashType, key)
-	} else {
-		t.Put(sk, PutInt64(size))
 	}
+	db.setSize(t, HashType, sk, key, size, gen)
 
 	return size, nil
 }
@@ -352,10 +347,27 @@ func (db *DB) HIncrBy(key []byte, field []byte, delta int64) (int64, error) {
 	var ek []byte
 	var err error
 
+	encodeKey := func() ([]byte, error) {
+		size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		return db.hEncodeHashKey(key, gen, field), nil
+	}
+
+	if n, ok, err := db.mergeIncr(t, encodeKey, delta); ok {
+		return n, err
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
-	ek = db.hEncodeHashKey(key, field)
+	_, gen, err := db.getWriteSize(t, HashType, db.hEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	ek = db.hEncodeHashKey(key, gen, field)
 
 	var n int64
 	if n, err = StrInt64(db.bucket.Get(ek)); err != nil {
@@ -364,7 +376,7 @@ func (db *DB) HIncrBy(key []byte, field []byte, delta int64) (int64, error) {
 
 	n += delta
 
-	_, err = db.hSetItem(key, field, num.FormatInt64ToSlice(n))
+	_, err = db.hSetItem(key, gen, field, num.FormatInt64ToSlice(n))
 	if err != nil {
 		return 0, err
 	}
@@ -380,11 +392,16 @@ func (db *DB) HGetAll(key []byte) ([]FVPair, error) {
 		return nil, err
 	}
 
-	start := db.hEncodeStartKey(key)
-	stop := db.hEncodeStopKey(key)
-
 	v := make([]FVPair, 0, 16)
 
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return v, err
+	}
+
+	start := db.hEncodeStartKey(key, gen)
+	stop := db.hEncodeStopKey(key, gen)
+
 	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
 	defer it.Close()
 
@@ -406,11 +423,16 @@ func (db *DB) HKeys(key []byte) ([][]byte, error) {
 		return nil, err
 	}
 
-	start := db.hEncodeStartKey(key)
-	stop := db.hEncodeStopKey(key)
-
 	v := make([][]byte, 0, 16)
 
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return v, err
+	}
+
+	start := db.hEncodeStartKey(key, gen)
+	stop := db.hEncodeStopKey(key, gen)
+
 	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
 	defer it.Close()
 
@@ -431,11 +453,16 @@ func (db *DB) HValues(key []byte) ([][]byte, error) {
 		return nil, err
 	}
 
-	start := db.hEncodeStartKey(key)
-	stop := db.hEncodeStopKey(key)
-
 	v := make([][]byte, 0, 16)
 
+	size, gen, err := db.getSize(db.hEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return v, err
+	}
+
+	start := db.hEncodeStartKey(key, gen)
+	stop := db.hEncodeStopKey(key, gen)
+
 	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
 	defer it.Close()
 
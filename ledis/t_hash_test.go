@@ -18,7 +18,7 @@ func TestHashCodec(t *testing.T) {
 		t.Fatal(string(k))
 	}
 
-	ek = db.hEncodeHashKey(key, field)
+	ek = db.hEncodeHashKey(key, 0, field)
 	if k, f, err := db.hDecodeHashKey(ek); err != nil {
 		t.Fatal(err)
 	} else if string(k) != "key" {
@@ -78,14 +78,23 @@ func (db *DB) incr(key []byte, delta int64) (int64, error) {
 
 	t := db.kvBatch
 
+	if n, ok, err := db.mergeIncr(t, func() ([]byte, error) { return key, nil }, delta); ok {
+		return n, err
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
-	var n int64
-	n, err = StrInt64(db.bucket.Get(key))
+	v, err := db.bucket.Get(key)
 	if err != nil {
 		return 0, err
 	}
+	t.exists(key, v != nil)
+
+	var n int64
+	if n, err = StrInt64(v, nil); err != nil {
+		return 0, err
+	}
 
 	n += delta
 
@@ -213,6 +222,7 @@ func (db *DB) GetSet(key []byte, value []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	t.exists(key, oldValue != nil)
 
 	t.Put(key, value)
 
@@ -233,20 +243,16 @@ func (db *DB) IncrBy(key []byte, increment int64) (int64, error) {
 
 // MGet gets multi data.
 func (db *DB) MGet(keys ...[]byte) ([][]byte, error) {
-	values := make([][]byte, len(keys))
-
-	it := db.bucket.NewIterator()
-	defer it.Close()
-
+	eks := make([][]byte, len(keys))
 	for i := range keys {
 		if err := checkKeySize(keys[i]); err != nil {
 			return nil, err
 		}
 
-		values[i] = it.Find(db.encodeKVKey(keys[i]))
+		eks[i] = db.encodeKVKey(keys[i])
 	}
 
-	return values, nil
+	return db.bucket.MultiGet(eks)
 }
 
 // MSet sets multi data.
@@ -329,6 +335,7 @@ func (db *DB) SetNX(key []byte, value []byte) (int64, error) {
 	} else if v != nil {
 		n = 0
 	} else {
+		t.exists(key, false)
 		t.Put(key, value)
 
 		err = t.Commit()
@@ -435,6 +442,7 @@ func (db *DB) SetRange(key []byte, offset int, value []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	t.exists(key, oldValue != nil)
 
 	extra := offset + len(value) - len(oldValue)
 	if extra > 0 {
@@ -530,6 +538,7 @@ func (db *DB) Append(key []byte, value []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	t.exists(key, oldValue != nil)
 
 	if len(oldValue)+len(value) > MaxValueSize {
 		return 0, errValueSize
@@ -737,6 +746,7 @@ func (db *DB) SetBit(key []byte, offset int, on int) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	t.exists(key, value != nil)
 
 	byteOffset := int(uint32(offset) >> 3)
 	extra := byteOffset + 1 - len(value)
@@ -51,19 +51,15 @@ func (db *DB) lDecodeMetaKey(ek []byte) ([]byte, error) {
 	return ek[pos:], nil
 }
 
-func (db *DB) lEncodeListKey(key []byte, seq int32) []byte {
-	buf := make([]byte, len(key)+7+len(db.indexVarBuf))
+func (db *DB) lEncodeListKey(key []byte, gen uint64, seq int32) []byte {
+	buf := make([]byte, genKeyLen(key, gen)+5+len(db.indexVarBuf))
 
 	pos := copy(buf, db.indexVarBuf)
 
 	buf[pos] = ListType
 	pos++
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
-	pos += 2
-
-	copy(buf[pos:], key)
-	pos += len(key)
+	pos += putGenKey(buf[pos:], key, gen)
 
 	binary.BigEndian.PutUint32(buf[pos:], uint32(seq))
 
@@ -84,20 +80,13 @@ func (db *DB) lDecodeListKey(ek []byte) (key []byte, seq int32, err error) {
 
 	pos++
 
-	if pos+2 > len(ek) {
+	var n int
+	if key, n, err = decodeGenKey(ek[pos:]); err != nil || pos+n+4 != len(ek) {
 		err = errListKey
 		return
 	}
 
-	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	pos += 2
-	if keyLen+pos+4 != len(ek) {
-		err = errListKey
-		return
-	}
-
-	key = ek[pos : pos+keyLen]
-	seq = int32(binary.BigEndian.Uint32(ek[pos+keyLen:]))
+	seq = int32(binary.BigEndian.Uint32(ek[pos+n:]))
 	return
 }
 
@@ -109,6 +98,7 @@ func (db *DB) lpush(key []byte, whereSeq int32, args ...[]byte) (int64, error) {
 	var headSeq int32
 	var tailSeq int32
 	var size int32
+	var gen uint64
 	var err error
 
 	t := db.listBatch
@@ -116,16 +106,23 @@ func (db *DB) lpush(key []byte, whereSeq int32, args ...[]byte) (int64, error) {
 	defer t.Unlock()
 
 	metaKey := db.lEncodeMetaKey(key)
-	headSeq, tailSeq, size, err = db.lGetMeta(nil, metaKey)
+	headSeq, tailSeq, size, gen, err = db.lGetMeta(nil, metaKey)
 	if err != nil {
 		return 0, err
 	}
+	t.exists(metaKey, size > 0)
 
 	pushCnt := len(args)
 	if pushCnt == 0 {
 		return int64(size), nil
 	}
 
+	if size == 0 {
+		if gen, err = db.newGen(t, ListType); err != nil {
+			return 0, err
+		}
+	}
+
 	seq := headSeq
 	var delta int32 = -1
 	if whereSeq == listTailSeq {
@@ -139,7 +136,7 @@ func (db *DB) lpush(key []byte, whereSeq int32, args ...[]byte) (int64, error) {
 	}
 
 	for i := 0; i < pushCnt; i++ {
-		ek := db.lEncodeListKey(key, seq+int32(i)*delta)
+		ek := db.lEncodeListKey(key, gen, seq+int32(i)*delta)
 		t.Put(ek, args[i])
 	}
 
@@ -155,7 +152,7 @@ func (db *DB) lpush(key []byte, whereSeq int32, args ...[]byte) (int64, error) {
 		tailSeq = seq
 	}
 
-	db.lSetMeta(metaKey, headSeq, tailSeq)
+	db.lSetMeta(metaKey, headSeq, tailSeq, gen)
 
 	err = t.Commit()
 
@@ -178,15 +175,17 @@ func (db *DB) lpop(key []byte, whereSeq int32) ([]byte, error) {
 	var headSeq int32
 	var tailSeq int32
 	var size int32
+	var gen uint64
 	var err error
 
 	metaKey := db.lEncodeMetaKey(key)
-	headSeq, tailSeq, size, err = db.lGetMeta(nil, metaKey)
+	headSeq, tailSeq, size, gen, err = db.lGetMeta(nil, metaKey)
 	if err != nil {
 		return nil, err
 	} else if size == 0 {
 		return nil, nil
 	}
+	t.exists(metaKey, true)
 
 	var value []byte
 
@@ -195,7 +194,7 @@ func (db *DB) lpop(key []byte, whereSeq int32) ([]byte, error) {
 		seq = tailSeq
 	}
 
-	itemKey := db.lEncodeListKey(key, seq)
+	itemKey := db.lEncodeListKey(key, gen, seq)
 	value, err = db.bucket.Get(itemKey)
 	if err != nil {
 		return nil, err
@@ -208,7 +207,7 @@ func (db *DB) lpop(key []byte, whereSeq int32) ([]byte, error) {
 	}
 
 	t.Delete(itemKey)
-	size = db.lSetMeta(metaKey, headSeq, tailSeq)
+	size = db.lSetMeta(metaKey, headSeq, tailSeq, gen)
 	if size == 0 {
 		db.rmExpire(t, ListType, key)
 	}
@@ -228,13 +227,15 @@ func (db *DB) ltrim2(key []byte, startP, stopP int64) (err error) {
 
 	var headSeq int32
 	var llen int32
+	var gen uint64
 	start := int32(startP)
 	stop := int32(stopP)
 
 	ek := db.lEncodeMetaKey(key)
-	if headSeq, _, llen, err = db.lGetMeta(nil, ek); err != nil {
+	if headSeq, _, llen, gen, err = db.lGetMeta(nil, ek); err != nil {
 		return err
 	}
+	t.exists(ek, llen > 0)
 
 	if start < 0 {
 		start = llen + start
@@ -257,16 +258,16 @@ func (db *DB) ltrim2(key []byte, startP, stopP int64) (err error) {
 
 	if start > 0 {
 		for i := int32(0); i < start; i++ {
-			t.Delete(db.lEncodeListKey(key, headSeq+i))
+			t.Delete(db.lEncodeListKey(key, gen, headSeq+i))
 		}
 	}
 	if stop < int32(llen-1) {
 		for i := int32(stop + 1); i < llen; i++ {
-			t.Delete(db.lEncodeListKey(key, headSeq+i))
+			t.Delete(db.lEncodeListKey(key, gen, headSeq+i))
 		}
 	}
 
-	db.lSetMeta(ek, headSeq+start, headSeq+stop)
+	db.lSetMeta(ek, headSeq+start, headSeq+stop, gen)
 
 	return t.Commit()
 }
@@ -287,15 +288,17 @@ func (db *DB) ltrim(key []byte, trimSize, whereSeq int32) (int32, error) {
 	var headSeq int32
 	var tailSeq int32
 	var size int32
+	var gen uint64
 	var err error
 
 	metaKey := db.lEncodeMetaKey(key)
-	headSeq, tailSeq, size, err = db.lGetMeta(nil, metaKey)
+	headSeq, tailSeq, size, gen, err = db.lGetMeta(nil, metaKey)
 	if err != nil {
 		return 0, err
 	} else if size == 0 {
 		return 0, nil
 	}
+	t.exists(metaKey, true)
 
 	var (
 		trimStartSeq int32
@@ -313,11 +316,11 @@ func (db *DB) ltrim(key []byte, trimSize, whereSeq int32) (int32, error) {
 	}
 
 	for trimSeq := trimStartSeq; trimSeq <= trimEndSeq; trimSeq++ {
-		itemKey := db.lEncodeListKey(key, trimSeq)
+		itemKey := db.lEncodeListKey(key, gen, trimSeq)
 		t.Delete(itemKey)
 	}
 
-	size = db.lSetMeta(metaKey, headSeq, tailSeq)
+	size = db.lSetMeta(metaKey, headSeq, tailSeq, gen)
 	if size == 0 {
 		db.rmExpire(t, ListType, key)
 	}
@@ -331,37 +334,18 @@ func (db *DB) ltrim(key []byte, trimSize, whereSeq int32) (int32, error) {
 func (db *DB) lDelete(t *batch, key []byte) int64 {
 	mk := db.lEncodeMetaKey(key)
 
-	var headSeq int32
-	var tailSeq int32
-	var err error
-
-	it := db.bucket.NewIterator()
-	defer it.Close()
-
-	headSeq, tailSeq, _, err = db.lGetMeta(it, mk)
-	if err != nil {
+	_, _, size, gen, err := db.lGetMeta(nil, mk)
+	if err != nil || size == 0 {
 		return 0
 	}
+	t.exists(mk, true)
 
-	var num int64
-	startKey := db.lEncodeListKey(key, headSeq)
-	stopKey := db.lEncodeListKey(key, tailSeq)
+	db.clearGen(t, ListType, mk, key, gen)
 
-	rit := store.NewRangeIterator(it, &store.Range{
-		Min:  startKey,
-		Max:  stopKey,
-		Type: store.RangeClose})
-	for ; rit.Valid(); rit.Next() {
-		t.Delete(rit.RawKey())
-		num++
-	}
-
-	t.Delete(mk)
-
-	return num
+	return int64(size)
 }
 
-func (db *DB) lGetMeta(it *store.Iterator, ek []byte) (headSeq int32, tailSeq int32, size int32, err error) {
+func (db *DB) lGetMeta(it *store.Iterator, ek []byte) (headSeq int32, tailSeq int32, size int32, gen uint64, err error) {
 	var v []byte
 	if it != nil {
 		v = it.Find(ek)
@@ -376,6 +360,7 @@ func (db *DB) lGetMeta(it *store.Iterator, ek []byte) (headSeq int32, tailSeq in
 		size = 0
 		return
 	} else {
+		v, gen = decodeGenMeta(v)
 		headSeq = int32(binary.LittleEndian.Uint32(v[0:4]))
 		tailSeq = int32(binary.LittleEndian.Uint32(v[4:8]))
 		size = tailSeq - headSeq + 1
@@ -383,7 +368,7 @@ func (db *DB) lGetMeta(it *store.Iterator, ek []byte) (headSeq int32, tailSeq in
 	return
 }
 
-func (db *DB) lSetMeta(ek []byte, headSeq int32, tailSeq int32) int32 {
+func (db *DB) lSetMeta(ek []byte, headSeq int32, tailSeq int32, gen uint64) int32 {
 	t := db.listBatch
 
 	size := tailSeq - headSeq + 1
@@ -398,7 +383,7 @@ func (db *DB) lSetMeta(ek []byte, headSeq int32, tailSeq int32) int32 {
 		binary.LittleEndian.PutUint32(buf[0:4], uint32(headSeq))
 		binary.LittleEndian.PutUint32(buf[4:8], uint32(tailSeq))
 
-		t.Put(ek, buf)
+		t.Put(ek, encodeGenMeta(buf, gen))
 	}
 
 	return size
@@ -430,6 +415,8 @@ func (db *DB) LIndex(key []byte, index int32) ([]byte, error) {
 	var seq int32
 	var headSeq int32
 	var tailSeq int32
+	var size int32
+	var gen uint64
 	var err error
 
 	metaKey := db.lEncodeMetaKey(key)
@@ -437,8 +424,8 @@ func (db *DB) LIndex(key []byte, index int32) ([]byte, error) {
 	it := db.bucket.NewIterator()
 	defer it.Close()
 
-	headSeq, tailSeq, _, err = db.lGetMeta(it, metaKey)
-	if err != nil {
+	headSeq, tailSeq, size, gen, err = db.lGetMeta(it, metaKey)
+	if err != nil || size == 0 {
 		return nil, err
 	}
 
@@ -448,7 +435,7 @@ func (db *DB) LIndex(key []byte, index int32) ([]byte, error) {
 		seq = tailSeq + index + 1
 	}
 
-	sk := db.lEncodeListKey(key, seq)
+	sk := db.lEncodeListKey(key, gen, seq)
 	v := it.Find(sk)
 
 	return v, nil
@@ -461,7 +448,7 @@ func (db *DB) LLen(key []byte) (int64, error) {
 	}
 
 	ek := db.lEncodeMetaKey(key)
-	_, _, size, err := db.lGetMeta(nil, ek)
+	_, _, size, _, err := db.lGetMeta(nil, ek)
 	return int64(size), err
 }
 
@@ -500,13 +487,14 @@ func (db *DB) LSet(key []byte, index int32, value []byte) error {
 	var headSeq int32
 	var tailSeq int32
 	//var size int32
+	var gen uint64
 	var err error
 	t := db.listBatch
 	t.Lock()
 	defer t.Unlock()
 	metaKey := db.lEncodeMetaKey(key)
 
-	headSeq, tailSeq, _, err = db.lGetMeta(nil, metaKey)
+	headSeq, tailSeq, _, gen, err = db.lGetMeta(nil, metaKey)
 	if err != nil {
 		return err
 	}
@@ -519,7 +507,7 @@ func (db *DB) LSet(key []byte, index int32, value []byte) error {
 	if seq < headSeq || seq > tailSeq {
 		return errListIndex
 	}
-	sk := db.lEncodeListKey(key, seq)
+	sk := db.lEncodeListKey(key, gen, seq)
 	t.Put(sk, value)
 	err = t.Commit()
 	return err
@@ -533,6 +521,7 @@ func (db *DB) LRange(key []byte, start int32, stop int32) ([][]byte, error) {
 
 	var headSeq int32
 	var llen int32
+	var gen uint64
 	var err error
 
 	metaKey := db.lEncodeMetaKey(key)
@@ -540,7 +529,7 @@ func (db *DB) LRange(key []byte, start int32, stop int32) ([][]byte, error) {
 	it := db.bucket.NewIterator()
 	defer it.Close()
 
-	if headSeq, _, llen, err = db.lGetMeta(it, metaKey); err != nil {
+	if headSeq, _, llen, gen, err = db.lGetMeta(it, metaKey); err != nil {
 		return nil, err
 	}
 
@@ -567,7 +556,7 @@ func (db *DB) LRange(key []byte, start int32, stop int32) ([][]byte, error) {
 
 	v := make([][]byte, 0, limit)
 
-	startKey := db.lEncodeListKey(key, headSeq)
+	startKey := db.lEncodeListKey(key, gen, headSeq)
 	rit := store.NewRangeLimitIterator(it,
 		&store.Range{
 			Min:  startKey,
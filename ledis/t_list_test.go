@@ -20,7 +20,7 @@ func TestListCodec(t *testing.T) {
 		t.Fatal(string(k))
 	}
 
-	ek = db.lEncodeListKey(key, 1024)
+	ek = db.lEncodeListKey(key, 0, 1024)
 	if k, seq, err := db.lDecodeListKey(ek); err != nil {
 		t.Fatal(err)
 	} else if string(k) != "key" {
@@ -1,7 +1,6 @@
 package ledis
 
 import (
-	"encoding/binary"
 	"errors"
 	"time"
 
@@ -56,19 +55,15 @@ func (db *DB) sDecodeSizeKey(ek []byte) ([]byte, error) {
 	return ek[pos:], nil
 }
 
-func (db *DB) sEncodeSetKey(key []byte, member []byte) []byte {
-	buf := make([]byte, len(key)+len(member)+1+1+2+len(db.indexVarBuf))
+func (db *DB) sEncodeSetKey(key []byte, gen uint64, member []byte) []byte {
+	buf := make([]byte, genKeyLen(key, gen)+len(member)+1+1+len(db.indexVarBuf))
 
 	pos := copy(buf, db.indexVarBuf)
 
 	buf[pos] = SetType
 	pos++
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
-	pos += 2
-
-	copy(buf[pos:], key)
-	pos += len(key)
+	pos += putGenKey(buf[pos:], key, gen)
 
 	buf[pos] = setStartSep
 	pos++
@@ -89,21 +84,13 @@ func (db *DB) sDecodeSetKey(ek []byte) ([]byte, []byte, error) {
 
 	pos++
 
-	if pos+2 > len(ek) {
-		return nil, nil, errSetKey
-	}
-
-	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	pos += 2
-
-	if keyLen+pos > len(ek) {
+	key, n, err := decodeGenKey(ek[pos:])
+	if err != nil {
 		return nil, nil, errSetKey
 	}
+	pos += n
 
-	key := ek[pos : pos+keyLen]
-	pos += keyLen
-
-	if ek[pos] != hashStartSep {
+	if pos >= len(ek) || ek[pos] != hashStartSep {
 		return nil, nil, errSetKey
 	}
 
@@ -112,12 +99,12 @@ func (db *DB) sDecodeSetKey(ek []byte) ([]byte, []byte, error) {
 	return key, member, nil
 }
 
-func (db *DB) sEncodeStartKey(key []byte) []byte {
-	return db.sEncodeSetKey(key, nil)
+func (db *DB) sEncodeStartKey(key []byte, gen uint64) []byte {
+	return db.sEncodeSetKey(key, gen, nil)
 }
 
-func (db *DB) sEncodeStopKey(key []byte) []byte {
-	k := db.sEncodeSetKey(key, nil)
+func (db *DB) sEncodeStopKey(key []byte, gen uint64) []byte {
+	k := db.sEncodeSetKey(key, gen, nil)
 
 	k[len(k)-1] = setStopSep
 
@@ -134,41 +121,24 @@ func (db *DB) sFlush() (drop int64, err error) {
 }
 
 func (db *DB) sDelete(t *batch, key []byte) int64 {
-	sk := db.sEncodeSizeKey(key)
-	start := db.sEncodeStartKey(key)
-	stop := db.sEncodeStopKey(key)
-
-	var num int64
-	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
-	for ; it.Valid(); it.Next() {
-		t.Delete(it.RawKey())
-		num++
-	}
-
-	it.Close()
-
-	t.Delete(sk)
-	return num
+	return db.clearSize(t, SetType, db.sEncodeSizeKey(key), key)
 }
 
-func (db *DB) sIncrSize(key []byte, delta int64) (int64, error) {
+func (db *DB) sIncrSize(key []byte, gen uint64, delta int64) (int64, error) {
 	t := db.setBatch
 	sk := db.sEncodeSizeKey(key)
 
-	var err error
-	var size int64
-	if size, err = Int64(db.bucket.Get(sk)); err != nil {
+	size, _, err := db.getSize(sk)
+	if err != nil {
 		return 0, err
 	}
+	t.exists(sk, size > 0)
 
 	size += delta
 	if size <= 0 {
 		size = 0
-		t.Delete(sk)
-		db.rmExpire(t, SetType, key)
-	} else {
-		t.Put(sk, PutInt64(size))
 	}
+	db.setSize(t, SetType, sk, key, size, gen)
 
 	return size, nil
 }
@@ -189,15 +159,15 @@ func (db *DB) sExpireAt(key []byte, when int64) (int64, error) {
 	return 1, nil
 }
 
-func (db *DB) sSetItem(key []byte, member []byte) (int64, error) {
+func (db *DB) sSetItem(key []byte, gen uint64, member []byte) (int64, error) {
 	t := db.setBatch
-	ek := db.sEncodeSetKey(key, member)
+	ek := db.sEncodeSetKey(key, gen, member)
 
 	var n int64 = 1
 	if v, _ := db.bucket.Get(ek); v != nil {
 		n = 0
 	} else {
-		if _, err := db.sIncrSize(key, 1); err != nil {
+		if _, err := db.sIncrSize(key, gen, 1); err != nil {
 			return 0, err
 		}
 	}
@@ -212,7 +182,11 @@ func (db *DB) SAdd(key []byte, args ...[]byte) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
-	var err error
+	_, gen, err := db.getWriteSize(t, SetType, db.sEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
 	var ek []byte
 	var num int64
 	for i := 0; i < len(args); i++ {
@@ -220,7 +194,7 @@ func (db *DB) SAdd(key []byte, args ...[]byte) (int64, error) {
 			return 0, err
 		}
 
-		ek = db.sEncodeSetKey(key, args[i])
+		ek = db.sEncodeSetKey(key, gen, args[i])
 
 		if v, err := db.bucket.Get(ek); err != nil {
 			return 0, err
@@ -231,7 +205,7 @@ func (db *DB) SAdd(key []byte, args ...[]byte) (int64, error) {
 		t.Put(ek, nil)
 	}
 
-	if _, err = db.sIncrSize(key, num); err != nil {
+	if _, err = db.sIncrSize(key, gen, num); err != nil {
 		return 0, err
 	}
 
@@ -248,7 +222,8 @@ func (db *DB) SCard(key []byte) (int64, error) {
 
 	sk := db.sEncodeSizeKey(key)
 
-	return Int64(db.bucket.Get(sk))
+	size, _, err := db.getSize(sk)
+	return size, err
 }
 
 func (db *DB) sDiffGeneric(keys ...[]byte) ([][]byte, error) {
@@ -389,7 +364,12 @@ func (db *DB) SInterStore(dstKey []byte, keys ...[]byte) (int64, error) {
 
 // SIsMember checks member in set.
 func (db *DB) SIsMember(key []byte, member []byte) (int64, error) {
-	ek := db.sEncodeSetKey(key, member)
+	size, gen, err := db.getSize(db.sEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	ek := db.sEncodeSetKey(key, gen, member)
 
 	var n int64 = 1
 	if v, err := db.bucket.Get(ek); err != nil {
@@ -400,17 +380,52 @@ func (db *DB) SIsMember(key []byte, member []byte) (int64, error) {
 	return n, nil
 }
 
+// SMIsMember checks whether the members are in the set, 1 for a member and 0 for not.
+func (db *DB) SMIsMember(key []byte, members ...[]byte) ([]int64, error) {
+	size, gen, err := db.getSize(db.sEncodeSizeKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]int64, len(members))
+	if size == 0 {
+		return r, nil
+	}
+
+	eks := make([][]byte, len(members))
+	for i, member := range members {
+		eks[i] = db.sEncodeSetKey(key, gen, member)
+	}
+
+	values, err := db.bucket.MultiGet(eks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range values {
+		if v != nil {
+			r[i] = 1
+		}
+	}
+	return r, nil
+}
+
 // SMembers gets members of set.
 func (db *DB) SMembers(key []byte) ([][]byte, error) {
 	if err := checkKeySize(key); err != nil {
 		return nil, err
 	}
 
-	start := db.sEncodeStartKey(key)
-	stop := db.sEncodeStopKey(key)
-
 	v := make([][]byte, 0, 16)
 
+	size, gen, err := db.getSize(db.sEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return v, err
+	}
+
+	start := db.sEncodeStartKey(key, gen)
+	stop := db.sEncodeStopKey(key, gen)
+
 	it := db.bucket.RangeLimitIterator(start, stop, store.RangeROpen, 0, -1)
 	defer it.Close()
 
@@ -434,7 +449,11 @@ func (db *DB) SRem(key []byte, args ...[]byte) (int64, error) {
 
 	var ek []byte
 	var v []byte
-	var err error
+
+	size, gen, err := db.getSize(db.sEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
 
 	it := db.bucket.NewIterator()
 	defer it.Close()
@@ -443,9 +462,11 @@ func (db *DB) SRem(key []byte, args ...[]byte) (int64, error) {
 	for i := 0; i < len(args); i++ {
 		if err := checkSetKMSize(key, args[i]); err != nil {
 			return 0, err
+		} else if size == 0 {
+			continue
 		}
 
-		ek = db.sEncodeSetKey(key, args[i])
+		ek = db.sEncodeSetKey(key, gen, args[i])
 
 		v = it.RawFind(ek)
 		if v == nil {
@@ -456,7 +477,7 @@ func (db *DB) SRem(key []byte, args ...[]byte) (int64, error) {
 		}
 	}
 
-	if _, err = db.sIncrSize(key, -num); err != nil {
+	if _, err = db.sIncrSize(key, gen, -num); err != nil {
 		return 0, err
 	}
 
@@ -517,9 +538,13 @@ func (db *DB) sStoreGeneric(dstKey []byte, optType byte, keys ...[]byte) (int64,
 	t.Lock()
 	defer t.Unlock()
 
+	gen, err := db.newGen(t, SetType)
+	if err != nil {
+		return 0, err
+	}
+
 	db.sDelete(t, dstKey)
 
-	var err error
 	var ek []byte
 	var v [][]byte
 
@@ -541,7 +566,7 @@ func (db *DB) sStoreGeneric(dstKey []byte, optType byte, keys ...[]byte) (int64,
 			return 0, err
 		}
 
-		ek = db.sEncodeSetKey(dstKey, m)
+		ek = db.sEncodeSetKey(dstKey, gen, m)
 
 		if _, err := db.bucket.Get(ek); err != nil {
 			return 0, err
@@ -552,7 +577,7 @@ func (db *DB) sStoreGeneric(dstKey []byte, optType byte, keys ...[]byte) (int64,
 
 	var n = int64(len(v))
 	sk := db.sEncodeSizeKey(dstKey)
-	t.Put(sk, PutInt64(n))
+	t.Put(sk, encodeGenMeta(PutInt64(n), gen))
 
 	if err = t.Commit(); err != nil {
 		return 0, err
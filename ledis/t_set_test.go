@@ -19,7 +19,7 @@ func TestSetCodec(t *testing.T) {
 		t.Fatal(string(k))
 	}
 
-	ek = db.sEncodeSetKey(key, member)
+	ek = db.sEncodeSetKey(key, 0, member)
 	if k, m, err := db.sDecodeSetKey(ek); err != nil {
 		t.Fatal(err)
 	} else if string(k) != "key" {
@@ -69,6 +69,18 @@ func TestDBSet(t *testing.T) {
 		t.Fatal(n)
 	}
 
+	if r, err := db.SMIsMember(key, member, []byte("none")); err != nil {
+		t.Fatal(err)
+	} else if len(r) != 2 || r[0] != 1 || r[1] != 0 {
+		t.Fatal(r)
+	}
+
+	if r, err := db.SMIsMember([]byte("testdb_set_none"), member); err != nil {
+		t.Fatal(err)
+	} else if len(r) != 1 || r[0] != 0 {
+		t.Fatal(r)
+	}
+
 	if v, err := db.SMembers(key); err != nil {
 		t.Fatal(err)
 	} else if string(v[0]) != "member" {
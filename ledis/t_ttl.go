@@ -132,6 +132,7 @@ func (db *DB) rmExpire(t *batch, dataType byte, key []byte) (int64, error) {
 	}
 
 	tk := db.expEncodeTimeKey(dataType, key, when)
+	t.exists(mk, true)
 	t.Delete(mk)
 	t.Delete(tk)
 	return 1, nil
@@ -200,6 +201,7 @@ func (c *ttlChecker) check() {
 			if exp <= now {
 				cb(t, k)
 				t.Delete(tk)
+				t.exists(mk, true)
 				t.Delete(mk)
 
 				t.Commit()
@@ -75,19 +75,15 @@ func (db *DB) zDecodeSizeKey(ek []byte) ([]byte, error) {
 	return ek[pos:], nil
 }
 
-func (db *DB) zEncodeSetKey(key []byte, member []byte) []byte {
-	buf := make([]byte, len(key)+len(member)+4+len(db.indexVarBuf))
+func (db *DB) zEncodeSetKey(key []byte, gen uint64, member []byte) []byte {
+	buf := make([]byte, genKeyLen(key, gen)+len(member)+2+len(db.indexVarBuf))
 
 	pos := copy(buf, db.indexVarBuf)
 
 	buf[pos] = ZSetType
 	pos++
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
-	pos += 2
-
-	copy(buf[pos:], key)
-	pos += len(key)
+	pos += putGenKey(buf[pos:], key, gen)
 
 	buf[pos] = zsetStartMemSep
 	pos++
@@ -109,51 +105,41 @@ func (db *DB) zDecodeSetKey(ek []byte) ([]byte, []byte, error) {
 
 	pos++
 
-	if pos+2 > len(ek) {
+	key, n, err := decodeGenKey(ek[pos:])
+	if err != nil {
 		return nil, nil, errZSetKey
 	}
+	pos += n
 
-	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	if keyLen+pos > len(ek) {
-		return nil, nil, errZSetKey
-	}
-
-	pos += 2
-	key := ek[pos : pos+keyLen]
-
-	if ek[pos+keyLen] != zsetStartMemSep {
+	if pos >= len(ek) || ek[pos] != zsetStartMemSep {
 		return nil, nil, errZSetKey
 	}
 	pos++
 
-	member := ek[pos+keyLen:]
+	member := ek[pos:]
 	return key, member, nil
 }
 
-func (db *DB) zEncodeStartSetKey(key []byte) []byte {
-	k := db.zEncodeSetKey(key, nil)
+func (db *DB) zEncodeStartSetKey(key []byte, gen uint64) []byte {
+	k := db.zEncodeSetKey(key, gen, nil)
 	return k
 }
 
-func (db *DB) zEncodeStopSetKey(key []byte) []byte {
-	k := db.zEncodeSetKey(key, nil)
+func (db *DB) zEncodeStopSetKey(key []byte, gen uint64) []byte {
+	k := db.zEncodeSetKey(key, gen, nil)
 	k[len(k)-1] = zsetStartMemSep + 1
 	return k
 }
 
-func (db *DB) zEncodeScoreKey(key []byte, member []byte, score int64) []byte {
-	buf := make([]byte, len(key)+len(member)+13+len(db.indexVarBuf))
+func (db *DB) zEncodeScoreKey(key []byte, gen uint64, member []byte, score int64) []byte {
+	buf := make([]byte, genKeyLen(key, gen)+len(member)+11+len(db.indexVarBuf))
 
 	pos := copy(buf, db.indexVarBuf)
 
 	buf[pos] = ZScoreType
 	pos++
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(key)))
-	pos += 2
-
-	copy(buf[pos:], key)
-	pos += len(key)
+	pos += putGenKey(buf[pos:], key, gen)
 
 	if score < 0 {
 		buf[pos] = zsetNScoreSep
@@ -172,12 +158,12 @@ func (db *DB) zEncodeScoreKey(key []byte, member []byte, score int64) []byte {
 	return buf
 }
 
-func (db *DB) zEncodeStartScoreKey(key []byte, score int64) []byte {
-	return db.zEncodeScoreKey(key, nil, score)
+func (db *DB) zEncodeStartScoreKey(key []byte, gen uint64, score int64) []byte {
+	return db.zEncodeScoreKey(key, gen, nil, score)
 }
 
-func (db *DB) zEncodeStopScoreKey(key []byte, score int64) []byte {
-	k := db.zEncodeScoreKey(key, nil, score)
+func (db *DB) zEncodeStopScoreKey(key []byte, gen uint64, score int64) []byte {
+	k := db.zEncodeScoreKey(key, gen, nil, score)
 	k[len(k)-1] = zsetStopMemSep
 	return k
 }
@@ -195,20 +181,12 @@ func (db *DB) zDecodeScoreKey(ek []byte) (key []byte, member []byte, score int64
 	}
 	pos++
 
-	if pos+2 > len(ek) {
+	var n int
+	if key, n, err = decodeGenKey(ek[pos:]); err != nil {
 		err = errZScoreKey
 		return
 	}
-	keyLen := int(binary.BigEndian.Uint16(ek[pos:]))
-	pos += 2
-
-	if keyLen+pos > len(ek) {
-		err = errZScoreKey
-		return
-	}
-
-	key = ek[pos : pos+keyLen]
-	pos += keyLen
+	pos += n
 
 	if pos+10 > len(ek) {
 		err = errZScoreKey
@@ -235,13 +213,13 @@ func (db *DB) zDecodeScoreKey(ek []byte) (key []byte, member []byte, score int64
 	return
 }
 
-func (db *DB) zSetItem(t *batch, key []byte, score int64, member []byte) (int64, error) {
+func (db *DB) zSetItem(t *batch, key []byte, gen uint64, score int64, member []byte) (int64, error) {
 	if score <= MinScore || score >= MaxScore {
 		return 0, errScoreOverflow
 	}
 
 	var exists int64
-	ek := db.zEncodeSetKey(key, member)
+	ek := db.zEncodeSetKey(key, gen, member)
 
 	if v, err := db.bucket.Get(ek); err != nil {
 		return 0, err
@@ -253,20 +231,20 @@ func (db *DB) zSetItem(t *batch, key []byte, score int64, member []byte) (int64,
 			return 0, err
 		}
 
-		sk := db.zEncodeScoreKey(key, member, s)
+		sk := db.zEncodeScoreKey(key, gen, member, s)
 		t.Delete(sk)
 	}
 
 	t.Put(ek, PutInt64(score))
 
-	sk := db.zEncodeScoreKey(key, member, score)
+	sk := db.zEncodeScoreKey(key, gen, member, score)
 	t.Put(sk, []byte{})
 
 	return exists, nil
 }
 
-func (db *DB) zDelItem(t *batch, key []byte, member []byte, skipDelScore bool) (int64, error) {
-	ek := db.zEncodeSetKey(key, member)
+func (db *DB) zDelItem(t *batch, key []byte, gen uint64, member []byte, skipDelScore bool) (int64, error) {
+	ek := db.zEncodeSetKey(key, gen, member)
 	if v, err := db.bucket.Get(ek); err != nil {
 		return 0, err
 	} else if v == nil {
@@ -280,7 +258,7 @@ func (db *DB) zDelItem(t *batch, key []byte, member []byte, skipDelScore bool) (
 			if err != nil {
 				return 0, err
 			}
-			sk := db.zEncodeScoreKey(key, member, s)
+			sk := db.zEncodeScoreKey(key, gen, member, s)
 			t.Delete(sk)
 		}
 	}
@@ -291,9 +269,7 @@ func (db *DB) zDelItem(t *batch, key []byte, member []byte, skipDelScore bool) (
 }
 
 func (db *DB) zDelete(t *batch, key []byte) int64 {
-	delMembCnt, _ := db.zRemRange(t, key, MinScore, MaxScore, 0, -1)
-	//	todo : log err
-	return delMembCnt
+	return db.clearSize(t, ZSetType, db.zEncodeSizeKey(key), key)
 }
 
 func (db *DB) zExpireAt(key []byte, when int64) (int64, error) {
@@ -323,6 +299,11 @@ func (db *DB) ZAdd(key []byte, args ...ScorePair) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
+	_, gen, err := db.getWriteSize(t, ZSetType, db.zEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
 	var num int64
 	for i := 0; i < len(args); i++ {
 		score := args[i].Score
@@ -332,7 +313,7 @@ func (db *DB) ZAdd(key []byte, args ...ScorePair) (int64, error) {
 			return 0, err
 		}
 
-		if n, err := db.zSetItem(t, key, score, member); err != nil {
+		if n, err := db.zSetItem(t, key, gen, score, member); err != nil {
 			return 0, err
 		} else if n == 0 {
 			//add new
@@ -340,29 +321,28 @@ func (db *DB) ZAdd(key []byte, args ...ScorePair) (int64, error) {
 		}
 	}
 
-	if _, err := db.zIncrSize(t, key, num); err != nil {
+	if _, err := db.zIncrSize(t, key, gen, num); err != nil {
 		return 0, err
 	}
 
-	err := t.Commit()
+	err = t.Commit()
 	return num, err
 }
 
-func (db *DB) zIncrSize(t *batch, key []byte, delta int64) (int64, error) {
+func (db *DB) zIncrSize(t *batch, key []byte, gen uint64, delta int64) (int64, error) {
 	sk := db.zEncodeSizeKey(key)
 
-	size, err := Int64(db.bucket.Get(sk))
+	size, _, err := db.getSize(sk)
 	if err != nil {
 		return 0, err
 	}
+	t.exists(sk, size > 0)
+
 	size += delta
 	if size <= 0 {
 		size = 0
-		t.Delete(sk)
-		db.rmExpire(t, ZSetType, key)
-	} else {
-		t.Put(sk, PutInt64(size))
 	}
+	db.setSize(t, ZSetType, sk, key, size, gen)
 
 	return size, nil
 }
@@ -374,7 +354,8 @@ func (db *DB) ZCard(key []byte) (int64, error) {
 	}
 
 	sk := db.zEncodeSizeKey(key)
-	return Int64(db.bucket.Get(sk))
+	size, _, err := db.getSize(sk)
+	return size, err
 }
 
 // ZScore gets the score of member.
@@ -385,7 +366,14 @@ func (db *DB) ZScore(key []byte, member []byte) (int64, error) {
 
 	score := InvalidScore
 
-	k := db.zEncodeSetKey(key, member)
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil {
+		return InvalidScore, err
+	} else if size == 0 {
+		return InvalidScore, ErrScoreMiss
+	}
+
+	k := db.zEncodeSetKey(key, gen, member)
 	if v, err := db.bucket.Get(k); err != nil {
 		return InvalidScore, err
 	} else if v == nil {
@@ -409,24 +397,31 @@ func (db *DB) ZRem(key []byte, members ...[]byte) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
 	var num int64
 	for i := 0; i < len(members); i++ {
 		if err := checkZSetKMSize(key, members[i]); err != nil {
 			return 0, err
+		} else if size == 0 {
+			continue
 		}
 
-		if n, err := db.zDelItem(t, key, members[i], false); err != nil {
+		if n, err := db.zDelItem(t, key, gen, members[i], false); err != nil {
 			return 0, err
 		} else if n == 1 {
 			num++
 		}
 	}
 
-	if _, err := db.zIncrSize(t, key, -num); err != nil {
+	if _, err := db.zIncrSize(t, key, gen, -num); err != nil {
 		return 0, err
 	}
 
-	err := t.Commit()
+	err = t.Commit()
 	return num, err
 }
 
@@ -440,14 +435,19 @@ func (db *DB) ZIncrBy(key []byte, delta int64, member []byte) (int64, error) {
 	t.Lock()
 	defer t.Unlock()
 
-	ek := db.zEncodeSetKey(key, member)
+	_, gen, err := db.getWriteSize(t, ZSetType, db.zEncodeSizeKey(key))
+	if err != nil {
+		return InvalidScore, err
+	}
+
+	ek := db.zEncodeSetKey(key, gen, member)
 
 	var oldScore int64
 	v, err := db.bucket.Get(ek)
 	if err != nil {
 		return InvalidScore, err
 	} else if v == nil {
-		db.zIncrSize(t, key, 1)
+		db.zIncrSize(t, key, gen, 1)
 	} else {
 		if oldScore, err = Int64(v, err); err != nil {
 			return InvalidScore, err
@@ -459,13 +459,13 @@ func (db *DB) ZIncrBy(key []byte, delta int64, member []byte) (int64, error) {
 		return InvalidScore, errScoreOverflow
 	}
 
-	sk := db.zEncodeScoreKey(key, member, newScore)
+	sk := db.zEncodeScoreKey(key, gen, member, newScore)
 	t.Put(sk, []byte{})
 	t.Put(ek, PutInt64(newScore))
 
 	if v != nil {
 		// so as to update score, we must delete the old one
-		oldSk := db.zEncodeScoreKey(key, member, oldScore)
+		oldSk := db.zEncodeScoreKey(key, gen, member, oldScore)
 		t.Delete(oldSk)
 	}
 
@@ -478,8 +478,14 @@ func (db *DB) ZCount(key []byte, min int64, max int64) (int64, error) {
 	if err := checkKeySize(key); err != nil {
 		return 0, err
 	}
-	minKey := db.zEncodeStartScoreKey(key, min)
-	maxKey := db.zEncodeStopScoreKey(key, max)
+
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	minKey := db.zEncodeStartScoreKey(key, gen, min)
+	maxKey := db.zEncodeStopScoreKey(key, gen, max)
 
 	rangeType := store.RangeROpen
 
@@ -498,7 +504,14 @@ func (db *DB) zrank(key []byte, member []byte, reverse bool) (int64, error) {
 		return 0, err
 	}
 
-	k := db.zEncodeSetKey(key, member)
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil {
+		return 0, err
+	} else if size == 0 {
+		return -1, nil
+	}
+
+	k := db.zEncodeSetKey(key, gen, member)
 
 	it := db.bucket.NewIterator()
 	defer it.Close()
@@ -514,14 +527,14 @@ func (db *DB) zrank(key []byte, member []byte, reverse bool) (int64, error) {
 	}
 	var rit *store.RangeLimitIterator
 
-	sk := db.zEncodeScoreKey(key, member, s)
+	sk := db.zEncodeScoreKey(key, gen, member, s)
 
 	if !reverse {
-		minKey := db.zEncodeStartScoreKey(key, MinScore)
+		minKey := db.zEncodeStartScoreKey(key, gen, MinScore)
 
 		rit = store.NewRangeIterator(it, &store.Range{Min: minKey, Max: sk, Type: store.RangeClose})
 	} else {
-		maxKey := db.zEncodeStopScoreKey(key, MaxScore)
+		maxKey := db.zEncodeStopScoreKey(key, gen, MaxScore)
 		rit = store.NewRevRangeIterator(it, &store.Range{Min: sk, Max: maxKey, Type: store.RangeClose})
 	}
 
@@ -542,9 +555,9 @@ func (db *DB) zrank(key []byte, member []byte, reverse bool) (int64, error) {
 	return -1, nil
 }
 
-func (db *DB) zIterator(key []byte, min int64, max int64, offset int, count int, reverse bool) *store.RangeLimitIterator {
-	minKey := db.zEncodeStartScoreKey(key, min)
-	maxKey := db.zEncodeStopScoreKey(key, max)
+func (db *DB) zIterator(key []byte, gen uint64, min int64, max int64, offset int, count int, reverse bool) *store.RangeLimitIterator {
+	minKey := db.zEncodeStartScoreKey(key, gen, min)
+	maxKey := db.zEncodeStopScoreKey(key, gen, max)
 
 	if !reverse {
 		return db.bucket.RangeLimitIterator(minKey, maxKey, store.RangeClose, offset, count)
@@ -557,7 +570,12 @@ func (db *DB) zRemRange(t *batch, key []byte, min int64, max int64, offset int,
 		return 0, errKeySize
 	}
 
-	it := db.zIterator(key, min, max, offset, count, false)
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
+	it := db.zIterator(key, gen, min, max, offset, count, false)
 	var num int64
 	for ; it.Valid(); it.Next() {
 		sk := it.RawKey()
@@ -566,7 +584,7 @@ func (db *DB) zRemRange(t *batch, key []byte, min int64, max int64, offset int,
 			continue
 		}
 
-		if n, err := db.zDelItem(t, key, m, true); err != nil {
+		if n, err := db.zDelItem(t, key, gen, m, true); err != nil {
 			return 0, err
 		} else if n == 1 {
 			num++
@@ -576,7 +594,7 @@ func (db *DB) zRemRange(t *batch, key []byte, min int64, max int64, offset int,
 	}
 	it.Close()
 
-	if _, err := db.zIncrSize(t, key, -num); err != nil {
+	if _, err := db.zIncrSize(t, key, gen, -num); err != nil {
 		return 0, err
 	}
 
@@ -600,14 +618,19 @@ func (db *DB) zRange(key []byte, min int64, max int64, offset int, count int, re
 
 	v := make([]ScorePair, 0, nv)
 
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return v, err
+	}
+
 	var it *store.RangeLimitIterator
 
 	//if reverse and offset is 0, count < 0, we may use forward iterator then reverse
 	//because store iterator prev is slower than next
 	if !reverse || (offset == 0 && count < 0) {
-		it = db.zIterator(key, min, max, offset, count, false)
+		it = db.zIterator(key, gen, min, max, offset, count, false)
 	} else {
-		it = db.zIterator(key, min, max, offset, count, true)
+		it = db.zIterator(key, gen, min, max, offset, count, true)
 	}
 
 	for ; it.Valid(); it.Next() {
@@ -670,15 +693,18 @@ func (db *DB) zParseLimit(key []byte, start int, stop int) (offset int, count in
 
 // ZClear clears the zset.
 func (db *DB) ZClear(key []byte) (int64, error) {
+	if len(key) > MaxKeySize {
+		return 0, errKeySize
+	}
+
 	t := db.zsetBatch
 	t.Lock()
 	defer t.Unlock()
 
-	rmCnt, err := db.zRemRange(t, key, MinScore, MaxScore, 0, -1)
-	if err == nil {
-		err = t.Commit()
-	}
+	rmCnt := db.zDelete(t, key)
+	db.rmExpire(t, ZSetType, key)
 
+	err := t.Commit()
 	return rmCnt, err
 }
 
@@ -689,9 +715,12 @@ func (db *DB) ZMclear(keys ...[]byte) (int64, error) {
 	defer t.Unlock()
 
 	for _, key := range keys {
-		if _, err := db.zRemRange(t, key, MinScore, MaxScore, 0, -1); err != nil {
-			return 0, err
+		if len(key) > MaxKeySize {
+			return 0, errKeySize
 		}
+
+		db.zDelete(t, key)
+		db.rmExpire(t, ZSetType, key)
 	}
 
 	err := t.Commit()
@@ -905,6 +934,11 @@ func (db *DB) ZUnionStore(destKey []byte, srcKeys [][]byte, weights []int64, agg
 	t.Lock()
 	defer t.Unlock()
 
+	gen, err := db.newGen(t, ZSetType)
+	if err != nil {
+		return 0, err
+	}
+
 	db.zDelete(t, destKey)
 
 	for member, score := range destMap {
@@ -912,14 +946,14 @@ func (db *DB) ZUnionStore(destKey []byte, srcKeys [][]byte, weights []int64, agg
 			return 0, err
 		}
 
-		if _, err := db.zSetItem(t, destKey, score, []byte(member)); err != nil {
+		if _, err := db.zSetItem(t, destKey, gen, score, []byte(member)); err != nil {
 			return 0, err
 		}
 	}
 
 	var n = int64(len(destMap))
 	sk := db.zEncodeSizeKey(destKey)
-	t.Put(sk, PutInt64(n))
+	t.Put(sk, encodeGenMeta(PutInt64(n), gen))
 
 	if err := t.Commit(); err != nil {
 		return 0, err
@@ -975,20 +1009,25 @@ func (db *DB) ZInterStore(destKey []byte, srcKeys [][]byte, weights []int64, agg
 	t.Lock()
 	defer t.Unlock()
 
+	gen, err := db.newGen(t, ZSetType)
+	if err != nil {
+		return 0, err
+	}
+
 	db.zDelete(t, destKey)
 
 	for member, score := range destMap {
 		if err := checkZSetKMSize(destKey, []byte(member)); err != nil {
 			return 0, err
 		}
-		if _, err := db.zSetItem(t, destKey, score, []byte(member)); err != nil {
+		if _, err := db.zSetItem(t, destKey, gen, score, []byte(member)); err != nil {
 			return 0, err
 		}
 	}
 
 	n := int64(len(destMap))
 	sk := db.zEncodeSizeKey(destKey)
-	t.Put(sk, PutInt64(n))
+	t.Put(sk, encodeGenMeta(PutInt64(n), gen))
 
 	if err := t.Commit(); err != nil {
 		return 0, err
@@ -998,15 +1037,20 @@ func (db *DB) ZInterStore(destKey []byte, srcKeys [][]byte, weights []int64, agg
 
 // ZRangeByLex scans the zset lexicographically
 func (db *DB) ZRangeByLex(key []byte, min []byte, max []byte, rangeType uint8, offset int, count int) ([][]byte, error) {
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return [][]byte{}, err
+	}
+
 	if min == nil {
-		min = db.zEncodeStartSetKey(key)
+		min = db.zEncodeStartSetKey(key, gen)
 	} else {
-		min = db.zEncodeSetKey(key, min)
+		min = db.zEncodeSetKey(key, gen, min)
 	}
 	if max == nil {
-		max = db.zEncodeStopSetKey(key)
+		max = db.zEncodeStopSetKey(key, gen)
 	} else {
-		max = db.zEncodeSetKey(key, max)
+		max = db.zEncodeSetKey(key, gen, max)
 	}
 
 	it := db.bucket.RangeLimitIterator(min, max, rangeType, offset, count)
@@ -1024,15 +1068,20 @@ func (db *DB) ZRangeByLex(key []byte, min []byte, max []byte, rangeType uint8, o
 
 // ZRemRangeByLex remvoes members in [min, max] lexicographically
 func (db *DB) ZRemRangeByLex(key []byte, min []byte, max []byte, rangeType uint8) (int64, error) {
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
 	if min == nil {
-		min = db.zEncodeStartSetKey(key)
+		min = db.zEncodeStartSetKey(key, gen)
 	} else {
-		min = db.zEncodeSetKey(key, min)
+		min = db.zEncodeSetKey(key, gen, min)
 	}
 	if max == nil {
-		max = db.zEncodeStopSetKey(key)
+		max = db.zEncodeStopSetKey(key, gen)
 	} else {
-		max = db.zEncodeSetKey(key, max)
+		max = db.zEncodeSetKey(key, gen, max)
 	}
 
 	t := db.zsetBatch
@@ -1057,15 +1106,20 @@ func (db *DB) ZRemRangeByLex(key []byte, min []byte, max []byte, rangeType uint8
 
 // ZLexCount gets the count of zset lexicographically.
 func (db *DB) ZLexCount(key []byte, min []byte, max []byte, rangeType uint8) (int64, error) {
+	size, gen, err := db.getSize(db.zEncodeSizeKey(key))
+	if err != nil || size == 0 {
+		return 0, err
+	}
+
 	if min == nil {
-		min = db.zEncodeStartSetKey(key)
+		min = db.zEncodeStartSetKey(key, gen)
 	} else {
-		min = db.zEncodeSetKey(key, min)
+		min = db.zEncodeSetKey(key, gen, min)
 	}
 	if max == nil {
-		max = db.zEncodeStopSetKey(key)
+		max = db.zEncodeStopSetKey(key, gen)
 	} else {
-		max = db.zEncodeSetKey(key, max)
+		max = db.zEncodeSetKey(key, gen, max)
 	}
 
 	it := db.bucket.RangeIterator(min, max, rangeType)
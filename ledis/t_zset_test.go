@@ -33,7 +33,7 @@ func TestZSetCodec(t *testing.T) {
 		t.Fatal(string(k))
 	}
 
-	ek = db.zEncodeSetKey(key, member)
+	ek = db.zEncodeSetKey(key, 0, member)
 	if k, m, err := db.zDecodeSetKey(ek); err != nil {
 		t.Fatal(err)
 	} else if string(k) != "key" {
@@ -42,7 +42,7 @@ func TestZSetCodec(t *testing.T) {
 		t.Fatal(string(m))
 	}
 
-	ek = db.zEncodeScoreKey(key, member, 100)
+	ek = db.zEncodeScoreKey(key, 0, member, 100)
 	if k, m, s, err := db.zDecodeScoreKey(ek); err != nil {
 		t.Fatal(err)
 	} else if string(k) != "key" {
@@ -0,0 +1,174 @@
+package ledis
+
+import (
+	"github.com/ledisdb/ledisdb/store"
+)
+
+// DefaultUsageSamples is the default number of the sampled elements of MemoryUsage
+const DefaultUsageSamples = 5
+
+// the store types holding the keys and data of the data types
+var usageStoreTypes = map[DataType][]byte{
+	KV:   {KVType},
+	LIST: {ListType, LMetaType},
+	HASH: {HashType, HSizeType},
+	SET:  {SetType, SSizeType},
+	ZSET: {ZSetType, ZSizeType, ZScoreType},
+}
+
+// DiskUsage is the approximate disk size of a database.
+type DiskUsage struct {
+	// all the keys of the database, including the TTL and meta keys
+	Total int64
+
+	Types map[DataType]int64
+}
+
+// StoreProperties returns the properties of the storage engine.
+func (l *Ledis) StoreProperties() (*store.Properties, error) {
+	return l.ldb.Properties()
+}
+
+func (l *Ledis) diskUsage(indexVarBuf []byte) (*DiskUsage, error) {
+	u := &DiskUsage{Types: make(map[DataType]int64, len(usageStoreTypes))}
+
+	var err error
+	min := append([]byte{}, indexVarBuf...)
+	max := prefixSuccessor(indexVarBuf)
+	if u.Total, err = l.ldb.ApproximateSize(min, max); err != nil {
+		return nil, err
+	}
+
+	for dataType, types := range usageStoreTypes {
+		for _, tp := range types {
+			min := append(append([]byte{}, indexVarBuf...), tp)
+			max := append(append([]byte{}, indexVarBuf...), tp+1)
+
+			n, err := l.ldb.ApproximateSize(min, max)
+			if err != nil {
+				return nil, err
+			}
+			u.Types[dataType] += n
+		}
+	}
+
+	return u, nil
+}
+
+// DiskUsage returns the approximate disk size of the database index, without selecting it.
+// It iterates all the keys of the database if the store can't estimate the size natively.
+func (l *Ledis) DiskUsage(index int) (*DiskUsage, error) {
+	if err := l.checkDBIndex(index); err != nil {
+		return nil, err
+	}
+
+	return l.diskUsage(encodeDBIndex(l.dbSlot(index)))
+}
+
+// DiskUsage returns the approximate disk size of the database.
+func (db *DB) DiskUsage() (*DiskUsage, error) {
+	return db.l.diskUsage(db.indexVarBuf)
+}
+
+func (db *DB) elementCount(dataType byte, key []byte) (int64, error) {
+	switch dataType {
+	case ListType:
+		return db.LLen(key)
+	case HashType:
+		return db.HLen(key)
+	case ZSetType:
+		return db.ZCard(key)
+	default:
+		return db.SCard(key)
+	}
+}
+
+// sampleUsage returns the total size of the keys and values in [min, max), it is estimated
+// by the first samples entries and the element count if the range has more entries.
+func (db *DB) sampleUsage(min []byte, max []byte, samples int, count func() (int64, error)) (int64, bool, error) {
+	it := db.bucket.RangeIterator(min, max, store.RangeROpen)
+	defer it.Close()
+
+	var n, size int64
+	for ; it.Valid(); it.Next() {
+		if samples > 0 && n == int64(samples) {
+			total, err := count()
+			if err != nil {
+				return 0, false, err
+			}
+			return size * total / n, false, nil
+		}
+
+		n++
+		size += int64(len(it.RawKey()) + len(it.RawValue()))
+	}
+
+	return size, true, nil
+}
+
+// MemoryUsage returns the estimated size of the key in all the data types, 0 if the key doesn't exist.
+// The data of hash, list, set and zset is estimated by the first samples elements, or counted exactly
+// if samples is 0. If the key has more elements and the store can estimate the disk size natively,
+// the approximate disk size is used unless it is 0, like the data is still in the memory table.
+func (db *DB) MemoryUsage(key []byte, samples int) (int64, error) {
+	if err := checkKeySize(key); err != nil {
+		return 0, err
+	}
+
+	types, err := db.existTypes(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, tp := range types {
+		mk := db.encodeKeyMetaKey(tp, key)
+		v, err := db.bucket.Get(mk)
+		if err != nil {
+			return 0, err
+		}
+
+		size += int64(len(mk) + len(v))
+		if tp == KVType {
+			continue
+		}
+
+		_, gen := decodeGenMeta(v)
+		ranges := gcDataRanges(db.indexVarBuf, tp, key, gen)
+
+		dataType := tp
+		count := func() (int64, error) {
+			return db.elementCount(dataType, key)
+		}
+
+		var sampled int64
+		exact := true
+		for _, r := range ranges {
+			n, ok, err := db.sampleUsage(r[0], r[1], samples, count)
+			if err != nil {
+				return 0, err
+			}
+			sampled += n
+			exact = exact && ok
+		}
+
+		var approximate int64
+		if !exact && db.l.ldb.SupportApproximateSize() {
+			for _, r := range ranges {
+				n, err := db.l.ldb.ApproximateSize(r[0], r[1])
+				if err != nil {
+					return 0, err
+				}
+				approximate += n
+			}
+		}
+
+		if approximate > 0 {
+			size += approximate
+		} else {
+			size += sampled
+		}
+	}
+
+	return size, nil
+}
@@ -0,0 +1,73 @@
+package ledis
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDBMemoryUsage(t *testing.T) {
+	getTestDB()
+	db, _ := testLedis.Select(7)
+	db.FlushAll()
+
+	key := []byte("usage_key")
+
+	if n, err := db.MemoryUsage(key, DefaultUsageSamples); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	db.Set(key, []byte("hello"))
+
+	kvSize := int64(len(db.encodeKVKey(key)) + len("hello"))
+	if n, err := db.MemoryUsage(key, DefaultUsageSamples); err != nil {
+		t.Fatal(err)
+	} else if n != kvSize {
+		t.Fatal(n, kvSize)
+	}
+
+	value := bytes.Repeat([]byte("v"), 1000)
+	for i := 0; i < 100; i++ {
+		db.HSet(key, []byte(fmt.Sprintf("field_%03d", i)), value)
+	}
+
+	all, err := db.MemoryUsage(key, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if all <= kvSize {
+		t.Fatal(all)
+	}
+
+	// all the fields have the same size, so the sampled estimate is exact
+	if !testLedis.ldb.SupportApproximateSize() {
+		if n, err := db.MemoryUsage(key, DefaultUsageSamples); err != nil {
+			t.Fatal(err)
+		} else if n != all {
+			t.Fatal(n, all)
+		}
+	}
+
+	if err := testLedis.CompactStore(); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the approximate size of a small range may be the size of the block holding it
+	if u.Types[HASH] <= 0 || u.Types[ZSET] >= u.Types[HASH] {
+		t.Fatal(u.Types)
+	} else if u.Total <= 0 {
+		t.Fatal(u.Total)
+	}
+
+	if _, err := testLedis.DiskUsage(MaxDatabases); err == nil {
+		t.Fatal("must error for the invalid index")
+	}
+
+	db.FlushAll()
+}
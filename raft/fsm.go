@@ -0,0 +1,76 @@
+package raft
+
+import (
+	"bytes"
+	"io"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/siddontang/go/log"
+)
+
+// fsm applies the committed logs to ledis.
+type fsm struct {
+	r *Raft
+}
+
+func (f *fsm) Apply(l *hraft.Log) interface{} {
+	if l.Type != hraft.LogCommand {
+		return nil
+	}
+
+	data := l.Data
+	if len(data) < tokenSize {
+		log.Errorf("invalid raft log %d", l.Index)
+		return errInvalidLog
+	}
+
+	local := bytes.Equal(data[0:tokenSize], f.r.token)
+
+	if err := f.r.ldb.ApplyConsensusLog(l.Index, data[tokenSize:], local); err != nil {
+		// the data can not go on with the other nodes
+		log.Fatalf("apply raft log %d error %s", l.Index, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (f *fsm) Snapshot() (hraft.FSMSnapshot, error) {
+	s, err := f.r.ldb.NewConsensusSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsmSnapshot{s}, nil
+}
+
+func (f *fsm) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	log.Infof("raft restores the snapshot")
+
+	if err := f.r.ldb.RestoreConsensusSnapshot(r); err != nil {
+		log.Errorf("raft restore snapshot error %s", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+type fsmSnapshot struct {
+	s *ledis.ConsensusSnapshot
+}
+
+func (s *fsmSnapshot) Persist(sink hraft.SnapshotSink) error {
+	if err := s.s.Dump(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {
+	s.s.Close()
+}
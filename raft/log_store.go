@@ -0,0 +1,110 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/ledisdb/ledisdb/rpl"
+)
+
+/*
+The raft logs are saved in the goleveldb store of the replication logs, the raft
+fields are encoded in the data of rpl.Log with the index as the log ID:
+
+	term(8 bytes) + type(1 byte) + extensions length(4 bytes) + extensions + data
+*/
+const logHeadSize = 13
+
+var errInvalidLog = errors.New("invalid raft log")
+
+type logStore struct {
+	s *rpl.GoLevelDBStore
+}
+
+func newLogStore(base string) (*logStore, error) {
+	// the raft logs must be synced before they are acknowledged
+	s, err := rpl.NewGoLevelDBStore(base, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logStore{s}, nil
+}
+
+func (s *logStore) FirstIndex() (uint64, error) {
+	return s.s.FirstID()
+}
+
+func (s *logStore) LastIndex() (uint64, error) {
+	return s.s.LastID()
+}
+
+func (s *logStore) GetLog(index uint64, log *hraft.Log) error {
+	rl := new(rpl.Log)
+	if err := s.s.GetLog(index, rl); err == rpl.ErrLogNotFound {
+		return hraft.ErrLogNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return decodeLog(rl, log)
+}
+
+func (s *logStore) StoreLog(log *hraft.Log) error {
+	return s.s.StoreLog(encodeLog(log))
+}
+
+func (s *logStore) StoreLogs(logs []*hraft.Log) error {
+	for _, log := range logs {
+		if err := s.StoreLog(log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *logStore) DeleteRange(min uint64, max uint64) error {
+	return s.s.DeleteRange(min, max)
+}
+
+func (s *logStore) Close() error {
+	return s.s.Close()
+}
+
+func encodeLog(log *hraft.Log) *rpl.Log {
+	buf := make([]byte, logHeadSize+len(log.Extensions)+len(log.Data))
+
+	binary.BigEndian.PutUint64(buf, log.Term)
+	buf[8] = byte(log.Type)
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(log.Extensions)))
+
+	pos := logHeadSize
+	pos += copy(buf[pos:], log.Extensions)
+	copy(buf[pos:], log.Data)
+
+	return &rpl.Log{ID: log.Index, Data: buf}
+}
+
+func decodeLog(rl *rpl.Log, log *hraft.Log) error {
+	buf := rl.Data
+	if len(buf) < logHeadSize {
+		return errInvalidLog
+	}
+
+	extLen := int(binary.BigEndian.Uint32(buf[9:]))
+	if len(buf) < logHeadSize+extLen {
+		return errInvalidLog
+	}
+
+	log.Index = rl.ID
+	log.Term = binary.BigEndian.Uint64(buf)
+	log.Type = hraft.LogType(buf[8])
+	log.Extensions = nil
+	if extLen > 0 {
+		log.Extensions = buf[logHeadSize : logHeadSize+extLen]
+	}
+	log.Data = buf[logHeadSize+extLen:]
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package raft
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+func TestLogStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := newLogStore(path.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer s.Close()
+
+	logs := []*hraft.Log{
+		{Index: 1, Term: 1, Type: hraft.LogConfiguration, Data: []byte("conf")},
+		{Index: 2, Term: 1, Type: hraft.LogCommand, Data: []byte("a"), Extensions: []byte("ext")},
+		{Index: 3, Term: 2, Type: hraft.LogNoop},
+	}
+
+	if err = s.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if idx, _ := s.FirstIndex(); idx != 1 {
+		t.Fatalf("bad first index %d", idx)
+	} else if idx, _ = s.LastIndex(); idx != 3 {
+		t.Fatalf("bad last index %d", idx)
+	}
+
+	for _, l := range logs {
+		var got hraft.Log
+		if err = s.GetLog(l.Index, &got); err != nil {
+			t.Fatalf("err: %v ", err)
+		}
+
+		if len(got.Data) == 0 {
+			got.Data = nil
+		}
+
+		if !reflect.DeepEqual(&got, l) {
+			t.Fatalf("bad log %v != %v", got, l)
+		}
+	}
+
+	var l hraft.Log
+	if err = s.GetLog(4, &l); err != hraft.ErrLogNotFound {
+		t.Fatalf("bad err %v", err)
+	}
+
+	// the conflicting logs at the end are replaced
+	if err = s.DeleteRange(2, 3); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if err = s.StoreLog(&hraft.Log{Index: 2, Term: 3, Type: hraft.LogCommand, Data: []byte("b")}); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if err = s.GetLog(2, &l); err != nil {
+		t.Fatalf("err: %v ", err)
+	} else if l.Term != 3 || string(l.Data) != "b" {
+		t.Fatalf("bad log %v", l)
+	}
+
+	// the compacted logs at the beginning are deleted
+	if err = s.DeleteRange(1, 1); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if idx, _ := s.FirstIndex(); idx != 2 {
+		t.Fatalf("bad first index %d", idx)
+	} else if idx, _ = s.LastIndex(); idx != 2 {
+		t.Fatalf("bad last index %d", idx)
+	}
+}
+
+func TestStableStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raft")
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := path.Join(dir, "stable.json")
+
+	s, err := newStableStore(name)
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if _, err = s.GetUint64([]byte("term")); err == nil || err.Error() != "not found" {
+		t.Fatalf("bad err %v", err)
+	}
+
+	if err = s.SetUint64([]byte("term"), 10); err != nil {
+		t.Fatalf("err: %v ", err)
+	} else if err = s.Set([]byte("vote"), []byte("a")); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	// reopen
+	if s, err = newStableStore(name); err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	if v, err := s.GetUint64([]byte("term")); err != nil || v != 10 {
+		t.Fatalf("bad term %d, err: %v", v, err)
+	} else if v, err := s.Get([]byte("vote")); err != nil || string(v) != "a" {
+		t.Fatalf("bad vote %s, err: %v", v, err)
+	}
+}
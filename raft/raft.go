@@ -0,0 +1,345 @@
+package raft
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/siddontang/go/log"
+	"github.com/siddontang/go/sync2"
+)
+
+/*
+	In the raft mode, every write batch of ledis is committed as a raft log by the majority
+	of the group before it is applied, so the acknowledged writes are never lost after the
+	leader is down, and the node with all the committed logs is elected as the new leader.
+
+	Only the leader serves the data commands, and it checks the leadership with the majority
+	before every command, so the reads are linearizable, the other nodes are read only and
+	reply the NOTLEADER error with the leader address.
+
+	The ID of a node is its server address, the raft logs are saved in the goleveldb store
+	of the replication logs, and the snapshots are the dumps of ledis.
+*/
+
+// every process prefixes a random token to the logs it commits, the token tells whether
+// the log is committed by this process when it is applied
+const tokenSize = 16
+
+const (
+	snapshotRetain = 2
+
+	transportMaxPool = 3
+	transportTimeout = 10 * time.Second
+)
+
+var errNoLeader = errors.New("NOTLEADER no leader now")
+
+type Raft struct {
+	cfg *config.Config
+
+	ldb *ledis.Ledis
+
+	token []byte
+
+	r *hraft.Raft
+
+	logs  *logStore
+	trans *hraft.NetworkTransport
+
+	// the leader serves after it applies all the logs of the previous leaders
+	ready sync2.AtomicBool
+
+	notifyCh chan bool
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// logWriter writes the logs of hashicorp/raft to the ledis log.
+type logWriter struct{}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	log.Info(string(bytes.TrimSpace(p)))
+	return len(p), nil
+}
+
+// NewRaft begins the raft mode of ledis, the group is bootstrapped with the peers
+// in the config if this node is one of them and has no raft state.
+func NewRaft(cfg *config.Config, ldb *ledis.Ledis) (*Raft, error) {
+	r := new(Raft)
+
+	r.cfg = cfg
+	r.ldb = ldb
+	r.notifyCh = make(chan bool, 16)
+	r.quit = make(chan struct{})
+
+	r.token = make([]byte, tokenSize)
+	if _, err := rand.Read(r.token); err != nil {
+		return nil, err
+	}
+
+	base := cfg.Raft.Path
+	if len(base) == 0 {
+		base = path.Join(cfg.DataDir, "raft")
+	}
+
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return nil, err
+	}
+
+	// only the leader can write
+	cfg.SetReadonly(true)
+
+	if err := ldb.SetConsensus(r); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if r.logs, err = newLogStore(path.Join(base, "log")); err != nil {
+		return nil, err
+	}
+
+	stable, err := newStableStore(path.Join(base, "stable.json"))
+	if err != nil {
+		r.logs.Close()
+		return nil, err
+	}
+
+	snaps, err := hraft.NewFileSnapshotStore(base, snapshotRetain, logWriter{})
+	if err != nil {
+		r.logs.Close()
+		return nil, err
+	}
+
+	if r.trans, err = hraft.NewTCPTransport(cfg.Raft.Addr, nil, transportMaxPool, transportTimeout, logWriter{}); err != nil {
+		r.logs.Close()
+		return nil, err
+	}
+
+	conf, err := r.newConfig(snaps)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+
+	if err = r.bootstrap(conf, stable, snaps); err != nil {
+		r.close()
+		return nil, err
+	}
+
+	if r.r, err = hraft.NewRaft(conf, &fsm{r}, r.logs, stable, snaps, r.trans); err != nil {
+		r.close()
+		return nil, err
+	}
+
+	r.wg.Add(1)
+	go r.onLeadership()
+
+	return r, nil
+}
+
+func (r *Raft) newConfig(snaps *hraft.FileSnapshotStore) (*hraft.Config, error) {
+	timeout := time.Duration(r.cfg.Raft.HeartbeatTimeout) * time.Millisecond
+
+	conf := hraft.DefaultConfig()
+	conf.LocalID = hraft.ServerID(r.cfg.Addr)
+	conf.HeartbeatTimeout = timeout
+	conf.ElectionTimeout = timeout
+	conf.LeaderLeaseTimeout = timeout / 2
+	conf.SnapshotThreshold = uint64(r.cfg.Raft.SnapshotThreshold)
+	conf.NotifyCh = r.notifyCh
+	conf.LogOutput = logWriter{}
+	conf.LogLevel = "INFO"
+
+	// the data of ledis is persistent with the applied index, so the snapshot is restored
+	// only if the data is older than it
+	snapshots, err := snaps.List()
+	if err != nil {
+		return nil, err
+	}
+	conf.NoSnapshotRestoreOnStart = len(snapshots) == 0 || snapshots[0].Index <= r.ldb.AppliedIndex()
+
+	return conf, hraft.ValidateConfig(conf)
+}
+
+func (r *Raft) bootstrap(conf *hraft.Config, stable hraft.StableStore, snaps hraft.SnapshotStore) error {
+	servers := make([]hraft.Server, 0, len(r.cfg.Raft.Peers))
+
+	found := false
+	for _, p := range r.cfg.Raft.Peers {
+		servers = append(servers, hraft.Server{
+			Suffrage: hraft.Voter,
+			ID:       hraft.ServerID(p.Addr),
+			Address:  hraft.ServerAddress(p.RaftAddr),
+		})
+
+		found = found || p.Addr == r.cfg.Addr
+	}
+
+	// the node not in the peers waits to join the group
+	if !found {
+		return nil
+	}
+
+	if ok, err := hraft.HasExistingState(r.logs, stable, snaps); err != nil || ok {
+		return err
+	}
+
+	log.Infof("raft bootstraps the group with %d peers", len(servers))
+
+	return hraft.BootstrapCluster(conf, r.logs, stable, snaps, r.trans, hraft.Configuration{Servers: servers})
+}
+
+// onLeadership makes ledis writable after this node is the leader and applies all the
+// committed logs, and read only after it is not.
+func (r *Raft) onLeadership() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case leader := <-r.notifyCh:
+			if !leader {
+				log.Infof("raft loses the leadership")
+
+				r.ready.Set(false)
+				r.cfg.SetReadonly(true)
+				continue
+			}
+
+			if err := r.r.Barrier(0).Error(); err != nil {
+				log.Errorf("raft leader applies the logs error %s", err.Error())
+				continue
+			}
+
+			log.Infof("raft becomes the leader")
+
+			r.cfg.SetReadonly(false)
+			r.ready.Set(true)
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// Commit commits the data by the group, it returns after the data is applied on this node.
+func (r *Raft) Commit(data []byte) error {
+	buf := make([]byte, tokenSize+len(data))
+	copy(buf, r.token)
+	copy(buf[tokenSize:], data)
+
+	f := r.r.Apply(buf, 0)
+	if err := f.Error(); err == hraft.ErrNotLeader {
+		return r.notLeaderError()
+	} else if err != nil {
+		return err
+	}
+
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// CheckLeader returns the NOTLEADER error if this node is not the leader confirmed by
+// the majority, the commands must call it first for the linearizable reads.
+func (r *Raft) CheckLeader() error {
+	if !r.ready.Get() {
+		return r.notLeaderError()
+	}
+
+	if err := r.r.VerifyLeader().Error(); err != nil {
+		return r.notLeaderError()
+	}
+	return nil
+}
+
+func (r *Raft) notLeaderError() error {
+	if addr := r.Leader(); len(addr) > 0 {
+		return fmt.Errorf("NOTLEADER %s", addr)
+	}
+	return errNoLeader
+}
+
+// Leader returns the server address of the leader, empty if it is unknown.
+func (r *Raft) Leader() string {
+	addr := r.r.Leader()
+	if len(addr) == 0 {
+		return ""
+	}
+
+	servers, err := r.Servers()
+	if err != nil {
+		return ""
+	}
+
+	for _, s := range servers {
+		if s.Address == addr {
+			return string(s.ID)
+		}
+	}
+	return ""
+}
+
+// IsLeader returns whether this node is the leader serving the commands.
+func (r *Raft) IsLeader() bool {
+	return r.ready.Get()
+}
+
+// Servers returns the nodes of the group.
+func (r *Raft) Servers() ([]hraft.Server, error) {
+	f := r.r.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+
+	return f.Configuration().Servers, nil
+}
+
+// Join adds the node with the server address and the raft address as a voter, it must be called on the leader.
+func (r *Raft) Join(addr string, raftAddr string) error {
+	err := r.r.AddVoter(hraft.ServerID(addr), hraft.ServerAddress(raftAddr), 0, 0).Error()
+	if err == hraft.ErrNotLeader {
+		return r.notLeaderError()
+	}
+	return err
+}
+
+// Remove removes the node with the server address, it must be called on the leader.
+func (r *Raft) Remove(addr string) error {
+	err := r.r.RemoveServer(hraft.ServerID(addr), 0, 0).Error()
+	if err == hraft.ErrNotLeader {
+		return r.notLeaderError()
+	}
+	return err
+}
+
+// Stats returns the statistics of hashicorp/raft.
+func (r *Raft) Stats() map[string]string {
+	return r.r.Stats()
+}
+
+// Close shuts down the raft, it must be called before ledis is closed.
+func (r *Raft) Close() {
+	if err := r.r.Shutdown().Error(); err != nil {
+		log.Errorf("raft shutdown error %s", err.Error())
+	}
+
+	close(r.quit)
+	r.wg.Wait()
+
+	r.close()
+}
+
+func (r *Raft) close() {
+	r.trans.Close()
+	r.logs.Close()
+}
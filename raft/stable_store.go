@@ -0,0 +1,105 @@
+package raft
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// errKeyNotFound must have the text "not found", which hashicorp/raft checks.
+var errKeyNotFound = errors.New("not found")
+
+// stableStore saves the term and the vote in a json file, they are changed rarely.
+type stableStore struct {
+	m sync.Mutex
+
+	name string
+
+	kvs map[string][]byte
+}
+
+func newStableStore(name string) (*stableStore, error) {
+	s := new(stableStore)
+	s.name = name
+	s.kvs = make(map[string][]byte)
+
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &s.kvs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *stableStore) Set(key []byte, val []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.kvs[string(key)] = append([]byte(nil), val...)
+	return s.save()
+}
+
+func (s *stableStore) Get(key []byte) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	v, ok := s.kvs[string(key)]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return v, nil
+}
+
+func (s *stableStore) SetUint64(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return s.Set(key, buf)
+}
+
+func (s *stableStore) GetUint64(key []byte) (uint64, error) {
+	v, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	} else if len(v) != 8 {
+		return 0, errors.New("invalid uint64 value")
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// save writes a temporary file then renames it, so the file is never half written.
+func (s *stableStore) save() error {
+	data, err := json.Marshal(s.kvs)
+	if err != nil {
+		return err
+	}
+
+	tmp := path.Join(path.Dir(s.name), "."+path.Base(s.name)+".tmp")
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.name)
+}
@@ -1,6 +1,7 @@
 package rpl
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/store/encrypted"
 	"github.com/siddontang/go/log"
 	"github.com/siddontang/go/num"
 )
@@ -19,6 +21,9 @@ const (
 	maxLogFileSize = int64(1024 * 1024 * 1024)
 
 	defaultLogNumInFile = int64(1024 * 1024)
+
+	// the compression flag of the log encrypted in the file, never sent to the slaves
+	logEncrypted = uint8(0x80)
 )
 
 /*
@@ -41,6 +46,9 @@ const (
 	//sha1 of github.com/ledisdb/ledisdb 20 bytes
 	magic data = "\x1c\x1d\xb8\x88\xff\x9e\x45\x55\x40\xf0\x4c\xda\xe0\xce\x47\xde\x65\x48\x71\x17"
 
+	if the encryption key file is set, the log data is encrypted with the log id as the
+	additional data, and the high bit of the compression is set.
+
 	we must guarantee that the log id is monotonic increment strictly.
 	if log1's id is 1, log2 must be 2
 */
@@ -50,6 +58,9 @@ type FileStore struct {
 
 	cfg *config.Config
 
+	// the keys to encrypt the logs, nil if no encryption
+	ks *encrypted.Keys
+
 	base string
 
 	rm sync.RWMutex
@@ -82,6 +93,12 @@ func NewFileStore(base string, cfg *config.Config) (*FileStore, error) {
 
 	s.cfg = cfg
 
+	if len(cfg.Encryption.KeyFile) > 0 {
+		if s.ks, err = encrypted.LoadKeys(cfg.Encryption.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = s.load(); err != nil {
 		return nil, err
 	}
@@ -100,6 +117,14 @@ func NewFileStore(base string, cfg *config.Config) (*FileStore, error) {
 }
 
 func (s *FileStore) GetLog(id uint64, l *Log) error {
+	if err := s.getLog(id, l); err != nil {
+		return err
+	}
+
+	return s.decryptLog(l)
+}
+
+func (s *FileStore) getLog(id uint64, l *Log) error {
 	//first search in table writer
 	if err := s.w.GetLog(id, l); err == nil {
 		return nil
@@ -159,7 +184,39 @@ func (s *FileStore) LastID() (uint64, error) {
 	return id, nil
 }
 
+// the log id is authenticated with the encrypted data, so the log data can't be moved
+func logAD(l *Log) []byte {
+	ad := make([]byte, 8)
+	binary.BigEndian.PutUint64(ad, l.ID)
+	return ad
+}
+
+func (s *FileStore) decryptLog(l *Log) error {
+	if l.Compression&logEncrypted == 0 {
+		return nil
+	} else if s.ks == nil {
+		return fmt.Errorf("log %d is encrypted but no key file is set", l.ID)
+	}
+
+	data, err := s.ks.Open(nil, l.Data, logAD(l))
+	if err != nil {
+		return err
+	}
+
+	l.Compression &^= logEncrypted
+	l.Data = data
+	return nil
+}
+
 func (s *FileStore) StoreLog(l *Log) error {
+	if s.ks != nil {
+		// l is still used by the caller, so the encrypted log is a copy
+		el := *l
+		el.Compression |= logEncrypted
+		el.Data = s.ks.Seal(nil, l.Data, logAD(l))
+		l = &el
+	}
+
 	s.wm.Lock()
 	err := s.storeLog(l)
 	s.wm.Unlock()
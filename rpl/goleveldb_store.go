@@ -100,7 +100,8 @@ func (s *GoLevelDBStore) StoreLog(log *Log) error {
 
 	s.buf.Reset()
 
-	if log.ID != last+1 {
+	// the empty store can begin with any log, like after a snapshot is loaded
+	if last != InvalidLogID && log.ID != last+1 {
 		return ErrStoreLogID
 	}
 
@@ -157,6 +158,26 @@ func (s *GoLevelDBStore) PurgeExpired(n int64) error {
 	return nil
 }
 
+// DeleteRange deletes the logs in [min, max], raft uses it to remove the
+// conflicting logs at the end and the compacted logs at the beginning.
+func (s *GoLevelDBStore) DeleteRange(min uint64, max uint64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.reset()
+
+	w := s.db.NewWriteBatch()
+	defer w.Rollback()
+
+	it := s.db.RangeIterator(num.Uint64ToBytes(min), num.Uint64ToBytes(max), store.RangeClose)
+	for ; it.Valid(); it.Next() {
+		w.Delete(it.RawKey())
+	}
+	it.Close()
+
+	return w.Commit()
+}
+
 func (s *GoLevelDBStore) Sync() error {
 	//no other way for sync, so ignore here
 	return nil
@@ -0,0 +1,183 @@
+package rpl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+/*
+	The replication ID is the lineage of the logs, the logs with the same ID and log ID are
+	the same. A master starts a new ID when it is promoted or its logs are cleared, and keeps
+	the ID of its old master with the last log ID of it, so the slaves of the old master can
+	continue with the promoted master if it has their last logs. A slave takes the ID of its master.
+
+	The ID is saved in the replication path as JSON, the ID of the store created before it is
+	empty, and the slave with the empty ID continues like before.
+
+	A slave with a replication filter keeps the filter of its last full sync with the ID,
+	the logs can't be continued with another filter, the data selected before is different.
+*/
+
+const idFileName = "repl.id"
+
+// ID is the replication ID and the previous one.
+type ID struct {
+	ID string `json:"id"`
+
+	// the ID before the promotion, and the last log ID of it
+	PrevID        string `json:"prev_id,omitempty"`
+	PrevLastLogID uint64 `json:"prev_last_log_id,omitempty"`
+
+	// the replication filter of the data, empty for all the data
+	Filter string `json:"filter,omitempty"`
+}
+
+func newID() string {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (r *Replication) loadID() error {
+	data, err := ioutil.ReadFile(path.Join(r.cfg.Replication.Path, idFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &r.id)
+}
+
+func (r *Replication) saveID(id ID) error {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(r.cfg.Replication.Path, idFileName)
+	if err = ioutil.WriteFile(name+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	r.id = id
+	return nil
+}
+
+// lastID returns the last log ID, which may be only committed after the logs are cleared.
+func (r *Replication) lastID() (uint64, error) {
+	id, err := r.s.LastID()
+	if err != nil {
+		return 0, err
+	}
+
+	if id < r.commitID {
+		id = r.commitID
+	}
+	return id, nil
+}
+
+// ensureID starts an ID if there is none, before the logs are created or sent.
+func (r *Replication) ensureID() error {
+	if len(r.id.ID) > 0 {
+		return nil
+	}
+	return r.saveID(ID{ID: newID()})
+}
+
+// ID returns the replication ID, which is empty before any log is created or sent.
+func (r *Replication) ID() ID {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.id
+}
+
+// Promote starts a new ID after the slave is promoted to a master,
+// and keeps the ID of its old master with the last log ID.
+func (r *Replication) Promote() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	last, err := r.lastID()
+	if err != nil {
+		return err
+	}
+
+	return r.saveID(ID{ID: newID(), PrevID: r.id.ID, PrevLastLogID: last, Filter: r.id.Filter})
+}
+
+// Follow takes the ID of the master which has the logs of this slave,
+// and keeps the ID before if it is changed, like the master is promoted.
+func (r *Replication) Follow(id string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if id == r.id.ID {
+		return nil
+	} else if len(r.id.ID) == 0 {
+		return r.saveID(ID{ID: id, Filter: r.id.Filter})
+	}
+
+	last, err := r.lastID()
+	if err != nil {
+		return err
+	}
+
+	return r.saveID(ID{ID: id, PrevID: r.id.ID, PrevLastLogID: last, Filter: r.id.Filter})
+}
+
+// Reset takes the ID of the master after the full data of it is loaded,
+// with the replication filter of the loaded data.
+func (r *Replication) Reset(id string, filter string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.saveID(ID{ID: id, Filter: filter})
+}
+
+// has returns whether the log lastLogID of the ID is in the logs.
+func (r *Replication) has(id string, lastLogID uint64, last uint64) bool {
+	if len(id) == 0 {
+		return false
+	}
+	return (id == r.id.ID && lastLogID <= last) || (id == r.id.PrevID && lastLogID <= r.id.PrevLastLogID)
+}
+
+// CanContinue returns whether the slave with the ID and the last log ID can continue to
+// sync the logs after it, otherwise its logs diverge and it needs the full data.
+func (r *Replication) CanContinue(id ID, lastLogID uint64) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if err := r.ensureID(); err != nil {
+		return false, err
+	}
+
+	// the empty slave, or the slave created before the ID
+	if lastLogID == 0 || len(id.ID) == 0 {
+		return true, nil
+	}
+
+	last, err := r.lastID()
+	if err != nil {
+		return false, err
+	}
+
+	if r.has(id.ID, lastLogID, last) {
+		return true, nil
+	}
+
+	// the promoted slave without new logs is still a slave of the old master
+	return lastLogID <= id.PrevLastLogID && r.has(id.PrevID, lastLogID, last), nil
+}
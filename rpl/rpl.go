@@ -2,6 +2,8 @@ package rpl
 
 import (
 	"encoding/binary"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"sync"
@@ -12,6 +14,8 @@ import (
 	"github.com/siddontang/go/snappy"
 )
 
+const pauseFileName = "pause.id"
+
 type Stat struct {
 	FirstID  uint64
 	LastID   uint64
@@ -28,12 +32,20 @@ type Replication struct {
 	commitID  uint64
 	commitLog *os.File
 
+	// the log ID from which the slave doesn't apply the logs, 0 if not paused
+	pauseID uint64
+
+	id ID
+
 	quit chan struct{}
 
 	wg sync.WaitGroup
 
 	nc chan struct{}
 
+	// closed and renewed after the commit ID is updated
+	cc chan struct{}
+
 	ncm sync.Mutex
 }
 
@@ -48,6 +60,7 @@ func NewReplication(cfg *config.Config) (*Replication, error) {
 
 	r.quit = make(chan struct{})
 	r.nc = make(chan struct{})
+	r.cc = make(chan struct{})
 
 	r.cfg = cfg
 
@@ -74,6 +87,14 @@ func NewReplication(cfg *config.Config) (*Replication, error) {
 		return nil, err
 	}
 
+	if err = r.loadID(); err != nil {
+		return nil, err
+	}
+
+	if err = r.loadPauseID(); err != nil {
+		return nil, err
+	}
+
 	log.Infof("staring replication with commit ID %d", r.commitID)
 
 	r.wg.Add(1)
@@ -120,6 +141,11 @@ func (r *Replication) Log(data []byte) (*Log, error) {
 
 	r.m.Lock()
 
+	if err := r.ensureID(); err != nil {
+		r.m.Unlock()
+		return nil, err
+	}
+
 	lastID, err := r.s.LastID()
 	if err != nil {
 		r.m.Unlock()
@@ -153,12 +179,17 @@ func (r *Replication) Log(data []byte) (*Log, error) {
 
 	r.m.Unlock()
 
+	r.noticeLog()
+
+	return l, nil
+}
+
+// noticeLog wakes up the waiters of WaitLog.
+func (r *Replication) noticeLog() {
 	r.ncm.Lock()
 	close(r.nc)
 	r.nc = make(chan struct{})
 	r.ncm.Unlock()
-
-	return l, nil
 }
 
 func (r *Replication) WaitLog() <-chan struct{} {
@@ -168,11 +199,33 @@ func (r *Replication) WaitLog() <-chan struct{} {
 	return ch
 }
 
+// noticeCommit wakes up the waiters of WaitCommit.
+func (r *Replication) noticeCommit() {
+	r.ncm.Lock()
+	close(r.cc)
+	r.cc = make(chan struct{})
+	r.ncm.Unlock()
+}
+
+// WaitCommit returns the channel closed after the commit ID is updated.
+func (r *Replication) WaitCommit() <-chan struct{} {
+	r.ncm.Lock()
+	ch := r.cc
+	r.ncm.Unlock()
+	return ch
+}
+
+// StoreLog stores the log received from the master with its ID,
+// and wakes up the waiters to send it to the slaves of this slave.
 func (r *Replication) StoreLog(log *Log) error {
 	r.m.Lock()
 	err := r.s.StoreLog(log)
 	r.m.Unlock()
 
+	if err == nil {
+		r.noticeLog()
+	}
+
 	return err
 }
 
@@ -203,9 +256,61 @@ func (r *Replication) UpdateCommitID(id uint64) error {
 	err := r.updateCommitID(id, r.cfg.Replication.SyncLog == 2)
 	r.m.Unlock()
 
+	if err == nil {
+		r.noticeCommit()
+	}
+
 	return err
 }
 
+func (r *Replication) loadPauseID() error {
+	data, err := ioutil.ReadFile(path.Join(r.cfg.Replication.Path, pauseFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if len(data) != 8 {
+		return fmt.Errorf("invalid pause log id file, size %d", len(data))
+	}
+
+	r.pauseID = binary.BigEndian.Uint64(data)
+	return nil
+}
+
+// PauseID returns the log ID from which the logs are not applied, 0 if not paused.
+func (r *Replication) PauseID() uint64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.pauseID
+}
+
+// UpdatePauseID saves the log ID from which the logs are not applied, so the pause is
+// kept after the restart, 0 to resume.
+func (r *Replication) UpdatePauseID(id uint64) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	name := path.Join(r.cfg.Replication.Path, pauseFileName)
+	if id == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint64(data, id)
+
+		if err := ioutil.WriteFile(name+".tmp", data, 0644); err != nil {
+			return err
+		} else if err = os.Rename(name+".tmp", name); err != nil {
+			return err
+		}
+	}
+
+	r.pauseID = id
+	return nil
+}
+
 func (r *Replication) Stat() (*Stat, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
@@ -289,6 +394,11 @@ func (r *Replication) ClearWithCommitID(id uint64) error {
 		return err
 	}
 
+	// the new logs are not the same as the cleared ones
+	if err := r.saveID(ID{ID: newID(), Filter: r.id.Filter}); err != nil {
+		return err
+	}
+
 	return r.updateCommitID(id, true)
 }
 
@@ -43,3 +43,98 @@ func TestReplication(t *testing.T) {
 
 	r.Close()
 }
+
+func TestReplicationID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpl")
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := config.NewConfigDefault()
+	c.Replication.Path = dir
+
+	r, err := NewReplication(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := r.ID(); len(id.ID) != 0 {
+		t.Fatal("the ID must be empty before any log")
+	}
+
+	for i := 0; i < 3; i++ {
+		if l, err := r.Log([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		} else {
+			r.UpdateCommitID(l.ID)
+		}
+	}
+
+	old := r.ID()
+	if len(old.ID) == 0 {
+		t.Fatal("the ID must be started by the log")
+	}
+
+	checkContinue := func(id ID, lastLogID uint64, expected bool) {
+		if ok, err := r.CanContinue(id, lastLogID); err != nil {
+			t.Fatal(err)
+		} else if ok != expected {
+			t.Fatalf("continue %v with %v at %d", ok, id, lastLogID)
+		}
+	}
+
+	checkContinue(old, 3, true)
+	checkContinue(old, 4, false)
+	checkContinue(ID{ID: "other"}, 1, false)
+	checkContinue(ID{ID: "other"}, 0, true)
+	checkContinue(ID{}, 2, true)
+
+	// the slave of the old master can continue with the promoted one
+	if err = r.Promote(); err != nil {
+		t.Fatal(err)
+	}
+
+	id := r.ID()
+	if id.ID == old.ID || id.PrevID != old.ID || id.PrevLastLogID != 3 {
+		t.Fatalf("invalid promoted ID %v", id)
+	}
+
+	if l, err := r.Log([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	} else {
+		r.UpdateCommitID(l.ID)
+	}
+
+	checkContinue(old, 3, true)
+	checkContinue(old, 4, false)
+	checkContinue(id, 4, true)
+
+	// the promoted slave without new logs can continue with its old master
+	checkContinue(ID{ID: "promoted", PrevID: id.ID, PrevLastLogID: 4}, 4, true)
+	checkContinue(ID{ID: "promoted", PrevID: id.ID, PrevLastLogID: 3}, 4, false)
+
+	if err = r.Follow("master"); err != nil {
+		t.Fatal(err)
+	} else if f := r.ID(); f.ID != "master" || f.PrevID != id.ID || f.PrevLastLogID != 4 {
+		t.Fatalf("invalid followed ID %v", f)
+	}
+
+	r.Close()
+
+	// the ID is saved
+	if r, err = NewReplication(c); err != nil {
+		t.Fatal(err)
+	} else if r.ID().ID != "master" {
+		t.Fatal(r.ID())
+	}
+
+	// the cleared logs start a new ID
+	if err = r.Clear(); err != nil {
+		t.Fatal(err)
+	} else if id := r.ID(); id.ID == "master" || len(id.PrevID) != 0 {
+		t.Fatal(id)
+	}
+
+	r.Close()
+}
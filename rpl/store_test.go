@@ -1,8 +1,11 @@
 package rpl
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/ledisdb/ledisdb/config"
@@ -26,6 +29,66 @@ func TestGoLevelDBStore(t *testing.T) {
 	testLogs(t, l)
 }
 
+func TestGoLevelDBStoreDeleteRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := NewGoLevelDBStore(dir, 0)
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer l.Close()
+
+	checkIDs := func(first uint64, last uint64) {
+		if id, err := l.FirstID(); err != nil || id != first {
+			t.Fatalf("bad first id %d, err: %v", id, err)
+		} else if id, err = l.LastID(); err != nil || id != last {
+			t.Fatalf("bad last id %d, err: %v", id, err)
+		}
+	}
+
+	// the empty store begins with any log
+	for i := 5; i <= 20; i++ {
+		if err := l.StoreLog(&Log{ID: uint64(i)}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	checkIDs(5, 20)
+
+	if err = l.StoreLog(&Log{ID: 22}); err != ErrStoreLogID {
+		t.Fatalf("err: %v", err)
+	}
+
+	// the conflicting logs at the end
+	if err = l.DeleteRange(16, 20); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	checkIDs(5, 15)
+
+	if err = l.StoreLog(&Log{ID: 16}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// the compacted logs at the beginning
+	if err = l.DeleteRange(5, 10); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	checkIDs(11, 16)
+
+	var out Log
+	if err = l.GetLog(10, &out); err != ErrLogNotFound {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err = l.DeleteRange(11, 16); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	checkIDs(0, 0)
+}
+
 func TestFileStore(t *testing.T) {
 	// Create a test dir
 	dir, err := ioutil.TempDir("", "ldb")
@@ -47,6 +110,58 @@ func TestFileStore(t *testing.T) {
 	testLogs(t, l)
 }
 
+func TestEncryptedFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldb")
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.NewConfigDefault()
+	cfg.Replication.MaxLogFileSize = 4096
+	cfg.Encryption.KeyFile = path.Join(dir, "key")
+
+	if err = ioutil.WriteFile(cfg.Encryption.KeyFile, []byte(strings.Repeat("ab", 32)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	base := path.Join(dir, "rpl")
+	l, err := NewFileStore(base, cfg)
+	if err != nil {
+		t.Fatalf("err: %v ", err)
+	}
+
+	testLogs(t, l)
+
+	data := []byte("encrypted replication log")
+	id, _ := l.LastID()
+	if err = l.StoreLog(&Log{ID: id + 1, Compression: 1, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// no plain data in the log files
+	fs, _ := ioutil.ReadDir(base)
+	for _, f := range fs {
+		b, _ := ioutil.ReadFile(path.Join(base, f.Name()))
+		if bytes.Contains(b, data) {
+			t.Fatalf("plain log in %s", f.Name())
+		}
+	}
+
+	if l, err = NewFileStore(base, cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var log Log
+	if err = l.GetLog(id+1, &log); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(log.Data, data) || log.Compression != 1 {
+		t.Fatalf("invalid log %q %d", log.Data, log.Compression)
+	}
+}
+
 func testLogs(t *testing.T, l LogStore) {
 	// Should be no first index
 	idx, err := l.FirstID()
@@ -0,0 +1,326 @@
+package sentinel
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siddontang/goredis"
+)
+
+const switchMasterChannel = "+switch-master"
+
+var (
+	errCmdParams = errors.New("ERR invalid command param")
+	errNoMaster  = errors.New("ERR no such master with that name")
+)
+
+type subscriber struct {
+	channels map[string]struct{}
+
+	// the messages are dropped if the subscriber is too slow
+	msgs chan []interface{}
+}
+
+func (s *Sentinel) onConn(nc net.Conn) {
+	s.m.Lock()
+	select {
+	case <-s.quit:
+		s.m.Unlock()
+		nc.Close()
+		return
+	default:
+		s.conns[nc] = struct{}{}
+	}
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, nc)
+		s.m.Unlock()
+
+		nc.Close()
+	}()
+
+	c, _ := goredis.NewConn(nc)
+
+	for {
+		req, err := c.ReceiveRequest()
+		if err != nil || len(req) == 0 {
+			return
+		}
+
+		cmd := strings.ToLower(string(req[0]))
+		args := req[1:]
+
+		var reply interface{}
+		switch cmd {
+		case "ping":
+			reply = "PONG"
+		case "sentinel":
+			reply = s.sentinelCommand(args)
+		case "subscribe":
+			if len(args) == 0 {
+				reply = errCmdParams
+				break
+			}
+			s.subscribe(c, args)
+			return
+		default:
+			reply = errors.New("ERR unknown command '" + cmd + "'")
+		}
+
+		if err = c.SendValue(reply); err != nil {
+			return
+		}
+	}
+}
+
+// subscribe sends the messages of the channels to the connection until it is closed.
+func (s *Sentinel) subscribe(c *goredis.Conn, channels [][]byte) {
+	sub := &subscriber{
+		channels: make(map[string]struct{}),
+		msgs:     make(chan []interface{}, len(channels)+64),
+	}
+
+	for i, ch := range channels {
+		sub.channels[string(ch)] = struct{}{}
+		sub.msgs <- []interface{}{[]byte("subscribe"), ch, int64(i + 1)}
+	}
+
+	s.m.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.m.Unlock()
+
+	defer func() {
+		s.m.Lock()
+		delete(s.subscribers, sub)
+		s.m.Unlock()
+	}()
+
+	// the commands after SUBSCRIBE are ignored, the connection is closed after the client quits
+	closed := make(chan struct{})
+	go func() {
+		for {
+			if _, err := c.ReceiveRequest(); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-sub.msgs:
+			c.SetWriteDeadline(time.Now().Add(s.timeout()))
+			if err := c.SendValue(msg); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// publish must be called with the lock.
+func (s *Sentinel) publish(channel string, msg string) {
+	for sub := range s.subscribers {
+		if _, ok := sub.channels[channel]; !ok {
+			continue
+		}
+
+		select {
+		case sub.msgs <- []interface{}{[]byte("message"), []byte(channel), []byte(msg)}:
+		default:
+		}
+	}
+}
+
+func (s *Sentinel) sentinelCommand(args [][]byte) interface{} {
+	if len(args) == 0 {
+		return errCmdParams
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch strings.ToLower(string(args[0])) {
+	case "masters":
+		ay := make([]interface{}, 0, len(s.masters))
+		for _, m := range s.masters {
+			ay = append(ay, s.masterFields(m))
+		}
+		return ay
+	case "master":
+		if len(args) != 2 {
+			return errCmdParams
+		}
+
+		m := s.master(string(args[1]))
+		if m == nil {
+			return errNoMaster
+		}
+		return s.masterFields(m)
+	case "slaves":
+		if len(args) != 2 {
+			return errCmdParams
+		}
+
+		m := s.master(string(args[1]))
+		if m == nil {
+			return errNoMaster
+		}
+
+		ay := make([]interface{}, 0, len(m.slaves))
+		for _, addr := range m.slaveAddrs() {
+			ay = append(ay, s.slaveFields(m.slaves[addr]))
+		}
+		return ay
+	case "get-master-addr-by-name":
+		if len(args) != 2 {
+			return errCmdParams
+		}
+
+		m := s.master(string(args[1]))
+		if m == nil {
+			return nil
+		}
+
+		host, port, _ := net.SplitHostPort(m.addr)
+		return []interface{}{[]byte(host), []byte(port)}
+	case "is-master-down-by-addr":
+		return s.isMasterDown(args[1:])
+	case "hello":
+		return s.onHello(args[1:])
+	default:
+		return errCmdParams
+	}
+}
+
+func (s *Sentinel) masterFields(m *master) []interface{} {
+	host, port, _ := net.SplitHostPort(m.addr)
+
+	flags := roleMaster
+	if m.down(s.downAfter()) {
+		flags += ",s_down"
+	}
+
+	return []interface{}{
+		[]byte("name"), []byte(m.name),
+		[]byte("ip"), []byte(host),
+		[]byte("port"), []byte(port),
+		[]byte("flags"), []byte(flags),
+		[]byte("num-slaves"), []byte(strconv.Itoa(len(m.slaves))),
+		[]byte("quorum"), []byte(strconv.Itoa(m.quorum)),
+		[]byte("config-epoch"), []byte(strconv.FormatUint(m.epoch, 10)),
+	}
+}
+
+func (s *Sentinel) slaveFields(inst *instance) []interface{} {
+	host, port, _ := net.SplitHostPort(inst.addr)
+
+	flags := inst.role
+	if len(flags) == 0 {
+		flags = roleSlave
+	}
+	if time.Since(inst.lastOK) > s.downAfter() {
+		flags += ",s_down"
+	}
+
+	return []interface{}{
+		[]byte("ip"), []byte(host),
+		[]byte("port"), []byte(port),
+		[]byte("flags"), []byte(flags),
+		[]byte("master"), []byte(inst.masterAddr),
+		[]byte("commit-log-id"), []byte(strconv.FormatUint(inst.commitID, 10)),
+		[]byte("slave-priority"), []byte(strconv.Itoa(inst.priority)),
+	}
+}
+
+func (s *Sentinel) masterByAddr(addr string) *master {
+	for _, m := range s.masters {
+		if m.addr == addr {
+			return m
+		}
+	}
+	return nil
+}
+
+// SENTINEL IS-MASTER-DOWN-BY-ADDR host port epoch runid
+//
+// The reply is whether the master is down, and the leader voted in the epoch if runid is not *.
+func (s *Sentinel) isMasterDown(args [][]byte) interface{} {
+	if len(args) != 4 {
+		return errCmdParams
+	}
+
+	epoch, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		return errCmdParams
+	}
+	runID := string(args[3])
+
+	m := s.masterByAddr(net.JoinHostPort(string(args[0]), string(args[1])))
+	if m == nil {
+		return []interface{}{int64(0), []byte("*"), int64(0)}
+	}
+
+	var down int64
+	if m.down(s.downAfter()) {
+		down = 1
+	}
+
+	if runID != "*" {
+		if epoch > s.currentEpoch {
+			s.currentEpoch = epoch
+		}
+
+		// vote once in every epoch
+		if m.leaderEpoch < epoch {
+			m.leader = runID
+			m.leaderEpoch = epoch
+
+			// do not begin a failover while the leader is doing it
+			if runID != s.runID {
+				m.failoverStart = time.Now()
+			}
+		}
+	}
+
+	return []interface{}{down, []byte(m.leader), int64(m.leaderEpoch)}
+}
+
+// SENTINEL HELLO name host port epoch
+//
+// The inner command between the sentinels, to send the master of the newest epoch.
+func (s *Sentinel) onHello(args [][]byte) interface{} {
+	if len(args) != 4 {
+		return errCmdParams
+	}
+
+	m := s.master(string(args[0]))
+	if m == nil {
+		return errNoMaster
+	}
+
+	epoch, err := strconv.ParseUint(string(args[3]), 10, 64)
+	if err != nil {
+		return errCmdParams
+	}
+
+	addr := net.JoinHostPort(string(args[1]), string(args[2]))
+
+	if epoch > m.epoch {
+		if addr != m.addr {
+			s.switchMaster(m, addr, epoch)
+		} else {
+			m.epoch = epoch
+		}
+	}
+
+	return "OK"
+}
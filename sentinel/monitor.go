@@ -0,0 +1,439 @@
+package sentinel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/siddontang/go/log"
+	"github.com/siddontang/goredis"
+)
+
+const (
+	roleMaster = "master"
+	roleSlave  = "slave"
+)
+
+type instance struct {
+	addr string
+
+	// the last time the instance replies
+	lastOK time.Time
+
+	role string
+
+	// the master of the slave
+	masterAddr string
+
+	commitID uint64
+
+	// the slave with the priority 0, like a filtered or delayed one, is never promoted
+	priority int
+}
+
+type master struct {
+	name   string
+	quorum int
+
+	addr string
+
+	// the epoch of the failover promoting the master, 0 for the configured one
+	epoch uint64
+
+	lastOK time.Time
+
+	slaves map[string]*instance
+
+	// the leader voted by this sentinel in leaderEpoch
+	leader      string
+	leaderEpoch uint64
+
+	// the time the failover begins or this sentinel votes, the next one must wait the failover timeout
+	failoverStart time.Time
+
+	// the password and the TLS of the instances, nil if TLS is disabled
+	password string
+	tlsCfg   *tls.Config
+}
+
+func newMaster(cfg config.SentinelMasterConfig) (*master, error) {
+	m := new(master)
+
+	m.name = cfg.Name
+	m.quorum = cfg.Quorum
+	m.addr = cfg.Addr
+	m.lastOK = time.Now()
+	m.slaves = make(map[string]*instance)
+	m.password = cfg.Password
+
+	if cfg.TLS.Enabled {
+		var err error
+		if m.tlsCfg, err = cfg.TLS.ClientConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *master) down(downAfter time.Duration) bool {
+	return time.Since(m.lastOK) > downAfter
+}
+
+func (m *master) slaveAddrs() []string {
+	addrs := make([]string, 0, len(m.slaves))
+	for addr := range m.slaves {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+func (s *Sentinel) monitor(m *master) {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.timeout())
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.check(m)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// check checks the master and its slaves, and begins the failover if the master is down.
+func (s *Sentinel) check(m *master) {
+	s.m.Lock()
+	addr := m.addr
+	slaves := m.slaveAddrs()
+	s.m.Unlock()
+
+	if r, err := s.role(m, addr); err == nil && r.role == roleMaster {
+		s.m.Lock()
+		if m.addr == addr {
+			m.lastOK = time.Now()
+
+			for _, slave := range r.slaves {
+				if _, ok := m.slaves[slave]; !ok && slave != addr {
+					log.Infof("sentinel discovers the slave %s of %s", slave, m.name)
+					m.slaves[slave] = &instance{addr: slave}
+				}
+			}
+		}
+		s.m.Unlock()
+	}
+
+	for _, slave := range slaves {
+		s.checkSlave(m, slave)
+	}
+
+	s.hello(m)
+
+	s.m.Lock()
+	down := m.down(s.downAfter())
+	s.m.Unlock()
+
+	if down {
+		s.tryFailover(m, addr)
+	}
+}
+
+func (s *Sentinel) checkSlave(m *master, addr string) {
+	r, err := s.role(m, addr)
+	if err != nil {
+		return
+	}
+
+	commitID, priority, err := s.slaveInfo(m, addr)
+	if err != nil {
+		return
+	}
+
+	s.m.Lock()
+	inst, ok := m.slaves[addr]
+	if !ok {
+		s.m.Unlock()
+		return
+	}
+
+	inst.lastOK = time.Now()
+	inst.role = r.role
+	inst.masterAddr = r.masterAddr
+	inst.commitID = commitID
+	inst.priority = priority
+
+	masterAddr := m.addr
+
+	// never reconfigure the slaves if the master is down or in a failover
+	stable := !m.down(s.downAfter()) && time.Since(m.failoverStart) > s.failoverTimeout()
+	s.m.Unlock()
+
+	if stable && addr != masterAddr && (r.role == roleMaster || r.masterAddr != masterAddr) {
+		log.Infof("sentinel reconfigures %s as the slave of %s", addr, masterAddr)
+		s.slaveof(m, addr, masterAddr)
+	}
+}
+
+// tryFailover begins the failover after the quorum agrees the master is down,
+// and this sentinel is voted as the leader.
+func (s *Sentinel) tryFailover(m *master, addr string) {
+	s.m.Lock()
+	busy := time.Since(m.failoverStart) < s.failoverTimeout()
+	s.m.Unlock()
+
+	if busy {
+		return
+	}
+
+	host, port, _ := net.SplitHostPort(addr)
+
+	downs := 1
+	for _, r := range s.askSentinels(host, port, 0, "*") {
+		if r.down {
+			downs++
+		}
+	}
+
+	if downs < m.quorum {
+		return
+	}
+
+	s.m.Lock()
+	if m.addr != addr || time.Since(m.failoverStart) < s.failoverTimeout() {
+		s.m.Unlock()
+		return
+	}
+
+	s.currentEpoch++
+	epoch := s.currentEpoch
+
+	m.leader = s.runID
+	m.leaderEpoch = epoch
+	m.failoverStart = time.Now()
+	s.m.Unlock()
+
+	log.Infof("sentinel finds master %s %s is down, try failover in epoch %d", m.name, addr, epoch)
+
+	votes := 1
+	for _, r := range s.askSentinels(host, port, epoch, s.runID) {
+		if r.leader == s.runID && r.leaderEpoch == epoch {
+			votes++
+		}
+	}
+
+	if needed := (len(s.cfg.Sentinels)+1)/2 + 1; votes < needed || votes < m.quorum {
+		log.Infof("sentinel is not voted as the leader in epoch %d, votes %d", epoch, votes)
+
+		// retry randomly later, so the sentinels do not split the votes again
+		s.m.Lock()
+		m.failoverStart = m.failoverStart.Add(time.Duration(rand.Int63n(int64(s.failoverTimeout()/2) + 1)))
+		s.m.Unlock()
+		return
+	}
+
+	s.failover(m, addr, epoch)
+}
+
+func (s *Sentinel) failover(m *master, addr string, epoch uint64) {
+	slave := s.selectSlave(m)
+	if len(slave) == 0 {
+		log.Errorf("sentinel failover %s in epoch %d error, no valid slave", m.name, epoch)
+		return
+	}
+
+	log.Infof("sentinel promotes %s as the master of %s in epoch %d", slave, m.name, epoch)
+
+	if _, err := s.do(m, slave, "SLAVEOF", "NO", "ONE"); err != nil {
+		log.Errorf("sentinel promotes %s error %s", slave, err.Error())
+		return
+	}
+
+	s.m.Lock()
+	if m.epoch < epoch {
+		s.switchMaster(m, slave, epoch)
+	}
+	slaves := m.slaveAddrs()
+	s.m.Unlock()
+
+	s.hello(m)
+
+	// the old master is reconfigured after it is back
+	for _, a := range slaves {
+		if a != addr {
+			s.slaveof(m, a, slave)
+		}
+	}
+}
+
+// selectSlave returns the slave with the highest commit log ID, which replies in down_after,
+// except the slaves with the priority 0.
+func (s *Sentinel) selectSlave(m *master) string {
+	s.m.Lock()
+	slaves := make([]string, 0, len(m.slaves))
+	for _, a := range m.slaveAddrs() {
+		inst := m.slaves[a]
+		if inst.role == roleSlave && time.Since(inst.lastOK) <= s.downAfter() {
+			slaves = append(slaves, a)
+		}
+	}
+	s.m.Unlock()
+
+	best := ""
+	var bestID uint64
+	for _, a := range slaves {
+		id, priority, err := s.slaveInfo(m, a)
+		if err != nil || priority == 0 {
+			continue
+		}
+
+		if len(best) == 0 || id > bestID {
+			best = a
+			bestID = id
+		}
+	}
+
+	return best
+}
+
+// switchMaster must be called with the lock.
+func (s *Sentinel) switchMaster(m *master, addr string, epoch uint64) {
+	old := m.addr
+
+	m.addr = addr
+	m.epoch = epoch
+	m.lastOK = time.Now()
+
+	delete(m.slaves, addr)
+	m.slaves[old] = &instance{addr: old}
+
+	if epoch > s.currentEpoch {
+		s.currentEpoch = epoch
+	}
+
+	log.Infof("sentinel switches master %s from %s to %s in epoch %d", m.name, old, addr, epoch)
+
+	oldHost, oldPort, _ := net.SplitHostPort(old)
+	host, port, _ := net.SplitHostPort(addr)
+	s.publish(switchMasterChannel, fmt.Sprintf("%s %s %s %s %s", m.name, oldHost, oldPort, host, port))
+}
+
+// hello sends the master address with its epoch to the other sentinels.
+func (s *Sentinel) hello(m *master) {
+	s.m.Lock()
+	host, port, _ := net.SplitHostPort(m.addr)
+	epoch := m.epoch
+	s.m.Unlock()
+
+	for _, addr := range s.cfg.Sentinels {
+		s.do(nil, addr, "SENTINEL", "HELLO", m.name, host, port, int64(epoch))
+	}
+}
+
+type voteReply struct {
+	down        bool
+	leader      string
+	leaderEpoch uint64
+}
+
+// askSentinels asks the other sentinels whether the master is down, and votes for the
+// leader runID in the epoch if runID is not *.
+func (s *Sentinel) askSentinels(host string, port string, epoch uint64, runID string) []voteReply {
+	replies := make([]voteReply, 0, len(s.cfg.Sentinels))
+
+	for _, addr := range s.cfg.Sentinels {
+		ay, err := goredis.MultiBulk(s.do(nil, addr, "SENTINEL", "IS-MASTER-DOWN-BY-ADDR", host, port, int64(epoch), runID))
+		if err != nil || len(ay) != 3 {
+			continue
+		}
+
+		down, _ := goredis.Int64(ay[0], nil)
+		leader, _ := goredis.String(ay[1], nil)
+		leaderEpoch, _ := goredis.Uint64(ay[2], nil)
+
+		replies = append(replies, voteReply{down == 1, leader, leaderEpoch})
+	}
+
+	return replies
+}
+
+type roleReply struct {
+	role       string
+	masterAddr string
+	slaves     []string
+}
+
+// role returns the role of the instance of m, and the slaves of the master.
+func (s *Sentinel) role(m *master, addr string) (*roleReply, error) {
+	ay, err := goredis.MultiBulk(s.do(m, addr, "ROLE"))
+	if err != nil {
+		return nil, err
+	} else if len(ay) < 3 {
+		return nil, fmt.Errorf("invalid role reply %v", ay)
+	}
+
+	r := new(roleReply)
+	if r.role, err = goredis.String(ay[0], nil); err != nil {
+		return nil, err
+	}
+
+	switch r.role {
+	case roleMaster:
+		slaves, _ := goredis.MultiBulk(ay[2], nil)
+		for _, v := range slaves {
+			if slave, err := goredis.Strings(v, nil); err == nil && len(slave) >= 2 {
+				r.slaves = append(r.slaves, net.JoinHostPort(slave[0], slave[1]))
+			}
+		}
+	case roleSlave:
+		host, _ := goredis.String(ay[1], nil)
+		port, _ := goredis.Int64(ay[2], nil)
+		r.masterAddr = net.JoinHostPort(host, strconv.FormatInt(port, 10))
+	default:
+		return nil, fmt.Errorf("invalid role %s", r.role)
+	}
+
+	return r, nil
+}
+
+// slaveInfo returns the commit_log_id and the slave_priority in INFO replication
+// of the instance of m.
+func (s *Sentinel) slaveInfo(m *master, addr string) (uint64, int, error) {
+	data, err := goredis.Bytes(s.do(m, addr, "INFO", "replication"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var commitID uint64
+	found := false
+
+	// the priority is only in the info of a slave
+	priority := 100
+
+	for _, line := range bytes.Split(data, []byte("\r\n")) {
+		if bytes.HasPrefix(line, []byte("commit_log_id:")) {
+			if commitID, err = strconv.ParseUint(string(line[len("commit_log_id:"):]), 10, 64); err != nil {
+				return 0, 0, err
+			}
+			found = true
+		} else if bytes.HasPrefix(line, []byte("slave_priority:")) {
+			if priority, err = strconv.Atoi(string(line[len("slave_priority:"):])); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	if !found {
+		return 0, 0, fmt.Errorf("no commit_log_id in info of %s", addr)
+	}
+	return commitID, priority, nil
+}
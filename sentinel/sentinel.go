@@ -0,0 +1,269 @@
+package sentinel
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/siddontang/go/log"
+	"github.com/siddontang/goredis"
+)
+
+/*
+	The sentinel monitors the masters and the slaves discovered by ROLE, and promotes a slave
+	after a master is down, like the redis sentinel.
+
+	A sentinel thinks the master is down if it does not reply in down_after, then asks the
+	other sentinels, and if the quorum of them agree, it asks them to vote it as the leader of
+	a new epoch. Every sentinel votes once in an epoch, and the leader with the votes of the
+	majority promotes the slave with the highest commit log ID by SLAVEOF NO ONE, then re-points
+	the other slaves to it.
+
+	The sentinels send the master address with its epoch to each other in every check, so the
+	other sentinels take the master of the newest epoch, and the clients can get it by
+	SENTINEL GET-MASTER-ADDR-BY-NAME or be notified by SUBSCRIBE +switch-master.
+
+	The old master is re-pointed to the new master after it is back, the replication ID makes
+	it sync the full data if its logs diverge.
+*/
+
+type Sentinel struct {
+	cfg *config.SentinelConfig
+
+	runID string
+
+	listener net.Listener
+
+	m sync.Mutex
+
+	// the newest epoch this sentinel knows
+	currentEpoch uint64
+
+	masters []*master
+
+	conns       map[net.Conn]struct{}
+	subscribers map[*subscriber]struct{}
+
+	pm   sync.Mutex
+	pool map[string][]*goredis.Conn
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newRunID() string {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func NewSentinel(cfg *config.SentinelConfig) (*Sentinel, error) {
+	s := new(Sentinel)
+
+	s.cfg = cfg
+	s.runID = newRunID()
+
+	s.conns = make(map[net.Conn]struct{})
+	s.subscribers = make(map[*subscriber]struct{})
+	s.pool = make(map[string][]*goredis.Conn)
+	s.quit = make(chan struct{})
+
+	for _, c := range cfg.Masters {
+		m, err := newMaster(c)
+		if err != nil {
+			return nil, err
+		}
+		s.masters = append(s.masters, m)
+	}
+
+	var err error
+	if s.listener, err = net.Listen("tcp", cfg.Addr); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Sentinel) Run() {
+	for _, m := range s.masters {
+		s.wg.Add(1)
+		go s.monitor(m)
+	}
+
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.onConn(c)
+	}
+}
+
+func (s *Sentinel) Close() {
+	select {
+	case <-s.quit:
+		return
+	default:
+		close(s.quit)
+	}
+
+	s.listener.Close()
+
+	s.wg.Wait()
+
+	s.m.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.m.Unlock()
+
+	s.pm.Lock()
+	for _, conns := range s.pool {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	s.pool = make(map[string][]*goredis.Conn)
+	s.pm.Unlock()
+}
+
+// MasterAddr returns the address of the master with the name.
+func (s *Sentinel) MasterAddr(name string) (string, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if m := s.master(name); m != nil {
+		return m.addr, true
+	}
+	return "", false
+}
+
+func (s *Sentinel) master(name string) *master {
+	for _, m := range s.masters {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *Sentinel) timeout() time.Duration {
+	return time.Duration(s.cfg.CheckInterval) * time.Millisecond
+}
+
+func (s *Sentinel) downAfter() time.Duration {
+	return time.Duration(s.cfg.DownAfter) * time.Millisecond
+}
+
+func (s *Sentinel) failoverTimeout() time.Duration {
+	return time.Duration(s.cfg.FailoverTimeout) * time.Millisecond
+}
+
+// do sends the command to the instance of m, or the sentinel if m is nil, the connections are reused.
+func (s *Sentinel) do(m *master, addr string, cmd string, args ...interface{}) (interface{}, error) {
+	var c *goredis.Conn
+
+	s.pm.Lock()
+	if conns := s.pool[addr]; len(conns) > 0 {
+		c = conns[len(conns)-1]
+		s.pool[addr] = conns[0 : len(conns)-1]
+	}
+	s.pm.Unlock()
+
+	if c == nil {
+		var err error
+		if c, err = s.dial(m, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	deadline := time.Now().Add(s.timeout())
+	c.SetReadDeadline(deadline)
+	c.SetWriteDeadline(deadline)
+
+	reply, err := c.Do(cmd, args...)
+	if err != nil {
+		if _, ok := err.(goredis.Error); !ok {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	s.pm.Lock()
+	select {
+	case <-s.quit:
+		c.Close()
+	default:
+		s.pool[addr] = append(s.pool[addr], c)
+	}
+	s.pm.Unlock()
+
+	return reply, err
+}
+
+// dial connects to the instance of m with TLS and AUTH if set, or the sentinel if m is nil.
+func (s *Sentinel) dial(m *master, addr string) (*goredis.Conn, error) {
+	var nc net.Conn
+	var err error
+
+	d := &net.Dialer{Timeout: s.timeout()}
+	if m == nil || m.tlsCfg == nil {
+		nc, err = d.Dial("tcp", addr)
+	} else {
+		tlsCfg := m.tlsCfg.Clone()
+		if len(tlsCfg.ServerName) == 0 {
+			if tlsCfg.ServerName, _, err = net.SplitHostPort(addr); err != nil {
+				return nil, err
+			}
+		}
+		nc, err = tls.DialWithDialer(d, "tcp", addr, tlsCfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := goredis.NewConn(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if m == nil || len(m.password) == 0 {
+		return c, nil
+	}
+
+	deadline := time.Now().Add(s.timeout())
+	c.SetReadDeadline(deadline)
+	c.SetWriteDeadline(deadline)
+
+	if res, err := goredis.String(c.Do("AUTH", m.password)); err != nil || strings.ToUpper(res) != "OK" {
+		c.Close()
+		if err == nil {
+			err = fmt.Errorf("auth %s fail, reply %s", addr, res)
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *Sentinel) slaveof(m *master, addr string, masterAddr string) error {
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.do(m, addr, "SLAVEOF", host, port); err != nil {
+		log.Errorf("sentinel set %s slaveof %s error %s", addr, masterAddr, err.Error())
+	}
+	return err
+}
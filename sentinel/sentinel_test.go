@@ -0,0 +1,259 @@
+package sentinel
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/server"
+	"github.com/siddontang/goredis"
+)
+
+func newTestApp(t *testing.T, dir string, addr string, slaveof string, adjust ...func(cfg *config.Config)) *server.App {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = path.Join(dir, addr)
+	cfg.Addr = addr
+	cfg.SlaveOf = slaveof
+	cfg.UseReplication = true
+
+	for _, f := range adjust {
+		f(cfg)
+	}
+
+	app, err := server.NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go app.Run()
+	return app
+}
+
+func waitFor(t *testing.T, timeout time.Duration, f func() error) {
+	var err error
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(100 * time.Millisecond) {
+		if err = f(); err == nil {
+			return
+		}
+	}
+	t.Fatal(err)
+}
+
+func checkRole(addr string, role string, masterAddr string) error {
+	c := goredis.NewClient(addr, "")
+	defer c.Close()
+
+	ay, err := goredis.MultiBulk(c.Do("ROLE"))
+	if err != nil {
+		return err
+	} else if r, _ := goredis.String(ay[0], nil); r != role {
+		return fmt.Errorf("%s role %s != %s", addr, r, role)
+	} else if role == roleSlave {
+		host, _ := goredis.String(ay[1], nil)
+		port, _ := goredis.Int64(ay[2], nil)
+		if a := fmt.Sprintf("%s:%d", host, port); a != masterAddr {
+			return fmt.Errorf("%s slaveof %s != %s", addr, a, masterAddr)
+		}
+	}
+	return nil
+}
+
+func TestSentinelFailover(t *testing.T) {
+	dir := "/tmp/test_sentinel"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	masterAddr := "127.0.0.1:11201"
+	slaveAddrs := []string{"127.0.0.1:11202", "127.0.0.1:11203"}
+	sentinelAddrs := []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"}
+
+	master := newTestApp(t, dir, masterAddr, "")
+
+	// the filtered slave has the same commit log ID, but it is never promoted
+	defer newTestApp(t, dir, slaveAddrs[0], masterAddr, func(cfg *config.Config) {
+		cfg.Replication.FilterDBs = []int{0}
+	}).Close()
+	defer newTestApp(t, dir, slaveAddrs[1], masterAddr).Close()
+
+	sentinels := make([]*Sentinel, 0, len(sentinelAddrs))
+	for i, addr := range sentinelAddrs {
+		cfg := config.NewSentinelConfigDefault()
+		cfg.Addr = addr
+		cfg.CheckInterval = 100
+		cfg.DownAfter = 1000
+		cfg.FailoverTimeout = 3000
+		cfg.Masters = []config.SentinelMasterConfig{{Name: "mymaster", Addr: masterAddr, Quorum: 2}}
+
+		for j, peer := range sentinelAddrs {
+			if i != j {
+				cfg.Sentinels = append(cfg.Sentinels, peer)
+			}
+		}
+
+		s, err := NewSentinel(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		go s.Run()
+		sentinels = append(sentinels, s)
+	}
+
+	c := goredis.NewClient(masterAddr, "")
+	if _, err := c.Do("SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	sc, err := goredis.Connect(sentinelAddrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	// the slaves are discovered by ROLE
+	waitFor(t, 10*time.Second, func() error {
+		ay, err := goredis.MultiBulk(sc.Do("SENTINEL", "SLAVES", "mymaster"))
+		if err != nil {
+			return err
+		} else if len(ay) != len(slaveAddrs) {
+			return fmt.Errorf("%d slaves are discovered", len(ay))
+		}
+		return nil
+	})
+
+	sub, err := goredis.Connect(sentinelAddrs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if _, err = sub.Do("SUBSCRIBE", switchMasterChannel); err != nil {
+		t.Fatal(err)
+	}
+
+	master.Close()
+
+	var newMaster string
+	waitFor(t, 20*time.Second, func() error {
+		ay, err := goredis.Strings(sc.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster"))
+		if err != nil {
+			return err
+		}
+
+		newMaster = ay[0] + ":" + ay[1]
+		if newMaster == masterAddr {
+			return fmt.Errorf("no failover")
+		} else if newMaster != slaveAddrs[1] {
+			t.Fatalf("the filtered slave %s is promoted", newMaster)
+		}
+
+		for _, s := range sentinels {
+			if addr, _ := s.MasterAddr("mymaster"); addr != newMaster {
+				return fmt.Errorf("sentinel master %s != %s", addr, newMaster)
+			}
+		}
+		return nil
+	})
+
+	if msg, err := goredis.Strings(sub.Receive()); err != nil {
+		t.Fatal(err)
+	} else if msg[0] != "message" || msg[1] != switchMasterChannel {
+		t.Fatal(msg)
+	}
+
+	waitFor(t, 10*time.Second, func() error {
+		if err := checkRole(newMaster, roleMaster, ""); err != nil {
+			return err
+		}
+
+		for _, addr := range slaveAddrs {
+			if addr != newMaster {
+				if err := checkRole(addr, roleSlave, newMaster); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	c = goredis.NewClient(newMaster, "")
+	defer c.Close()
+
+	if _, err := c.Do("SET", "b", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old master is re-pointed to the new master after it is back
+	master = newTestApp(t, dir, masterAddr, "")
+	defer master.Close()
+
+	waitFor(t, 20*time.Second, func() error {
+		return checkRole(masterAddr, roleSlave, newMaster)
+	})
+
+	waitFor(t, 10*time.Second, func() error {
+		c := goredis.NewClient(masterAddr, "")
+		defer c.Close()
+
+		if v, err := goredis.String(c.Do("GET", "b")); err != nil {
+			return err
+		} else if v != "2" {
+			return fmt.Errorf("%s != 2", v)
+		}
+		return nil
+	})
+}
+
+func TestSentinelAuth(t *testing.T) {
+	dir := "/tmp/test_sentinel_auth"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	addr := "127.0.0.1:11251"
+
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = dir
+	cfg.Addr = addr
+	cfg.AuthPassword = "secret"
+
+	app, err := server.NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+	go app.Run()
+
+	scfg := config.NewSentinelConfigDefault()
+	scfg.Addr = "127.0.0.1:11252"
+	scfg.Masters = []config.SentinelMasterConfig{{Name: "mymaster", Addr: addr, Password: "secret"}}
+
+	s, err := NewSentinel(scfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	m := s.master("mymaster")
+	if r, err := s.role(m, addr); err != nil {
+		t.Fatal(err)
+	} else if r.role != roleMaster {
+		t.Fatal(r.role)
+	}
+
+	m.password = "wrong"
+	s.pool = make(map[string][]*goredis.Conn)
+	if _, err = s.role(m, addr); err == nil {
+		t.Fatal("must fail for the wrong password")
+	}
+
+	// the TLS files are loaded in creating the sentinel
+	scfg.Masters[0].TLS = config.ReplicationTLS{Enabled: true, CAFile: path.Join(dir, "none.pem")}
+	if _, err = NewSentinel(scfg); err == nil {
+		t.Fatal("must fail for the missing CA file")
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/ledisdb/ledisdb/raft"
 	"github.com/siddontang/goredis"
 )
 
@@ -34,6 +35,9 @@ type App struct {
 	//for slave replication
 	m *master
 
+	//for the raft mode, nil if not used
+	raft *raft.Raft
+
 	info *info
 
 	script *script
@@ -43,6 +47,9 @@ type App struct {
 	slaves       map[string]*client
 	slaveSyncAck chan uint64
 
+	// closed and renewed after the slaves ack the logs, to wake up the clients waiting for the acks
+	slaveAckCh chan struct{}
+
 	snap *snapshotStore
 
 	connWait sync.WaitGroup
@@ -100,6 +107,7 @@ func NewApp(cfg *config.Config) (*App, error) {
 
 	app.slaves = make(map[string]*client)
 	app.slaveSyncAck = make(chan uint64)
+	app.slaveAckCh = make(chan struct{})
 
 	app.rcs = make(map[*respClient]struct{})
 
@@ -120,6 +128,13 @@ func NewApp(cfg *config.Config) (*App, error) {
 		}
 	}
 
+	var replTLSCfg *tls.Config
+	if cfg.Replication.TLS.Enabled {
+		if replTLSCfg, err = cfg.Replication.TLS.ClientConfig(); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.Addr != "" {
 		addrNetType := netType(cfg.Addr)
 
@@ -172,11 +187,23 @@ func NewApp(cfg *config.Config) (*App, error) {
 		app.cfg.Readonly = true
 	}
 
+	if len(cfg.Raft.Addr) > 0 && (len(cfg.SlaveOf) > 0 || cfg.UseReplication) {
+		return nil, fmt.Errorf("raft mode can not be used with replication")
+	}
+
 	if app.ldb, err = ledis.Open(cfg); err != nil {
 		return nil, err
 	}
 
+	if len(cfg.Raft.Addr) > 0 {
+		if app.raft, err = raft.NewRaft(cfg, app.ldb); err != nil {
+			app.ldb.Close()
+			return nil, err
+		}
+	}
+
 	app.m = newMaster(app)
+	app.m.tlsCfg = replTLSCfg
 
 	app.openScript()
 
@@ -225,6 +252,11 @@ func (app *App) Close() {
 		app.access.Close()
 	}
 
+	//the raft applies the logs to ledis until it is shut down
+	if app.raft != nil {
+		app.raft.Close()
+	}
+
 	app.ldb.Close()
 }
 
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveMagic starts the FULLSYNC reply of a checkpoint, the reply of
+// a dump starts with the commit ID which never reaches it.
+var archiveMagic = []byte("ledisckp")
+
+var errArchive = errors.New("invalid checkpoint archive")
+
+// archiveFile is a file in the checkpoint directory, the name is the relative path.
+type archiveFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func listArchiveFiles(dir string) ([]archiveFile, error) {
+	var files []archiveFile
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, archiveFile{filepath.ToSlash(name), info.Size(), info.ModTime()})
+		return nil
+	})
+
+	return files, err
+}
+
+// archiveSize returns the size of the archive, which is the magic and a tar stream
+// of ustar headers, so the size is known before writing it.
+func archiveSize(files []archiveFile) int64 {
+	n := int64(len(archiveMagic))
+	for _, f := range files {
+		n += 512 + (f.size+511)/512*512
+	}
+
+	// two zero blocks end the tar stream
+	return n + 1024
+}
+
+// writeArchive writes the files of the checkpoint directory, the files must not be changed,
+// but they may be removed by purging the snapshot, then the slave fails and syncs again.
+func writeArchive(w io.Writer, dir string, files []archiveFile) error {
+	if _, err := w.Write(archiveMagic); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		h := &tar.Header{
+			Name:     f.name,
+			Mode:     0644,
+			Size:     f.size,
+			ModTime:  time.Unix(f.modTime.Unix(), 0),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatUSTAR,
+		}
+
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+
+		fd, err := os.Open(filepath.Join(dir, filepath.FromSlash(f.name)))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.CopyN(tw, fd, f.size)
+		fd.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// isArchive checks whether the reply of FULLSYNC is a checkpoint archive.
+func isArchive(r io.ReadSeeker) (bool, error) {
+	buf := make([]byte, len(archiveMagic))
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(buf[0:n], archiveMagic), nil
+}
+
+// readArchive extracts the checkpoint archive to dir.
+func readArchive(r io.Reader, dir string) error {
+	buf := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	} else if !bytes.Equal(buf, archiveMagic) {
+		return errArchive
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(h.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return errArchive
+		}
+
+		p := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
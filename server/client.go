@@ -2,12 +2,15 @@ package server
 
 import (
 	"bytes"
-	//	"fmt"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"time"
 
 	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/siddontang/go/log"
+	"github.com/siddontang/go/num"
 	"github.com/siddontang/go/sync2"
 )
 
@@ -35,6 +38,11 @@ type client struct {
 
 	db *ledis.DB
 
+	// the index and mapping version of the selected db, the db is selected again
+	// if the databases are swapped or flushed asynchronously
+	dbIndex   int
+	dbVersion int64
+
 	remoteAddr string
 	cmd        string
 	args       [][]byte
@@ -45,13 +53,29 @@ type client struct {
 
 	syncBuf bytes.Buffer
 
+	// the last log ID the slave owns, or the log ID of the last write of the client
 	lastLogID sync2.AtomicUint64
 
+	// the log ID of the last write of the running command, 0 if it doesn't write
+	cmdLogID uint64
+	// whether the running command commits any write
+	cmdCommitted bool
+
+	// set by CLIENT DURABILITY, the writes are replied after ackSlaves slaves own them or ackTimeout
+	ackSlaves  int
+	ackTimeout time.Duration
+
+	// set by CLIENT LOGID, every reply is attached with the log ID of the last write of the client
+	attachLogID bool
+
 	// reqErr chan error
 
 	buf bytes.Buffer
 
 	slaveListeningAddr string
+
+	// the data sent to the slave, set by REPLCONF, nil for all
+	rplFilter *ledis.ReplicationFilter
 }
 
 func newClient(app *App) *client {
@@ -60,11 +84,25 @@ func newClient(app *App) *client {
 	c.app = app
 	c.ldb = app.ldb
 	c.isAuthed = false
-	c.db, _ = app.ldb.Select(0) //use default db
+	c.selectDB(0) //use default db
 
 	return c
 }
 
+func (c *client) selectDB(index int) error {
+	version := c.ldb.DBVersion()
+
+	db, err := c.ldb.Select(index)
+	if err != nil {
+		return err
+	}
+
+	c.db = db.Track(c.committed)
+	c.dbIndex = index
+	c.dbVersion = version
+	return nil
+}
+
 func (c *client) close() {
 
 }
@@ -80,14 +118,18 @@ func (c *client) perform() {
 
 	c.cmd = strings.ToLower(c.cmd)
 
+	if c.db != nil && c.dbVersion != c.ldb.DBVersion() {
+		c.selectDB(c.dbIndex)
+	}
+
 	if len(c.cmd) == 0 {
 		err = ErrEmptyCommand
 	} else if exeCmd, ok := regCmds[c.cmd]; !ok {
 		err = ErrNotFound
 	} else if c.authEnabled() && !c.isAuthed && c.cmd != "auth" {
 		err = ErrNotAuthenticated
-	} else {
-		err = exeCmd(c)
+	} else if err = c.checkRaftLeader(); err == nil {
+		err = c.execute(exeCmd)
 	}
 
 	if c.app.access != nil {
@@ -111,6 +153,184 @@ func (c *client) perform() {
 	return
 }
 
+// committed is called by the selected database with the log ID of every write of the client.
+func (c *client) committed(logID uint64) {
+	c.cmdCommitted = true
+	if logID > c.cmdLogID {
+		c.cmdLogID = logID
+	}
+}
+
+// execute runs the command, and sets the last log ID of the client if it writes. In the sync
+// durability mode, the reply is held until the slaves ack the write, and the error is returned
+// instead if not enough slaves ack it before the timeout, though the write is done. With
+// CLIENT LOGID ON, the reply is the array of the last log ID of the client and the reply.
+func (c *client) execute(exeCmd CommandFunc) error {
+	c.cmdLogID = 0
+	c.cmdCommitted = false
+
+	// the last log ID of the slave is the ack
+	if len(c.slaveListeningAddr) > 0 {
+		return c.retrySwapped(exeCmd)
+	}
+
+	var rec *replyRecorder
+	resp := c.resp
+	attach := c.attachLogID
+	if c.ackSlaves > 0 || attach {
+		rec = new(replyRecorder)
+		c.resp = rec
+	}
+
+	err := c.retrySwapped(exeCmd)
+	c.resp = resp
+
+	noReplicas := false
+	if logID := c.cmdLogID; logID > 0 {
+		c.lastLogID.Set(logID)
+
+		if c.ackSlaves > 0 {
+			if n := c.app.waitSlaveAcks(logID, c.ackSlaves, c.ackTimeout); n < c.ackSlaves {
+				log.Infof("client %s write log %d is acked by %d slaves < %d", c.remoteAddr, logID, n, c.ackSlaves)
+				err = fmt.Errorf("NOREPLICAS acked %d < %d", n, c.ackSlaves)
+				noReplicas = true
+			}
+		}
+	}
+
+	if rec == nil {
+		return err
+	} else if !attach {
+		if !noReplicas {
+			rec.replay(resp)
+		}
+		return err
+	}
+
+	if err != nil {
+		rec.reset()
+		rec.writeError(err)
+	}
+	resp.writeArray([]interface{}{int64(c.lastLogID.Get()), rec.value()})
+	return nil
+}
+
+func (c *client) retrySwapped(exeCmd CommandFunc) error {
+	err := exeCmd(c)
+	if err == ledis.ErrDBSwapped && !c.cmdCommitted {
+		// the database is swapped before the command writes, run it on the new handle,
+		// but not after a part is committed, like FLUSHDB committing one type at a time
+		if err = c.selectDB(c.dbIndex); err == nil {
+			err = exeCmd(c)
+		}
+	}
+	return err
+}
+
+// committedLast sets the log ID of the running command to the last log, after it writes
+// in the commit of Ledis which blocks all the other writes, like FLUSHALL.
+func (c *client) committedLast() {
+	if s, err := c.ldb.ReplicationStat(); err == nil {
+		c.committed(s.LastID)
+	}
+}
+
+// replyRecorder records the reply, which is written after the slaves ack the write,
+// or as the array element with the log ID, see writeArray for the element types.
+type replyRecorder struct {
+	replies []func(w responseWriter)
+	values  []interface{}
+}
+
+func (r *replyRecorder) add(f func(w responseWriter), v interface{}) {
+	r.replies = append(r.replies, f)
+	r.values = append(r.values, v)
+}
+
+func (r *replyRecorder) reset() {
+	r.replies = r.replies[0:0]
+	r.values = r.values[0:0]
+}
+
+func (r *replyRecorder) replay(w responseWriter) {
+	for _, f := range r.replies {
+		f(w)
+	}
+}
+
+// value returns the recorded reply, or the array of the replies if not one.
+func (r *replyRecorder) value() interface{} {
+	if len(r.values) == 1 {
+		return r.values[0]
+	}
+	return append([]interface{}{}, r.values...)
+}
+
+func (r *replyRecorder) writeError(err error) {
+	r.add(func(w responseWriter) { w.writeError(err) }, err)
+}
+
+func (r *replyRecorder) writeStatus(status string) {
+	r.add(func(w responseWriter) { w.writeStatus(status) }, status)
+}
+
+func (r *replyRecorder) writeInteger(n int64) {
+	r.add(func(w responseWriter) { w.writeInteger(n) }, n)
+}
+
+func (r *replyRecorder) writeBulk(b []byte) {
+	var v interface{}
+	if b != nil {
+		v = b
+	}
+	r.add(func(w responseWriter) { w.writeBulk(b) }, v)
+}
+
+func (r *replyRecorder) writeArray(lst []interface{}) {
+	r.add(func(w responseWriter) { w.writeArray(lst) }, lst)
+}
+
+func (r *replyRecorder) writeSliceArray(lst [][]byte) {
+	r.add(func(w responseWriter) { w.writeSliceArray(lst) }, lst)
+}
+
+func (r *replyRecorder) writeFVPairArray(lst []ledis.FVPair) {
+	var v [][]byte
+	if lst != nil {
+		v = make([][]byte, 0, len(lst)*2)
+		for _, p := range lst {
+			v = append(v, p.Field, p.Value)
+		}
+	}
+	r.add(func(w responseWriter) { w.writeFVPairArray(lst) }, v)
+}
+
+func (r *replyRecorder) writeScorePairArray(lst []ledis.ScorePair, withScores bool) {
+	var v [][]byte
+	if lst != nil {
+		v = make([][]byte, 0, len(lst)*2)
+		for _, p := range lst {
+			v = append(v, p.Member)
+			if withScores {
+				v = append(v, num.FormatInt64ToSlice(p.Score))
+			}
+		}
+	}
+	r.add(func(w responseWriter) { w.writeScorePairArray(lst, withScores) }, v)
+}
+
+// writeBulkFrom reads the data now, the reader may be closed after the command.
+func (r *replyRecorder) writeBulkFrom(n int64, rb io.Reader) {
+	b, err := ioutil.ReadAll(io.LimitReader(rb, n))
+	if err != nil {
+		r.writeError(err)
+		return
+	}
+	r.writeBulk(b)
+}
+
+func (r *replyRecorder) flush() {}
+
 func (c *client) catGenericCommand() []byte {
 	buffer := c.buf
 	buffer.Reset()
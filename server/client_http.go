@@ -67,8 +67,7 @@ func (c *httpClient) makeRequest(app *App, r *http.Request, w http.ResponseWrite
 
 	db, cmd, argsStr, contentType := c.parseReqPath(r)
 
-	c.db, err = app.ldb.Select(db)
-	if err != nil {
+	if err = c.selectDB(db); err != nil {
 		return err
 	}
 
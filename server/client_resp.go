@@ -204,13 +204,10 @@ func (c *respClient) handleXSelectCmd() error {
 		return fmt.Errorf("invalid db for XSELECT, err %v", err)
 	}
 
-	db, err := c.app.ldb.Select(index)
-	if err != nil {
+	if err := c.selectDB(index); err != nil {
 		return fmt.Errorf("invalid db for XSELECT, err %v", err)
 	}
 
-	c.db = db
-
 	c.cmd = hack.String(lowerSlice(c.args[2]))
 	c.args = c.args[3:]
 
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/siddontang/go/hack"
+)
+
+func parseSelectDB(c *client, arg []byte) (*ledis.DB, error) {
+	index, err := ledis.StrInt64(arg, nil)
+	if err != nil {
+		return nil, ErrValue
+	}
+
+	return c.ldb.Select(int(index))
+}
+
+// RENAME key newkey
+func renameCommand(c *client) error {
+	args := c.args
+	if len(args) != 2 {
+		return ErrCmdParams
+	}
+
+	if err := c.db.Rename(args[0], args[1]); err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+// RENAMENX key newkey
+func renamenxCommand(c *client) error {
+	args := c.args
+	if len(args) != 2 {
+		return ErrCmdParams
+	}
+
+	n, err := c.db.RenameNX(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(n)
+	return nil
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func copyCommand(c *client) error {
+	args := c.args
+	if len(args) < 2 {
+		return ErrCmdParams
+	}
+
+	dst := c.db
+	replace := false
+
+	var err error
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(hack.String(args[i])) {
+		case "DB":
+			if i+1 >= len(args) {
+				return ErrCmdParams
+			}
+
+			if dst, err = parseSelectDB(c, args[i+1]); err != nil {
+				return err
+			}
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return ErrSyntax
+		}
+	}
+
+	n, err := c.db.Copy(args[0], dst, args[1], replace)
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(n)
+	return nil
+}
+
+// MOVE key db
+func moveCommand(c *client) error {
+	args := c.args
+	if len(args) != 2 {
+		return ErrCmdParams
+	}
+
+	dst, err := parseSelectDB(c, args[1])
+	if err != nil {
+		return err
+	}
+
+	n, err := c.db.Move(args[0], dst)
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(n)
+	return nil
+}
+
+func init() {
+	register("rename", renameCommand)
+	register("renamenx", renamenxCommand)
+	register("copy", copyCommand)
+	register("move", moveCommand)
+}
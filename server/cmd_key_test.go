@@ -0,0 +1,91 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/siddontang/goredis"
+)
+
+func TestRename(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	c.Do("SELECT", 2)
+	defer c.Do("SELECT", 0)
+
+	c.Do("DEL", "rename_a", "rename_b", "rename_c")
+	c.Do("ZCLEAR", "rename_a")
+	c.Do("ZCLEAR", "rename_b")
+	c.Do("ZCLEAR", "rename_c")
+
+	c.Do("ZADD", "rename_a", 1, "a", 2, "b")
+	c.Do("ZEXPIRE", "rename_a", 100)
+
+	if _, err := c.Do("RENAME", "rename_a", "rename_b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := goredis.Int(c.Do("ZCARD", "rename_b")); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c.Do("ZTTL", "rename_b")); err != nil {
+		t.Fatal(err)
+	} else if n <= 0 {
+		t.Fatal(n)
+	}
+
+	if _, err := c.Do("RENAME", "rename_a", "rename_b"); err == nil {
+		t.Fatal("must error")
+	}
+
+	c.Do("SET", "rename_a", 1)
+	if n, err := goredis.Int(c.Do("RENAMENX", "rename_a", "rename_b")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c.Do("COPY", "rename_b", "rename_c", "DB", 3)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c.Do("COPY", "rename_b", "rename_c", "DB", 3)); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c.Do("COPY", "rename_b", "rename_c", "DB", 3, "REPLACE")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err := c.Do("COPY", "rename_b", "rename_c", "UNKNOWN"); err == nil {
+		t.Fatal("must error")
+	}
+
+	if n, err := goredis.Int(c.Do("MOVE", "rename_a", 3)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	c.Do("SELECT", 3)
+	if n, err := goredis.Int(c.Do("GET", "rename_a")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c.Do("ZSCORE", "rename_c", "b")); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatal(n)
+	}
+}
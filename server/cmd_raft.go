@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siddontang/go/hack"
+)
+
+// the commands served by every node in the raft mode, the others are served by the leader only
+var raftLocalCmds = map[string]bool{
+	"auth":   true,
+	"ping":   true,
+	"echo":   true,
+	"select": true,
+	"info":   true,
+	"time":   true,
+	"config": true,
+	"role":   true,
+	"raft":   true,
+	"client": true,
+}
+
+// checkRaftLeader returns the NOTLEADER error with the leader address if the command
+// must be served by the leader, and this node is not.
+func (c *client) checkRaftLeader() error {
+	if c.app.raft == nil || raftLocalCmds[c.cmd] {
+		return nil
+	}
+
+	return c.app.raft.CheckLeader()
+}
+
+// RAFT JOIN addr raft_addr | REMOVE addr | LEADER | NODES
+func raftCommand(c *client) error {
+	if c.app.raft == nil {
+		return fmt.Errorf("raft mode is not enabled")
+	} else if len(c.args) == 0 {
+		return ErrCmdParams
+	}
+
+	args := c.args[1:]
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "join":
+		if len(args) != 2 {
+			return ErrCmdParams
+		}
+
+		if err := c.app.raft.Join(string(args[0]), string(args[1])); err != nil {
+			return err
+		}
+		c.resp.writeStatus(OK)
+	case "remove":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		if err := c.app.raft.Remove(string(args[0])); err != nil {
+			return err
+		}
+		c.resp.writeStatus(OK)
+	case "leader":
+		if len(args) != 0 {
+			return ErrCmdParams
+		}
+
+		if addr := c.app.raft.Leader(); len(addr) > 0 {
+			c.resp.writeBulk(hack.Slice(addr))
+		} else {
+			c.resp.writeBulk(nil)
+		}
+	case "nodes":
+		if len(args) != 0 {
+			return ErrCmdParams
+		}
+
+		servers, err := c.app.raft.Servers()
+		if err != nil {
+			return err
+		}
+
+		leader := c.app.raft.Leader()
+
+		ay := make([]interface{}, 0, len(servers))
+		for _, s := range servers {
+			role := "follower"
+			if string(s.ID) == leader {
+				role = "leader"
+			}
+
+			ay = append(ay, []interface{}{
+				[]byte(s.ID),
+				[]byte(s.Address),
+				[]byte(role),
+			})
+		}
+		c.resp.writeArray(ay)
+	default:
+		return ErrCmdParams
+	}
+
+	return nil
+}
+
+func init() {
+	register("raft", raftCommand)
+}
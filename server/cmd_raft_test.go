@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/siddontang/goredis"
+)
+
+func newRaftTestApp(t *testing.T, dir string, addr string, raftAddr string, peers []config.RaftPeer) *App {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = path.Join(dir, addr)
+	cfg.Addr = addr
+	cfg.Raft.Addr = raftAddr
+	cfg.Raft.Peers = peers
+	cfg.Raft.HeartbeatTimeout = 200
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go app.Run()
+	return app
+}
+
+func waitRaft(t *testing.T, timeout time.Duration, f func() error) {
+	var err error
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(100 * time.Millisecond) {
+		if err = f(); err == nil {
+			return
+		}
+	}
+	t.Fatal(err)
+}
+
+// raftLeader returns the node serving the writes.
+func raftLeader(apps map[string]*App) (string, error) {
+	for addr, app := range apps {
+		if app.raft.IsLeader() {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("no leader")
+}
+
+func TestRaft(t *testing.T) {
+	dir := "/tmp/test_raft"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	peers := []config.RaftPeer{
+		{Addr: "127.0.0.1:11221", RaftAddr: "127.0.0.1:11231"},
+		{Addr: "127.0.0.1:11222", RaftAddr: "127.0.0.1:11232"},
+		{Addr: "127.0.0.1:11223", RaftAddr: "127.0.0.1:11233"},
+	}
+
+	apps := make(map[string]*App)
+	for _, p := range peers {
+		app := newRaftTestApp(t, dir, p.Addr, p.RaftAddr, peers)
+		defer app.Close()
+		apps[p.Addr] = app
+	}
+
+	var leader string
+	waitRaft(t, 10*time.Second, func() (err error) {
+		leader, err = raftLeader(apps)
+		return
+	})
+
+	c := goredis.NewClient(leader, "")
+	defer c.Close()
+
+	if _, err := c.Do("SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	} else if _, err = c.Do("HSET", "h", "f", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c.Do("RAFT", "LEADER")); err != nil {
+		t.Fatal(err)
+	} else if v != leader {
+		t.Fatalf("leader %s != %s", v, leader)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("RAFT", "NODES")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != len(peers) {
+		t.Fatalf("%d nodes != %d", len(ay), len(peers))
+	}
+
+	// the committed writes are applied on every node, the followers redirect the commands
+	for addr := range apps {
+		if addr == leader {
+			continue
+		}
+
+		fc := goredis.NewClient(addr, "")
+		defer fc.Close()
+
+		if _, err := fc.Do("GET", "a"); err == nil || err.Error() != "NOTLEADER "+leader {
+			t.Fatalf("follower %s error %v", addr, err)
+		} else if _, err = fc.Do("SET", "a", "2"); err == nil {
+			t.Fatalf("follower %s must not write", addr)
+		}
+
+		if v, err := goredis.String(fc.Do("INFO", "raft")); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(v, "raft_state:follower") {
+			t.Fatal(v)
+		}
+
+		waitRaft(t, 5*time.Second, func() error {
+			return checkDataEqual(apps[leader], apps[addr])
+		})
+	}
+
+	// a new leader is elected with all the committed writes after the leader is down
+	apps[leader].Close()
+	delete(apps, leader)
+
+	waitRaft(t, 10*time.Second, func() (err error) {
+		leader, err = raftLeader(apps)
+		return
+	})
+
+	c = goredis.NewClient(leader, "")
+	defer c.Close()
+
+	if v, err := goredis.String(c.Do("GET", "a")); err != nil {
+		t.Fatal(err)
+	} else if v != "1" {
+		t.Fatalf("%s != 1", v)
+	}
+
+	if _, err := c.Do("SET", "b", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new node joins the group and receives all the data
+	app := newRaftTestApp(t, dir, "127.0.0.1:11224", "127.0.0.1:11234", nil)
+	defer app.Close()
+
+	if _, err := c.Do("RAFT", "JOIN", "127.0.0.1:11224", "127.0.0.1:11234"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitRaft(t, 10*time.Second, func() error {
+		return checkDataEqual(apps[leader], app)
+	})
+
+	if _, err := c.Do("RAFT", "REMOVE", "127.0.0.1:11224"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("RAFT", "NODES")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != len(peers) {
+		t.Fatalf("%d nodes != %d", len(ay), len(peers))
+	}
+
+	if _, err := c.Do("SLAVEOF", "127.0.0.1", "11224"); err == nil {
+		t.Fatal("slaveof must fail in the raft mode")
+	}
+}
@@ -3,13 +3,16 @@ package server
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/ledisdb/ledisdb/rpl"
 	"github.com/siddontang/go/hack"
+	"github.com/siddontang/go/log"
 	"github.com/siddontang/go/num"
 )
 
@@ -51,26 +54,59 @@ func slaveofCommand(c *client) error {
 	return nil
 }
 
+// FULLSYNC [NEW] [CHECKPOINT store]
+//
+// With CHECKPOINT, the reply is the archive of a checkpoint if the master
+// has the same store and it supports checkpoints, otherwise a dump. The slave
+// with a replication filter always gets a new dump of the filtered data.
 func fullsyncCommand(c *client) error {
 	args := c.args
 	needNew := false
-	if len(args) == 1 && strings.ToLower(hack.String(args[0])) == "new" {
-		needNew = true
+	checkpoint := false
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(hack.String(args[i])) {
+		case "new":
+			needNew = true
+		case "checkpoint":
+			if i+1 >= len(args) {
+				return ErrCmdParams
+			}
+
+			checkpoint = c.app.ldb.SupportCheckpoint() && hack.String(args[i+1]) == c.app.cfg.DBName
+			i++
+		default:
+			return ErrSyntax
+		}
+	}
+
+	if c.rplFilter != nil {
+		return filteredFullsync(c)
 	}
 
 	var s *snapshot
 	var err error
 	var t time.Time
 
-	dumper := c.app.ldb
+	openLatest := c.app.snap.OpenLatest
+	create := func() (*snapshot, time.Time, error) {
+		return c.app.snap.Create(c.app.ldb)
+	}
+
+	if checkpoint {
+		openLatest = c.app.snap.OpenLatestCheckpoint
+		create = func() (*snapshot, time.Time, error) {
+			return c.app.snap.CreateCheckpoint(c.app.ldb)
+		}
+	}
 
 	if needNew {
-		s, t, err = c.app.snap.Create(dumper)
+		s, t, err = create()
 	} else {
-		if s, t, err = c.app.snap.OpenLatest(); err != nil {
+		if s, t, err = openLatest(); err != nil {
 			return err
 		} else if s == nil {
-			s, t, err = c.app.snap.Create(dumper)
+			s, t, err = create()
 		} else {
 			gap := time.Duration(c.app.cfg.Replication.ExpiredLogDays*24*3600) * time.Second / 2
 			minT := time.Now().Add(-gap)
@@ -78,7 +114,7 @@ func fullsyncCommand(c *client) error {
 			//snapshot is too old
 			if t.Before(minT) {
 				s.Close()
-				s, t, err = c.app.snap.Create(dumper)
+				s, t, err = create()
 			}
 		}
 	}
@@ -96,6 +132,22 @@ func fullsyncCommand(c *client) error {
 	return nil
 }
 
+// filteredFullsync replies a temporary dump of the data selected by the filter of the slave.
+func filteredFullsync(c *client) error {
+	s, err := c.app.snap.CreateTemp(func(w io.Writer) error {
+		return c.app.ldb.DumpFiltered(w, c.rplFilter)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeBulkFrom(s.Size(), s)
+
+	s.Close()
+
+	return nil
+}
+
 var dummyBuf = make([]byte, 8)
 
 func syncCommand(c *client) error {
@@ -122,7 +174,7 @@ func syncCommand(c *client) error {
 		return fmt.Errorf("invalid sync logid %d > %d + 1", logID, stat.LastID)
 	}
 
-	c.lastLogID.Set(lastLogID)
+	c.app.slaveSynced(c, lastLogID)
 
 	if lastLogID == stat.LastID {
 		c.app.slaveAck(c)
@@ -132,7 +184,7 @@ func syncCommand(c *client) error {
 
 	c.syncBuf.Write(dummyBuf)
 
-	if _, _, err := c.app.ldb.ReadLogsToTimeout(logID, &c.syncBuf, 1, c.app.quit); err != nil {
+	if _, _, err := c.app.ldb.ReadFilteredLogsToTimeout(logID, &c.syncBuf, 1, c.app.quit, c.rplFilter); err != nil {
 		return err
 	}
 
@@ -151,6 +203,12 @@ func syncCommand(c *client) error {
 
 //inner command, only for replication
 //REPLCONF <option> <value> <option> <value> ...
+//
+//With repl-id, the reply is CONTINUE or FULLRESYNC with the master replication ID,
+//like the PSYNC of redis.
+//
+//filter-db index and filter-prefix prefix, repeated for every database and prefix,
+//set the replication filter, the slave only gets the selected data.
 func replconfCommand(c *client) error {
 	args := c.args
 	if len(args)%2 != 0 {
@@ -161,12 +219,18 @@ func replconfCommand(c *client) error {
 		return ledis.ErrRplNotSupport
 	}
 
-	//now only support "listening-port"
+	// the replication ID and the last log ID of the slave, see rpl.ID
+	var id rpl.ID
+	var lastLogID uint64
+	hasID := false
+
+	var filter ledis.ReplicationFilter
+
+	var err error
 	for i := 0; i < len(args); i += 2 {
 		switch strings.ToLower(hack.String(args[i])) {
 		case "listening-port":
 			var host string
-			var err error
 			if _, err = num.ParseUint16(hack.String(args[i+1])); err != nil {
 				return err
 			}
@@ -177,11 +241,170 @@ func replconfCommand(c *client) error {
 			c.slaveListeningAddr = net.JoinHostPort(host, hack.String(args[i+1]))
 
 			c.app.addSlave(c)
+		case "repl-id":
+			id.ID = string(args[i+1])
+			hasID = true
+		case "repl-prev-id":
+			id.PrevID = string(args[i+1])
+		case "repl-prev-last-log-id":
+			if id.PrevLastLogID, err = ledis.StrUint64(args[i+1], nil); err != nil {
+				return ErrCmdParams
+			}
+		case "repl-last-log-id":
+			if lastLogID, err = ledis.StrUint64(args[i+1], nil); err != nil {
+				return ErrCmdParams
+			}
+		case "filter-db":
+			var index int
+			if index, err = strconv.Atoi(hack.String(args[i+1])); err != nil {
+				return ErrValue
+			} else if index < 0 || index >= c.app.cfg.Databases {
+				return fmt.Errorf("invalid filter db index %d", index)
+			}
+			filter.DBs = append(filter.DBs, index)
+		case "filter-prefix":
+			filter.Prefixes = append(filter.Prefixes, append([]byte(nil), args[i+1]...))
 		default:
 			return ErrSyntax
 		}
 	}
 
+	if len(filter.DBs) > 0 || len(filter.Prefixes) > 0 {
+		c.rplFilter = &filter
+	}
+
+	// the slave before the replication ID only needs OK
+	if !hasID {
+		c.resp.writeStatus(OK)
+		return nil
+	}
+
+	ok, err := c.app.ldb.CanContinueReplication(id, lastLogID)
+	if err != nil {
+		return err
+	}
+
+	masterID, err := c.app.ldb.ReplicationID()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		c.resp.writeStatus(fmt.Sprintf("%s %s", replContinue, masterID.ID))
+	} else {
+		log.Infof("slave %s diverges at log %d of %s, needs full sync", c.remoteAddr, lastLogID, id.ID)
+		c.resp.writeStatus(fmt.Sprintf("%s %s", replFullResync, masterID.ID))
+	}
+	return nil
+}
+
+// WAIT numreplicas timeout
+//
+// Waits until numreplicas slaves own the last write of the client or the timeout in milliseconds,
+// no timeout if it is 0, and replies the number of the slaves owning it.
+func waitCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	numSlaves, err := strconv.Atoi(hack.String(c.args[0]))
+	if err != nil || numSlaves < 0 {
+		return ErrValue
+	}
+
+	timeout, err := strconv.ParseInt(hack.String(c.args[1]), 10, 64)
+	if err != nil || timeout < 0 {
+		return ErrValue
+	}
+
+	if !c.app.ldb.ReplicationUsed() {
+		return ledis.ErrRplNotSupport
+	}
+
+	n := c.app.waitSlaveAcks(c.lastLogID.Get(), numSlaves, time.Duration(timeout)*time.Millisecond)
+
+	c.resp.writeInteger(int64(n))
+	return nil
+}
+
+// WAITCOMMIT logid timeout
+//
+// Waits until the slave commits the log logid or the timeout in milliseconds, no timeout if it
+// is 0, and replies the commit log ID. The reads after it see the writes of the log, whose ID
+// is got by CLIENT LASTLOGID on the master.
+func waitcommitCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	logID, err := ledis.StrUint64(c.args[0], nil)
+	if err != nil {
+		return ErrValue
+	}
+
+	timeout, err := strconv.ParseInt(hack.String(c.args[1]), 10, 64)
+	if err != nil || timeout < 0 {
+		return ErrValue
+	}
+
+	commitID, err := c.app.ldb.WaitCommitID(logID, time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(int64(commitID))
+	return nil
+}
+
+// REPLICATION PAUSE [logid] | RESUME | SKIPTO logid
+//
+// Controls the applying of the received logs on the delayed slave, PAUSE stops before
+// the log logid, or the next log without it, and SKIPTO skips the logs before logid.
+func replicationCommand(c *client) error {
+	if len(c.args) == 0 {
+		return ErrCmdParams
+	}
+
+	args := c.args[1:]
+
+	var err error
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "pause":
+		var logID uint64
+		if len(args) > 1 {
+			return ErrCmdParams
+		} else if len(args) == 1 {
+			if logID, err = ledis.StrUint64(args[0], nil); err != nil || logID == 0 {
+				return ErrValue
+			}
+		}
+
+		err = c.app.ldb.PauseReplication(logID)
+	case "resume":
+		if len(args) != 0 {
+			return ErrCmdParams
+		}
+
+		err = c.app.ldb.ResumeReplication()
+	case "skipto":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		var logID uint64
+		if logID, err = ledis.StrUint64(args[0], nil); err != nil {
+			return ErrValue
+		}
+
+		err = c.app.ldb.SkipReplication(logID)
+	default:
+		return ErrSyntax
+	}
+
+	if err != nil {
+		return err
+	}
+
 	c.resp.writeStatus(OK)
 	return nil
 }
@@ -209,19 +432,7 @@ func roleCommand(c *client) error {
 	if isMaster {
 		ay = append(ay, []byte("master"))
 		ay = append(ay, lastID)
-
-		items := make([]interface{}, 0, 3)
-
-		c.app.slock.Lock()
-		for addr, slave := range c.app.slaves {
-			host, port, _ := splitHostPort(addr)
-
-			items = append(items, []interface{}{[]byte(host),
-				strconv.AppendUint(nil, uint64(port), 10),
-				strconv.AppendUint(nil, slave.lastLogID.Get(), 10)})
-		}
-		c.app.slock.Unlock()
-		ay = append(ay, items)
+		ay = append(ay, roleSlaves(c.app))
 	} else {
 		host, port, _ := splitHostPort(slaveof)
 		ay = append(ay, []byte("slave"))
@@ -229,12 +440,32 @@ func roleCommand(c *client) error {
 		ay = append(ay, int64(port))
 		ay = append(ay, []byte(replStatetring(c.app.m.state.Get())))
 		ay = append(ay, lastID)
+
+		// the slaves of this slave in the cascading replication
+		ay = append(ay, roleSlaves(c.app))
 	}
 
 	c.resp.writeArray(ay)
 	return nil
 }
 
+// roleSlaves returns the host, port and last log ID of every slave.
+func roleSlaves(app *App) []interface{} {
+	items := make([]interface{}, 0, 3)
+
+	app.slock.Lock()
+	for addr, slave := range app.slaves {
+		host, port, _ := splitHostPort(addr)
+
+		items = append(items, []interface{}{[]byte(host),
+			strconv.AppendUint(nil, uint64(port), 10),
+			strconv.AppendUint(nil, slave.lastLogID.Get(), 10)})
+	}
+	app.slock.Unlock()
+
+	return items
+}
+
 func replStatetring(r int32) string {
 	switch r {
 	case replConnectState:
@@ -270,4 +501,7 @@ func init() {
 	register("sync", syncCommand)
 	register("replconf", replconfCommand)
 	register("role", roleCommand)
+	register("wait", waitCommand)
+	register("waitcommit", waitcommitCommand)
+	register("replication", replicationCommand)
 }
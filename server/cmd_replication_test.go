@@ -1,9 +1,21 @@
 package server
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -144,6 +156,7 @@ func TestReplication(t *testing.T) {
 		int64(11182),
 		[]byte("connected"),
 		int64(sStat.LastID),
+		[]interface{}{},
 	}); err != nil {
 		t.Fatal(err)
 	}
@@ -157,6 +170,22 @@ func TestReplication(t *testing.T) {
 	if err = checkDataEqual(master, slave); err != nil {
 		t.Fatal(err)
 	}
+
+	if err = master.ldb.SwapDB(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1 * time.Second)
+	slave.ldb.WaitReplication()
+
+	if err = checkDataEqual(master, slave); err != nil {
+		t.Fatal(err)
+	}
+
+	sdb, _ := slave.ldb.Select(1)
+	if v, _ := sdb.Get([]byte("a")); v == nil {
+		t.Fatal("slave databases must be swapped")
+	}
 }
 
 func checkTestRole(addr string, checkRoles []interface{}) error {
@@ -170,3 +199,741 @@ func checkTestRole(addr string, checkRoles []interface{}) error {
 	}
 	return nil
 }
+
+// writeTestCerts writes a CA and a certificate of 127.0.0.1 and localhost signed by it in dir.
+// newTestReplicationApp runs the app with the replication in dataDir/name,
+// slaveof is empty for the master.
+func newTestReplicationApp(t *testing.T, dataDir string, name string, addr string, slaveof string) *App {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = path.Join(dataDir, name)
+	cfg.Addr = addr
+	cfg.SlaveOf = slaveof
+	cfg.UseReplication = true
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go app.Run()
+	return app
+}
+
+func writeTestCerts(dir string) error {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ledis test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	crt := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	crtDER, err := x509.CreateCertificate(rand.Reader, crt, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]*pem.Block{
+		"ca.crt":   {Type: "CERTIFICATE", Bytes: caDER},
+		"test.crt": {Type: "CERTIFICATE", Bytes: crtDER},
+		"test.key": {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+
+	for name, b := range files {
+		if err = ioutil.WriteFile(path.Join(dir, name), pem.EncodeToMemory(b), 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestReplicationTLS(t *testing.T) {
+	dataDir := "/tmp/test_replication_tls"
+	os.RemoveAll(dataDir)
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll(dataDir)
+
+	if err := writeTestCerts(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	masterCfg := config.NewConfigDefault()
+	masterCfg.DataDir = path.Join(dataDir, "master")
+	masterCfg.Addr = "127.0.0.1:11190"
+	masterCfg.UseReplication = true
+	masterCfg.TLS = config.TLS{
+		Enabled:     true,
+		Certificate: path.Join(dataDir, "test.crt"),
+		Key:         path.Join(dataDir, "test.key"),
+	}
+
+	master, err := NewApp(masterCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	go master.Run()
+
+	newSlave := func(name string, addr string, serverName string) *App {
+		cfg := config.NewConfigDefault()
+		cfg.DataDir = path.Join(dataDir, name)
+		cfg.Addr = addr
+		cfg.SlaveOf = masterCfg.Addr
+		cfg.UseReplication = true
+		cfg.Replication.TLS = config.ReplicationTLS{
+			Enabled:     true,
+			CAFile:      path.Join(dataDir, "ca.crt"),
+			Certificate: path.Join(dataDir, "test.crt"),
+			Key:         path.Join(dataDir, "test.key"),
+			ServerName:  serverName,
+		}
+
+		app, err := NewApp(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go app.Run()
+		return app
+	}
+
+	slave := newSlave("slave", "127.0.0.1:11191", "")
+	defer slave.Close()
+
+	// the master certificate can't be verified with the wrong server name
+	wrongSlave := newSlave("wrong_slave", "127.0.0.1:11192", "other.example")
+	defer wrongSlave.Close()
+
+	db, _ := master.ldb.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+
+	time.Sleep(2 * time.Second)
+	slave.ldb.WaitReplication()
+
+	if err = checkDataEqual(master, slave); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = checkDataEqual(master, wrongSlave); err == nil {
+		t.Fatal("must not replicate with the wrong server name")
+	} else if s := wrongSlave.m.state.Get(); s != replConnectState {
+		t.Fatalf("invalid state %d", s)
+	}
+}
+
+func TestCascadingReplication(t *testing.T) {
+	dataDir := "/tmp/test_replication_cascading"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	master := newTestReplicationApp(t, dataDir, "master", "127.0.0.1:11193", "")
+	defer master.Close()
+
+	mid := newTestReplicationApp(t, dataDir, "mid", "127.0.0.1:11194", "127.0.0.1:11193")
+	defer mid.Close()
+
+	leaf := newTestReplicationApp(t, dataDir, "leaf", "127.0.0.1:11195", "127.0.0.1:11194")
+	defer leaf.Close()
+
+	db, _ := master.ldb.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+	db.Set([]byte("b"), []byte("2"))
+
+	checkChain := func() {
+		time.Sleep(time.Second)
+		mid.ldb.WaitReplication()
+		leaf.ldb.WaitReplication()
+
+		if err := checkDataEqual(master, leaf); err != nil {
+			t.Fatal(err)
+		}
+
+		// the logs keep the IDs of the master
+		mStat, _ := master.ldb.ReplicationStat()
+		lStat, _ := leaf.ldb.ReplicationStat()
+		if mStat.LastID != lStat.CommitID {
+			t.Fatalf("%d != %d", mStat.LastID, lStat.CommitID)
+		}
+
+		if err := checkTestRole(mid.cfg.Addr, []interface{}{
+			[]byte("slave"),
+			[]byte("127.0.0.1"),
+			int64(11193),
+			[]byte("connected"),
+			int64(mStat.LastID),
+			[]interface{}{
+				[]interface{}{
+					[]byte("127.0.0.1"),
+					[]byte("11195"),
+					[]byte(fmt.Sprintf("%d", mStat.LastID)),
+				}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkChain()
+
+	// the leaf loads the full data from the slave
+	if err := leaf.slaveof(mid.cfg.Addr, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Set([]byte("c"), []byte("3"))
+	db.Del([]byte("a"))
+
+	checkChain()
+
+	var buf bytes.Buffer
+	mid.info.dumpReplication(&buf)
+	if !strings.Contains(buf.String(), "slave0:addr=127.0.0.1:11195") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestReplicationFailover(t *testing.T) {
+	dataDir := "/tmp/test_replication_failover"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	master := newTestReplicationApp(t, dataDir, "master", "127.0.0.1:11196", "")
+	defer master.Close()
+
+	slave1 := newTestReplicationApp(t, dataDir, "slave1", "127.0.0.1:11197", "127.0.0.1:11196")
+	defer slave1.Close()
+
+	slave2 := newTestReplicationApp(t, dataDir, "slave2", "127.0.0.1:11198", "127.0.0.1:11196")
+	defer slave2.Close()
+
+	db, _ := master.ldb.Select(0)
+	db.Set([]byte("a"), []byte("1"))
+	db.Set([]byte("b"), []byte("2"))
+
+	time.Sleep(time.Second)
+	slave1.ldb.WaitReplication()
+	slave2.ldb.WaitReplication()
+
+	masterID, _ := master.ldb.ReplicationID()
+	if id, _ := slave2.ldb.ReplicationID(); id.ID != masterID.ID {
+		t.Fatalf("%s != %s", id.ID, masterID.ID)
+	}
+
+	// promote slave1, and the old master writes without replicating to it
+	if err := slave1.slaveof("", false, false); err != nil {
+		t.Fatal(err)
+	}
+	db.Set([]byte("c"), []byte("3"))
+
+	promotedID, _ := slave1.ldb.ReplicationID()
+	if promotedID.ID == masterID.ID || promotedID.PrevID != masterID.ID {
+		t.Fatalf("invalid promoted ID %v", promotedID)
+	}
+
+	s1db, _ := slave1.ldb.Select(0)
+	s1db.Set([]byte("d"), []byte("4"))
+
+	// slave2 has the logs of the old master after the promotion, so it diverges
+	if err := slave2.slaveof(slave1.cfg.Addr, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old master diverges too
+	if err := master.slaveof(slave1.cfg.Addr, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Second)
+	slave2.ldb.WaitReplication()
+	master.ldb.WaitReplication()
+
+	for _, app := range []*App{slave2, master} {
+		if err := checkDataEqual(slave1, app); err != nil {
+			t.Fatal(err)
+		}
+
+		adb, _ := app.ldb.Select(0)
+		if v, _ := adb.Get([]byte("c")); v != nil {
+			t.Fatal("the diverged write must be dropped by the full sync")
+		}
+
+		if id, _ := app.ldb.ReplicationID(); id.ID != promotedID.ID {
+			t.Fatalf("%s != %s", id.ID, promotedID.ID)
+		}
+	}
+
+	// promote slave2 without diverging, slave1 and the master continue incrementally
+	s1Stat, _ := slave1.ldb.ReplicationStat()
+	mStat, _ := master.ldb.ReplicationStat()
+
+	if err := slave2.slaveof("", false, false); err != nil {
+		t.Fatal(err)
+	} else if err = slave1.slaveof(slave2.cfg.Addr, false, false); err != nil {
+		t.Fatal(err)
+	} else if err = master.slaveof(slave2.cfg.Addr, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s2db, _ := slave2.ldb.Select(0)
+	s2db.Set([]byte("e"), []byte("5"))
+
+	time.Sleep(2 * time.Second)
+	slave1.ldb.WaitReplication()
+	master.ldb.WaitReplication()
+
+	for _, app := range []*App{slave1, master} {
+		if err := checkDataEqual(slave2, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the logs are kept without the full sync
+	if s, _ := slave1.ldb.ReplicationStat(); s.FirstID != s1Stat.FirstID || s.FirstID == 0 {
+		t.Fatalf("%d != %d", s.FirstID, s1Stat.FirstID)
+	} else if s, _ := master.ldb.ReplicationStat(); s.LastID <= mStat.LastID {
+		t.Fatalf("%d <= %d", s.LastID, mStat.LastID)
+	}
+}
+
+func TestWait(t *testing.T) {
+	dataDir := "/tmp/test_replication_wait"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	master := newTestReplicationApp(t, dataDir, "master", "127.0.0.1:11241", "")
+	defer master.Close()
+
+	slave := newTestReplicationApp(t, dataDir, "slave", "127.0.0.1:11242", "127.0.0.1:11241")
+
+	// the durability mode is of the connection
+	c, err := goredis.Connect(master.cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do("SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := goredis.Int(c.Do("WAIT", 1, 5000)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("%d != 1", n)
+	}
+
+	// only one slave, WAIT returns after the timeout
+	start := time.Now()
+	if n, err := goredis.Int(c.Do("WAIT", 2, 300)); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("%d != 1", n)
+	} else if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("WAIT returns in %s", d)
+	}
+
+	if _, err := c.Do("CLIENT", "DURABILITY", "SYNC", 1, 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	if ay, err := goredis.MultiBulk(c.Do("CLIENT", "DURABILITY")); err != nil {
+		t.Fatal(err)
+	} else if mode, _ := goredis.String(ay[0], nil); mode != "sync" {
+		t.Fatalf("%s != sync", mode)
+	}
+
+	// the write is replied after the slave owns it
+	if _, err := c.Do("SET", "b", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, _ := master.ldb.ReplicationStat()
+	master.slock.Lock()
+	n := master.ackedSlaves(stat.LastID)
+	master.slock.Unlock()
+	if n != 1 {
+		t.Fatalf("%d slaves ack the write", n)
+	}
+
+	// the write is done, but replied with the error after the timeout if no slave acks
+	slave.Close()
+
+	if _, err := c.Do("CLIENT", "DURABILITY", "SYNC", 1, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	start = time.Now()
+	if _, err := c.Do("SET", "c", "3"); err == nil || !strings.HasPrefix(err.Error(), "NOREPLICAS") {
+		t.Fatalf("must be NOREPLICAS, not %v", err)
+	} else if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("write returns in %s", d)
+	}
+
+	if v, err := goredis.String(c.Do("GET", "c")); err != nil {
+		t.Fatal(err)
+	} else if v != "3" {
+		t.Fatalf("%s != 3", v)
+	}
+
+	if _, err := c.Do("CLIENT", "DURABILITY", "ASYNC"); err != nil {
+		t.Fatal(err)
+	}
+
+	start = time.Now()
+	if _, err := c.Do("SET", "d", "4"); err != nil {
+		t.Fatal(err)
+	} else if d := time.Since(start); d >= 300*time.Millisecond {
+		t.Fatalf("async write returns in %s", d)
+	}
+}
+
+func TestWaitCommit(t *testing.T) {
+	dataDir := "/tmp/test_replication_waitcommit"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	master := newTestReplicationApp(t, dataDir, "master", "127.0.0.1:11243", "")
+	defer master.Close()
+
+	slave := newTestReplicationApp(t, dataDir, "slave", "127.0.0.1:11244", "127.0.0.1:11243")
+	defer slave.Close()
+
+	mc, err := goredis.Connect(master.cfg.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+
+	sc := goredis.NewClient(slave.cfg.Addr, "")
+	defer sc.Close()
+
+	for i := 0; i < 3; i++ {
+		value := fmt.Sprintf("%d", i)
+		if _, err := mc.Do("SET", "a", value); err != nil {
+			t.Fatal(err)
+		}
+
+		logID, err := goredis.Int64(mc.Do("CLIENT", "LASTLOGID"))
+		if err != nil {
+			t.Fatal(err)
+		} else if logID == 0 {
+			t.Fatal("no log id of the write")
+		}
+
+		// the slave reads the write after it commits the log
+		if id, err := goredis.Int64(sc.Do("WAITCOMMIT", logID, 5000)); err != nil {
+			t.Fatal(err)
+		} else if id < logID {
+			t.Fatalf("commit id %d < %d", id, logID)
+		}
+
+		if v, err := goredis.String(sc.Do("GET", "a")); err != nil {
+			t.Fatal(err)
+		} else if v != value {
+			t.Fatalf("%s != %s", v, value)
+		}
+	}
+
+	logID, _ := goredis.Int64(mc.Do("CLIENT", "LASTLOGID"))
+
+	// the log ID is of the writes of the client, not the others
+	db, _ := master.ldb.Select(1)
+	db.Set([]byte("b"), []byte("1"))
+
+	if id, err := goredis.Int64(mc.Do("CLIENT", "LASTLOGID")); err != nil {
+		t.Fatal(err)
+	} else if id != logID {
+		t.Fatalf("%d != %d", id, logID)
+	}
+
+	// the log ID is attached to the replies in a pipeline
+	if _, err := mc.Do("CLIENT", "LOGID", "ON"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range [][]interface{}{{"SET", "a", "x"}, {"GET", "a"}, {"INCR", "a"}} {
+		if err := mc.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		ay, err := goredis.MultiBulk(mc.Receive())
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ay) != 2 {
+			t.Fatalf("invalid reply %v", ay)
+		}
+
+		id, _ := goredis.Int64(ay[0], nil)
+		ids = append(ids, id)
+	}
+
+	// the GET doesn't write, and the INCR error is attached with the log ID of the SET
+	if ids[0] <= logID || ids[1] != ids[0] || ids[2] != ids[0] {
+		t.Fatalf("invalid log ids %v after %d", ids, logID)
+	}
+
+	if _, err := mc.Do("CLIENT", "LOGID", "OFF"); err != nil {
+		t.Fatal(err)
+	}
+	logID = ids[0]
+
+	// WAITCOMMIT returns after the timeout if the log is not committed
+	start := time.Now()
+	if id, err := goredis.Int64(sc.Do("WAITCOMMIT", logID+100, 300)); err != nil {
+		t.Fatal(err)
+	} else if id >= logID+100 {
+		t.Fatalf("commit id %d >= %d", id, logID+100)
+	} else if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("WAITCOMMIT returns in %s", d)
+	}
+}
+
+func TestReplicationFilter(t *testing.T) {
+	dataDir := "/tmp/test_replication_filter"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	masterCfg := config.NewConfigDefault()
+	masterCfg.DataDir = path.Join(dataDir, "master")
+	masterCfg.Addr = "127.0.0.1:11245"
+	masterCfg.UseReplication = true
+
+	master, err := NewApp(masterCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	go master.Run()
+
+	slaveCfg := config.NewConfigDefault()
+	slaveCfg.DataDir = path.Join(dataDir, "slave")
+	slaveCfg.Addr = "127.0.0.1:11246"
+	slaveCfg.UseReplication = true
+	slaveCfg.Replication.FilterDBs = []int{1}
+	slaveCfg.Replication.FilterPrefixes = []string{"cfg:"}
+
+	slave, err := NewApp(slaveCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { slave.Close() }()
+	go slave.Run()
+
+	db0, _ := master.ldb.Select(0)
+	db1, _ := master.ldb.Select(1)
+
+	db0.Set([]byte("cfg:a"), []byte("0"))
+	db1.Set([]byte("cfg:a"), []byte("1"))
+	db1.Set([]byte("b"), []byte("1"))
+
+	check := func(keys ...string) {
+		t.Helper()
+
+		sdb0, _ := slave.ldb.Select(0)
+		sdb1, _ := slave.ldb.Select(1)
+
+		if v, _ := sdb0.Get([]byte("cfg:a")); v != nil {
+			t.Fatalf("db 0 key %q must be filtered", v)
+		}
+
+		for _, key := range keys {
+			if v, _ := sdb1.Get([]byte(key)); string(v) != "1" {
+				t.Fatalf("db 1 key %s %q is not replicated", key, v)
+			}
+		}
+
+		if v, _ := sdb1.Get([]byte("b")); v != nil {
+			t.Fatalf("db 1 key b %q must be filtered", v)
+		}
+
+		// the slave counts the keys it has, not the ones of the master
+		if n, _ := sdb1.DBSize(); n != int64(len(keys)) {
+			t.Fatalf("db 1 size %d != %d", n, len(keys))
+		}
+	}
+
+	// the full sync has the filtered data only
+	c := goredis.NewClient(slaveCfg.Addr, "")
+	defer c.Close()
+
+	if _, err = c.Do("SLAVEOF", "127.0.0.1", "11245", "RESTART"); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCommit := func() {
+		t.Helper()
+
+		stat, err := master.ldb.ReplicationStat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the slave may commit the logs before the full sync is loaded
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(100 * time.Millisecond) {
+			if id, err := slave.ldb.WaitCommitID(stat.LastID, 5*time.Second); err != nil {
+				t.Fatal(err)
+			} else if id >= stat.LastID && slave.m.state.Get() == replConnectedState {
+				return
+			}
+		}
+		t.Fatal("slave doesn't sync the logs")
+	}
+
+	waitCommit()
+	check("cfg:a")
+
+	// the synced logs have the filtered data only
+	db1.Set([]byte("cfg:c"), []byte("1"))
+	db1.Set([]byte("b"), []byte("2"))
+	db0.Set([]byte("cfg:a"), []byte("1"))
+
+	waitCommit()
+	check("cfg:a", "cfg:c")
+
+	// the deletions are synced
+	db1.Del([]byte("cfg:a"))
+
+	waitCommit()
+	check("cfg:c")
+
+	sdb1, _ := slave.ldb.Select(1)
+	if v, _ := sdb1.Get([]byte("cfg:a")); v != nil {
+		t.Fatalf("deleted key %q", v)
+	}
+
+	// the swapped databases are loaded again by the full sync
+	if err = master.ldb.SwapDB(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	waitCommit()
+
+	sdb0, _ := slave.ldb.Select(0)
+	sdb1, _ = slave.ldb.Select(1)
+	if v, _ := sdb1.Get([]byte("cfg:a")); string(v) != "1" {
+		t.Fatalf("swapped db 1 key cfg:a %q is not replicated", v)
+	} else if v, _ = sdb1.Get([]byte("cfg:c")); v != nil {
+		t.Fatalf("swapped db 1 key cfg:c %q must be filtered", v)
+	} else if v, _ = sdb0.Get([]byte("cfg:c")); v != nil {
+		t.Fatalf("swapped db 0 key cfg:c %q must be filtered", v)
+	} else if n, _ := sdb1.DBSize(); n != 1 {
+		t.Fatalf("swapped db 1 size %d != 1", n)
+	}
+
+	// the data before the new filter is loaded by the full sync
+	db1, _ = master.ldb.Select(1)
+	db1.Set([]byte("b"), []byte("1"))
+
+	waitCommit()
+
+	if v, _ := sdb1.Get([]byte("b")); v != nil {
+		t.Fatalf("db 1 key b %q must be filtered", v)
+	}
+
+	slave.Close()
+
+	slaveCfg.SlaveOf = masterCfg.Addr
+	slaveCfg.Replication.FilterPrefixes = []string{"cfg:", "b"}
+
+	if slave, err = NewApp(slaveCfg); err != nil {
+		t.Fatal(err)
+	}
+	go slave.Run()
+
+	waitCommit()
+
+	sdb1, _ = slave.ldb.Select(1)
+	if v, _ := sdb1.Get([]byte("b")); string(v) != "1" {
+		t.Fatalf("db 1 key b %q is not loaded with the new filter", v)
+	} else if n, _ := sdb1.DBSize(); n != 2 {
+		t.Fatalf("db 1 size %d != 2", n)
+	}
+}
+
+func TestReplicationPause(t *testing.T) {
+	dataDir := "/tmp/test_replication_pause"
+	os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir)
+
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = dataDir
+	cfg.Addr = "127.0.0.1:11247"
+	cfg.UseReplication = true
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+	go app.Run()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	defer c.Close()
+
+	if _, err = c.Do("SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, _ := app.ldb.ReplicationStat()
+
+	for _, args := range [][]interface{}{
+		{"PAUSE"},
+		{"PAUSE", stat.LastID + 1},
+		{"RESUME"},
+		{"SKIPTO", stat.LastID + 1},
+	} {
+		if s, err := goredis.String(c.Do("REPLICATION", args...)); err != nil {
+			t.Fatalf("%v error %v", args, err)
+		} else if s != OK {
+			t.Fatalf("%v reply %s", args, s)
+		}
+	}
+
+	for _, args := range [][]interface{}{
+		{"PAUSE", 0},
+		{"SKIPTO", stat.LastID},
+		{"SKIPTO", stat.LastID + 2},
+		{"STOP"},
+	} {
+		if _, err := c.Do("REPLICATION", args...); err == nil {
+			t.Fatalf("%v must fail", args)
+		}
+	}
+}
@@ -258,6 +258,100 @@ func (scg scanCommandGroup) xzscanCommand(c *client) error {
 	return nil
 }
 
+func parseKeyScanType(tp []byte) (ledis.DataType, error) {
+	switch strings.ToUpper(hack.String(tp)) {
+	case "KV", "STRING":
+		return ledis.KV, nil
+	case "HASH":
+		return ledis.HASH, nil
+	case "LIST":
+		return ledis.LIST, nil
+	case "SET":
+		return ledis.SET, nil
+	case "ZSET":
+		return ledis.ZSET, nil
+	default:
+		return 0, fmt.Errorf("invalid key type %s", tp)
+	}
+}
+
+// SCAN cursor [MATCH match] [COUNT count] [TYPE type]
+func scanCommand(c *client) error {
+	args := c.args
+
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	cursor := args[0]
+	if bytes.Equal(cursor, nilCursorRedis) {
+		cursor = nil
+	}
+
+	var match string
+	var dataTypes []ledis.DataType
+	count := 10
+
+	args = args[1:]
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return ErrCmdParams
+		}
+
+		switch strings.ToUpper(hack.String(args[i])) {
+		case "MATCH":
+			match = globToRegexp(hack.String(args[i+1]))
+		case "COUNT":
+			n, err := strconv.Atoi(hack.String(args[i+1]))
+			if err != nil {
+				return ErrValue
+			}
+			count = n
+		case "TYPE":
+			dataType, err := parseKeyScanType(args[i+1])
+			if err != nil {
+				return err
+			}
+			dataTypes = append(dataTypes, dataType)
+		default:
+			return fmt.Errorf("invalid argument %s", args[i])
+		}
+
+		i++
+	}
+
+	next, ay, err := c.db.KeyScan(cursor, count, match, dataTypes...)
+	if err != nil {
+		return err
+	}
+
+	data := make([]interface{}, 2)
+	if next == nil {
+		data[0] = nilCursorRedis
+	} else {
+		data[0] = next
+	}
+	data[1] = ay
+
+	c.resp.writeArray(data)
+	return nil
+}
+
+// KEYS pattern
+func keysCommand(c *client) error {
+	if len(c.args) != 1 {
+		return ErrCmdParams
+	}
+
+	ay, err := c.db.Keys(globToRegexp(hack.String(c.args[0])))
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeSliceArray(ay)
+	return nil
+}
+
 var (
 	xScanGroup = scanCommandGroup{nilCursorLedis, parseXScanArgs}
 	scanGroup  = scanCommandGroup{nilCursorRedis, parseScanArgs}
@@ -269,6 +363,8 @@ var (
 )
 
 func init() {
+	register("scan", scanCommand)
+	register("keys", keysCommand)
 	register("hscan", scanGroup.xhscanCommand)
 	register("sscan", scanGroup.xsscanCommand)
 	register("zscan", scanGroup.xzscanCommand)
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
 
 	"github.com/ledisdb/ledisdb/config"
@@ -32,6 +33,7 @@ func TestScan(t *testing.T) {
 	testListKeyScan(t, c)
 	testZSetKeyScan(t, c)
 	testSetKeyScan(t, c)
+	testKeyspaceScan(t, c)
 }
 
 func checkScanValues(t *testing.T, ay interface{}, values ...interface{}) {
@@ -123,6 +125,126 @@ func testSetKeyScan(t *testing.T, c *goredis.Client) {
 	checkScan(t, c, "SET")
 }
 
+func testKeyspaceScan(t *testing.T, c *goredis.Client) {
+	cursor := "0"
+	n := 0
+	for {
+		ay, err := goredis.Values(c.Do("SCAN", cursor, "count", 7))
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ay) != 2 {
+			t.Fatal(len(ay))
+		}
+
+		keys, _ := goredis.Strings(ay[1], nil)
+		n += len(keys)
+
+		cursor = string(ay[0].([]byte))
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if n != 50 {
+		t.Fatal(n)
+	}
+
+	if ay, err := goredis.Values(c.Do("SCAN", "0", "count", 100, "type", "hash")); err != nil {
+		t.Fatal(err)
+	} else if n := ay[0].([]byte); string(n) != "0" {
+		t.Fatal(string(n))
+	} else {
+		checkScanValues(t, ay[1], 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	}
+
+	if ay, err := goredis.Values(c.Do("SCAN", "0", "match", "[^0-8]", "count", 100, "type", "string")); err != nil {
+		t.Fatal(err)
+	} else {
+		checkScanValues(t, ay[1], 9)
+	}
+
+	if _, err := c.Do("SCAN", "invalid"); err == nil {
+		t.Fatal("must error")
+	}
+
+	if ay, err := goredis.Strings(c.Do("KEYS", "1*")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 5 {
+		t.Fatal(len(ay))
+	}
+
+	if ay, err := goredis.Strings(c.Do("KEYS", "no_such_key?")); err != nil {
+		t.Fatal(err)
+	} else if len(ay) != 0 {
+		t.Fatal(len(ay))
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tbl := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"*", "abc", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"h[ae]llo", "hello", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"a.b", "axb", false},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+		{"[abc", "[abc", true},
+		{"user:*", "user:1", true},
+		{"[é]", "é", true},
+		{"[^é]", "é", false},
+		{"caf[éè]", "cafè", true},
+		{"caf?", "café", true},
+		{"\\é*", "ét", true},
+		{"[\xe9]", "\xe9", true},
+		{"\xff*", "\xff", true},
+	}
+
+	for _, v := range tbl {
+		r := regexp.MustCompile(globToRegexp(v.pattern))
+		if r.MatchString(v.key) != v.match {
+			t.Fatalf("%q %q must match %v", v.pattern, v.key, v.match)
+		}
+	}
+}
+
+func TestScanMatchNonASCII(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	for _, key := range []string{"scan_é_1", "scan_è_2", "scan_e_3"} {
+		if _, err := c.Do("SET", key, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	cursor := "0"
+	for {
+		ay, err := goredis.Values(c.Do("SCAN", cursor, "match", "scan_[é]_*", "count", 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ks, _ := goredis.Strings(ay[1], nil)
+		keys = append(keys, ks...)
+
+		if cursor = string(ay[0].([]byte)); cursor == "0" {
+			break
+		}
+	}
+
+	if len(keys) != 1 || keys[0] != "scan_é_1" {
+		t.Fatalf("%q != [scan_é_1]", keys)
+	}
+}
+
 func TestXHashScan(t *testing.T) {
 	c := getTestConn()
 	defer c.Close()
@@ -52,6 +52,8 @@ func evalGenericCommand(c *client, evalSha1 bool) (err error) {
 	}()
 
 	luaClient.db = c.db
+	luaClient.dbIndex = c.dbIndex
+	luaClient.dbVersion = c.dbVersion
 	// luaClient.script = m
 	luaClient.remoteAddr = c.remoteAddr
 
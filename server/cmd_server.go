@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
 )
 
 func pingCommand(c *client) error {
@@ -71,11 +72,9 @@ func selectCommand(c *client) error {
 	// 	}
 	// }
 
-	db, err := c.ldb.Select(index)
-	if err != nil {
+	if err := c.selectDB(index); err != nil {
 		return err
 	}
-	c.db = db
 	c.resp.writeStatus(OK)
 
 	return nil
@@ -96,12 +95,45 @@ func infoCommand(c *client) error {
 	return nil
 }
 
+// parseFlushAsync parses the [ASYNC|SYNC] option of FLUSHALL and FLUSHDB.
+func parseFlushAsync(args [][]byte) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	} else if len(args) > 1 {
+		return false, ErrCmdParams
+	}
+
+	switch strings.ToUpper(hack.String(args[0])) {
+	case "ASYNC":
+		return true, nil
+	case "SYNC":
+		return false, nil
+	default:
+		return false, ErrSyntax
+	}
+}
+
 func flushallCommand(c *client) error {
-	err := c.ldb.FlushAll()
+	async, err := parseFlushAsync(c.args)
 	if err != nil {
 		return err
 	}
 
+	if async {
+		//the replication logs are kept, so no need to resync
+		if err := c.ldb.FlushAllAsync(); err != nil {
+			return err
+		}
+		c.committedLast()
+
+		c.resp.writeStatus(OK)
+		return nil
+	}
+
+	if err := c.ldb.FlushAll(); err != nil {
+		return err
+	}
+
 	//we will restart the replication from master if possible
 	c.app.tryReSlaveof()
 
@@ -110,8 +142,85 @@ func flushallCommand(c *client) error {
 }
 
 func flushdbCommand(c *client) error {
-	_, err := c.db.FlushAll()
+	async, err := parseFlushAsync(c.args)
+	if err != nil {
+		return err
+	}
+
+	if async {
+		if err = c.ldb.FlushDBAsync(c.dbIndex); err == nil {
+			c.committedLast()
+		}
+	} else {
+		_, err = c.db.FlushAll()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func swapdbCommand(c *client) error {
+	if len(c.args) != 2 {
+		return ErrCmdParams
+	}
+
+	index1, err := strconv.Atoi(hack.String(c.args[0]))
 	if err != nil {
+		return ErrValue
+	}
+
+	index2, err := strconv.Atoi(hack.String(c.args[1]))
+	if err != nil {
+		return ErrValue
+	}
+
+	if err := c.ldb.SwapDB(index1, index2); err != nil {
+		return err
+	}
+	c.committedLast()
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+func dbsizeCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	n, err := c.db.DBSize()
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeInteger(n)
+	return nil
+}
+
+func randomkeyCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	key, err := c.db.RandomKey()
+	if err != nil {
+		return err
+	}
+
+	c.resp.writeBulk(key)
+	return nil
+}
+
+func repairkeycountCommand(c *client) error {
+	if len(c.args) != 0 {
+		return ErrCmdParams
+	}
+
+	if err := c.ldb.RepairKeyCount(); err != nil {
 		return err
 	}
 
@@ -178,6 +287,151 @@ func configCommand(c *client) error {
 	}
 }
 
+// MEMORY USAGE key [SAMPLES count]
+func memoryCommand(c *client) error {
+	args := c.args
+	if len(args) < 1 {
+		return ErrCmdParams
+	}
+
+	if strings.ToLower(hack.String(args[0])) != "usage" {
+		return ErrCmdParams
+	}
+
+	if len(args) != 2 && len(args) != 4 {
+		return ErrCmdParams
+	}
+
+	samples := ledis.DefaultUsageSamples
+	if len(args) == 4 {
+		if strings.ToLower(hack.String(args[2])) != "samples" {
+			return ErrSyntax
+		}
+
+		n, err := ledis.StrInt64(args[3], nil)
+		if err != nil || n < 0 {
+			return ErrValue
+		}
+		samples = int(n)
+	}
+
+	n, err := c.db.MemoryUsage(args[1], samples)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		c.resp.writeBulk(nil)
+	} else {
+		c.resp.writeInteger(n)
+	}
+	return nil
+}
+
+// CLIENT DURABILITY [SYNC numreplicas timeout | ASYNC] | LASTLOGID | LOGID ON|OFF
+func clientCommand(c *client) error {
+	if len(c.args) == 0 {
+		return ErrCmdParams
+	}
+
+	switch strings.ToLower(hack.String(c.args[0])) {
+	case "durability":
+		return clientDurabilityCommand(c, c.args[1:])
+	case "lastlogid":
+		if len(c.args) != 1 {
+			return ErrCmdParams
+		}
+
+		// the token to read the writes of the client on the slaves by WAITCOMMIT
+		c.resp.writeInteger(int64(c.lastLogID.Get()))
+		return nil
+	case "logid":
+		return clientLogIDCommand(c, c.args[1:])
+	default:
+		return ErrCmdParams
+	}
+}
+
+// CLIENT LOGID ON|OFF
+//
+// With ON, the reply of every following command is the array of the log ID of the last
+// write of the client and the reply, so the token for WAITCOMMIT comes with the write.
+func clientLogIDCommand(c *client, args [][]byte) error {
+	if len(args) != 1 {
+		return ErrCmdParams
+	}
+
+	switch strings.ToLower(hack.String(args[0])) {
+	case "on":
+		c.attachLogID = true
+	case "off":
+		c.attachLogID = false
+	default:
+		return ErrSyntax
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
+// CLIENT DURABILITY [SYNC numreplicas timeout | ASYNC]
+//
+// In the sync mode, every write of the client is replied after numreplicas slaves own it or
+// the timeout in milliseconds, no timeout if it is 0, and the reply is NOREPLICAS after the
+// timeout though the write is done. Without the mode, the reply is the current mode with its
+// numreplicas and timeout.
+func clientDurabilityCommand(c *client, args [][]byte) error {
+	if len(args) == 0 {
+		mode := "async"
+		if c.ackSlaves > 0 {
+			mode = "sync"
+		}
+
+		c.resp.writeArray([]interface{}{
+			[]byte(mode),
+			int64(c.ackSlaves),
+			int64(c.ackTimeout / time.Millisecond),
+		})
+		return nil
+	}
+
+	switch strings.ToLower(hack.String(args[0])) {
+	case "sync":
+		if len(args) != 3 {
+			return ErrCmdParams
+		}
+
+		if !c.app.ldb.ReplicationUsed() {
+			return ledis.ErrRplNotSupport
+		}
+
+		n, err := ledis.StrInt64(args[1], nil)
+		if err != nil || n <= 0 {
+			return ErrValue
+		}
+
+		timeout, err := ledis.StrInt64(args[2], nil)
+		if err != nil || timeout < 0 {
+			return ErrValue
+		}
+
+		c.ackSlaves = int(n)
+		c.ackTimeout = time.Duration(timeout) * time.Millisecond
+	case "async":
+		if len(args) != 1 {
+			return ErrCmdParams
+		}
+
+		c.ackSlaves = 0
+		c.ackTimeout = 0
+	default:
+		return ErrSyntax
+	}
+
+	c.resp.writeStatus(OK)
+	return nil
+}
+
 func init() {
 	register("auth", authCommand)
 	register("ping", pingCommand)
@@ -186,6 +440,12 @@ func init() {
 	register("info", infoCommand)
 	register("flushall", flushallCommand)
 	register("flushdb", flushdbCommand)
+	register("dbsize", dbsizeCommand)
+	register("randomkey", randomkeyCommand)
+	register("repairkeycount", repairkeycountCommand)
+	register("swapdb", swapdbCommand)
 	register("time", timeCommand)
 	register("config", configCommand)
+	register("memory", memoryCommand)
+	register("client", clientCommand)
 }
@@ -1,8 +1,12 @@
 package server
 
 import (
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
 	"github.com/siddontang/goredis"
 )
 
@@ -87,3 +91,211 @@ func TestXSelect(t *testing.T) {
 	c2.Do("SELECT", 0)
 
 }
+
+func TestKeyspace(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/test_keyspace"
+	cfg.Addr = "127.0.0.1:11187"
+
+	os.RemoveAll(cfg.DataDir)
+
+	s, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run()
+	defer s.Close()
+
+	c := goredis.NewClient(cfg.Addr, "")
+	c.SetMaxIdleConns(1)
+	defer c.Close()
+
+	if n, err := goredis.Int(c.Do("DBSIZE")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if _, err := goredis.Bytes(c.Do("RANDOMKEY")); err != goredis.ErrNil {
+		t.Fatal(err)
+	}
+
+	c.Do("SET", "a", 1)
+	c.Do("EXPIRE", "a", 100)
+	c.Do("HSET", "b", "f", 1)
+	c.Do("SADD", "c", 1)
+
+	if n, err := goredis.Int(c.Do("DBSIZE")); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatal(n)
+	}
+
+	if key, err := goredis.String(c.Do("RANDOMKEY")); err != nil {
+		t.Fatal(err)
+	} else if key != "a" && key != "b" && key != "c" {
+		t.Fatal(key)
+	}
+
+	if _, err := c.Do("REPAIRKEYCOUNT"); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := goredis.String(c.Do("INFO", "keyspace")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(info, "db0:keys=3,expires=1,kv=1,list=0,hash=1,set=1,zset=0\r\n") {
+		t.Fatal(info)
+	} else if strings.Contains(info, "db1:") {
+		t.Fatal(info)
+	}
+}
+
+func TestSwapDB(t *testing.T) {
+	c1 := getTestConn()
+	defer c1.Close()
+
+	c2 := getTestConn()
+	defer c2.Close()
+
+	c1.Do("SELECT", 14)
+	defer c1.Do("SELECT", 0)
+
+	c2.Do("SELECT", 15)
+	defer c2.Do("SELECT", 0)
+
+	c1.Do("FLUSHDB")
+	c2.Do("FLUSHDB")
+
+	c1.Do("SET", "swapdb_a", "14")
+	c2.Do("SET", "swapdb_a", "15")
+	c2.Do("SET", "swapdb_b", "15")
+
+	if _, err := c1.Do("SWAPDB", 14, 15); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := goredis.String(c1.Do("GET", "swapdb_a")); err != nil {
+		t.Fatal(err)
+	} else if v != "15" {
+		t.Fatal(v)
+	}
+
+	if v, err := goredis.String(c2.Do("GET", "swapdb_a")); err != nil {
+		t.Fatal(err)
+	} else if v != "14" {
+		t.Fatal(v)
+	}
+
+	if _, err := c1.Do("SWAPDB", 14, 16); err == nil {
+		t.Fatal("must error")
+	}
+
+	if _, err := c1.Do("FLUSHDB", "ASYNC"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := goredis.Int(c1.Do("DBSIZE")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int(c2.Do("DBSIZE")); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatal(n)
+	}
+
+	if _, err := c1.Do("FLUSHDB", "LATER"); err == nil {
+		t.Fatal("must error")
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "test_memory_usage"
+
+	if _, err := goredis.Int64(c.Do("MEMORY", "USAGE", key)); err != goredis.ErrNil {
+		t.Fatal(err)
+	}
+
+	c.Do("HSET", key, "f1", "v1")
+	c.Do("HSET", key, "f2", "v2")
+
+	if n, err := goredis.Int64(c.Do("MEMORY", "USAGE", key)); err != nil {
+		t.Fatal(err)
+	} else if n <= 0 {
+		t.Fatal(n)
+	}
+
+	if n, err := goredis.Int64(c.Do("MEMORY", "USAGE", key, "SAMPLES", 0)); err != nil {
+		t.Fatal(err)
+	} else if n <= 0 {
+		t.Fatal(n)
+	}
+
+	if _, err := c.Do("MEMORY", "USAGE", key, "SAMPLES", -1); err == nil {
+		t.Fatal("must error for the negative samples")
+	}
+
+	if _, err := c.Do("MEMORY", "DOCTOR"); err == nil {
+		t.Fatal("must error for the unknown subcommand")
+	}
+
+	if info, err := goredis.String(c.Do("INFO", "store")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(info, "disk_size:") || !strings.Contains(info, "block_cache_hit_rate:") {
+		t.Fatal(info)
+	}
+
+	if info, err := goredis.String(c.Do("INFO", "disk")); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(info, "db0:total=") {
+		t.Fatal(info)
+	}
+}
+
+func TestRetrySwapped(t *testing.T) {
+	startTestApp()
+
+	c := newClient(testApp)
+	if err := c.selectDB(12); err != nil {
+		t.Fatal(err)
+	}
+
+	// swapped before the first write, it runs again on the new handle
+	n := 0
+	err := c.execute(func(c *client) error {
+		n++
+		if n == 1 {
+			if err := c.ldb.SwapDB(12, 13); err != nil {
+				return err
+			}
+		}
+		return c.db.Set([]byte("retry_swapped_a"), []byte("1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("run %d times != 2", n)
+	}
+
+	// swapped after a part is committed, it must not run again on another database
+	n = 0
+	err = c.execute(func(c *client) error {
+		n++
+		if err := c.db.Set([]byte("retry_swapped_b"), []byte("1")); err != nil {
+			return err
+		} else if err = c.ldb.SwapDB(12, 13); err != nil {
+			return err
+		}
+		return c.db.Set([]byte("retry_swapped_c"), []byte("1"))
+	})
+	if err != ledis.ErrDBSwapped {
+		t.Fatalf("err %v != %v", err, ledis.ErrDBSwapped)
+	} else if n != 1 {
+		t.Fatalf("run %d times != 1", n)
+	}
+}
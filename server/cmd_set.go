@@ -114,6 +114,26 @@ func sismemberCommand(c *client) error {
 	return nil
 }
 
+func smismemberCommand(c *client) error {
+	args := c.args
+	if len(args) < 2 {
+		return ErrCmdParams
+	}
+
+	r, err := c.db.SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	ay := make([]interface{}, len(r))
+	for i, n := range r {
+		ay[i] = n
+	}
+
+	c.resp.writeArray(ay)
+	return nil
+}
+
 func smembersCommand(c *client) error {
 	args := c.args
 	if len(args) != 1 {
@@ -268,6 +288,7 @@ func init() {
 	register("sinter", sinterCommand)
 	register("sinterstore", sinterstoreCommand)
 	register("sismember", sismemberCommand)
+	register("smismember", smismemberCommand)
 	register("smembers", smembersCommand)
 	register("srem", sremCommand)
 	register("sunion", sunionCommand)
@@ -91,6 +91,12 @@ func TestSet(t *testing.T) {
 		t.Fatal(n)
 	}
 
+	if n, err := goredis.MultiBulk(c.Do("smismember", key2, 0, 100, 1)); err != nil {
+		t.Fatal(err)
+	} else if len(n) != 3 || n[0].(int64) != 1 || n[1].(int64) != 0 || n[2].(int64) != 1 {
+		t.Fatal(n)
+	}
+
 	if n, err := goredis.MultiBulk(c.Do("smembers", key2)); err != nil {
 		t.Fatal(err)
 	} else if len(n) != 4 {
@@ -161,6 +167,10 @@ func TestSetErrorParams(t *testing.T) {
 		t.Fatalf("invalid err of %v", err)
 	}
 
+	if _, err := c.Do("smismember", "k1"); err == nil {
+		t.Fatalf("invalid err of %v", err)
+	}
+
 	if _, err := c.Do("smembers"); err == nil {
 		t.Fatalf("invalid err of %v", err)
 	}
@@ -6,11 +6,13 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ledisdb/ledisdb/ledis"
+	"github.com/ledisdb/ledisdb/store"
 	"github.com/siddontang/go/sync2"
 )
 
@@ -75,6 +77,12 @@ func (i *info) Dump(section string) []byte {
 		i.dumpStore(buf)
 	case "replication":
 		i.dumpReplication(buf)
+	case "raft":
+		i.dumpRaft(buf)
+	case "keyspace":
+		i.dumpKeyspace(buf)
+	case "disk":
+		i.dumpDisk(buf)
 	default:
 		buf.WriteString(fmt.Sprintf("# %s\r\n", section))
 	}
@@ -97,6 +105,12 @@ func (i *info) dumpAll(buf *bytes.Buffer) {
 	i.dumpGC(buf)
 	buf.Write(Delims)
 	i.dumpReplication(buf)
+	buf.Write(Delims)
+	if i.app.raft != nil {
+		i.dumpRaft(buf)
+		buf.Write(Delims)
+	}
+	i.dumpKeyspace(buf)
 }
 
 func (i *info) dumpServer(buf *bytes.Buffer) {
@@ -188,23 +202,68 @@ func (i *info) dumpStore(buf *bytes.Buffer) {
 		infoPair{"get_missing", s.GetMissingNum},
 		infoPair{"put", s.PutNum},
 		infoPair{"delete", s.DeleteNum},
+		infoPair{"delete_range", s.DeleteRangeNum},
+		infoPair{"merge", s.MergeNum},
 		infoPair{"get_total_time", s.GetTotalTime.Get().String()},
 		infoPair{"iter", s.IterNum},
 		infoPair{"iter_seek", s.IterSeekNum},
 		infoPair{"iter_close", s.IterCloseNum},
 		infoPair{"batch_commit", s.BatchCommitNum},
 		infoPair{"batch_commit_total_time", s.BatchCommitTotalTime.Get().String()},
+		infoPair{"compress", s.CompressNum},
+		infoPair{"compress_ratio", fmt.Sprintf("%.4f", compressRatio(s))},
+		infoPair{"decompress", s.DecompressNum},
+		infoPair{"cache_hit", s.CacheHitNum},
+		infoPair{"cache_miss", s.CacheMissNum},
+		infoPair{"cache_hit_rate", fmt.Sprintf("%.4f", cacheHitRate(s))},
+	)
+
+	p, err := i.app.ldb.StoreProperties()
+	if err != nil {
+		return
+	}
+
+	files := make([]string, 0, len(p.LevelFiles))
+	for _, n := range p.LevelFiles {
+		files = append(files, fmt.Sprintf("%d", n))
+	}
+
+	i.dumpPairs(buf, infoPair{"disk_size", p.DiskSize},
+		infoPair{"disk_size_human", getMemoryHuman(uint64(p.DiskSize))},
+		infoPair{"level_files", strings.Join(files, ",")},
+		infoPair{"pending_compaction_bytes", p.PendingCompactionBytes},
+		infoPair{"memtable_size", p.MemTableSize},
+		infoPair{"block_cache_size", p.BlockCacheSize},
+		infoPair{"block_cache_hit_rate", fmt.Sprintf("%.4f", p.BlockCacheHitRate())},
 	)
 }
 
+// compressRatio returns the compressed size divided by the raw size of the compressed values.
+func compressRatio(s *store.Stat) float64 {
+	if n := s.CompressRawSize.Get(); n > 0 {
+		return float64(s.CompressSize.Get()) / float64(n)
+	}
+	return 0
+}
+
+func cacheHitRate(s *store.Stat) float64 {
+	hit := s.CacheHitNum.Get()
+	if n := hit + s.CacheMissNum.Get(); n > 0 {
+		return float64(hit) / float64(n)
+	}
+	return 0
+}
+
 func (i *info) dumpReplication(buf *bytes.Buffer) {
 	buf.WriteString("# Replication\r\n")
 
 	p := []infoPair{}
 	i.app.slock.Lock()
 	slaves := make([]string, 0, len(i.app.slaves))
+	slaveLogIDs := make([]uint64, 0, len(i.app.slaves))
 	for _, s := range i.app.slaves {
 		slaves = append(slaves, s.slaveListeningAddr)
+		slaveLogIDs = append(slaveLogIDs, s.lastLogID.Get())
 	}
 	i.app.slock.Unlock()
 
@@ -237,6 +296,12 @@ func (i *info) dumpReplication(buf *bytes.Buffer) {
 		p = append(p, infoPair{"slaves", strings.Join(slaves, ",")})
 	}
 
+	// the slaves of a slave are in the cascading replication
+	p = append(p, infoPair{"connected_slaves", len(slaves)})
+	for n, addr := range slaves {
+		p = append(p, infoPair{fmt.Sprintf("slave%d", n), fmt.Sprintf("addr=%s,last_log_id=%d", addr, slaveLogIDs[n])})
+	}
+
 	s, _ := i.app.ldb.ReplicationStat()
 	if s != nil {
 		p = append(p, infoPair{"last_log_id", s.LastID})
@@ -250,6 +315,12 @@ func (i *info) dumpReplication(buf *bytes.Buffer) {
 
 	p = append(p, infoPair{"master_last_log_id", i.Replication.MasterLastLogID.Get()})
 
+	if id, err := i.app.ldb.ReplicationID(); err == nil {
+		p = append(p, infoPair{"repl_id", id.ID})
+		p = append(p, infoPair{"repl_prev_id", id.PrevID})
+		p = append(p, infoPair{"repl_prev_last_log_id", id.PrevLastLogID})
+	}
+
 	if isSlave {
 		// add some redis slave replication info for outer failover service :-)
 		state := i.app.m.state.Get()
@@ -259,8 +330,21 @@ func (i *info) dumpReplication(buf *bytes.Buffer) {
 			p = append(p, infoPair{"master_link_status", "down"})
 		}
 
-		// here, all the slaves have same priority now
-		p = append(p, infoPair{"slave_priority", 100})
+		// the delayed slave applies the logs later
+		p = append(p, infoPair{"apply_delay", i.app.cfg.Replication.ApplyDelay})
+		p = append(p, infoPair{"apply_pause_log_id", i.app.ldb.ReplicationPauseID()})
+
+		// the filtered slave has only a part of the data, and the delayed slave is behind
+		// on purpose, the failover never promotes them with the priority 0
+		rc := &i.app.cfg.Replication
+		p = append(p, infoPair{"filter_dbs", joinInts(rc.FilterDBs)})
+		p = append(p, infoPair{"filter_prefixes", strings.Join(rc.FilterPrefixes, ",")})
+
+		if len(rc.FilterDBs) > 0 || len(rc.FilterPrefixes) > 0 || rc.ApplyDelay > 0 {
+			p = append(p, infoPair{"slave_priority", 0})
+		} else {
+			p = append(p, infoPair{"slave_priority", 100})
+		}
 		if s != nil {
 			if s.LastID > 0 {
 				p = append(p, infoPair{"slave_repl_offset", s.LastID})
@@ -275,8 +359,104 @@ func (i *info) dumpReplication(buf *bytes.Buffer) {
 	i.dumpPairs(buf, p...)
 }
 
+func (i *info) dumpRaft(buf *bytes.Buffer) {
+	buf.WriteString("# Raft\r\n")
+
+	if i.app.raft == nil {
+		i.dumpPairs(buf, infoPair{"raft_enabled", 0})
+		return
+	}
+
+	stats := i.app.raft.Stats()
+
+	i.dumpPairs(buf,
+		infoPair{"raft_enabled", 1},
+		infoPair{"raft_state", strings.ToLower(stats["state"])},
+		infoPair{"raft_leader", i.app.raft.Leader()},
+		infoPair{"raft_term", stats["term"]},
+		infoPair{"raft_num_peers", stats["num_peers"]},
+		infoPair{"raft_last_log_index", stats["last_log_index"]},
+		infoPair{"raft_commit_index", stats["commit_index"]},
+		infoPair{"raft_applied_index", i.app.ldb.AppliedIndex()},
+		infoPair{"raft_last_snapshot_index", stats["last_snapshot_index"]},
+	)
+}
+
+var keyspaceTypes = []ledis.DataType{ledis.KV, ledis.LIST, ledis.HASH, ledis.SET, ledis.ZSET}
+
+func (i *info) dumpKeyspace(buf *bytes.Buffer) {
+	buf.WriteString("# Keyspace\r\n")
+
+	p := []infoPair{}
+	for index := 0; index < i.app.cfg.Databases; index++ {
+		var keys, expires int64
+		types := make([]string, 0, len(keyspaceTypes))
+		for _, tp := range keyspaceTypes {
+			n, m, err := i.app.ldb.KeyCount(index, tp)
+			if err != nil {
+				continue
+			}
+
+			keys += n
+			expires += m
+			types = append(types, fmt.Sprintf("%s=%d", strings.ToLower(tp.String()), n))
+		}
+
+		if keys == 0 {
+			continue
+		}
+
+		p = append(p, infoPair{fmt.Sprintf("db%d", index),
+			fmt.Sprintf("keys=%d,expires=%d,%s", keys, expires, strings.Join(types, ","))})
+	}
+
+	i.dumpPairs(buf, p...)
+}
+
+// dumpDisk dumps the approximate disk size of every non-empty database,
+// it is not in the default sections because it iterates the keys if the store can't estimate the size.
+func (i *info) dumpDisk(buf *bytes.Buffer) {
+	buf.WriteString("# Disk\r\n")
+
+	p := []infoPair{}
+	for index := 0; index < i.app.cfg.Databases; index++ {
+		var keys int64
+		for _, tp := range keyspaceTypes {
+			n, _, _ := i.app.ldb.KeyCount(index, tp)
+			keys += n
+		}
+
+		if keys == 0 {
+			continue
+		}
+
+		u, err := i.app.ldb.DiskUsage(index)
+		if err != nil {
+			continue
+		}
+
+		types := make([]string, 0, len(keyspaceTypes))
+		for _, tp := range keyspaceTypes {
+			types = append(types, fmt.Sprintf("%s=%d", strings.ToLower(tp.String()), u.Types[tp]))
+		}
+
+		p = append(p, infoPair{fmt.Sprintf("db%d", index),
+			fmt.Sprintf("total=%d,%s", u.Total, strings.Join(types, ","))})
+	}
+
+	i.dumpPairs(buf, p...)
+}
+
 func (i *info) dumpPairs(buf *bytes.Buffer, pairs ...infoPair) {
 	for _, v := range pairs {
 		buf.WriteString(fmt.Sprintf("%s:%v\r\n", v.Key, v.Value))
 	}
 }
+
+func joinInts(ns []int) string {
+	ss := make([]string, len(ns))
+	for i, n := range ns {
+		ss[i] = strconv.Itoa(n)
+	}
+	return strings.Join(ss, ",")
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path"
@@ -19,6 +21,12 @@ import (
 	"github.com/siddontang/goredis"
 )
 
+// the replies of REPLCONF with the replication ID
+const (
+	replContinue   = "CONTINUE"
+	replFullResync = "FULLRESYNC"
+)
+
 var (
 	errConnectMaster = errors.New("connect master error")
 	errReplClosed    = errors.New("replication is closed")
@@ -58,6 +66,12 @@ type master struct {
 
 	addr string
 
+	// the TLS to connect to the master, nil if disabled
+	tlsCfg *tls.Config
+
+	// the replication ID of the master in the handshake, empty for the master before it
+	masterID string
+
 	wg sync.WaitGroup
 
 	syncBuf syncBuffer
@@ -103,13 +117,36 @@ func (m *master) closeConn() {
 	m.conn = nil
 }
 
+// connect connects to the master, with TLS if enabled.
+func (m *master) connect() (*goredis.Conn, error) {
+	if m.tlsCfg == nil {
+		return goredis.Connect(m.addr)
+	}
+
+	tlsCfg := m.tlsCfg.Clone()
+	if len(tlsCfg.ServerName) == 0 {
+		host, _, err := net.SplitHostPort(m.addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ServerName = host
+	}
+
+	conn, err := tls.Dial(netType(m.addr), m.addr, tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return goredis.NewConn(conn)
+}
+
 func (m *master) checkConn() error {
 	m.connLock.Lock()
 	defer m.connLock.Unlock()
 
 	var err error
 	if m.conn == nil {
-		m.conn, err = goredis.Connect(m.addr)
+		m.conn, err = m.connect()
 
 		if err != nil {
 			return err
@@ -206,7 +243,8 @@ func (m *master) runReplication(restart bool) {
 
 		m.state.Set(replConnectedState)
 
-		if err := m.replConf(); err != nil {
+		full, err := m.replConf()
+		if err != nil {
 			if strings.Contains(err.Error(), ledis.ErrRplNotSupport.Error()) {
 				log.Fatalf("master doesn't support replication, wait 10s and retry")
 				select {
@@ -221,7 +259,7 @@ func (m *master) runReplication(restart bool) {
 			continue
 		}
 
-		if restart {
+		if restart || full {
 			if err := m.fullSync(); err != nil {
 				log.Errorf("restart fullsync error %s", err.Error())
 				continue
@@ -243,25 +281,81 @@ func (m *master) runReplication(restart bool) {
 	}
 }
 
-func (m *master) replConf() error {
+// replConf sends the listening port, the replication ID with the last log ID and the
+// replication filter, it returns true if the logs diverge from the master and the full
+// sync is needed.
+func (m *master) replConf() (bool, error) {
 	_, port, err := net.SplitHostPort(m.app.cfg.Addr)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if s, err := goredis.String(m.conn.Do("replconf", "listening-port", port)); err != nil {
-		return err
-	} else if strings.ToUpper(s) != "OK" {
-		return fmt.Errorf("not ok but %s", s)
+	id, err := m.app.ldb.ReplicationID()
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	next, err := m.nextSyncLogID()
+	if err != nil {
+		return false, err
+	}
+
+	args := []interface{}{"listening-port", port,
+		"repl-id", id.ID, "repl-prev-id", id.PrevID, "repl-prev-last-log-id", id.PrevLastLogID,
+		"repl-last-log-id", next - 1}
+
+	// the master only sends the selected data
+	for _, index := range m.app.cfg.Replication.FilterDBs {
+		args = append(args, "filter-db", index)
+	}
+
+	for _, prefix := range m.app.cfg.Replication.FilterPrefixes {
+		args = append(args, "filter-prefix", prefix)
+	}
+
+	s, err := goredis.String(m.conn.Do("replconf", args...))
+	if err != nil {
+		return false, err
+	}
+
+	m.masterID = ""
+
+	reply := strings.Fields(s)
+	switch {
+	case len(reply) == 1 && strings.ToUpper(reply[0]) == "OK":
+		// the master before the replication ID
+		return false, nil
+	case len(reply) == 2 && reply[0] == replContinue:
+		m.masterID = reply[1]
+
+		// the logs after are filtered by the new filter, but the data before is not
+		if changed, err := m.app.ldb.ReplicationFilterChanged(); err != nil {
+			return false, err
+		} else if changed {
+			log.Infof("replication filter is changed, full sync from master %s", m.addr)
+			return true, nil
+		}
+
+		return false, m.app.ldb.FollowReplication(m.masterID, false)
+	case len(reply) == 2 && reply[0] == replFullResync:
+		log.Infof("logs diverge from master %s, full sync", m.addr)
+		m.masterID = reply[1]
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid replconf reply %s", s)
+	}
 }
 
 func (m *master) fullSync() error {
 	log.Info("begin full sync")
 
-	if err := m.conn.Send("fullsync"); err != nil {
+	// the master with the same store replies a checkpoint, which is much cheaper than a dump
+	var args []interface{}
+	if m.app.ldb.SupportCheckpoint() {
+		args = append(args, "checkpoint", m.app.cfg.DBName)
+	}
+
+	if err := m.conn.Send("fullsync", args...); err != nil {
 		return err
 	}
 
@@ -282,8 +376,42 @@ func (m *master) fullSync() error {
 		return err
 	}
 
-	if _, err = m.app.ldb.LoadDumpFile(dumpPath); err != nil {
-		log.Errorf("load dump file error %s", err.Error())
+	if f, err = os.Open(dumpPath); err != nil {
+		return err
+	}
+
+	checkpoint, err := isArchive(f)
+	if err == nil && checkpoint {
+		err = m.loadCheckpoint(f)
+	}
+	f.Close()
+
+	if err == nil && !checkpoint {
+		if _, err = m.app.ldb.LoadDumpFile(dumpPath); err != nil {
+			log.Errorf("load dump file error %s", err.Error())
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the data is the same as the master now
+	return m.app.ldb.FollowReplication(m.masterID, true)
+}
+
+func (m *master) loadCheckpoint(r io.Reader) error {
+	dir := path.Join(m.app.cfg.DataDir, "master.checkpoint")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	if err := readArchive(r, dir); err != nil {
+		log.Errorf("read checkpoint error %s", err.Error())
+		return err
+	}
+
+	if _, err := m.app.ldb.LoadCheckpoint(dir); err != nil {
+		log.Errorf("load checkpoint error %s", err.Error())
 		return err
 	}
 
@@ -318,7 +446,8 @@ func (m *master) sync() error {
 	m.syncBuf.Reset()
 
 	if err = m.conn.ReceiveBulkTo(&m.syncBuf); err != nil {
-		if strings.Contains(err.Error(), ledis.ErrLogMissed.Error()) {
+		if strings.Contains(err.Error(), ledis.ErrLogMissed.Error()) ||
+			strings.Contains(err.Error(), ledis.ErrReplicationResync.Error()) {
 			return m.fullSync()
 		}
 		return err
@@ -352,6 +481,10 @@ func (m *master) sync() error {
 }
 
 func (app *App) slaveof(masterAddr string, restart bool, readonly bool) error {
+	if app.raft != nil {
+		return fmt.Errorf("slaveof can not be used in the raft mode")
+	}
+
 	app.m.Lock()
 	defer app.m.Unlock()
 
@@ -373,6 +506,11 @@ func (app *App) slaveof(masterAddr string, restart bool, readonly bool) error {
 			return err
 		}
 
+		// the slaves of the old master can continue with the new replication ID
+		if err := app.ldb.PromoteReplication(); err != nil {
+			return err
+		}
+
 		app.cfg.SetReadonly(readonly)
 	} else {
 		return app.m.startReplication(masterAddr, restart)
@@ -414,6 +552,63 @@ func (app *App) removeSlave(c *client, activeQuit bool) {
 		delete(app.slaves, addr)
 		log.Infof("remove slave %s", addr)
 		asyncNotifyUint64(app.slaveSyncAck, c.lastLogID.Get())
+		app.wakeAckWaiters()
+	}
+}
+
+// slaveSynced sets the last log ID the slave owns, and wakes up the clients waiting for the acks.
+func (app *App) slaveSynced(c *client, lastLogID uint64) {
+	c.lastLogID.Set(lastLogID)
+
+	app.slock.Lock()
+	app.wakeAckWaiters()
+	app.slock.Unlock()
+}
+
+// wakeAckWaiters must be called with slock.
+func (app *App) wakeAckWaiters() {
+	close(app.slaveAckCh)
+	app.slaveAckCh = make(chan struct{})
+}
+
+// ackedSlaves returns the number of the slaves owning the log logID, it must be called with slock.
+func (app *App) ackedSlaves(logID uint64) int {
+	n := 0
+	for _, s := range app.slaves {
+		if s.lastLogID.Get() >= logID {
+			n++
+		}
+	}
+	return n
+}
+
+// waitSlaveAcks waits until numSlaves slaves own the log logID or the timeout, no timeout if it is 0,
+// and returns the number of the slaves owning the log.
+func (app *App) waitSlaveAcks(logID uint64, numSlaves int, timeout time.Duration) int {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+
+	for {
+		app.slock.Lock()
+		n := app.ackedSlaves(logID)
+		ch := app.slaveAckCh
+		app.slock.Unlock()
+
+		if n >= numSlaves {
+			return n
+		}
+
+		select {
+		case <-ch:
+		case <-timeoutCh:
+			return n
+		case <-app.quit:
+			return n
+		}
 	}
 }
 
@@ -7,15 +7,21 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
 	"github.com/siddontang/go/log"
 )
 
 const (
 	snapshotTimeFormat = "2006-01-02T15:04:05.999999999"
+
+	// the dump snapshot is a file, and the checkpoint snapshot is a directory
+	dumpPrefix       = "dmp-"
+	checkpointPrefix = "ckp-"
 )
 
 type snapshotStore struct {
@@ -29,14 +35,23 @@ type snapshotStore struct {
 }
 
 func snapshotName(t time.Time) string {
-	return fmt.Sprintf("dmp-%s", t.Format(snapshotTimeFormat))
+	return fmt.Sprintf("%s%s", dumpPrefix, t.Format(snapshotTimeFormat))
+}
+
+func checkpointName(t time.Time) string {
+	return fmt.Sprintf("%s%s", checkpointPrefix, t.Format(snapshotTimeFormat))
+}
+
+func isCheckpointName(name string) bool {
+	return strings.HasPrefix(name, checkpointPrefix)
 }
 
 func parseSnapshotName(name string) (time.Time, error) {
 	var timeString string
-	if _, err := fmt.Sscanf(name, "dmp-%s", &timeString); err != nil {
-		println(err.Error())
-		return time.Time{}, err
+	if strings.HasPrefix(name, dumpPrefix) || strings.HasPrefix(name, checkpointPrefix) {
+		timeString = name[len(dumpPrefix):]
+	} else {
+		return time.Time{}, fmt.Errorf("invalid snapshot name %s", name)
 	}
 	when, err := time.Parse(snapshotTimeFormat, timeString)
 	if err != nil {
@@ -85,7 +100,7 @@ func (s *snapshotStore) checkSnapshots() error {
 	for _, info := range snapshots {
 		if path.Ext(info.Name()) == ".tmp" {
 			log.Errorf("temp snapshot file name %s, try remove", info.Name())
-			os.Remove(path.Join(cfg.Snapshot.Path, info.Name()))
+			os.RemoveAll(path.Join(cfg.Snapshot.Path, info.Name()))
 			continue
 		}
 
@@ -97,8 +112,10 @@ func (s *snapshotStore) checkSnapshots() error {
 		names = append(names, info.Name())
 	}
 
-	//from old to new
-	sort.Strings(names)
+	//from old to new, the prefixes have the same length
+	sort.Slice(names, func(i, j int) bool {
+		return names[i][len(dumpPrefix):] < names[j][len(dumpPrefix):]
+	})
 
 	s.names = names
 
@@ -144,7 +161,7 @@ func (s *snapshotStore) purge(create bool) {
 	}
 
 	for _, name := range names {
-		if err := os.Remove(s.snapshotPath(name)); err != nil {
+		if err := os.RemoveAll(s.snapshotPath(name)); err != nil {
 			log.Errorf("purge snapshot %s error %s", name, err.Error())
 		}
 	}
@@ -158,33 +175,88 @@ type snapshotDumper interface {
 	Dump(w io.Writer) error
 }
 
+type snapshotCheckpointer interface {
+	Checkpoint(dir string) (*ledis.DumpHead, error)
+}
+
+// snapshot reads a dump file, or the archive of a checkpoint directory.
 type snapshot struct {
 	io.ReadCloser
 
 	f *os.File
+
+	dir   string
+	files []archiveFile
+	r     *io.PipeReader
+
+	// the temporary dump removed after closed
+	temp bool
 }
 
 func (st *snapshot) Read(b []byte) (int, error) {
-	return st.f.Read(b)
+	if st.f != nil {
+		return st.f.Read(b)
+	}
+
+	if st.r == nil {
+		var w *io.PipeWriter
+		st.r, w = io.Pipe()
+		go func() {
+			w.CloseWithError(writeArchive(w, st.dir, st.files))
+		}()
+	}
+	return st.r.Read(b)
 }
 
 func (st *snapshot) Close() error {
-	return st.f.Close()
+	if st.f != nil && st.temp {
+		err := st.f.Close()
+		os.Remove(st.f.Name())
+		return err
+	} else if st.f != nil {
+		return st.f.Close()
+	} else if st.r != nil {
+		return st.r.Close()
+	}
+	return nil
 }
 
 func (st *snapshot) Size() int64 {
+	if st.f == nil {
+		return archiveSize(st.files)
+	}
+
 	s, _ := st.f.Stat()
 	return s.Size()
 }
 
-func (s *snapshotStore) Create(d snapshotDumper) (*snapshot, time.Time, error) {
+func (s *snapshotStore) openSnapshot(name string) (*snapshot, error) {
+	if !isCheckpointName(name) {
+		f, err := os.Open(s.snapshotPath(name))
+		if err != nil {
+			return nil, err
+		}
+		return &snapshot{f: f}, nil
+	}
+
+	dir := s.snapshotPath(name)
+	files, err := listArchiveFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{dir: dir, files: files}, nil
+}
+
+// create creates the snapshot with the name got from the time by nameFunc, the snapshot
+// is created in the temporary path by createFunc and renamed when done.
+func (s *snapshotStore) create(nameFunc func(time.Time) string, createFunc func(string) error) (*snapshot, time.Time, error) {
 	s.Lock()
 	defer s.Unlock()
 
 	s.purge(true)
 
 	now := time.Now()
-	name := snapshotName(now)
+	name := nameFunc(now)
 
 	tmpName := name + ".tmp"
 
@@ -196,45 +268,95 @@ func (s *snapshotStore) Create(d snapshotDumper) (*snapshot, time.Time, error) {
 		}
 	}
 
-	f, err := os.OpenFile(s.snapshotPath(tmpName), os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, time.Time{}, err
-	}
-
-	if err := d.Dump(f); err != nil {
-		f.Close()
-		os.Remove(s.snapshotPath(tmpName))
+	if err := createFunc(s.snapshotPath(tmpName)); err != nil {
+		os.RemoveAll(s.snapshotPath(tmpName))
 		return nil, time.Time{}, err
 	}
 
-	f.Close()
 	if err := os.Rename(s.snapshotPath(tmpName), s.snapshotPath(name)); err != nil {
 		return nil, time.Time{}, err
 	}
 
-	if f, err = os.Open(s.snapshotPath(name)); err != nil {
+	st, err := s.openSnapshot(name)
+	if err != nil {
 		return nil, time.Time{}, err
 	}
 	s.names = append(s.names, name)
 
-	return &snapshot{f: f}, now, nil
+	return st, now, nil
 }
 
-func (s *snapshotStore) OpenLatest() (*snapshot, time.Time, error) {
-	s.Lock()
-	defer s.Unlock()
+func (s *snapshotStore) Create(d snapshotDumper) (*snapshot, time.Time, error) {
+	return s.create(snapshotName, func(p string) error {
+		f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+
+		if err = d.Dump(f); err != nil {
+			f.Close()
+			return err
+		}
+
+		return f.Close()
+	})
+}
 
-	if len(s.names) == 0 {
-		return nil, time.Time{}, nil
+// CreateTemp creates a temporary dump not kept by the store, like the filtered dump of a slave,
+// it is removed after closed, or at the next start if the server crashes.
+func (s *snapshotStore) CreateTemp(dump func(w io.Writer) error) (*snapshot, error) {
+	f, err := ioutil.TempFile(s.cfg.Snapshot.Path, "temp-*.tmp")
+	if err != nil {
+		return nil, err
 	}
 
-	name := s.names[len(s.names)-1]
-	t, _ := parseSnapshotName(name)
+	st := &snapshot{f: f, temp: true}
+
+	if err = dump(f); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
 
-	f, err := os.Open(s.snapshotPath(name))
 	if err != nil {
-		return nil, time.Time{}, err
+		st.Close()
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// CreateCheckpoint creates a checkpoint snapshot, it links the table files of the store,
+// so they take no more disk space until they are removed by the compaction.
+func (s *snapshotStore) CreateCheckpoint(c snapshotCheckpointer) (*snapshot, time.Time, error) {
+	return s.create(checkpointName, func(p string) error {
+		_, err := c.Checkpoint(p)
+		return err
+	})
+}
+
+func (s *snapshotStore) openLatest(checkpoint bool) (*snapshot, time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for i := len(s.names) - 1; i >= 0; i-- {
+		name := s.names[i]
+		if isCheckpointName(name) != checkpoint {
+			continue
+		}
+
+		t, _ := parseSnapshotName(name)
+		st, err := s.openSnapshot(name)
+		return st, t, err
 	}
 
-	return &snapshot{f: f}, t, err
+	return nil, time.Time{}, nil
+}
+
+// OpenLatest opens the latest dump snapshot, or returns nil if there is none.
+func (s *snapshotStore) OpenLatest() (*snapshot, time.Time, error) {
+	return s.openLatest(false)
+}
+
+// OpenLatestCheckpoint opens the latest checkpoint snapshot, or returns nil if there is none.
+func (s *snapshotStore) OpenLatestCheckpoint() (*snapshot, time.Time, error) {
+	return s.openLatest(true)
 }
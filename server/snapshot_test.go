@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/ledis"
 )
 
 type testSnapshotDumper struct {
@@ -77,3 +79,91 @@ func TestSnapshot(t *testing.T) {
 
 	s.Close()
 }
+
+type testSnapshotCheckpointer struct {
+}
+
+func (c *testSnapshotCheckpointer) Checkpoint(dir string) (*ledis.DumpHead, error) {
+	if err := os.MkdirAll(path.Join(dir, "data"), 0755); err != nil {
+		return nil, err
+	}
+
+	ioutil.WriteFile(path.Join(dir, "head"), []byte("head"), 0644)
+	ioutil.WriteFile(path.Join(dir, "data", "000001.ldb"), bytes.Repeat([]byte("a"), 1000), 0644)
+	ioutil.WriteFile(path.Join(dir, "data", "CURRENT"), nil, 0644)
+	return new(ledis.DumpHead), nil
+}
+
+func TestSnapshotCheckpoint(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.Snapshot.MaxNum = 2
+	cfg.Snapshot.Path = path.Join(os.TempDir(), "snapshot_checkpoint")
+
+	os.RemoveAll(cfg.Snapshot.Path)
+	defer os.RemoveAll(cfg.Snapshot.Path)
+
+	s, err := newSnapshotStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, _, err := s.Create(new(testSnapshotDumper)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _, err := s.CreateCheckpoint(new(testSnapshotCheckpointer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if int64(len(b)) != f.Size() {
+		t.Fatalf("archive size %d != %d", len(b), f.Size())
+	}
+
+	if ok, _ := isArchive(bytes.NewReader(b)); !ok {
+		t.Fatal("must be archive")
+	}
+
+	dir := path.Join(os.TempDir(), "snapshot_checkpoint_load")
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	if err = readArchive(bytes.NewReader(b), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := ioutil.ReadFile(path.Join(dir, "data", "000001.ldb")); !bytes.Equal(v, bytes.Repeat([]byte("a"), 1000)) {
+		t.Fatal("invalid table in archive")
+	} else if v, _ := ioutil.ReadFile(path.Join(dir, "head")); string(v) != "head" {
+		t.Fatal("invalid head in archive")
+	}
+
+	// the dump and the checkpoint are opened separately
+	if f, _, err := s.OpenLatest(); err != nil {
+		t.Fatal(err)
+	} else {
+		b, _ := ioutil.ReadAll(f)
+		f.Close()
+		if string(b) != "hello world" {
+			t.Fatal("invalid read snapshot")
+		}
+	}
+
+	if f, _, err := s.OpenLatestCheckpoint(); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Close()
+		if f.dir == "" {
+			t.Fatal("must open checkpoint")
+		}
+	}
+
+	if ok, _ := isArchive(bytes.NewReader([]byte("hello world"))); ok {
+		t.Fatal("dump is not archive")
+	}
+}
@@ -1,5 +1,12 @@
 package server
 
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
 func lowerSlice(buf []byte) []byte {
 	for i, r := range buf {
 		if 'A' <= r && r <= 'Z' {
@@ -21,3 +28,92 @@ func upperSlice(buf []byte) []byte {
 	}
 	return buf
 }
+
+// globToRegexp converts a redis glob-style pattern to an anchored regexp,
+// supporting *, ?, [...], [^...] and \ escaping like redis KEYS and SCAN MATCH.
+// The regexp matches the runes of the key, so a multi-byte rune is one char.
+func globToRegexp(pattern string) string {
+	var buf bytes.Buffer
+
+	buf.WriteString("(?s)^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteByte('.')
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			i += quoteGlobChar(&buf, pattern, i) - 1
+		case '[':
+			start := i + 1
+			if start < len(pattern) && pattern[start] == '^' {
+				start++
+			}
+
+			end := start
+			for ; end < len(pattern) && pattern[end] != ']'; end++ {
+				if pattern[end] == '\\' {
+					end++
+				}
+			}
+
+			if end >= len(pattern) || end == start {
+				// no close bracket or empty class, treat as a literal
+				buf.WriteString(`\[`)
+				continue
+			}
+
+			buf.WriteByte('[')
+			if start > i+1 {
+				buf.WriteByte('^')
+			}
+			for j := start; j < end; j++ {
+				c := pattern[j]
+				escaped := false
+				if c == '\\' {
+					j++
+					c = pattern[j]
+					escaped = true
+				}
+
+				if (c == '-' && !escaped) || isAlphaNum(c) {
+					buf.WriteByte(c)
+				} else if c < utf8.RuneSelf {
+					buf.WriteByte('\\')
+					buf.WriteByte(c)
+				} else {
+					j += quoteGlobChar(&buf, pattern, j) - 1
+				}
+			}
+			buf.WriteByte(']')
+			i = end
+		default:
+			i += quoteGlobChar(&buf, pattern, i) - 1
+		}
+	}
+
+	buf.WriteByte('$')
+	return buf.String()
+}
+
+// quoteGlobChar writes the char of the pattern at i quoted for the regexp and returns
+// its size. A non-ASCII rune is written as \x{...}, so it is not split into bytes in a
+// class, and an invalid byte as \x{fffd}, which the regexp decodes it to in the key.
+func quoteGlobChar(buf *bytes.Buffer, pattern string, i int) int {
+	if pattern[i] < utf8.RuneSelf {
+		buf.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		return 1
+	}
+
+	r, n := utf8.DecodeRuneInString(pattern[i:])
+	fmt.Fprintf(buf, `\x{%x}`, r)
+	return n
+}
+
+func isAlphaNum(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
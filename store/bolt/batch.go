@@ -0,0 +1,80 @@
+package bolt
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	bolt "go.etcd.io/bbolt"
+)
+
+// WriteBatch keeps the writes in a leveldb batch, and replays
+// them in one bbolt transaction when committing.
+type WriteBatch struct {
+	db     *DB
+	wbatch *leveldb.Batch
+}
+
+func newWriteBatch(db *DB) *WriteBatch {
+	return &WriteBatch{
+		db:     db,
+		wbatch: new(leveldb.Batch),
+	}
+}
+
+func (w *WriteBatch) Put(key, value []byte) {
+	w.wbatch.Put(key, value)
+}
+
+func (w *WriteBatch) Delete(key []byte) {
+	w.wbatch.Delete(key)
+}
+
+func (w *WriteBatch) Commit() error {
+	return w.commit(false)
+}
+
+func (w *WriteBatch) SyncCommit() error {
+	return w.commit(true)
+}
+
+func (w *WriteBatch) commit(sync bool) error {
+	err := w.db.update(func(b *bolt.Bucket) error {
+		r := &replayer{b: b}
+		if err := w.wbatch.Replay(r); err != nil {
+			return err
+		}
+		return r.err
+	}, sync)
+
+	w.wbatch.Reset()
+	return err
+}
+
+func (w *WriteBatch) Rollback() error {
+	w.wbatch.Reset()
+	return nil
+}
+
+func (w *WriteBatch) Close() {
+	w.wbatch.Reset()
+}
+
+// Data returns the batch data, which has the same format as leveldb.
+func (w *WriteBatch) Data() []byte {
+	return w.wbatch.Dump()
+}
+
+type replayer struct {
+	b   *bolt.Bucket
+	err error
+}
+
+func (r *replayer) Put(key, value []byte) {
+	if r.err == nil {
+		r.err = r.b.Put(key, value)
+	}
+}
+
+func (r *replayer) Delete(key []byte) {
+	if r.err == nil {
+		r.err = r.b.Delete(key)
+	}
+}
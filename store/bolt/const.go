@@ -0,0 +1,3 @@
+package bolt
+
+const DBName = "bolt"
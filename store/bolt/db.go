@@ -0,0 +1,186 @@
+// Package bolt is a wrapper for the pure go B+tree bbolt, no cgo needed.
+//
+// All the data is saved in one bucket, and the map_size and nosync of the [lmdb] section
+// are used. bbolt allows only one writer at the same time, and an open read transaction
+// of an iterator or snapshot blocks the writer which needs to grow the mmap, so set
+// map_size larger than the database.
+package bolt
+
+import (
+	"os"
+	"path"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+var bucketName = []byte("ledisdb")
+
+type Store struct {
+}
+
+func (s Store) String() string {
+	return DBName
+}
+
+type DB struct {
+	path string
+
+	cfg *config.LMDBConfig
+
+	db *bolt.DB
+}
+
+func (s Store) Open(dbPath string, cfg *config.Config) (driver.IDB, error) {
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		return nil, err
+	}
+
+	db := new(DB)
+	db.path = dbPath
+	db.cfg = &cfg.LMDB
+
+	opts := &bolt.Options{
+		NoSync:          db.cfg.NoSync,
+		InitialMmapSize: db.cfg.MapSize,
+		FreelistType:    bolt.FreelistMapType,
+	}
+
+	var err error
+	db.db, err = bolt.Open(path.Join(dbPath, "ledis.db"), 0644, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	}); err != nil {
+		db.db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Repair only opens and closes the database, bbolt has no repair tool,
+// the meta pages are checked in opening.
+func (s Store) Repair(path string, cfg *config.Config) error {
+	db, err := s.Open(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+func (db *DB) Get(key []byte) ([]byte, error) {
+	var v []byte
+	err := db.db.View(func(tx *bolt.Tx) error {
+		v = get(tx, key)
+		return nil
+	})
+	return v, err
+}
+
+// MultiGet gets all the keys in one read transaction.
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	var values [][]byte
+	err := db.db.View(func(tx *bolt.Tx) error {
+		values = multiGet(tx, keys)
+		return nil
+	})
+	return values, err
+}
+
+func multiGet(tx *bolt.Tx, keys [][]byte) [][]byte {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = get(tx, key)
+	}
+	return values
+}
+
+func get(tx *bolt.Tx, key []byte) []byte {
+	v := tx.Bucket(bucketName).Get(key)
+	if v == nil {
+		return nil
+	}
+
+	// the value is only valid in the transaction
+	return append([]byte{}, v...)
+}
+
+func (db *DB) Put(key, value []byte) error {
+	return db.update(func(b *bolt.Bucket) error {
+		return b.Put(key, value)
+	}, false)
+}
+
+func (db *DB) Delete(key []byte) error {
+	return db.update(func(b *bolt.Bucket) error {
+		return b.Delete(key)
+	}, false)
+}
+
+func (db *DB) SyncPut(key []byte, value []byte) error {
+	return db.update(func(b *bolt.Bucket) error {
+		return b.Put(key, value)
+	}, true)
+}
+
+func (db *DB) SyncDelete(key []byte) error {
+	return db.update(func(b *bolt.Bucket) error {
+		return b.Delete(key)
+	}, true)
+}
+
+func (db *DB) update(fn func(b *bolt.Bucket) error, sync bool) error {
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(bucketName))
+	})
+
+	// the commit is already synced if nosync is not set
+	if err == nil && sync && db.cfg.NoSync {
+		err = db.db.Sync()
+	}
+	return err
+}
+
+func (db *DB) NewWriteBatch() driver.IWriteBatch {
+	return newWriteBatch(db)
+}
+
+func (db *DB) NewIterator() driver.IIterator {
+	tx, err := db.db.Begin(false)
+	return newIterator(tx, true, err)
+}
+
+func (db *DB) NewSnapshot() (driver.ISnapshot, error) {
+	tx, err := db.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		db: db,
+		tx: tx,
+	}
+
+	return s, nil
+}
+
+// Compact does nothing, the free pages of bbolt are reused by later writes.
+func (db *DB) Compact() error {
+	return nil
+}
+
+func init() {
+	driver.Register(Store{})
+}
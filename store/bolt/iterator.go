@@ -0,0 +1,85 @@
+package bolt
+
+import (
+	"github.com/siddontang/go/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Iterator reads a point-in-time view of the data in one read transaction.
+// It is rolled back when the iterator is closed if owned by the iterator,
+// a snapshot iterator uses the transaction of the snapshot.
+type Iterator struct {
+	tx  *bolt.Tx
+	own bool
+
+	c *bolt.Cursor
+
+	key   []byte
+	value []byte
+}
+
+func newIterator(tx *bolt.Tx, own bool, err error) *Iterator {
+	if err != nil {
+		log.Errorf("new bolt iterator error %s", err.Error())
+		return &Iterator{}
+	}
+
+	it := new(Iterator)
+	it.tx = tx
+	it.own = own
+	it.c = tx.Bucket(bucketName).Cursor()
+	return it
+}
+
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+func (it *Iterator) Close() error {
+	it.key = nil
+	it.value = nil
+
+	if it.own && it.tx != nil {
+		it.tx.Rollback()
+	}
+	it.tx = nil
+	return nil
+}
+
+func (it *Iterator) Valid() bool {
+	return it.key != nil
+}
+
+func (it *Iterator) Next() {
+	if it.c != nil {
+		it.key, it.value = it.c.Next()
+	}
+}
+
+func (it *Iterator) Prev() {
+	if it.c != nil {
+		it.key, it.value = it.c.Prev()
+	}
+}
+
+func (it *Iterator) First() {
+	if it.c != nil {
+		it.key, it.value = it.c.First()
+	}
+}
+
+func (it *Iterator) Last() {
+	if it.c != nil {
+		it.key, it.value = it.c.Last()
+	}
+}
+
+func (it *Iterator) Seek(key []byte) {
+	if it.c != nil {
+		it.key, it.value = it.c.Seek(key)
+	}
+}
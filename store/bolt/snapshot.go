@@ -0,0 +1,30 @@
+package bolt
+
+import (
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+// Snapshot is a read transaction, it blocks growing the mmap
+// of the writer, so don't keep it for a long time.
+type Snapshot struct {
+	db *DB
+	tx *bolt.Tx
+}
+
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.tx, key), nil
+}
+
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, error) {
+	return multiGet(s.tx, keys), nil
+}
+
+func (s *Snapshot) NewIterator() driver.IIterator {
+	return newIterator(s.tx, false, nil)
+}
+
+func (s *Snapshot) Close() {
+	s.tx.Rollback()
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"bytes"
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+/*
+	The read cache keeps the values of the hot keys in memory, it is a bounded LRU sharded
+	by the key hash. Only the existing values are cached, and the values are copied in and
+	out, so the callers can modify them.
+
+	The writes invalidate the keys after they are committed to the store. A value read from
+	the store is only added if no key of its shard is invalidated since the read began,
+	otherwise the value read before a concurrent write may be cached after the invalidation.
+*/
+
+const (
+	cacheShards = 16
+
+	// the estimated memory of a cached item besides the key and value
+	cacheItemOverhead = 64
+)
+
+type cacheItem struct {
+	key   string
+	value []byte
+}
+
+func (item *cacheItem) size() int {
+	return len(item.key) + len(item.value) + cacheItemOverhead
+}
+
+type cacheShard struct {
+	m sync.Mutex
+
+	capacity int
+	size     int
+
+	items map[string]*list.Element
+	lru   *list.List
+
+	// increased by every invalidation
+	version uint64
+}
+
+type cache struct {
+	shards [cacheShards]cacheShard
+}
+
+func newCache(capacity int) *cache {
+	c := new(cache)
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.capacity = capacity / cacheShards
+		s.items = make(map[string]*list.Element)
+		s.lru = list.New()
+	}
+	return c
+}
+
+func (c *cache) shard(key []byte) *cacheShard {
+	h := fnv.New32a()
+	h.Write(key)
+	return &c.shards[h.Sum32()%cacheShards]
+}
+
+// get returns the copy of the cached value, and false if the key is not cached.
+func (c *cache) get(key []byte) ([]byte, bool) {
+	s := c.shard(key)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	e, ok := s.items[string(key)]
+	if !ok {
+		return nil, false
+	}
+
+	s.lru.MoveToFront(e)
+	return append([]byte{}, e.Value.(*cacheItem).value...), true
+}
+
+// version returns the version of the key shard, which must be got before reading the store.
+func (c *cache) version(key []byte) uint64 {
+	s := c.shard(key)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.version
+}
+
+// add adds the value read from the store, if the key shard is not invalidated since version.
+func (c *cache) add(key []byte, value []byte, version uint64) {
+	s := c.shard(key)
+
+	item := &cacheItem{key: string(key), value: append([]byte{}, value...)}
+	if item.size() > s.capacity {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.version != version {
+		return
+	}
+
+	if e, ok := s.items[item.key]; ok {
+		s.remove(e)
+	}
+
+	s.items[item.key] = s.lru.PushFront(item)
+	s.size += item.size()
+
+	for s.size > s.capacity {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *cacheShard) remove(e *list.Element) {
+	item := s.lru.Remove(e).(*cacheItem)
+	delete(s.items, item.key)
+	s.size -= item.size()
+}
+
+func (c *cache) invalidate(key []byte) {
+	s := c.shard(key)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.version++
+	if e, ok := s.items[string(key)]; ok {
+		s.remove(e)
+	}
+}
+
+// invalidateRange invalidates the keys in [start, end).
+func (c *cache) invalidateRange(start []byte, end []byte) {
+	for i := range c.shards {
+		s := &c.shards[i]
+
+		s.m.Lock()
+		s.version++
+		for key, e := range s.items {
+			if bytes.Compare([]byte(key), start) >= 0 && bytes.Compare([]byte(key), end) < 0 {
+				s.remove(e)
+			}
+		}
+		s.m.Unlock()
+	}
+}
+
+// cacheWrites records the keys written by the batch, invalidated after the batch is committed.
+type cacheWrites struct {
+	keys   [][]byte
+	ranges [][2][]byte
+}
+
+func (w *cacheWrites) addKey(key []byte) {
+	w.keys = append(w.keys, append([]byte{}, key...))
+}
+
+func (w *cacheWrites) addRange(start []byte, end []byte) {
+	w.ranges = append(w.ranges, [2][]byte{append([]byte{}, start...), append([]byte{}, end...)})
+}
+
+func (w *cacheWrites) invalidate(c *cache) {
+	for _, key := range w.keys {
+		c.invalidate(key)
+	}
+	for _, r := range w.ranges {
+		c.invalidateRange(r[0], r[1])
+	}
+	w.reset()
+}
+
+func (w *cacheWrites) reset() {
+	w.keys = w.keys[0:0]
+	w.ranges = w.ranges[0:0]
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+// ErrCheckpointNotSupported is returned by Checkpoint if the driver has no checkpoint.
+var ErrCheckpointNotSupported = errors.New("checkpoint is not supported by the store")
+
+// SupportCheckpoint returns whether the driver can copy the database cheaply.
+func (db *DB) SupportCheckpoint() bool {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	_, ok := db.db.(driver.ICheckpointer)
+	return ok
+}
+
+// Checkpoint creates a consistent copy of the database in dir, which can be opened by OpenPath.
+func (db *DB) Checkpoint(dir string) error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	d, ok := db.db.(driver.ICheckpointer)
+	if !ok {
+		return ErrCheckpointNotSupported
+	}
+
+	db.st.CheckpointNum.Add(1)
+
+	t := time.Now()
+	err := d.Checkpoint(dir)
+	db.st.CheckpointTotalTime.Add(time.Now().Sub(t))
+
+	return err
+}
@@ -0,0 +1,457 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledisdb/ledisdb/store/driver"
+	"github.com/siddontang/go/log"
+)
+
+/*
+	The value codec compresses the values with zstd, it is configured by the upper layer
+	which knows the key layout, see CodecOptions.
+
+	encoded value: codecMagic | dictionary ID (uvarint, 0 for no dictionary) | zstd frame
+
+	A value which may be encoded but starts with codecMagic is always encoded, so the encoded
+	values can be told from the plain ones, and the codec can be enabled for the existing data.
+
+	The dictionary of every class is trained from the first DictSamples compressed values,
+	and saved under MetaKey, it is never changed or removed, so the values can always be decoded:
+
+	MetaKey -> empty, the mark that the codec is enabled
+	MetaKey | dictionary ID (bigendian uint32) -> class | dictionary content
+*/
+
+var codecMagic = []byte{0xfe, 'z', 's', 't'}
+
+const (
+	// the max size of a sampled value to train the dictionary
+	codecMaxSampleSize = 4096
+
+	// the trained dictionary smaller than it is not used
+	codecMinDictSize = 256
+)
+
+var errCodecCorrupted = errors.New("invalid encoded value")
+
+// CodecOptions configures the value codec, see DB.SetCodec.
+type CodecOptions struct {
+	// Class returns the class of the key like the data type, and false if its value is never encoded.
+	Class func(key []byte) (byte, bool)
+
+	// MinSize is the min value size to compress of every class, the class not in it is not compressed.
+	MinSize map[byte]int
+
+	// Level is the zstd compression level.
+	Level int
+
+	// DictSize is the max size of the dictionary of every class, 0 to compress without the dictionary.
+	DictSize int
+
+	// DictSamples is the number of the values to train the dictionary.
+	DictSamples int
+
+	// MetaKey is the key saving the codec meta, the dictionaries are saved with their IDs appended.
+	MetaKey []byte
+}
+
+type codecDict struct {
+	id      uint32
+	class   byte
+	content []byte
+
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+type codec struct {
+	opts CodecOptions
+
+	db driver.IDB
+	st *Stat
+
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+
+	m sync.RWMutex
+
+	dicts      map[uint32]*codecDict
+	classDicts map[byte]*codecDict
+	lastID     uint32
+
+	// the sampled values to train the dictionaries
+	samples map[byte][][]byte
+	trained map[byte]bool
+}
+
+func newCodec(db driver.IDB, st *Stat, opts *CodecOptions) (*codec, error) {
+	c := &codec{opts: *opts, db: db, st: st}
+	c.dicts = make(map[uint32]*codecDict)
+	c.classDicts = make(map[byte]*codecDict)
+	c.samples = make(map[byte][][]byte)
+	c.trained = make(map[byte]bool)
+
+	var err error
+	if c.enc, err = c.newEncoder(); err != nil {
+		return nil, err
+	}
+
+	if c.dec, err = zstd.NewReader(nil); err != nil {
+		return nil, err
+	}
+
+	if err = c.loadDicts(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *codec) newEncoder(opts ...zstd.EOption) (*zstd.Encoder, error) {
+	opts = append(opts,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.opts.Level)),
+		zstd.WithEncoderCRC(false))
+	return zstd.NewWriter(nil, opts...)
+}
+
+func (c *codec) newDict(id uint32, class byte, content []byte) (*codecDict, error) {
+	d := &codecDict{id: id, class: class, content: content}
+
+	var err error
+	if d.enc, err = c.newEncoder(zstd.WithEncoderDictRaw(id, content)); err != nil {
+		return nil, err
+	}
+
+	if d.dec, err = zstd.NewReader(nil, zstd.WithDecoderDictRaw(id, content)); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (c *codec) dictKey(id uint32) []byte {
+	key := append([]byte{}, c.opts.MetaKey...)
+	return append(key, byte(id>>24), byte(id>>16), byte(id>>8), byte(id))
+}
+
+// addDict adds the dictionary, the newest one of the class is used to compress.
+func (c *codec) addDict(d *codecDict) {
+	c.dicts[d.id] = d
+	if cd, ok := c.classDicts[d.class]; !ok || cd.id < d.id {
+		c.classDicts[d.class] = d
+	}
+	if d.id > c.lastID {
+		c.lastID = d.id
+	}
+}
+
+func (c *codec) loadDicts() error {
+	it := c.db.NewIterator()
+	defer it.Close()
+
+	prefix := c.opts.MetaKey
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		} else if len(key) != len(prefix)+4 {
+			continue
+		}
+
+		v := it.Value()
+		if len(v) < 1 {
+			return errCodecCorrupted
+		}
+
+		d, err := c.newDict(binary.BigEndian.Uint32(key[len(prefix):]), v[0], append([]byte{}, v[1:]...))
+		if err != nil {
+			return err
+		}
+		c.addDict(d)
+	}
+
+	return nil
+}
+
+// saveMeta saves the mark and all the dictionaries, like after all the keys are deleted.
+func (c *codec) saveMeta() error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	if len(c.opts.MinSize) == 0 && len(c.dicts) == 0 {
+		return nil
+	}
+
+	wb := c.db.NewWriteBatch()
+	defer wb.Close()
+
+	wb.Put(c.opts.MetaKey, []byte{})
+	for _, d := range c.dicts {
+		wb.Put(c.dictKey(d.id), append([]byte{d.class}, d.content...))
+	}
+
+	return wb.SyncCommit()
+}
+
+// sample keeps the value to train the dictionary of the class, and trains it in background
+// when there are enough samples.
+func (c *codec) sample(class byte, value []byte) {
+	if c.opts.DictSize <= 0 {
+		return
+	}
+
+	if len(value) > codecMaxSampleSize {
+		value = value[0:codecMaxSampleSize]
+	}
+
+	c.m.Lock()
+	if c.trained[class] || c.classDicts[class] != nil {
+		c.m.Unlock()
+		return
+	}
+
+	samples := append(c.samples[class], append([]byte{}, value...))
+	if len(samples) < c.opts.DictSamples {
+		c.samples[class] = samples
+		c.m.Unlock()
+		return
+	}
+
+	// trained only once, even if no dictionary is made
+	delete(c.samples, class)
+	c.trained[class] = true
+	c.m.Unlock()
+
+	go c.train(class, samples)
+}
+
+func (c *codec) train(class byte, samples [][]byte) {
+	content := trainDict(samples, c.opts.DictSize)
+	if len(content) < codecMinDictSize {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	id := c.lastID + 1
+	d, err := c.newDict(id, class, content)
+	if err != nil {
+		log.Errorf("create dictionary error %s", err.Error())
+		return
+	}
+
+	// the dictionary must be saved before any value uses it
+	if err = c.db.SyncPut(c.dictKey(id), append([]byte{class}, content...)); err != nil {
+		log.Errorf("save dictionary error %s", err.Error())
+		return
+	}
+
+	c.addDict(d)
+}
+
+// encode returns the encoded value, or the value itself if it is not compressed.
+func (c *codec) encode(key []byte, value []byte) []byte {
+	class, ok := c.opts.Class(key)
+	if !ok {
+		return value
+	}
+
+	escape := bytes.HasPrefix(value, codecMagic)
+	minSize, ok := c.opts.MinSize[class]
+	if !escape && (!ok || len(value) < minSize) {
+		return value
+	}
+
+	c.m.RLock()
+	d := c.classDicts[class]
+	c.m.RUnlock()
+
+	if d == nil && ok {
+		c.sample(class, value)
+	}
+
+	buf := make([]byte, len(codecMagic)+binary.MaxVarintLen32, len(codecMagic)+binary.MaxVarintLen32+len(value)/2)
+	copy(buf, codecMagic)
+
+	var ev []byte
+	if d != nil {
+		n := binary.PutUvarint(buf[len(codecMagic):], uint64(d.id))
+		ev = d.enc.EncodeAll(value, buf[0:len(codecMagic)+n])
+	} else {
+		n := binary.PutUvarint(buf[len(codecMagic):], 0)
+		ev = c.enc.EncodeAll(value, buf[0:len(codecMagic)+n])
+	}
+
+	if !escape && len(ev) >= len(value) {
+		return value
+	}
+
+	c.st.CompressNum.Add(1)
+	c.st.CompressRawSize.Add(int64(len(value)))
+	c.st.CompressSize.Add(int64(len(ev)))
+	return ev
+}
+
+// decode returns the plain value of the encoded one, or the value itself if it is not encoded.
+func (c *codec) decode(key []byte, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, codecMagic) {
+		return value, nil
+	} else if _, ok := c.opts.Class(key); !ok {
+		return value, nil
+	}
+
+	id, n := binary.Uvarint(value[len(codecMagic):])
+	if n <= 0 {
+		return nil, errCodecCorrupted
+	}
+
+	dec := c.dec
+	if id != 0 {
+		c.m.RLock()
+		d, ok := c.dicts[uint32(id)]
+		c.m.RUnlock()
+
+		if !ok {
+			return nil, errCodecCorrupted
+		}
+		dec = d.dec
+	}
+
+	c.st.DecompressNum.Add(1)
+	return dec.DecodeAll(value[len(codecMagic)+n:], []byte{})
+}
+
+// mustDecode decodes the value for the iterator, which can't return an error.
+func (c *codec) mustDecode(key []byte, value []byte) []byte {
+	v, err := c.decode(key, value)
+	if err != nil {
+		log.Errorf("decode value of key %q error %s", key, err.Error())
+		return value
+	}
+	return v
+}
+
+func (c *codec) close() {
+	c.enc.Close()
+	c.dec.Close()
+
+	c.m.Lock()
+	for _, d := range c.dicts {
+		d.enc.Close()
+		d.dec.Close()
+	}
+	c.m.Unlock()
+}
+
+// SetCodec enables the value codec, the dictionaries saved before are loaded, and the mark
+// is saved if any class is compressed. It must be set before any read and write.
+func (db *DB) SetCodec(opts *CodecOptions) error {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	return db.setCodec(opts)
+}
+
+func (db *DB) setCodec(opts *CodecOptions) error {
+	c, err := newCodec(db.db, db.st, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.MinSize) > 0 {
+		if err = c.saveMeta(); err != nil {
+			c.close()
+			return err
+		}
+	}
+
+	db.c = c
+	return nil
+}
+
+// SaveCodecMeta saves the codec mark and the dictionaries again, like after all the keys are deleted.
+func (db *DB) SaveCodecMeta() error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	if db.c == nil {
+		return nil
+	}
+	return db.c.saveMeta()
+}
+
+// codecIterator decodes the value once at every position.
+type codecIterator struct {
+	driver.IIterator
+	c *codec
+
+	value   []byte
+	decoded bool
+}
+
+func (it *codecIterator) Value() []byte {
+	if !it.decoded {
+		it.decoded = true
+		if v := it.IIterator.Value(); v != nil {
+			it.value = it.c.mustDecode(it.IIterator.Key(), v)
+		} else {
+			it.value = nil
+		}
+	}
+	return it.value
+}
+
+func (it *codecIterator) reset() {
+	it.value = nil
+	it.decoded = false
+}
+
+func (it *codecIterator) First() {
+	it.reset()
+	it.IIterator.First()
+}
+
+func (it *codecIterator) Last() {
+	it.reset()
+	it.IIterator.Last()
+}
+
+func (it *codecIterator) Seek(key []byte) {
+	it.reset()
+	it.IIterator.Seek(key)
+}
+
+func (it *codecIterator) Next() {
+	it.reset()
+	it.IIterator.Next()
+}
+
+func (it *codecIterator) Prev() {
+	it.reset()
+	it.IIterator.Prev()
+}
+
+func newCodecIterator(it driver.IIterator, c *codec) driver.IIterator {
+	if c == nil {
+		return it
+	}
+	return &codecIterator{IIterator: it, c: c}
+}
+
+func (c *codec) decodeValues(keys [][]byte, values [][]byte) ([][]byte, error) {
+	var err error
+	for i, v := range values {
+		if v != nil {
+			if values[i], err = c.decode(keys[i], v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/binary"
+)
+
+const (
+	// the size of the d-gram and the segment to build the dictionary
+	dictGramSize    = 8
+	dictSegmentSize = 64
+)
+
+type dictSegment struct {
+	sample int
+	pos    int
+	end    int
+	score  int
+}
+
+type dictSegments []*dictSegment
+
+func (s dictSegments) Len() int            { return len(s) }
+func (s dictSegments) Less(i, j int) bool  { return s[i].score > s[j].score }
+func (s dictSegments) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *dictSegments) Push(x interface{}) { *s = append(*s, x.(*dictSegment)) }
+func (s *dictSegments) Pop() interface{} {
+	old := *s
+	x := old[len(old)-1]
+	*s = old[0 : len(old)-1]
+	return x
+}
+
+func dictGram(b []byte) uint64 {
+	return binary.LittleEndian.Uint64(b)
+}
+
+// trainDict builds the raw dictionary of at most size bytes from the samples, it is a simple
+// version of the COVER algorithm of zstd:
+//
+//  1. count the d-grams of the samples, a d-gram is counted once in a sample
+//  2. score the segments of the samples by the sum of the counts of their distinct d-grams
+//  3. choose the best segment, and clear the counts of its d-grams, so the d-grams are not
+//     scored again, until the dictionary is full or no d-gram is in more than one sample
+//
+// The scores are only decreased, so the segment at the top of the heap is scored again,
+// and chosen if it is still not less than the next one.
+//
+// The best segments are put at the end of the dictionary, which are the nearest to the data.
+func trainDict(samples [][]byte, size int) []byte {
+	counts := make(map[uint64]int)
+	seen := make(map[uint64]bool)
+	for _, s := range samples {
+		for k := range seen {
+			delete(seen, k)
+		}
+
+		for i := 0; i+dictGramSize <= len(s); i++ {
+			g := dictGram(s[i:])
+			if !seen[g] {
+				seen[g] = true
+				counts[g]++
+			}
+		}
+	}
+
+	// the d-grams only in one sample are useless
+	for g, n := range counts {
+		if n < 2 {
+			delete(counts, g)
+		}
+	}
+
+	score := func(seg *dictSegment) int {
+		for k := range seen {
+			delete(seen, k)
+		}
+
+		n := 0
+		s := samples[seg.sample]
+		for i := seg.pos; i+dictGramSize <= seg.end; i++ {
+			g := dictGram(s[i:])
+			if !seen[g] {
+				seen[g] = true
+				n += counts[g]
+			}
+		}
+		return n
+	}
+
+	var h dictSegments
+	for i, s := range samples {
+		for pos := 0; pos+dictGramSize <= len(s); pos += dictSegmentSize / 2 {
+			end := pos + dictSegmentSize
+			if end > len(s) {
+				end = len(s)
+			}
+
+			seg := &dictSegment{sample: i, pos: pos, end: end}
+			seg.score = score(seg)
+			h = append(h, seg)
+		}
+	}
+	heap.Init(&h)
+
+	var chosen []*dictSegment
+	total := 0
+	for h.Len() > 0 && total < size {
+		seg := heap.Pop(&h).(*dictSegment)
+		if seg.score = score(seg); h.Len() > 0 && seg.score < h[0].score {
+			heap.Push(&h, seg)
+			continue
+		}
+
+		if seg.score == 0 {
+			break
+		}
+
+		if total+seg.end-seg.pos > size {
+			seg.end = seg.pos + size - total
+		}
+
+		chosen = append(chosen, seg)
+		total += seg.end - seg.pos
+
+		s := samples[seg.sample]
+		for i := seg.pos; i+dictGramSize <= seg.end; i++ {
+			counts[dictGram(s[i:])] = 0
+		}
+	}
+
+	dict := make([]byte, 0, total)
+	for i := len(chosen) - 1; i >= 0; i-- {
+		seg := chosen[i]
+		dict = append(dict, samples[seg.sample][seg.pos:seg.end]...)
+	}
+	return dict
+}
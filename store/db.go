@@ -1,28 +1,177 @@
 package store
 
 import (
+	"errors"
+	"os"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/store/driver"
 )
 
+// the number of the deleted keys in one commit if the driver can't delete a range natively
+const deleteRangeBatchSize = 10000
+
+// ErrStoreReopened is returned by the snapshot which is closed by Reopen.
+var ErrStoreReopened = errors.New("store is reopened")
+
 type DB struct {
 	db   driver.IDB
 	name string
+	path string
+
+	// rw is held shared by the operations of the driver, and exclusively by Reopen
+	// which replaces the driver, gen is increased then, so the write batches of the
+	// old driver are created again
+	rw  sync.RWMutex
+	gen uint64
+
+	// the open iterators and snapshots, they are closed by Reopen
+	opens    map[reopenCloser]struct{}
+	opensMtx sync.Mutex
 
 	st *Stat
 
 	cfg *config.Config
 
+	// the value codec, nil if not set
+	c *codec
+
+	// the read cache, nil if disabled
+	cache *cache
+
 	lastCommit time.Time
 
 	m sync.Mutex
+
+	// serializes the merges read and put if the driver doesn't merge natively
+	mergeMtx sync.Mutex
+}
+
+// reopenCloser is the iterator or snapshot closed by Reopen, with rw held exclusively,
+// its calls don't hold rw but a reopenGuard.
+type reopenCloser interface {
+	closeReopen()
+}
+
+// reopenGuard counts the running calls of an iterator or snapshot, so Reopen closes it
+// after them without the calls locking the store, negative after it is closed.
+type reopenGuard struct {
+	n int32
+}
+
+const reopenGuardClosed = -1 << 30
+
+// enter starts a call, it returns false if closed, leave must be called if true.
+func (g *reopenGuard) enter() bool {
+	if atomic.AddInt32(&g.n, 1) > 0 {
+		return true
+	}
+
+	atomic.AddInt32(&g.n, -1)
+	return false
+}
+
+func (g *reopenGuard) leave() {
+	atomic.AddInt32(&g.n, -1)
+}
+
+// close waits for the running calls, the calls after it fail to enter.
+// It returns false if closed before.
+func (g *reopenGuard) close() bool {
+	for {
+		if atomic.CompareAndSwapInt32(&g.n, 0, reopenGuardClosed) {
+			return true
+		} else if atomic.LoadInt32(&g.n) < 0 {
+			return false
+		}
+		runtime.Gosched()
+	}
+}
+
+func (db *DB) addOpen(c reopenCloser) {
+	db.opensMtx.Lock()
+	if db.opens == nil {
+		db.opens = make(map[reopenCloser]struct{})
+	}
+	db.opens[c] = struct{}{}
+	db.opensMtx.Unlock()
+}
+
+func (db *DB) removeOpen(c reopenCloser) {
+	db.opensMtx.Lock()
+	delete(db.opens, c)
+	db.opensMtx.Unlock()
 }
 
 func (db *DB) Close() error {
-	return db.db.Close()
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	err := db.db.Close()
+	if db.c != nil {
+		db.c.close()
+	}
+	return err
+}
+
+// Reopen closes the store, replaces the data with the store in path, which must be
+// created by the same driver like a checkpoint and is moved, and opens the store again.
+// The open iterators and snapshots are closed, and the codec is set with opts again
+// if opts is not nil and some values may be compressed, see SetCodec.
+func (db *DB) Reopen(path string, opts *CodecOptions) error {
+	s, err := driver.GetStore(db.cfg)
+	if err != nil {
+		return err
+	}
+
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	db.opensMtx.Lock()
+	for c := range db.opens {
+		c.closeReopen()
+	}
+	db.opens = nil
+	db.opensMtx.Unlock()
+
+	if db.c != nil {
+		db.c.close()
+		db.c = nil
+	}
+
+	if err = db.db.Close(); err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(db.path); err != nil {
+		return err
+	} else if err = os.Rename(path, db.path); err != nil {
+		return err
+	}
+
+	if db.db, err = s.Open(db.path, db.cfg); err != nil {
+		return err
+	}
+	db.gen++
+
+	if db.cache != nil {
+		db.cache = newCache(db.cfg.ReadCacheSize)
+	}
+
+	if opts == nil {
+		return nil
+	} else if len(opts.MinSize) == 0 {
+		// only decode the values if the codec is enabled in the new data
+		if v, err := db.db.Get(opts.MetaKey); err != nil || v == nil {
+			return err
+		}
+	}
+
+	return db.setCodec(opts)
 }
 
 func (db *DB) String() string {
@@ -30,26 +179,83 @@ func (db *DB) String() string {
 }
 
 func (db *DB) NewIterator() *Iterator {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	db.st.IterNum.Add(1)
 
 	it := new(Iterator)
-	it.it = db.db.NewIterator()
+	it.it = newCodecIterator(db.db.NewIterator(), db.c)
 	it.st = db.st
+	it.db = db
+
+	db.addOpen(it)
 
 	return it
 }
 
 func (db *DB) Get(key []byte) ([]byte, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	t := time.Now()
-	v, err := db.db.Get(key)
+	v, err := db.cachedGet(key)
 	db.st.statGet(v, err)
 	db.st.GetTotalTime.Add(time.Now().Sub(t))
 	return v, err
 }
 
+// cachedGet gets the value from the read cache first, and caches the value read from the store.
+func (db *DB) cachedGet(key []byte) ([]byte, error) {
+	if db.cache == nil {
+		return db.get(key)
+	}
+
+	if v, ok := db.cache.get(key); ok {
+		db.st.CacheHitNum.Add(1)
+		return v, nil
+	}
+	db.st.CacheMissNum.Add(1)
+
+	version := db.cache.version(key)
+	v, err := db.get(key)
+	if err == nil && v != nil {
+		db.cache.add(key, v, version)
+	}
+	return v, err
+}
+
+func (db *DB) invalidate(key []byte) {
+	if db.cache != nil {
+		db.cache.invalidate(key)
+	}
+}
+
+// get gets the decoded value without the stat, it must be called with rw held.
+func (db *DB) get(key []byte) ([]byte, error) {
+	v, err := db.db.Get(key)
+	if err != nil || v == nil || db.c == nil {
+		return v, err
+	}
+	return db.c.decode(key, v)
+}
+
 func (db *DB) Put(key []byte, value []byte) error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	return db.put(key, value)
+}
+
+func (db *DB) put(key []byte, value []byte) error {
 	db.st.PutNum.Add(1)
 
+	if db.c != nil {
+		value = db.c.encode(key, value)
+	}
+
+	defer db.invalidate(key)
+
 	if db.needSyncCommit() {
 		return db.db.SyncPut(key, value)
 	}
@@ -57,24 +263,120 @@ func (db *DB) Put(key []byte, value []byte) error {
 }
 
 func (db *DB) Delete(key []byte) error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	db.st.DeleteNum.Add(1)
 
+	defer db.invalidate(key)
+
 	if db.needSyncCommit() {
 		return db.db.SyncDelete(key)
 	}
 	return db.db.Delete(key)
 }
 
+// SupportDeleteRange returns whether the driver deletes a range of keys natively,
+// otherwise DeleteRange deletes the keys in the range one by one.
+func (db *DB) SupportDeleteRange() bool {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	_, ok := db.db.(driver.IRangeDeleter)
+	return ok
+}
+
+// DeleteRange deletes the keys in [start, end).
+func (db *DB) DeleteRange(start []byte, end []byte) error {
+	if db.SupportDeleteRange() {
+		return db.deleteRange(start, end)
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Close()
+
+	n := 0
+	it := db.RangeIterator(start, end, RangeROpen)
+	defer it.Close()
+
+	for ; it.Valid(); it.Next() {
+		wb.Delete(it.RawKey())
+
+		if n++; n == deleteRangeBatchSize {
+			if err := wb.Commit(); err != nil {
+				return err
+			}
+			n = 0
+		}
+	}
+
+	return wb.Commit()
+}
+
+func (db *DB) deleteRange(start []byte, end []byte) error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	db.st.DeleteRangeNum.Add(1)
+	if db.cache != nil {
+		defer db.cache.invalidateRange(start, end)
+	}
+	return db.db.(driver.IRangeDeleter).DeleteRange(start, end)
+}
+
+// SupportMerge returns whether the driver merges natively with the merge
+// operator driver.Int64AddMergeName, otherwise Merge reads and puts.
+func (db *DB) SupportMerge() bool {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	_, ok := db.db.(driver.IMerger)
+	return ok
+}
+
+// Merge adds the int64 delta in value to the value of key, see driver.MergeInt64Add.
+// If the driver doesn't merge natively, the value is read and the sum is put with the
+// merges locked, so they don't lose the deltas of each other, but a write of the key
+// not by Merge meanwhile may be lost.
+func (db *DB) Merge(key []byte, value []byte) error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	if d, ok := db.db.(driver.IMerger); ok {
+		db.st.MergeNum.Add(1)
+		defer db.invalidate(key)
+		return d.Merge(key, value)
+	}
+
+	db.mergeMtx.Lock()
+	defer db.mergeMtx.Unlock()
+
+	v, err := db.get(key)
+	if err != nil {
+		return err
+	} else if v != nil {
+		value = driver.MergeInt64Add(v, value)
+	}
+	return db.put(key, value)
+}
+
 func (db *DB) NewWriteBatch() *WriteBatch {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	db.st.BatchNum.Add(1)
 	wb := new(WriteBatch)
 	wb.wb = db.db.NewWriteBatch()
+	wb.gen = db.gen
 	wb.st = db.st
 	wb.db = db
 	return wb
 }
 
 func (db *DB) NewSnapshot() (*Snapshot, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	db.st.SnapshotNum.Add(1)
 
 	var err error
@@ -83,11 +385,18 @@ func (db *DB) NewSnapshot() (*Snapshot, error) {
 		return nil, err
 	}
 	s.st = db.st
+	s.c = db.c
+	s.db = db
+
+	db.addOpen(s)
 
 	return s, nil
 }
 
 func (db *DB) Compact() error {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
 	db.st.CompactNum.Add(1)
 
 	t := time.Now()
@@ -145,14 +454,23 @@ func (db *DB) needSyncCommit() bool {
 }
 
 func (db *DB) GetSlice(key []byte) (Slice, error) {
-	if d, ok := db.db.(driver.ISliceGeter); ok {
-		t := time.Now()
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	t := time.Now()
+
+	// the encoded value in the slice of the driver can't be decoded in place,
+	// and the cached value is not in the slice of the driver
+	if d, ok := db.db.(driver.ISliceGeter); ok && db.c == nil && db.cache == nil {
 		v, err := d.GetSlice(key)
 		db.st.statGet(v, err)
 		db.st.GetTotalTime.Add(time.Now().Sub(t))
 		return v, err
 	}
-	v, err := db.Get(key)
+
+	v, err := db.cachedGet(key)
+	db.st.statGet(v, err)
+	db.st.GetTotalTime.Add(time.Now().Sub(t))
 	if err != nil {
 		return nil, err
 	} else if v == nil {
@@ -55,3 +55,55 @@ type IWriteBatch interface {
 type ISliceGeter interface {
 	GetSlice(key []byte) (ISlice, error)
 }
+
+// IRangeDeleter is implemented by the drivers which can delete a range of keys natively.
+type IRangeDeleter interface {
+	// DeleteRange deletes the keys in [start, end).
+	DeleteRange(start []byte, end []byte) error
+}
+
+// IBatchRangeDeleter is implemented by the write batches which can delete a range of keys natively,
+// the range deletion must be saved in Data like RocksDB, with the record kind 0xF and the value as the end key.
+type IBatchRangeDeleter interface {
+	// DeleteRange deletes the keys in [start, end), including the keys put in the batch before.
+	DeleteRange(start []byte, end []byte)
+}
+
+// IMultiGeter is implemented by the drivers and snapshots which can get many keys natively.
+type IMultiGeter interface {
+	// MultiGet returns the values in the order of the keys, nil for the missing key.
+	MultiGet(keys [][]byte) ([][]byte, error)
+}
+
+// IMerger is implemented by the drivers which register the Int64AddMergeName merge operator,
+// their write batches must implement IBatchMerger too.
+type IMerger interface {
+	// Merge adds the int64 delta in value to the value of key, see MergeInt64Add.
+	Merge(key []byte, value []byte) error
+}
+
+// IBatchMerger is implemented by the write batches which can merge natively,
+// the merge must be saved in Data like RocksDB, with the record kind 0x2.
+type IBatchMerger interface {
+	Merge(key []byte, value []byte)
+}
+
+// ISizer is implemented by the drivers which can estimate the disk size of a range natively.
+type ISizer interface {
+	// ApproximateSize returns the approximate disk size of the keys in [start, end),
+	// the recently written data in the memory table may be not counted.
+	ApproximateSize(start []byte, end []byte) (int64, error)
+}
+
+// IPropertier is implemented by the drivers which can report the engine properties.
+type IPropertier interface {
+	Properties() (*Properties, error)
+}
+
+// ICheckpointer is implemented by the drivers which can copy the database cheaply,
+// like hard linking the immutable table files.
+type ICheckpointer interface {
+	// Checkpoint creates a consistent copy of the database in dir, which must not exist,
+	// the copy has all the writes committed before and can be opened by the same driver.
+	Checkpoint(dir string) error
+}
@@ -0,0 +1,26 @@
+package driver
+
+import (
+	"strconv"
+)
+
+// Int64AddMergeName is the name of the merge operator which adds int64 deltas,
+// the values and the deltas are all decimal strings.
+const Int64AddMergeName = "ledis.int64add"
+
+// MergeInt64Add merges the operands from the oldest to the newest, the oldest one
+// may be the existing value. The result is the sum of the operands, or the oldest
+// operand which is not an integer, so a value which is not an integer is never
+// changed by the deltas. It is associative as the merge operators require.
+func MergeInt64Add(operands ...[]byte) []byte {
+	var sum int64
+	for _, op := range operands {
+		n, err := strconv.ParseInt(string(op), 10, 64)
+		if err != nil {
+			return op
+		}
+		sum += n
+	}
+
+	return strconv.AppendInt(nil, sum, 10)
+}
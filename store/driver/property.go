@@ -0,0 +1,32 @@
+package driver
+
+// Properties is the engine state reported by IPropertier,
+// a field is zero if the driver can't tell it.
+type Properties struct {
+	// the number of table files of every level
+	LevelFiles []int64
+
+	// the total size of the table files
+	DiskSize int64
+
+	// the estimated bytes which need to be compacted
+	PendingCompactionBytes int64
+
+	// the size of the memory tables
+	MemTableSize int64
+
+	// the used size of the block cache
+	BlockCacheSize int64
+
+	BlockCacheHits   int64
+	BlockCacheMisses int64
+}
+
+// BlockCacheHitRate returns the hit rate of the block cache, 0 if no block is read.
+func (p *Properties) BlockCacheHitRate() float64 {
+	n := p.BlockCacheHits + p.BlockCacheMisses
+	if n == 0 {
+		return 0
+	}
+	return float64(p.BlockCacheHits) / float64(n)
+}
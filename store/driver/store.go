@@ -2,6 +2,7 @@ package driver
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/ledisdb/ledisdb/config"
 )
@@ -14,6 +15,9 @@ type Store interface {
 
 var dbs = map[string]Store{}
 
+// the wrappers of the stores, like "encrypted" for "encrypted:goleveldb"
+var wrappers = map[string]func(Store) Store{}
+
 func Register(s Store) {
 	name := s.String()
 	if _, ok := dbs[name]; ok {
@@ -23,6 +27,16 @@ func Register(s Store) {
 	dbs[name] = s
 }
 
+// RegisterWrapper registers the store wrapping others, the store name is
+// the wrapper name and the wrapped store name joined by ":".
+func RegisterWrapper(name string, wrap func(Store) Store) {
+	if _, ok := wrappers[name]; ok {
+		panic(fmt.Errorf("store wrapper %s is registered", name))
+	}
+
+	wrappers[name] = wrap
+}
+
 func ListStores() []string {
 	s := []string{}
 	for k := range dbs {
@@ -37,9 +51,26 @@ func GetStore(cfg *config.Config) (Store, error) {
 		cfg.DBName = config.DefaultDBName
 	}
 
-	s, ok := dbs[cfg.DBName]
+	return getStore(cfg.DBName)
+}
+
+func getStore(name string) (Store, error) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		wrap, ok := wrappers[name[0:i]]
+		if !ok {
+			return nil, fmt.Errorf("store wrapper %s is not registered", name[0:i])
+		}
+
+		s, err := getStore(name[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		return wrap(s), nil
+	}
+
+	s, ok := dbs[name]
 	if !ok {
-		return nil, fmt.Errorf("store %s is not registered", cfg.DBName)
+		return nil, fmt.Errorf("store %s is not registered", name)
 	}
 
 	return s, nil
@@ -0,0 +1,58 @@
+package encrypted
+
+import (
+	"github.com/ledisdb/ledisdb/store/driver"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// WriteBatch writes the encrypted data to the wrapped batch, and keeps
+// the plain data in a leveldb batch for the replication.
+type WriteBatch struct {
+	db *DB
+	wb driver.IWriteBatch
+
+	data *leveldb.Batch
+}
+
+func newWriteBatch(db *DB) *WriteBatch {
+	return &WriteBatch{
+		db:   db,
+		wb:   db.db.NewWriteBatch(),
+		data: new(leveldb.Batch),
+	}
+}
+
+func (w *WriteBatch) Put(key, value []byte) {
+	w.data.Put(key, value)
+	w.wb.Put(w.db.encodeKey(key), w.db.encodeValue(key, value))
+}
+
+func (w *WriteBatch) Delete(key []byte) {
+	w.data.Delete(key)
+	w.wb.Delete(w.db.encodeKey(key))
+}
+
+func (w *WriteBatch) Commit() error {
+	w.data.Reset()
+	return w.wb.Commit()
+}
+
+func (w *WriteBatch) SyncCommit() error {
+	w.data.Reset()
+	return w.wb.SyncCommit()
+}
+
+func (w *WriteBatch) Rollback() error {
+	w.data.Reset()
+	return w.wb.Rollback()
+}
+
+func (w *WriteBatch) Close() {
+	w.data.Reset()
+	w.wb.Close()
+}
+
+// Data returns the plain batch data, which has the same format as leveldb.
+func (w *WriteBatch) Data() []byte {
+	return w.data.Dump()
+}
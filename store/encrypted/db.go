@@ -0,0 +1,210 @@
+// Package encrypted wraps another store to encrypt the data at rest, the store name is like
+// "encrypted:goleveldb", and the keys are loaded from the key file in the encryption config.
+//
+// The values are encrypted with AES-GCM and authenticated with their plain keys. The keys are
+// kept plain unless encrypt_keys is set, then they are encrypted deterministically and keep the order.
+//
+// The data of the write batch is kept plain for the replication, which is encrypted by the
+// replication log store if needed. The range deletion and the merge are not passed through,
+// because the wrapped store can't see the plain values, the store falls back to the plain ones.
+//
+// The key id of the key encrypting the keys is saved in the KEK file of the store directory,
+// the store can't be opened if the key file doesn't have it any more.
+package encrypted
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+// StoreName is the name of the wrapper.
+const StoreName = "encrypted"
+
+// the file saving the key id of the key encrypting the keys
+const kekFileName = "KEK"
+
+var errNoKeyFile = errors.New("encrypted store needs the key file in the encryption config")
+
+type Store struct {
+	s driver.Store
+}
+
+func (s Store) String() string {
+	return StoreName + ":" + s.s.String()
+}
+
+func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
+	if len(cfg.Encryption.KeyFile) == 0 {
+		return nil, errNoKeyFile
+	}
+
+	ks, err := LoadKeys(cfg.Encryption.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	idb, err := s.s.Open(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Encryption.EncryptKeys {
+		if err = loadKeyEncryptionKey(path, ks); err != nil {
+			idb.Close()
+			return nil, err
+		}
+	}
+
+	db := &DB{db: idb, ks: ks, encryptKeys: cfg.Encryption.EncryptKeys}
+	if _, ok := idb.(driver.ICheckpointer); ok {
+		return &CheckpointDB{db}, nil
+	}
+	return db, nil
+}
+
+// loadKeyEncryptionKey uses the key encrypting the keys of the store in dir,
+// or saves the first key for the new store.
+func loadKeyEncryptionKey(dir string, ks *Keys) error {
+	name := path.Join(dir, kekFileName)
+
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return saveKeyEncryptionKey(dir, ks)
+	} else if err != nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(string(b)), 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid key id in %s, %s", name, err.Error())
+	}
+	return ks.UseKeyEncryptionKey(uint32(id))
+}
+
+func saveKeyEncryptionKey(dir string, ks *Keys) error {
+	return ioutil.WriteFile(path.Join(dir, kekFileName), []byte(fmt.Sprintf("%08x\n", ks.KeyEncryptionKeyID())), 0644)
+}
+
+func (s Store) Repair(path string, cfg *config.Config) error {
+	return s.s.Repair(path, cfg)
+}
+
+type DB struct {
+	db driver.IDB
+	ks *Keys
+
+	encryptKeys bool
+}
+
+func (db *DB) encodeKey(key []byte) []byte {
+	if !db.encryptKeys || key == nil {
+		return key
+	}
+	return db.ks.EncryptKey(make([]byte, 0, 2*len(key)), key)
+}
+
+func (db *DB) decodeKey(key []byte) ([]byte, error) {
+	if !db.encryptKeys {
+		return key, nil
+	}
+	return db.ks.DecryptKey(make([]byte, 0, len(key)/2), key)
+}
+
+func (db *DB) encodeValue(key []byte, value []byte) []byte {
+	return db.ks.Seal(make([]byte, 0, len(value)+Overhead), value, key)
+}
+
+// decodeValue decrypts the value of the plain key, the empty value is not nil.
+func (db *DB) decodeValue(key []byte, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return db.ks.Open(make([]byte, 0, len(value)), value, key)
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+func (db *DB) Get(key []byte) ([]byte, error) {
+	v, err := db.db.Get(db.encodeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return db.decodeValue(key, v)
+}
+
+func (db *DB) Put(key []byte, value []byte) error {
+	return db.db.Put(db.encodeKey(key), db.encodeValue(key, value))
+}
+
+func (db *DB) Delete(key []byte) error {
+	return db.db.Delete(db.encodeKey(key))
+}
+
+func (db *DB) SyncPut(key []byte, value []byte) error {
+	return db.db.SyncPut(db.encodeKey(key), db.encodeValue(key, value))
+}
+
+func (db *DB) SyncDelete(key []byte) error {
+	return db.db.SyncDelete(db.encodeKey(key))
+}
+
+func (db *DB) NewIterator() driver.IIterator {
+	return &Iterator{it: db.db.NewIterator(), db: db}
+}
+
+func (db *DB) NewWriteBatch() driver.IWriteBatch {
+	return newWriteBatch(db)
+}
+
+func (db *DB) NewSnapshot() (driver.ISnapshot, error) {
+	s, err := db.db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{s: s, db: db}, nil
+}
+
+func (db *DB) Compact() error {
+	return db.db.Compact()
+}
+
+// Properties returns the properties of the wrapped store, the sizes include the encryption overhead.
+func (db *DB) Properties() (*driver.Properties, error) {
+	if p, ok := db.db.(driver.IPropertier); ok {
+		return p.Properties()
+	}
+	return &driver.Properties{}, nil
+}
+
+// CheckpointDB is the DB wrapping the store which can create checkpoints,
+// the checkpoint is encrypted and opened with the same keys.
+type CheckpointDB struct {
+	*DB
+}
+
+func (db *CheckpointDB) Checkpoint(dir string) error {
+	if err := db.db.(driver.ICheckpointer).Checkpoint(dir); err != nil {
+		return err
+	}
+
+	if db.encryptKeys {
+		return saveKeyEncryptionKey(dir, db.ks)
+	}
+	return nil
+}
+
+func init() {
+	driver.RegisterWrapper(StoreName, func(s driver.Store) driver.Store {
+		return Store{s}
+	})
+}
@@ -0,0 +1,83 @@
+package encrypted
+
+import (
+	"github.com/ledisdb/ledisdb/store/driver"
+	"github.com/siddontang/go/log"
+)
+
+// Iterator decrypts the key and the value once at every position.
+type Iterator struct {
+	it driver.IIterator
+	db *DB
+
+	key   []byte
+	value []byte
+
+	keyDecoded   bool
+	valueDecoded bool
+}
+
+func (it *Iterator) reset() {
+	it.key = nil
+	it.value = nil
+	it.keyDecoded = false
+	it.valueDecoded = false
+}
+
+func (it *Iterator) Key() []byte {
+	if !it.keyDecoded {
+		it.keyDecoded = true
+
+		var err error
+		if it.key, err = it.db.decodeKey(it.it.Key()); err != nil {
+			log.Errorf("decrypt key error %s", err.Error())
+		}
+	}
+	return it.key
+}
+
+func (it *Iterator) Value() []byte {
+	if !it.valueDecoded {
+		it.valueDecoded = true
+
+		var err error
+		if it.value, err = it.db.decodeValue(it.Key(), it.it.Value()); err != nil {
+			log.Errorf("decrypt value error %s", err.Error())
+		}
+	}
+	return it.value
+}
+
+func (it *Iterator) Close() error {
+	it.reset()
+	return it.it.Close()
+}
+
+func (it *Iterator) Valid() bool {
+	return it.it.Valid()
+}
+
+func (it *Iterator) Next() {
+	it.reset()
+	it.it.Next()
+}
+
+func (it *Iterator) Prev() {
+	it.reset()
+	it.it.Prev()
+}
+
+func (it *Iterator) First() {
+	it.reset()
+	it.it.First()
+}
+
+func (it *Iterator) Last() {
+	it.reset()
+	it.it.Last()
+}
+
+func (it *Iterator) Seek(key []byte) {
+	it.reset()
+	it.it.Seek(it.db.encodeKey(key))
+}
@@ -0,0 +1,324 @@
+package encrypted
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+	The key file is a key rotation list, one hex encoded 32 bytes AES-256 key per line,
+	the empty lines and the lines starting with # are skipped:
+
+	# 2024-01
+	6f0d...
+	# 2024-07, the last key encrypts the new values
+	a3c9...
+
+	the encrypted value: key id (4 bytes) | nonce (12 bytes) | AES-GCM ciphertext and tag
+
+	the key id is the first 4 bytes of the SHA-256 of the key, so the values encrypted
+	by any key in the file can be decrypted, and the old keys are removed only after
+	all their values are rewritten.
+
+	the encrypted key is deterministic and keeps the order, see EncryptKey, so the key
+	encrypting the keys is fixed, the keys can't be found any more after rotating it.
+	It is the first key when the store is created, and its key id is saved in the store,
+	see UseKeyEncryptionKey, so the other keys can still be rotated out.
+*/
+
+const (
+	keySize   = 32
+	keyIDSize = 4
+	nonceSize = 12
+
+	// Overhead is the size added to the encrypted value.
+	Overhead = keyIDSize + nonceSize + 16
+)
+
+var (
+	ErrNoKey      = errors.New("no encryption key in the key file")
+	ErrUnknownKey = errors.New("unknown encryption key id")
+	ErrCorrupted  = errors.New("encrypted data corrupted")
+)
+
+type key struct {
+	id   uint32
+	aead cipher.AEAD
+
+	// the deterministic key encryption, init is the state before the first byte
+	prf  []byte
+	gap  cipher.Block
+	init []byte
+}
+
+func newKey(b []byte) (*key, error) {
+	k := new(key)
+
+	sum := sha256.Sum256(b)
+	k.id = binary.BigEndian.Uint32(sum[:])
+
+	block, err := aes.NewCipher(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+
+	// the subkeys of the key encryption are derived, not to reuse the value key
+	k.prf = deriveKey(b, "ledis key prf")
+	if k.gap, err = aes.NewCipher(deriveKey(b, "ledis key gap")); err != nil {
+		return nil, err
+	}
+	k.init = hmac.New(sha256.New, k.prf).Sum(nil)
+
+	return k, nil
+}
+
+func deriveKey(b []byte, label string) []byte {
+	h := hmac.New(sha256.New, b)
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// Keys is the key rotation list, the last key encrypts the values and all the keys decrypt them.
+type Keys struct {
+	keys []*key
+	ids  map[uint32]*key
+
+	// the key encrypting the keys, the first key by default
+	kek     *key
+	ciphers sync.Pool
+}
+
+// NewKeys creates the key rotation list from the raw 32 bytes keys, from old to new.
+func NewKeys(raw [][]byte) (*Keys, error) {
+	if len(raw) == 0 {
+		return nil, ErrNoKey
+	}
+
+	ks := &Keys{ids: make(map[uint32]*key, len(raw))}
+	for _, b := range raw {
+		if len(b) != keySize {
+			return nil, fmt.Errorf("invalid encryption key size %d, must be %d", len(b), keySize)
+		}
+
+		k, err := newKey(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := ks.ids[k.id]; ok {
+			return nil, fmt.Errorf("duplicated encryption key id %08x", k.id)
+		}
+
+		ks.keys = append(ks.keys, k)
+		ks.ids[k.id] = k
+	}
+
+	ks.kek = ks.keys[0]
+	ks.ciphers.New = func() interface{} {
+		return newKeyCipher(ks.kek)
+	}
+
+	return ks, nil
+}
+
+// KeyEncryptionKeyID returns the key id of the key encrypting the keys.
+func (ks *Keys) KeyEncryptionKeyID() uint32 {
+	return ks.kek.id
+}
+
+// UseKeyEncryptionKey sets the key encrypting the keys to the key with id, which must be
+// in the list. It must be called before any key is encrypted.
+func (ks *Keys) UseKeyEncryptionKey(id uint32) error {
+	k, ok := ks.ids[id]
+	if !ok {
+		return fmt.Errorf("the key %08x encrypting the keys is not in the key file, it can't be removed", id)
+	}
+
+	ks.kek = k
+	return nil
+}
+
+// LoadKeys loads the key rotation list from the key file.
+func LoadKeys(path string) (*Keys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw [][]byte
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		b, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key at %s:%d, %s", path, n, err.Error())
+		}
+		raw = append(raw, b)
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewKeys(raw)
+}
+
+// Seal encrypts the value with the last key and appends it to dst,
+// ad is authenticated but not encrypted, like the plain key of the value.
+func (ks *Keys) Seal(dst []byte, value []byte, ad []byte) []byte {
+	k := ks.keys[len(ks.keys)-1]
+
+	n := len(dst)
+	dst = append(dst, make([]byte, keyIDSize+nonceSize)...)
+	binary.BigEndian.PutUint32(dst[n:], k.id)
+
+	nonce := dst[n+keyIDSize : n+keyIDSize+nonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+
+	return k.aead.Seal(dst, nonce, value, ad)
+}
+
+// Open decrypts the value sealed by any key in the list and appends it to dst.
+func (ks *Keys) Open(dst []byte, value []byte, ad []byte) ([]byte, error) {
+	if len(value) < Overhead {
+		return nil, ErrCorrupted
+	}
+
+	k, ok := ks.ids[binary.BigEndian.Uint32(value)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	nonce := value[keyIDSize : keyIDSize+nonceSize]
+	b, err := k.aead.Open(dst, nonce, value[keyIDSize+nonceSize:], ad)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return b, nil
+}
+
+// EncryptKey encrypts the key deterministically and keeps the order: every byte is mapped to
+// 2 bytes by a strictly increasing function, which is the sum of 256 pseudo random gaps in [1, 255]
+// chosen by the bytes before it. So the keys with the same prefix have the same encrypted prefix,
+// the order of the keys is kept, and the ranges and the prefix scans still work.
+//
+// Like all order preserving encryption, the order and the common prefixes of the keys are leaked,
+// only the values are encrypted with AES-GCM.
+func (ks *Keys) EncryptKey(dst []byte, key []byte) []byte {
+	c := ks.getKeyCipher()
+	defer ks.ciphers.Put(c)
+
+	for _, b := range key {
+		v := c.encrypt(b)
+		dst = append(dst, byte(v>>8), byte(v))
+		c.next(b)
+	}
+	return dst
+}
+
+// DecryptKey decrypts the key encrypted by EncryptKey and appends it to dst.
+func (ks *Keys) DecryptKey(dst []byte, key []byte) ([]byte, error) {
+	if len(key)%2 != 0 {
+		return nil, ErrCorrupted
+	}
+
+	c := ks.getKeyCipher()
+	defer ks.ciphers.Put(c)
+
+	for i := 0; i < len(key); i += 2 {
+		b, ok := c.decrypt(uint16(key[i])<<8 | uint16(key[i+1]))
+		if !ok {
+			return nil, ErrCorrupted
+		}
+		dst = append(dst, b)
+		c.next(b)
+	}
+	return dst, nil
+}
+
+type keyCipher struct {
+	k     *key
+	h     hash.Hash
+	state []byte
+	gaps  [256]byte
+}
+
+func newKeyCipher(k *key) *keyCipher {
+	return &keyCipher{k: k, h: hmac.New(sha256.New, k.prf)}
+}
+
+// getKeyCipher returns the cached cipher of the key encrypting the keys, at the first byte.
+func (ks *Keys) getKeyCipher() *keyCipher {
+	c := ks.ciphers.Get().(*keyCipher)
+	if c.k != ks.kek {
+		c = newKeyCipher(ks.kek)
+	}
+	c.state = append(c.state[:0], c.k.init...)
+	return c
+}
+
+// fillGaps generates the gaps of the current position from the state of the bytes before.
+func (c *keyCipher) fillGaps() {
+	for i := range c.gaps {
+		c.gaps[i] = 0
+	}
+	cipher.NewCTR(c.k.gap, c.state[0:aes.BlockSize]).XORKeyStream(c.gaps[:], c.gaps[:])
+	for i, g := range c.gaps {
+		c.gaps[i] = 1 + g%255
+	}
+}
+
+func (c *keyCipher) next(b byte) {
+	c.h.Reset()
+	c.h.Write(c.state)
+	c.h.Write([]byte{b})
+	c.state = c.h.Sum(c.state[:0])
+}
+
+func (c *keyCipher) encrypt(b byte) uint16 {
+	c.fillGaps()
+
+	var v uint16
+	for _, g := range c.gaps[0 : int(b)+1] {
+		v += uint16(g)
+	}
+	return v
+}
+
+func (c *keyCipher) decrypt(v uint16) (byte, bool) {
+	c.fillGaps()
+
+	var sum uint16
+	for i, g := range c.gaps {
+		if sum += uint16(g); sum == v {
+			return byte(i), true
+		} else if sum > v {
+			break
+		}
+	}
+	return 0, false
+}
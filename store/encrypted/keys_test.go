@@ -0,0 +1,112 @@
+package encrypted
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func testKeys(t *testing.T, raw ...byte) *Keys {
+	var keys [][]byte
+	for _, b := range raw {
+		keys = append(keys, bytes.Repeat([]byte{b}, keySize))
+	}
+
+	ks, err := NewKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestSeal(t *testing.T) {
+	old := testKeys(t, 1)
+	ks := testKeys(t, 1, 2)
+
+	v := old.Seal(nil, []byte("value"), []byte("key"))
+	if b, err := ks.Open(nil, v, []byte("key")); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "value" {
+		t.Fatal(string(b))
+	}
+
+	if _, err := ks.Open(nil, v, []byte("key2")); err != ErrCorrupted {
+		t.Fatal("must fail for the other key")
+	}
+
+	// the new value is sealed by the last key
+	v = ks.Seal(nil, []byte("value"), nil)
+	if _, err := old.Open(nil, v, nil); err != ErrUnknownKey {
+		t.Fatal(err)
+	}
+
+	if b, err := ks.Open(nil, ks.Seal(nil, nil, nil), nil); err != nil {
+		t.Fatal(err)
+	} else if len(b) != 0 {
+		t.Fatal(len(b))
+	}
+
+	if _, err := NewKeys([][]byte{[]byte("short")}); err == nil {
+		t.Fatal("must fail for the short key")
+	}
+}
+
+func TestEncryptKey(t *testing.T) {
+	ks := testKeys(t, 1, 2)
+
+	// the key encryption uses the first key by default, not the last one
+	if !bytes.Equal(ks.EncryptKey(nil, []byte("abc")), testKeys(t, 1).EncryptKey(nil, []byte("abc"))) {
+		t.Fatal("key encryption must not be rotated")
+	}
+
+	// the key encrypting the keys can be moved, but not removed
+	moved := testKeys(t, 2, 1)
+	if err := moved.UseKeyEncryptionKey(ks.KeyEncryptionKeyID()); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(ks.EncryptKey(nil, []byte("abc")), moved.EncryptKey(nil, []byte("abc"))) {
+		t.Fatal("key encryption must use the moved key")
+	}
+
+	if err := testKeys(t, 2, 3).UseKeyEncryptionKey(ks.KeyEncryptionKeyID()); err == nil {
+		t.Fatal("must fail for the removed key")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = make([]byte, r.Intn(8))
+		for j := range keys[i] {
+			// small alphabet for more common prefixes
+			keys[i][j] = byte(r.Intn(4)) * 85
+		}
+	}
+
+	encKeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		encKeys[i] = ks.EncryptKey(nil, key)
+
+		if b, err := ks.DecryptKey(nil, encKeys[i]); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(b, key) {
+			t.Fatalf("%q != %q", b, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	sort.Slice(encKeys, func(i, j int) bool { return bytes.Compare(encKeys[i], encKeys[j]) < 0 })
+
+	for i, key := range keys {
+		if b, _ := ks.DecryptKey(nil, encKeys[i]); !bytes.Equal(b, key) {
+			t.Fatalf("order not kept, %q != %q", b, key)
+		}
+
+		if len(key) > 2 && bytes.Contains(encKeys[i], key) {
+			t.Fatalf("plain key %q in %q", key, encKeys[i])
+		}
+	}
+
+	if _, err := ks.DecryptKey(nil, []byte{1, 2, 3}); err != ErrCorrupted {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,26 @@
+package encrypted
+
+import (
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+type Snapshot struct {
+	s  driver.ISnapshot
+	db *DB
+}
+
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	v, err := s.s.Get(s.db.encodeKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return s.db.decodeValue(key, v)
+}
+
+func (s *Snapshot) NewIterator() driver.IIterator {
+	return &Iterator{it: s.s.NewIterator(), db: s.db}
+}
+
+func (s *Snapshot) Close() {
+	s.s.Close()
+}
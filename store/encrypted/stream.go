@@ -0,0 +1,185 @@
+package encrypted
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+	The encrypted stream, like the dump:
+
+	magic | chunk | chunk | ... | final chunk
+
+	chunk: sealed len (bigendian uint32, the high bit is set for the final chunk) | sealed
+
+	the chunk is sealed with the chunk index and the final flag as the additional data,
+	so the reordered, dropped or truncated chunks are found.
+*/
+
+// StreamMagic starts the encrypted stream.
+var StreamMagic = []byte("ledisenc")
+
+const (
+	streamChunkSize = 64 * 1024
+	streamFinalFlag = uint32(1) << 31
+)
+
+var ErrStreamMagic = errors.New("invalid encrypted stream")
+
+// IsStream checks whether the data starts with StreamMagic.
+func IsStream(b []byte) bool {
+	return bytes.HasPrefix(b, StreamMagic)
+}
+
+func streamAD(buf []byte, index uint64, final bool) []byte {
+	binary.BigEndian.PutUint64(buf, index)
+	buf[8] = 0
+	if final {
+		buf[8] = 1
+	}
+	return buf[0:9]
+}
+
+type streamWriter struct {
+	w  io.Writer
+	ks *Keys
+
+	buf    []byte
+	sealed []byte
+	ad     [9]byte
+	index  uint64
+
+	err error
+}
+
+// NewWriter returns the writer encrypting the stream to w, it must be closed
+// to write the final chunk, but w is not closed.
+func NewWriter(w io.Writer, ks *Keys) io.WriteCloser {
+	s := &streamWriter{w: w, ks: ks}
+	s.buf = make([]byte, 0, streamChunkSize)
+	_, s.err = w.Write(StreamMagic)
+	return s
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	n := 0
+	for s.err == nil && len(b) > 0 {
+		m := copy(s.buf[len(s.buf):cap(s.buf)], b)
+		s.buf = s.buf[0 : len(s.buf)+m]
+		b = b[m:]
+		n += m
+
+		if len(s.buf) == cap(s.buf) {
+			s.writeChunk(false)
+		}
+	}
+	return n, s.err
+}
+
+func (s *streamWriter) writeChunk(final bool) {
+	s.sealed = s.ks.Seal(append(s.sealed[:0], 0, 0, 0, 0), s.buf, streamAD(s.ad[:], s.index, final))
+
+	n := uint32(len(s.sealed) - 4)
+	if final {
+		n |= streamFinalFlag
+	}
+	binary.BigEndian.PutUint32(s.sealed, n)
+
+	_, s.err = s.w.Write(s.sealed)
+	s.buf = s.buf[:0]
+	s.index++
+}
+
+func (s *streamWriter) Close() error {
+	if s.err == nil {
+		s.writeChunk(true)
+	}
+
+	if s.err == nil {
+		s.err = io.ErrClosedPipe
+		return nil
+	}
+	return s.err
+}
+
+type streamReader struct {
+	r  io.Reader
+	ks *Keys
+
+	plain  []byte
+	buf    []byte
+	sealed []byte
+	ad     [9]byte
+	index  uint64
+
+	final bool
+	err   error
+}
+
+// NewReader returns the reader decrypting the stream from r, which must start with StreamMagic.
+func NewReader(r io.Reader, ks *Keys) io.Reader {
+	s := &streamReader{r: r, ks: ks}
+
+	magic := make([]byte, len(StreamMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		s.err = err
+	} else if !IsStream(magic) {
+		s.err = ErrStreamMagic
+	}
+	return s
+}
+
+func (s *streamReader) Read(b []byte) (int, error) {
+	for len(s.buf) == 0 && s.err == nil {
+		if s.final {
+			s.err = io.EOF
+		} else {
+			s.readChunk()
+		}
+	}
+
+	if len(s.buf) > 0 {
+		n := copy(b, s.buf)
+		s.buf = s.buf[n:]
+		return n, nil
+	}
+	return 0, s.err
+}
+
+func (s *streamReader) readChunk() {
+	var head [4]byte
+	if _, s.err = io.ReadFull(s.r, head[:]); s.err != nil {
+		// the stream without the final chunk is truncated
+		if s.err == io.EOF {
+			s.err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	n := binary.BigEndian.Uint32(head[:])
+	s.final = n&streamFinalFlag != 0
+	n &^= streamFinalFlag
+
+	if n > streamChunkSize+Overhead {
+		s.err = ErrCorrupted
+		return
+	}
+
+	if cap(s.sealed) < int(n) {
+		s.sealed = make([]byte, n)
+	}
+	s.sealed = s.sealed[0:n]
+
+	if _, s.err = io.ReadFull(s.r, s.sealed); s.err != nil {
+		if s.err == io.EOF {
+			s.err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	s.plain, s.err = s.ks.Open(s.plain[:0], s.sealed, streamAD(s.ad[:], s.index, s.final))
+	s.buf = s.plain
+	s.index++
+}
@@ -0,0 +1,56 @@
+package encrypted
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	ks := testKeys(t, 1)
+
+	for _, n := range []int{0, 100, streamChunkSize, 3*streamChunkSize + 7} {
+		data := bytes.Repeat([]byte("ledis"), n)[0:n]
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf, ks)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		} else if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b := buf.Bytes()
+		if !IsStream(b) {
+			t.Fatal("must be stream")
+		} else if n > 0 && bytes.Contains(b, data) {
+			t.Fatal("plain data in stream")
+		}
+
+		if v, err := ioutil.ReadAll(NewReader(bytes.NewReader(b), ks)); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(v, data) {
+			t.Fatalf("stream of %d bytes read %d", n, len(v))
+		}
+
+		// the truncated stream is found even at the chunk boundary
+		for _, m := range []int{len(b) - 1, len(b) - Overhead - 4} {
+			if m < len(StreamMagic) {
+				continue
+			}
+
+			if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b[0:m]), ks)); err == nil {
+				t.Fatalf("truncated stream of %d bytes must fail", n)
+			}
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("notencrypted")), ks).Read(make([]byte, 1)); err != ErrStreamMagic {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(nil), ks).Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal(err)
+	}
+}
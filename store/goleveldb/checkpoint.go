@@ -0,0 +1,131 @@
+package goleveldb
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// FileDB is the database on disk, which can create checkpoints unlike the memory database.
+type FileDB struct {
+	*DB
+}
+
+// the times to retry the checkpoint if a linked table is removed by the compaction
+const checkpointRetries = 3
+
+var errCheckpointManifest = errors.New("invalid CURRENT file")
+
+func copyFile(src string, dst string) error {
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	d, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(d, s); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// linkFile hard links the file, or copies it if the link fails, like across the devices.
+func linkFile(src string, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// linkFiles links the tables and copies the manifest and the journals to dir.
+func (db *FileDB) linkFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// the iterator holds the current version, so its tables are not removed
+	it := db.db.NewIterator(nil, nil)
+	defer it.Release()
+
+	current, err := ioutil.ReadFile(path.Join(db.path, "CURRENT"))
+	if err != nil {
+		return err
+	}
+
+	manifest := strings.TrimSpace(string(current))
+	if !strings.HasPrefix(manifest, "MANIFEST-") {
+		return errCheckpointManifest
+	}
+
+	if err = copyFile(path.Join(db.path, manifest), path.Join(dir, manifest)); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(path.Join(dir, "CURRENT"), current, 0644); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(db.path)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		src := path.Join(db.path, name)
+		dst := path.Join(dir, name)
+
+		switch path.Ext(name) {
+		case ".ldb", ".sst":
+			// the table removed after listing is not in the copied manifest,
+			// or the checkpoint is found broken when opening
+			if err = linkFile(src, dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case ".log":
+			// the journal is appended later, so it is copied
+			if err = copyFile(src, dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Checkpoint hard links the tables of the current version to dir, and copies the manifest and
+// the journals. The checkpoint is opened once to recover the journals and check the tables,
+// and retried if a table is removed by the compaction in the meantime.
+func (db *FileDB) Checkpoint(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return os.ErrExist
+	}
+
+	opts := newOptions(db.cfg)
+	opts.ErrorIfMissing = true
+
+	var err error
+	for i := 0; i < checkpointRetries; i++ {
+		if err = db.linkFiles(dir); err == nil {
+			var cdb *leveldb.DB
+			if cdb, err = leveldb.OpenFile(dir, opts); err == nil {
+				return cdb.Close()
+			}
+		}
+
+		os.RemoveAll(dir)
+	}
+
+	return err
+}
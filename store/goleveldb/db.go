@@ -66,7 +66,7 @@ func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
 		return nil, err
 	}
 
-	return db, nil
+	return &FileDB{db}, nil
 }
 
 func (s Store) Repair(path string, cfg *config.Config) error {
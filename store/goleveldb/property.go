@@ -0,0 +1,46 @@
+package goleveldb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+func (db *DB) ApproximateSize(start []byte, end []byte) (int64, error) {
+	sizes, err := db.db.SizeOf([]util.Range{{Start: start, Limit: end}})
+	if err != nil {
+		return 0, err
+	}
+	return sizes.Sum(), nil
+}
+
+func (db *DB) Properties() (*driver.Properties, error) {
+	p := &driver.Properties{}
+
+	// the tables are listed as "num:size[min .. max]" under "--- level n ---"
+	tables, err := db.db.GetProperty("leveldb.sstables")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(tables, "\n") {
+		var level int
+		var num, size int64
+		if n, _ := fmt.Sscanf(line, "--- level %d ---", &level); n == 1 {
+			p.LevelFiles = append(p.LevelFiles, 0)
+		} else if n, _ := fmt.Sscanf(line, "%d:%d", &num, &size); n == 2 && len(p.LevelFiles) > 0 {
+			p.LevelFiles[len(p.LevelFiles)-1]++
+			p.DiskSize += size
+		}
+	}
+
+	if v, err := db.db.GetProperty("leveldb.cachedblock"); err == nil {
+		p.BlockCacheSize, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	return p, nil
+}
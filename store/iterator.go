@@ -42,11 +42,24 @@ type Limit struct {
 type Iterator struct {
 	it driver.IIterator
 	st *Stat
+
+	// the store of the iterator, the driver iterator is closed if it is reopened
+	db *DB
+	g  reopenGuard
+}
+
+// closeReopen closes the driver iterator before the store is reopened,
+// the iterator is not valid any more.
+func (it *Iterator) closeReopen() {
+	if it.g.close() {
+		it.st.IterCloseNum.Add(1)
+		it.it.Close()
+	}
 }
 
 // Key returns a copy of key.
 func (it *Iterator) Key() []byte {
-	k := it.it.Key()
+	k := it.RawKey()
 	if k == nil {
 		return nil
 	}
@@ -56,7 +69,7 @@ func (it *Iterator) Key() []byte {
 
 // Value returns a copy of value.
 func (it *Iterator) Value() []byte {
-	v := it.it.Value()
+	v := it.RawValue()
 	if v == nil {
 		return nil
 	}
@@ -67,12 +80,22 @@ func (it *Iterator) Value() []byte {
 // RawKey returns a reference of key.
 // you must be careful that it will be changed after next iterate.
 func (it *Iterator) RawKey() []byte {
+	if !it.g.enter() {
+		return nil
+	}
+	defer it.g.leave()
+
 	return it.it.Key()
 }
 
 // RawValue returns a reference of value.
 // you must be careful that it will be changed after next iterate.
 func (it *Iterator) RawValue() []byte {
+	if !it.g.enter() {
+		return nil
+	}
+	defer it.g.leave()
+
 	return it.it.Value()
 }
 
@@ -106,38 +129,71 @@ func (it *Iterator) BufValue(b []byte) []byte {
 }
 
 func (it *Iterator) Close() {
-	if it.it != nil {
-		it.st.IterCloseNum.Add(1)
-		it.it.Close()
-		it.it = nil
+	// closed before, or by Reopen
+	if !it.g.close() {
+		return
 	}
+
+	it.st.IterCloseNum.Add(1)
+	it.it.Close()
+	it.db.removeOpen(it)
 }
 
 func (it *Iterator) Valid() bool {
+	if !it.g.enter() {
+		return false
+	}
+	defer it.g.leave()
+
 	return it.it.Valid()
 }
 
 func (it *Iterator) Next() {
+	if !it.g.enter() {
+		return
+	}
+	defer it.g.leave()
+
 	it.st.IterSeekNum.Add(1)
 	it.it.Next()
 }
 
 func (it *Iterator) Prev() {
+	if !it.g.enter() {
+		return
+	}
+	defer it.g.leave()
+
 	it.st.IterSeekNum.Add(1)
 	it.it.Prev()
 }
 
 func (it *Iterator) SeekToFirst() {
+	if !it.g.enter() {
+		return
+	}
+	defer it.g.leave()
+
 	it.st.IterSeekNum.Add(1)
 	it.it.First()
 }
 
 func (it *Iterator) SeekToLast() {
+	if !it.g.enter() {
+		return
+	}
+	defer it.g.leave()
+
 	it.st.IterSeekNum.Add(1)
 	it.it.Last()
 }
 
 func (it *Iterator) Seek(key []byte) {
+	if !it.g.enter() {
+		return
+	}
+	defer it.g.leave()
+
 	it.st.IterSeekNum.Add(1)
 	it.it.Seek(key)
 }
@@ -332,3 +388,16 @@ func rangeLimitIterator(i *Iterator, r *Range, l *Limit, direction uint8) *Range
 
 	return it
 }
+
+// closedIterator is the iterator closed by Reopen, it is never valid.
+type closedIterator struct{}
+
+func (closedIterator) Close() error  { return nil }
+func (closedIterator) First()        {}
+func (closedIterator) Last()         {}
+func (closedIterator) Seek([]byte)   {}
+func (closedIterator) Next()         {}
+func (closedIterator) Prev()         {}
+func (closedIterator) Valid() bool   { return false }
+func (closedIterator) Key() []byte   { return nil }
+func (closedIterator) Value() []byte { return nil }
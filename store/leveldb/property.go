@@ -0,0 +1,62 @@
+// +build leveldb
+
+package leveldb
+
+// #include <leveldb/c.h>
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+func (db *DB) ApproximateSize(start []byte, end []byte) (int64, error) {
+	// the keys are copied to C, cgo can't pass the Go pointers in Go memory
+	cStart := (*C.char)(C.CBytes(start))
+	cEnd := (*C.char)(C.CBytes(end))
+	defer C.leveldb_free(unsafe.Pointer(cStart))
+	defer C.leveldb_free(unsafe.Pointer(cEnd))
+
+	startLen := C.size_t(len(start))
+	endLen := C.size_t(len(end))
+
+	var size C.uint64_t
+	C.leveldb_approximate_sizes(db.db, 1, &cStart, &startLen, &cEnd, &endLen, &size)
+
+	return int64(size), nil
+}
+
+func (db *DB) getProperty(name string) (string, bool) {
+	cName := C.CString(name)
+	defer C.leveldb_free(unsafe.Pointer(cName))
+
+	v := C.leveldb_property_value(db.db, cName)
+	if v == nil {
+		return "", false
+	}
+	defer C.leveldb_free(unsafe.Pointer(v))
+
+	return C.GoString(v), true
+}
+
+func (db *DB) Properties() (*driver.Properties, error) {
+	p := &driver.Properties{}
+
+	// the tables are listed as "num:size[min .. max]" under "--- level n ---"
+	tables, _ := db.getProperty("leveldb.sstables")
+	for _, line := range strings.Split(tables, "\n") {
+		var level int
+		var num, size int64
+		if n, _ := fmt.Sscanf(line, "--- level %d ---", &level); n == 1 {
+			p.LevelFiles = append(p.LevelFiles, 0)
+		} else if n, _ := fmt.Sscanf(line, "%d:%d", &num, &size); n == 2 && len(p.LevelFiles) > 0 {
+			p.LevelFiles[len(p.LevelFiles)-1]++
+			p.DiskSize += size
+		}
+	}
+
+	return p, nil
+}
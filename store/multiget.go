@@ -0,0 +1,96 @@
+package store
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+// multiGet gets the keys with one iterator in the key order, so the iterator
+// needn't seek for a key if it is already not less than the key.
+func multiGet(it driver.IIterator, keys [][]byte) [][]byte {
+	values := make([][]byte, len(keys))
+
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.Slice(idx, func(i, j int) bool {
+		return bytes.Compare(keys[idx[i]], keys[idx[j]]) < 0
+	})
+
+	seeked := false
+	for _, i := range idx {
+		key := keys[i]
+		if !seeked || (it.Valid() && bytes.Compare(it.Key(), key) < 0) {
+			it.Seek(key)
+			seeked = true
+		}
+
+		if it.Valid() && bytes.Equal(it.Key(), key) {
+			values[i] = append([]byte{}, it.Value()...)
+		}
+	}
+
+	return values
+}
+
+func (st *Stat) statMultiGet(values [][]byte, err error, t time.Time) {
+	for _, v := range values {
+		st.statGet(v, err)
+	}
+	st.GetTotalTime.Add(time.Now().Sub(t))
+}
+
+// MultiGet returns the values in the order of the keys, nil for the missing key.
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	t := time.Now()
+
+	var values [][]byte
+	var err error
+	if d, ok := db.db.(driver.IMultiGeter); ok {
+		if values, err = d.MultiGet(keys); err == nil && db.c != nil {
+			values, err = db.c.decodeValues(keys, values)
+		}
+	} else {
+		db.st.IterNum.Add(1)
+		it := newCodecIterator(db.db.NewIterator(), db.c)
+		values = multiGet(it, keys)
+		err = it.Close()
+		db.st.IterCloseNum.Add(1)
+	}
+
+	db.st.statMultiGet(values, err, t)
+	return values, err
+}
+
+// MultiGet returns the values in the order of the keys, nil for the missing key.
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, error) {
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+
+	t := time.Now()
+
+	var values [][]byte
+	var err error
+	if d, ok := s.ISnapshot.(driver.IMultiGeter); ok {
+		if values, err = d.MultiGet(keys); err == nil && s.c != nil {
+			values, err = s.c.decodeValues(keys, values)
+		}
+	} else {
+		s.st.IterNum.Add(1)
+		it := newCodecIterator(s.ISnapshot.NewIterator(), s.c)
+		values = multiGet(it, keys)
+		err = it.Close()
+		s.st.IterCloseNum.Add(1)
+	}
+
+	s.st.statMultiGet(values, err, t)
+	return values, err
+}
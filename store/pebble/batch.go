@@ -0,0 +1,55 @@
+package pebble
+
+import (
+	"github.com/cockroachdb/pebble"
+)
+
+type WriteBatch struct {
+	db     *DB
+	wbatch *pebble.Batch
+}
+
+func (w *WriteBatch) Put(key, value []byte) {
+	w.wbatch.Set(key, value, nil)
+}
+
+func (w *WriteBatch) Delete(key []byte) {
+	w.wbatch.Delete(key, nil)
+}
+
+func (w *WriteBatch) Merge(key, value []byte) {
+	w.wbatch.Merge(key, value, nil)
+}
+
+func (w *WriteBatch) DeleteRange(start, end []byte) {
+	w.wbatch.DeleteRange(start, end, nil)
+}
+
+func (w *WriteBatch) Commit() error {
+	return w.commit(pebble.NoSync)
+}
+
+func (w *WriteBatch) SyncCommit() error {
+	return w.commit(pebble.Sync)
+}
+
+func (w *WriteBatch) commit(opts *pebble.WriteOptions) error {
+	// a committed pebble batch can't be used again, so apply it and keep it reusable
+	err := w.db.db.Apply(w.wbatch, opts)
+	w.wbatch.Reset()
+	return err
+}
+
+func (w *WriteBatch) Rollback() error {
+	w.wbatch.Reset()
+	return nil
+}
+
+func (w *WriteBatch) Close() {
+	w.wbatch.Close()
+}
+
+// Data returns the batch data, which has the same format as leveldb.
+func (w *WriteBatch) Data() []byte {
+	return w.wbatch.Repr()
+}
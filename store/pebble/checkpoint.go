@@ -0,0 +1,10 @@
+package pebble
+
+import (
+	"github.com/cockroachdb/pebble"
+)
+
+// Checkpoint links the tables and copies the WAL to dir, the WAL is flushed before.
+func (db *DB) Checkpoint(dir string) error {
+	return db.db.Checkpoint(dir, pebble.WithFlushedWAL())
+}
@@ -0,0 +1,3 @@
+package pebble
+
+const DBName = "pebble"
@@ -0,0 +1,208 @@
+// Package pebble is a wrapper for the pure go pebble, no cgo needed.
+package pebble
+
+import (
+	"io"
+	"os"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+
+	"github.com/ledisdb/ledisdb/config"
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+const (
+	noCompression     = 0
+	snappyCompression = 1
+	zstdCompression   = 2
+)
+
+type Store struct {
+}
+
+func (s Store) String() string {
+	return DBName
+}
+
+type DB struct {
+	path string
+
+	cfg *config.PebbleConfig
+
+	db *pebble.DB
+
+	opts *pebble.Options
+
+	cache *pebble.Cache
+}
+
+func (s Store) Open(path string, cfg *config.Config) (driver.IDB, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	db := new(DB)
+	db.path = path
+	db.cfg = &cfg.Pebble
+
+	db.initOpts()
+
+	var err error
+	db.db, err = pebble.Open(db.path, db.opts)
+	if err != nil {
+		db.cache.Unref()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Repair only opens and closes the database, pebble checks the manifest
+// and replays the WAL in opening, there is no more repair tool.
+func (s Store) Repair(path string, cfg *config.Config) error {
+	db, err := s.Open(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+func (db *DB) initOpts() {
+	cfg := db.cfg
+
+	db.cache = pebble.NewCache(int64(cfg.CacheSize))
+
+	opts := &pebble.Options{}
+	opts.Cache = db.cache
+	opts.Merger = int64AddMerger
+	opts.MemTableSize = uint64(cfg.MemTableSize)
+	opts.MaxOpenFiles = cfg.MaxOpenFiles
+	opts.L0CompactionThreshold = cfg.L0CompactionThreshold
+	opts.L0StopWritesThreshold = cfg.L0StopWritesThreshold
+	opts.LBaseMaxBytes = int64(cfg.LBaseMaxBytes)
+
+	opts.Levels = make([]pebble.LevelOptions, 7)
+	for i := range opts.Levels {
+		l := &opts.Levels[i]
+		l.BlockSize = cfg.BlockSize
+
+		if cfg.BloomFilterBits > 0 {
+			l.FilterPolicy = bloom.FilterPolicy(cfg.BloomFilterBits)
+		}
+
+		switch cfg.Compression {
+		case snappyCompression:
+			l.Compression = pebble.SnappyCompression
+		case zstdCompression:
+			l.Compression = pebble.ZstdCompression
+		default:
+			l.Compression = pebble.NoCompression
+		}
+
+		if i > 0 {
+			l.TargetFileSize = opts.Levels[i-1].TargetFileSize * 2
+		}
+	}
+
+	db.opts = opts.EnsureDefaults()
+}
+
+func (db *DB) Close() error {
+	err := db.db.Close()
+	db.cache.Unref()
+	return err
+}
+
+func (db *DB) Put(key, value []byte) error {
+	return db.db.Set(key, value, pebble.NoSync)
+}
+
+func (db *DB) Get(key []byte) ([]byte, error) {
+	return get(db.db.Get(key))
+}
+
+func get(v []byte, closer io.Closer, err error) ([]byte, error) {
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the value is only valid before closing
+	buf := make([]byte, len(v))
+	copy(buf, v)
+
+	closer.Close()
+	return buf, nil
+}
+
+func (db *DB) Delete(key []byte) error {
+	return db.db.Delete(key, pebble.NoSync)
+}
+
+func (db *DB) SyncPut(key []byte, value []byte) error {
+	return db.db.Set(key, value, pebble.Sync)
+}
+
+func (db *DB) SyncDelete(key []byte) error {
+	return db.db.Delete(key, pebble.Sync)
+}
+
+func (db *DB) Merge(key []byte, value []byte) error {
+	return db.db.Merge(key, value, pebble.NoSync)
+}
+
+func (db *DB) DeleteRange(start []byte, end []byte) error {
+	return db.db.DeleteRange(start, end, pebble.NoSync)
+}
+
+func (db *DB) NewWriteBatch() driver.IWriteBatch {
+	wb := &WriteBatch{
+		db:     db,
+		wbatch: db.db.NewBatch(),
+	}
+	return wb
+}
+
+func (db *DB) NewIterator() driver.IIterator {
+	it, err := db.db.NewIter(nil)
+	return newIterator(it, err)
+}
+
+func (db *DB) NewSnapshot() (driver.ISnapshot, error) {
+	s := &Snapshot{
+		db:  db,
+		snp: db.db.NewSnapshot(),
+	}
+
+	return s, nil
+}
+
+func (db *DB) Compact() error {
+	it, err := db.db.NewIter(nil)
+	if err != nil {
+		return err
+	}
+
+	var start, end []byte
+	if it.First() {
+		start = append([]byte{}, it.Key()...)
+	}
+
+	if it.Last() {
+		// the end key is exclusive
+		end = append(append([]byte{}, it.Key()...), 0)
+	}
+
+	if err = it.Close(); err != nil || start == nil {
+		return err
+	}
+
+	return db.db.Compact(start, end, true)
+}
+
+func init() {
+	driver.Register(Store{})
+}
@@ -0,0 +1,72 @@
+package pebble
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/siddontang/go/log"
+)
+
+type Iterator struct {
+	it *pebble.Iterator
+}
+
+// newIterator returns an always invalid iterator if err is not nil,
+// because the driver iterator can't return the error.
+func newIterator(it *pebble.Iterator, err error) *Iterator {
+	if err != nil {
+		log.Errorf("new pebble iterator error %s", err.Error())
+		return &Iterator{}
+	}
+
+	return &Iterator{it: it}
+}
+
+func (it *Iterator) Key() []byte {
+	return it.it.Key()
+}
+
+func (it *Iterator) Value() []byte {
+	return it.it.Value()
+}
+
+func (it *Iterator) Close() error {
+	if it.it != nil {
+		err := it.it.Close()
+		it.it = nil
+		return err
+	}
+	return nil
+}
+
+func (it *Iterator) Valid() bool {
+	return it.it != nil && it.it.Valid()
+}
+
+func (it *Iterator) Next() {
+	if it.it != nil {
+		it.it.Next()
+	}
+}
+
+func (it *Iterator) Prev() {
+	if it.it != nil {
+		it.it.Prev()
+	}
+}
+
+func (it *Iterator) First() {
+	if it.it != nil {
+		it.it.First()
+	}
+}
+
+func (it *Iterator) Last() {
+	if it.it != nil {
+		it.it.Last()
+	}
+}
+
+func (it *Iterator) Seek(key []byte) {
+	if it.it != nil {
+		it.it.SeekGE(key)
+	}
+}
@@ -0,0 +1,37 @@
+package pebble
+
+import (
+	"io"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+var int64AddMerger = &pebble.Merger{
+	Name: driver.Int64AddMergeName,
+	Merge: func(key, value []byte) (pebble.ValueMerger, error) {
+		m := new(int64AddValueMerger)
+		m.operands = append(m.operands, append([]byte{}, value...))
+		return m, nil
+	},
+}
+
+// int64AddValueMerger keeps the operands from the oldest to the newest,
+// and merges them with driver.MergeInt64Add in finishing.
+type int64AddValueMerger struct {
+	operands [][]byte
+}
+
+func (m *int64AddValueMerger) MergeNewer(value []byte) error {
+	m.operands = append(m.operands, append([]byte{}, value...))
+	return nil
+}
+
+func (m *int64AddValueMerger) MergeOlder(value []byte) error {
+	m.operands = append([][]byte{append([]byte{}, value...)}, m.operands...)
+	return nil
+}
+
+func (m *int64AddValueMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return driver.MergeInt64Add(m.operands...), nil, nil
+}
@@ -0,0 +1,28 @@
+package pebble
+
+import (
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+func (db *DB) ApproximateSize(start []byte, end []byte) (int64, error) {
+	n, err := db.db.EstimateDiskUsage(start, end)
+	return int64(n), err
+}
+
+func (db *DB) Properties() (*driver.Properties, error) {
+	m := db.db.Metrics()
+
+	p := &driver.Properties{}
+	for _, l := range m.Levels {
+		p.LevelFiles = append(p.LevelFiles, l.NumFiles)
+		p.DiskSize += l.Size
+	}
+
+	p.PendingCompactionBytes = int64(m.Compact.EstimatedDebt)
+	p.MemTableSize = int64(m.MemTable.Size)
+	p.BlockCacheSize = m.BlockCache.Size
+	p.BlockCacheHits = m.BlockCache.Hits
+	p.BlockCacheMisses = m.BlockCache.Misses
+
+	return p, nil
+}
@@ -0,0 +1,24 @@
+package pebble
+
+import (
+	"github.com/cockroachdb/pebble"
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+type Snapshot struct {
+	db  *DB
+	snp *pebble.Snapshot
+}
+
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.snp.Get(key))
+}
+
+func (s *Snapshot) NewIterator() driver.IIterator {
+	it, err := s.snp.NewIter(nil)
+	return newIterator(it, err)
+}
+
+func (s *Snapshot) Close() {
+	s.snp.Close()
+}
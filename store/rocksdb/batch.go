@@ -48,6 +48,34 @@ func (w *WriteBatch) Delete(key []byte) {
 		(*C.char)(unsafe.Pointer(&key[0])), C.size_t(len(key)))
 }
 
+func (w *WriteBatch) Merge(key, value []byte) {
+	w.commitOk = false
+
+	var k, v *C.char
+	if len(key) != 0 {
+		k = (*C.char)(unsafe.Pointer(&key[0]))
+	}
+	if len(value) != 0 {
+		v = (*C.char)(unsafe.Pointer(&value[0]))
+	}
+
+	C.rocksdb_writebatch_merge(w.wbatch, k, C.size_t(len(key)), v, C.size_t(len(value)))
+}
+
+func (w *WriteBatch) DeleteRange(start, end []byte) {
+	w.commitOk = false
+
+	var s, e *C.char
+	if len(start) != 0 {
+		s = (*C.char)(unsafe.Pointer(&start[0]))
+	}
+	if len(end) != 0 {
+		e = (*C.char)(unsafe.Pointer(&end[0]))
+	}
+
+	C.rocksdb_writebatch_delete_range(w.wbatch, s, C.size_t(len(start)), e, C.size_t(len(end)))
+}
+
 func (w *WriteBatch) Commit() error {
 	return w.commit(w.db.writeOpts)
 }
@@ -0,0 +1,31 @@
+// +build rocksdb
+
+package rocksdb
+
+// #include <stdlib.h>
+// #include "rocksdb/c.h"
+import "C"
+
+import (
+	"unsafe"
+)
+
+// Checkpoint links the tables to dir after flushing the memory table.
+func (db *DB) Checkpoint(dir string) error {
+	var errStr *C.char
+	cp := C.rocksdb_checkpoint_object_create(db.db, &errStr)
+	if errStr != nil {
+		return saveError(errStr)
+	}
+	defer C.rocksdb_checkpoint_object_destroy(cp)
+
+	cDir := C.CString(dir)
+	defer C.free(unsafe.Pointer(cDir))
+
+	// 0 means always flushing the memory table, so the WAL is not needed
+	C.rocksdb_checkpoint_create(cp, cDir, 0, &errStr)
+	if errStr != nil {
+		return saveError(errStr)
+	}
+	return nil
+}
@@ -128,6 +128,7 @@ func (db *DB) initOptions(cfg *config.RocksDBConfig) {
 	blockOpts.SetBlockSize(cfg.BlockSize)
 	opts.SetBlockBasedTableFactory(blockOpts)
 
+	opts.SetMergeOperator(NewInt64AddMergeOperator())
 	opts.SetCompression(CompressionOpt(cfg.Compression))
 	opts.SetWriteBufferSize(cfg.WriteBufferSize)
 	opts.SetMaxOpenFiles(cfg.MaxOpenFiles)
@@ -312,6 +313,54 @@ func (db *DB) getSlice(ro *ReadOptions, key []byte) (driver.ISlice, error) {
 	return NewCSlice(unsafe.Pointer(value), int(vallen)), nil
 }
 
+func (db *DB) multiGet(ro *ReadOptions, keys [][]byte) ([][]byte, error) {
+	n := len(keys)
+	values := make([][]byte, n)
+	if n == 0 {
+		return values, nil
+	}
+
+	// the keys are copied to C, cgo can't pass the Go pointers in Go memory
+	cKeys := make([]*C.char, n)
+	cKeySizes := make([]C.size_t, n)
+	for i, key := range keys {
+		cKeys[i] = (*C.char)(C.CBytes(key))
+		cKeySizes[i] = C.size_t(len(key))
+	}
+
+	defer func() {
+		for _, k := range cKeys {
+			C.free(unsafe.Pointer(k))
+		}
+	}()
+
+	cValues := make([]*C.char, n)
+	cValueSizes := make([]C.size_t, n)
+	errStrs := make([]*C.char, n)
+
+	C.rocksdb_multi_get(db.db, ro.Opt, C.size_t(n),
+		&cKeys[0], &cKeySizes[0], &cValues[0], &cValueSizes[0], &errStrs[0])
+
+	var err error
+	for i := 0; i < n; i++ {
+		if errStrs[i] != nil {
+			if e := saveError(errStrs[i]); err == nil {
+				err = e
+			}
+		}
+
+		if cValues[i] != nil {
+			values[i] = C.GoBytes(unsafe.Pointer(cValues[i]), C.int(cValueSizes[i]))
+			C.free(unsafe.Pointer(cValues[i]))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
 func (db *DB) delete(wo *WriteOptions, key []byte) error {
 	var errStr *C.char
 	var k *C.char
@@ -328,11 +377,43 @@ func (db *DB) delete(wo *WriteOptions, key []byte) error {
 	return nil
 }
 
+func (db *DB) Merge(key []byte, value []byte) error {
+	var errStr *C.char
+	var k, v *C.char
+	if len(key) != 0 {
+		k = (*C.char)(unsafe.Pointer(&key[0]))
+	}
+	if len(value) != 0 {
+		v = (*C.char)(unsafe.Pointer(&value[0]))
+	}
+
+	C.rocksdb_merge(
+		db.db, db.writeOpts.Opt, k, C.size_t(len(key)), v, C.size_t(len(value)), &errStr)
+
+	if errStr != nil {
+		return saveError(errStr)
+	}
+	return nil
+}
+
+// DeleteRange deletes the keys in [start, end) with a range tombstone.
+func (db *DB) DeleteRange(start []byte, end []byte) error {
+	wb := db.NewWriteBatch().(*WriteBatch)
+	defer wb.Close()
+
+	wb.DeleteRange(start, end)
+	return wb.Commit()
+}
+
 func (db *DB) Compact() error {
 	C.rocksdb_compact_range(db.db, nil, 0, nil, 0)
 	return nil
 }
 
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, error) {
+	return db.multiGet(db.readOpts, keys)
+}
+
 func (db *DB) GetSlice(key []byte) (driver.ISlice, error) {
 	return db.getSlice(db.readOpts, key)
 }
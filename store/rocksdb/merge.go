@@ -0,0 +1,18 @@
+// +build rocksdb
+
+package rocksdb
+
+// #cgo LDFLAGS: -lrocksdb
+// #include "rocksdb/c.h"
+// #include "rocksdb_ext.h"
+import "C"
+
+type MergeOperator struct {
+	Opt *C.rocksdb_mergeoperator_t
+}
+
+// NewInt64AddMergeOperator returns the merge operator adding the decimal int64 deltas,
+// it is implemented in C++ to avoid calling back into Go in compactions.
+func NewInt64AddMergeOperator() *MergeOperator {
+	return &MergeOperator{C.rocksdb_mergeoperator_create_int64add_ext()}
+}
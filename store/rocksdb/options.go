@@ -90,6 +90,11 @@ func (o *Options) SetMaxOpenFiles(n int) {
 	C.rocksdb_options_set_max_open_files(o.Opt, C.int(n))
 }
 
+// SetMergeOperator sets the merge operator, which is destroyed with the options.
+func (o *Options) SetMergeOperator(m *MergeOperator) {
+	C.rocksdb_options_set_merge_operator(o.Opt, m.Opt)
+}
+
 func (o *Options) SetCompression(t CompressionOpt) {
 	C.rocksdb_options_set_compression(o.Opt, C.int(t))
 }
@@ -0,0 +1,95 @@
+// +build rocksdb
+
+package rocksdb
+
+// #include <stdlib.h>
+// #include "rocksdb/c.h"
+import "C"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+func (db *DB) ApproximateSize(start []byte, end []byte) (int64, error) {
+	// the keys are copied to C, cgo can't pass the Go pointers in Go memory
+	cStart := (*C.char)(C.CBytes(start))
+	cEnd := (*C.char)(C.CBytes(end))
+	defer C.free(unsafe.Pointer(cStart))
+	defer C.free(unsafe.Pointer(cEnd))
+
+	startLen := C.size_t(len(start))
+	endLen := C.size_t(len(end))
+
+	var size C.uint64_t
+	var errStr *C.char
+	C.rocksdb_approximate_sizes(db.db, 1, &cStart, &startLen, &cEnd, &endLen, &size, &errStr)
+	if errStr != nil {
+		return 0, saveError(errStr)
+	}
+
+	return int64(size), nil
+}
+
+func (db *DB) getProperty(name string) (string, bool) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	v := C.rocksdb_property_value(db.db, cName)
+	if v == nil {
+		return "", false
+	}
+	defer C.free(unsafe.Pointer(v))
+
+	return C.GoString(v), true
+}
+
+func (db *DB) getIntProperty(name string) int64 {
+	v, _ := db.getProperty(name)
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
+// getTicker returns the ticker count in the statistics like "rocksdb.block.cache.hit COUNT : 10".
+func getTicker(stats string, name string) int64 {
+	for _, line := range strings.Split(stats, "\n") {
+		var n int64
+		if strings.HasPrefix(line, name+" ") {
+			fmt.Sscanf(line[len(name):], " COUNT : %d", &n)
+			return n
+		}
+	}
+
+	return 0
+}
+
+func (db *DB) Properties() (*driver.Properties, error) {
+	p := &driver.Properties{}
+
+	for i := 0; i < db.cfg.NumLevels; i++ {
+		p.LevelFiles = append(p.LevelFiles, db.getIntProperty(fmt.Sprintf("rocksdb.num-files-at-level%d", i)))
+	}
+
+	p.DiskSize = db.getIntProperty("rocksdb.total-sst-files-size")
+	p.PendingCompactionBytes = db.getIntProperty("rocksdb.estimate-pending-compaction-bytes")
+	p.MemTableSize = db.getIntProperty("rocksdb.cur-size-all-mem-tables")
+	p.BlockCacheSize = db.getIntProperty("rocksdb.block-cache-usage")
+
+	// the block cache tickers are only counted with enable_statistics
+	if db.cfg.EnableStatistics {
+		v := C.rocksdb_options_statistics_get_string(db.opts.Opt)
+		if v != nil {
+			stats := C.GoString(v)
+			C.free(unsafe.Pointer(v))
+
+			p.BlockCacheHits = getTicker(stats, "rocksdb.block.cache.hit")
+			p.BlockCacheMisses = getTicker(stats, "rocksdb.block.cache.miss")
+		}
+	}
+
+	return p, nil
+}
@@ -2,7 +2,9 @@
 
 #include "rocksdb_ext.h"
 
+#include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
 #include <string>
 
 extern "C" {
@@ -41,4 +43,98 @@ void rocksdb_write_ext(rocksdb_t* db,
     }
 }
 
-}
\ No newline at end of file
+// the int64 add merge operator, it must be the same as MergeInt64Add in the driver package
+static const char* int64add_name(void* state) {
+    return "ledis.int64add";
+}
+
+static void int64add_destructor(void* state) {
+}
+
+static void int64add_delete_value(void* state, const char* value, size_t value_length) {
+    free((void*)value);
+}
+
+// parse the decimal int64 like strconv.ParseInt(s, 10, 64) in Go
+static int int64add_parse(const char* s, size_t n, long long* v) {
+    size_t i = 0;
+    int neg = 0;
+    if(n > 0 && (s[0] == '+' || s[0] == '-')) {
+        neg = s[0] == '-';
+        i = 1;
+    }
+
+    if(i == n) {
+        return 0;
+    }
+
+    unsigned long long max = neg ? 9223372036854775808ULL : 9223372036854775807ULL;
+    unsigned long long u = 0;
+    for(; i < n; i++) {
+        if(s[i] < '0' || s[i] > '9') {
+            return 0;
+        }
+
+        unsigned long long d = s[i] - '0';
+        if(u > (max - d) / 10) {
+            return 0;
+        }
+        u = u * 10 + d;
+    }
+
+    *v = neg ? (long long)(0ULL - u) : (long long)u;
+    return 1;
+}
+
+static char* int64add_copy(const char* s, size_t n, size_t* new_value_length) {
+    char* buf = (char*)malloc(n > 0 ? n : 1);
+    memcpy(buf, s, n);
+    *new_value_length = n;
+    return buf;
+}
+
+static char* int64add_merge(const char* existing_value, size_t existing_value_length,
+    const char* const* operands_list, const size_t* operands_list_length, int num_operands,
+    unsigned char* success, size_t* new_value_length) {
+    *success = 1;
+
+    long long v;
+    if(existing_value != NULL && !int64add_parse(existing_value, existing_value_length, &v)) {
+        return int64add_copy(existing_value, existing_value_length, new_value_length);
+    }
+
+    // add as unsigned to wrap around like Go
+    unsigned long long sum = existing_value != NULL ? (unsigned long long)v : 0;
+    for(int i = 0; i < num_operands; i++) {
+        if(!int64add_parse(operands_list[i], operands_list_length[i], &v)) {
+            return int64add_copy(operands_list[i], operands_list_length[i], new_value_length);
+        }
+        sum += (unsigned long long)v;
+    }
+
+    char buf[32];
+    int n = snprintf(buf, sizeof(buf), "%lld", (long long)sum);
+    return int64add_copy(buf, (size_t)n, new_value_length);
+}
+
+static char* int64add_full_merge(void* state, const char* key, size_t key_length,
+    const char* existing_value, size_t existing_value_length,
+    const char* const* operands_list, const size_t* operands_list_length, int num_operands,
+    unsigned char* success, size_t* new_value_length) {
+    return int64add_merge(existing_value, existing_value_length,
+        operands_list, operands_list_length, num_operands, success, new_value_length);
+}
+
+static char* int64add_partial_merge(void* state, const char* key, size_t key_length,
+    const char* const* operands_list, const size_t* operands_list_length, int num_operands,
+    unsigned char* success, size_t* new_value_length) {
+    return int64add_merge(NULL, 0,
+        operands_list, operands_list_length, num_operands, success, new_value_length);
+}
+
+rocksdb_mergeoperator_t* rocksdb_mergeoperator_create_int64add_ext() {
+    return rocksdb_mergeoperator_create(NULL, int64add_destructor,
+        int64add_full_merge, int64add_partial_merge, int64add_delete_value, int64add_name);
+}
+
+}
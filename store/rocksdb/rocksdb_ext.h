@@ -17,6 +17,9 @@ extern unsigned char rocksdb_iter_next_ext(rocksdb_iterator_t*);
 extern unsigned char rocksdb_iter_prev_ext(rocksdb_iterator_t*);
 extern void rocksdb_write_ext(rocksdb_t* db, const rocksdb_writeoptions_t* options, rocksdb_writebatch_t* batch, char** errptr);
 
+// the merge operator adding the decimal int64 deltas, named ledis.int64add
+extern rocksdb_mergeoperator_t* rocksdb_mergeoperator_create_int64add_ext();
+
 #ifdef __cplusplus
 }
 #endif
@@ -25,6 +25,10 @@ func (s *Snapshot) GetSlice(key []byte) (driver.ISlice, error) {
 	return s.db.getSlice(s.readOpts, key)
 }
 
+func (s *Snapshot) MultiGet(keys [][]byte) ([][]byte, error) {
+	return s.db.multiGet(s.readOpts, keys)
+}
+
 func (s *Snapshot) NewIterator() driver.IIterator {
 	it := new(Iterator)
 	it.it = C.rocksdb_create_iterator(s.db.db, s.db.iteratorOpts.Opt)
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"github.com/ledisdb/ledisdb/store/driver"
+)
+
+// Properties is the engine state of the store.
+type Properties = driver.Properties
+
+// SupportApproximateSize returns whether the driver estimates the disk size natively,
+// otherwise ApproximateSize iterates the range.
+func (db *DB) SupportApproximateSize() bool {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	_, ok := db.db.(driver.ISizer)
+	return ok
+}
+
+// ApproximateSize returns the approximate disk size of the keys in [start, end),
+// or the total size of the keys and values in the range if the driver can't estimate it.
+func (db *DB) ApproximateSize(start []byte, end []byte) (int64, error) {
+	if db.SupportApproximateSize() {
+		db.rw.RLock()
+		defer db.rw.RUnlock()
+
+		return db.db.(driver.ISizer).ApproximateSize(start, end)
+	}
+
+	var n int64
+	it := db.RangeIterator(start, end, RangeROpen)
+	defer it.Close()
+
+	for ; it.Valid(); it.Next() {
+		n += int64(len(it.RawKey()) + len(it.RawValue()))
+	}
+
+	return n, nil
+}
+
+// Properties returns the engine properties, all the fields are zero if the driver can't report them.
+func (db *DB) Properties() (*Properties, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	if d, ok := db.db.(driver.IPropertier); ok {
+		return d.Properties()
+	}
+
+	return &Properties{}, nil
+}
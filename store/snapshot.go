@@ -7,12 +7,33 @@ import (
 type Snapshot struct {
 	driver.ISnapshot
 	st *Stat
+	c  *codec
+
+	// the store of the snapshot, the driver snapshot is closed if it is reopened
+	db *DB
+	g  reopenGuard
+}
+
+// closeReopen closes the driver snapshot before the store is reopened,
+// the reads of the snapshot return ErrStoreReopened.
+func (s *Snapshot) closeReopen() {
+	if s.g.close() {
+		s.st.SnapshotCloseNum.Add(1)
+		s.ISnapshot.Close()
+	}
+	s.ISnapshot = closedSnapshot{}
 }
 
 func (s *Snapshot) NewIterator() *Iterator {
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+
 	it := new(Iterator)
-	it.it = s.ISnapshot.NewIterator()
+	it.it = newCodecIterator(s.ISnapshot.NewIterator(), s.c)
 	it.st = s.st
+	it.db = s.db
+
+	s.db.addOpen(it)
 
 	s.st.IterNum.Add(1)
 
@@ -20,18 +41,35 @@ func (s *Snapshot) NewIterator() *Iterator {
 }
 
 func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	if !s.g.enter() {
+		return nil, ErrStoreReopened
+	}
+	defer s.g.leave()
+
+	return s.get(key)
+}
+
+func (s *Snapshot) get(key []byte) ([]byte, error) {
 	v, err := s.ISnapshot.Get(key)
+	if err == nil && v != nil && s.c != nil {
+		v, err = s.c.decode(key, v)
+	}
 	s.st.statGet(v, err)
 	return v, err
 }
 
 func (s *Snapshot) GetSlice(key []byte) (Slice, error) {
-	if d, ok := s.ISnapshot.(driver.ISliceGeter); ok {
+	if !s.g.enter() {
+		return nil, ErrStoreReopened
+	}
+	defer s.g.leave()
+
+	if d, ok := s.ISnapshot.(driver.ISliceGeter); ok && s.c == nil {
 		v, err := d.GetSlice(key)
 		s.st.statGet(v, err)
 		return v, err
 	}
-	v, err := s.Get(key)
+	v, err := s.get(key)
 	if err != nil {
 		return nil, err
 	} else if v == nil {
@@ -42,6 +80,19 @@ func (s *Snapshot) GetSlice(key []byte) (Slice, error) {
 }
 
 func (s *Snapshot) Close() {
+	// closed before, or by Reopen
+	if !s.g.close() {
+		return
+	}
+
 	s.st.SnapshotCloseNum.Add(1)
 	s.ISnapshot.Close()
+	s.db.removeOpen(s)
 }
+
+// closedSnapshot is the snapshot closed by Reopen.
+type closedSnapshot struct{}
+
+func (closedSnapshot) Get([]byte) ([]byte, error)    { return nil, ErrStoreReopened }
+func (closedSnapshot) NewIterator() driver.IIterator { return closedIterator{} }
+func (closedSnapshot) Close()                        {}
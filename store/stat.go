@@ -10,6 +10,8 @@ type Stat struct {
 	GetTotalTime         sync2.AtomicDuration
 	PutNum               sync2.AtomicInt64
 	DeleteNum            sync2.AtomicInt64
+	DeleteRangeNum       sync2.AtomicInt64
+	MergeNum             sync2.AtomicInt64
 	IterNum              sync2.AtomicInt64
 	IterSeekNum          sync2.AtomicInt64
 	IterCloseNum         sync2.AtomicInt64
@@ -23,6 +25,14 @@ type Stat struct {
 	TxCloseNum           sync2.AtomicInt64
 	CompactNum           sync2.AtomicInt64
 	CompactTotalTime     sync2.AtomicDuration
+	CheckpointNum        sync2.AtomicInt64
+	CheckpointTotalTime  sync2.AtomicDuration
+	CompressNum          sync2.AtomicInt64
+	CompressRawSize      sync2.AtomicInt64
+	CompressSize         sync2.AtomicInt64
+	DecompressNum        sync2.AtomicInt64
+	CacheHitNum          sync2.AtomicInt64
+	CacheMissNum         sync2.AtomicInt64
 }
 
 func (st *Stat) statGet(v interface{}, err error) {
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/store/driver"
 
+	_ "github.com/ledisdb/ledisdb/store/bolt"      // register bolt
+	_ "github.com/ledisdb/ledisdb/store/encrypted" // register the encrypted wrapper
 	_ "github.com/ledisdb/ledisdb/store/goleveldb" // register goleveldb
 	_ "github.com/ledisdb/ledisdb/store/leveldb"   // register leveldb
+	_ "github.com/ledisdb/ledisdb/store/pebble"    // register pebble
 	_ "github.com/ledisdb/ledisdb/store/rocksdb"   // register rocksdb
 )
 
@@ -17,17 +21,22 @@ func getStorePath(cfg *config.Config) string {
 	if len(cfg.DBPath) > 0 {
 		return cfg.DBPath
 	}
-	return path.Join(cfg.DataDir, fmt.Sprintf("%s_data", cfg.DBName))
+	// the wrapped store name like "encrypted:goleveldb" is not a good file name
+	name := strings.Replace(cfg.DBName, ":", "_", -1)
+	return path.Join(cfg.DataDir, fmt.Sprintf("%s_data", name))
 }
 
 func Open(cfg *config.Config) (*DB, error) {
+	return OpenPath(cfg, getStorePath(cfg))
+}
+
+// OpenPath opens the store of cfg.DBName in path, like a checkpoint.
+func OpenPath(cfg *config.Config, path string) (*DB, error) {
 	s, err := driver.GetStore(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	path := getStorePath(cfg)
-
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
@@ -40,9 +49,14 @@ func Open(cfg *config.Config) (*DB, error) {
 	db := new(DB)
 	db.db = idb
 	db.name = s.String()
+	db.path = path
 	db.st = &Stat{}
 	db.cfg = cfg
 
+	if cfg.ReadCacheSize > 0 {
+		db.cache = newCache(cfg.ReadCacheSize)
+	}
+
 	return db, nil
 }
 
@@ -3,9 +3,13 @@ package store
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ledisdb/ledisdb/config"
 	"github.com/ledisdb/ledisdb/store/driver"
@@ -35,12 +39,122 @@ func TestStore(t *testing.T) {
 	}
 }
 
+func TestEncryptedStore(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/testdb_encrypted"
+	cfg.LMDB.MapSize = 10 * 1024 * 1024
+	cfg.Encryption.KeyFile = "/tmp/testdb_encrypted.key"
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	keys := "# old key\n" + strings.Repeat("01", 32) + "\n\n" + strings.Repeat("02", 32) + "\n"
+	if err := ioutil.WriteFile(cfg.Encryption.KeyFile, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(cfg.Encryption.KeyFile)
+
+	for _, name := range []string{"goleveldb", "pebble", "bolt"} {
+		for _, encryptKeys := range []bool{false, true} {
+			t.Logf("store encrypted:%s, encrypt keys %v", name, encryptKeys)
+			cfg.DBName = "encrypted:" + name
+			cfg.Encryption.EncryptKeys = encryptKeys
+
+			os.RemoveAll(getStorePath(cfg))
+
+			db, err := Open(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testStore(db, t)
+			testClear(db, t)
+
+			db.Put([]byte("encrypted_key"), []byte("encrypted_value"))
+			db.Close()
+
+			// the wrapped store has no plain value, and no plain key if encrypted
+			cfg.DBName = name
+			cfg.DBPath = getStorePath(&config.Config{DataDir: cfg.DataDir, DBName: "encrypted:" + name})
+
+			if db, err = Open(cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			n := 0
+			it := db.NewIterator()
+			for it.SeekToFirst(); it.Valid(); it.Next() {
+				n++
+				if bytes.Contains(it.RawValue(), []byte("encrypted_value")) {
+					t.Fatal("plain value in the encrypted store")
+				} else if bytes.Contains(it.RawKey(), []byte("encrypted_key")) == encryptKeys {
+					t.Fatalf("key %q, encrypt keys %v", it.RawKey(), encryptKeys)
+				}
+			}
+			it.Close()
+			db.Close()
+
+			if n != 1 {
+				t.Fatalf("%d != 1", n)
+			}
+
+			cfg.DBPath = ""
+
+			if encryptKeys {
+				testRotateKeyEncryptionKey(cfg, t)
+			}
+		}
+	}
+}
+
+// testRotateKeyEncryptionKey checks that the first key, which encrypts the keys,
+// can't be removed from the key file, but can be moved.
+func testRotateKeyEncryptionKey(cfg *config.Config, t *testing.T) {
+	name := cfg.DBName
+	cfg.DBName = "encrypted:" + name
+	defer func() { cfg.DBName = name }()
+
+	keys, err := ioutil.ReadFile(cfg.Encryption.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.WriteFile(cfg.Encryption.KeyFile, keys, 0600)
+
+	rotated := strings.Repeat("02", 32) + "\n" + strings.Repeat("03", 32) + "\n"
+	if err = ioutil.WriteFile(cfg.Encryption.KeyFile, []byte(rotated), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err := Open(cfg); err == nil {
+		db.Close()
+		t.Fatal("must error for the removed key encrypting the keys")
+	}
+
+	rotated = strings.Repeat("02", 32) + "\n" + strings.Repeat("01", 32) + "\n"
+	if err = ioutil.WriteFile(cfg.Encryption.KeyFile, []byte(rotated), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValue(db, t, "encrypted_key", "encrypted_value")
+	db.Close()
+}
+
 func testStore(db *DB, t *testing.T) {
 	testSimple(db, t)
 	testBatch(db, t)
 	testIterator(db, t)
 	testSnapshot(db, t)
 	testBatchData(db, t)
+	testDeleteRange(db, t)
+	testMultiGet(db, t)
+	testMerge(db, t)
+	testApproximateSize(db, t)
+	testCheckpoint(db, t)
+	testReopen(db, t)
 }
 
 func testClear(db *DB, t *testing.T) {
@@ -282,6 +396,18 @@ func testIterator(db *DB, t *testing.T) {
 		t.Fatal(err)
 	}
 	it.Close()
+
+	// the iterator doesn't see the writes after it is created
+	it = db.RangeLimitIterator(k(1), k(5), RangeClose, 0, -1)
+	db.Put(k(20), []byte("value"))
+	db.Delete(k(3))
+	if err := checkIterator(it, 1, 2, 3, 4, 5); err != nil {
+		t.Fatal(err)
+	}
+	it.Close()
+
+	db.Delete(k(20))
+	db.Put(k(3), []byte("value"))
 }
 
 func testSnapshot(db *DB, t *testing.T) {
@@ -367,3 +493,658 @@ func testBatchData(db *DB, t *testing.T) {
 		t.Fatalf("%v != %v", kvs, expected)
 	}
 }
+
+func checkRangeKeys(db *DB, t *testing.T, min []byte, max []byte, expected ...string) {
+	var keys []string
+	it := db.RangeIterator(min, max, RangeROpen)
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+
+	if len(keys) != len(expected) || (len(keys) > 0 && !reflect.DeepEqual(keys, expected)) {
+		t.Fatalf("%v != %v", keys, expected)
+	}
+}
+
+func testDeleteRange(db *DB, t *testing.T) {
+	min := []byte("dr_")
+	max := []byte("dr_z")
+
+	w := db.NewWriteBatch()
+	defer w.Close()
+
+	for _, k := range []string{"dr_a", "dr_b", "dr_c", "dr_d", "dr_e"} {
+		w.Put([]byte(k), []byte("1"))
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key put in the batch before is deleted too
+	w.Put([]byte("dr_bb"), []byte("1"))
+	w.Put([]byte("dr_f"), []byte("1"))
+	w.DeleteRange([]byte("dr_b"), []byte("dr_d"))
+
+	// replay the batch into another one like the replication
+	d, err := NewBatchData(append([]byte{}, w.Data()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = d.Items(); err == nil && db.SupportDeleteRange() {
+		t.Fatal("must error for range deletion")
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRangeKeys(db, t, min, max, "dr_a", "dr_d", "dr_e", "dr_f")
+
+	w2 := db.NewWriteBatch()
+	defer w2.Close()
+
+	if err = d.Replay(w2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRangeKeys(db, t, min, max, "dr_a", "dr_d", "dr_e", "dr_f")
+
+	if err := db.DeleteRange([]byte("dr_d"), max); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRangeKeys(db, t, min, max, "dr_a")
+
+	if err := db.DeleteRange(min, max); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRangeKeys(db, t, min, max)
+}
+
+func testMultiGet(db *DB, t *testing.T) {
+	db.Put([]byte("mg_a"), []byte("1"))
+	db.Put([]byte("mg_b"), []byte{})
+	db.Put([]byte("mg_d"), []byte("4"))
+
+	keys := [][]byte{[]byte("mg_d"), []byte("mg_c"), []byte("mg_a"), []byte("mg_b"), []byte("mg_d"), []byte("mg_z")}
+	expected := [][]byte{[]byte("4"), nil, []byte("1"), {}, []byte("4"), nil}
+
+	if vs, err := db.MultiGet(keys); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(vs, expected) {
+		t.Fatalf("%q != %q", vs, expected)
+	}
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	db.Delete([]byte("mg_a"))
+
+	if vs, err := snap.MultiGet(keys); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(vs, expected) {
+		t.Fatalf("%q != %q", vs, expected)
+	}
+
+	if vs, err := db.MultiGet(nil); err != nil {
+		t.Fatal(err)
+	} else if len(vs) != 0 {
+		t.Fatal(len(vs))
+	}
+}
+
+func checkValue(db *DB, t *testing.T, key string, expected string) {
+	if v, err := db.Get([]byte(key)); err != nil {
+		t.Fatal(err)
+	} else if string(v) != expected {
+		t.Fatalf("%s: %q != %q", key, v, expected)
+	}
+}
+
+func testMerge(db *DB, t *testing.T) {
+	db.Put([]byte("merge_a"), []byte("10"))
+	db.Put([]byte("merge_b"), []byte("abc"))
+
+	w := db.NewWriteBatch()
+	defer w.Close()
+
+	w.Merge([]byte("merge_a"), []byte("5"))
+	w.Merge([]byte("merge_b"), []byte("5"))
+	w.Merge([]byte("merge_c"), []byte("-3"))
+
+	// the merge applies to the value put in the batch before
+	w.Put([]byte("merge_d"), []byte("1"))
+	w.Merge([]byte("merge_d"), []byte("2"))
+
+	d, err := NewBatchData(append([]byte{}, w.Data()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = d.Items(); err == nil && db.SupportMerge() {
+		t.Fatal("must error for merge")
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkValue(db, t, "merge_a", "15")
+	checkValue(db, t, "merge_b", "abc")
+	checkValue(db, t, "merge_c", "-3")
+	checkValue(db, t, "merge_d", "3")
+
+	// replay the batch again like the replication
+	if err = d.Replay(w); err != nil {
+		t.Fatal(err)
+	} else if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fallback saves the sum as a put, so the replay does nothing
+	if db.SupportMerge() {
+		checkValue(db, t, "merge_a", "20")
+		checkValue(db, t, "merge_c", "-6")
+	} else {
+		checkValue(db, t, "merge_a", "15")
+		checkValue(db, t, "merge_c", "-3")
+	}
+
+	db.Put([]byte("merge_a"), []byte("20"))
+	if err := db.Merge([]byte("merge_a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkValue(db, t, "merge_a", "21")
+
+	// the concurrent merges don't lose the deltas without the native merge too
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := db.Merge([]byte("merge_a"), []byte("1")); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	checkValue(db, t, "merge_a", "121")
+}
+
+func testApproximateSize(db *DB, t *testing.T) {
+	min := []byte("size_")
+	max := []byte("size`")
+
+	var total int64
+	value := bytes.Repeat([]byte("v"), 1000)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("size_%03d", i))
+		db.Put(key, value)
+		total += int64(len(key) + len(value))
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.ApproximateSize(min, max)
+	if err != nil {
+		t.Fatal(err)
+	} else if !db.SupportApproximateSize() && n != total {
+		t.Fatal(n, total)
+	} else if n <= 0 {
+		t.Fatal(n)
+	}
+
+	p, err := db.Properties()
+	if err != nil {
+		t.Fatal(err)
+	} else if p.BlockCacheHitRate() < 0 || p.BlockCacheHitRate() > 1 {
+		t.Fatal(p.BlockCacheHitRate())
+	}
+
+	if err := db.DeleteRange(min, max); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCheckpoint(db *DB, t *testing.T) {
+	dir := getStorePath(db.cfg) + "_checkpoint"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	if !db.SupportCheckpoint() {
+		if err := db.Checkpoint(dir); err != ErrCheckpointNotSupported {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	db.Put([]byte("ckp_a"), []byte("1"))
+	db.Put([]byte("ckp_b"), []byte("2"))
+
+	if err := db.Checkpoint(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Put([]byte("ckp_a"), []byte("3"))
+	db.Delete([]byte("ckp_b"))
+
+	if err := db.Checkpoint(dir); err == nil {
+		t.Fatal("must error for the existing checkpoint")
+	}
+
+	cdb, err := OpenPath(db.cfg, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+
+	checkValue(cdb, t, "ckp_a", "1")
+	checkValue(cdb, t, "ckp_b", "2")
+	checkValue(db, t, "ckp_a", "3")
+	checkValue(db, t, "ckp_b", "")
+}
+
+func testReopen(db *DB, t *testing.T) {
+	if !db.SupportCheckpoint() {
+		return
+	}
+
+	dir := getStorePath(db.cfg) + "_checkpoint"
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	db.Put([]byte("ckp_a"), []byte("1"))
+	db.Delete([]byte("ckp_b"))
+
+	if err := db.Checkpoint(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Put([]byte("ckp_a"), []byte("2"))
+	db.Put([]byte("ckp_b"), []byte("3"))
+
+	it := db.NewIterator()
+	defer it.Close()
+	it.SeekToFirst()
+
+	s, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	wb := db.NewWriteBatch()
+	defer wb.Close()
+
+	// the codec is set again for the values compressed in the checkpoint
+	var opts *CodecOptions
+	if db.c != nil {
+		opts = testCodecOptions(true)
+	}
+
+	if err = db.Reopen(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("the checkpoint must be moved")
+	}
+
+	checkValue(db, t, "ckp_a", "1")
+	checkValue(db, t, "ckp_b", "")
+
+	// the iterators and snapshots are closed
+	if it.Valid() {
+		t.Fatal("the iterator must be invalid")
+	}
+	if _, err = s.Get([]byte("ckp_a")); err != ErrStoreReopened {
+		t.Fatal(err)
+	}
+
+	// the batch writes to the reopened store
+	wb.Put([]byte("ckp_b"), []byte("4"))
+	if err = wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkValue(db, t, "ckp_b", "4")
+}
+
+func testCodecOptions(compress bool) *CodecOptions {
+	opts := &CodecOptions{
+		Class: func(key []byte) (byte, bool) {
+			if bytes.HasPrefix(key, []byte("codec_meta")) {
+				return 0, false
+			} else if bytes.HasPrefix(key, []byte("codec_")) {
+				return 2, true
+			}
+			return 1, true
+		},
+		MinSize:     map[byte]int{},
+		Level:       3,
+		DictSize:    4096,
+		DictSamples: 100,
+		MetaKey:     []byte("codec_meta"),
+	}
+	if compress {
+		opts.MinSize[1] = 0
+		opts.MinSize[2] = 0
+	}
+	return opts
+}
+
+func TestCodecStore(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/testdb_codec"
+	cfg.LMDB.MapSize = 10 * 1024 * 1024
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	for _, name := range []string{"goleveldb", "pebble", "bolt"} {
+		t.Logf("store %s with codec", name)
+		cfg.DBName = name
+
+		db, err := Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = db.SetCodec(testCodecOptions(true)); err != nil {
+			t.Fatal(err)
+		}
+
+		testStore(db, t)
+		testClear(db, t)
+		testCodec(db, t)
+		db.Close()
+
+		// the values are still decoded with the saved dictionaries if nothing is compressed
+		if db, err = Open(cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = db.SetCodec(testCodecOptions(false)); err != nil {
+			t.Fatal(err)
+		}
+
+		checkCodecValues(db, t)
+		db.Close()
+	}
+}
+
+func codecValue(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user%d","email":"user%d@example.com","active":true,"roles":["reader","writer"]}`, i, i, i))
+}
+
+func checkCodecValues(db *DB, t *testing.T) {
+	keys := make([][]byte, 0, 400)
+	for i := 0; i < 400; i++ {
+		key := []byte(fmt.Sprintf("codec_%04d", i))
+		keys = append(keys, key)
+
+		checkValue(db, t, string(key), string(codecValue(i)))
+
+		if s, err := db.GetSlice(key); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(s.Data(), codecValue(i)) {
+			t.Fatalf("%q != %q", s.Data(), codecValue(i))
+		}
+	}
+
+	checkValue(db, t, "codec_escape", string(codecMagic)+"escape")
+
+	if vs, err := db.MultiGet(keys); err != nil {
+		t.Fatal(err)
+	} else {
+		for i, v := range vs {
+			if !bytes.Equal(v, codecValue(i)) {
+				t.Fatalf("%q != %q", v, codecValue(i))
+			}
+		}
+	}
+
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	if v, err := snap.Get(keys[1]); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(v, codecValue(1)) {
+		t.Fatalf("%q != %q", v, codecValue(1))
+	}
+
+	i := 0
+	it := snap.NewIterator()
+	defer it.Close()
+	for it.Seek([]byte("codec_0")); it.Valid() && i < len(keys); it.Next() {
+		if !bytes.Equal(it.Value(), codecValue(i)) {
+			t.Fatalf("%q != %q", it.Value(), codecValue(i))
+		}
+		i++
+	}
+
+	if i != len(keys) {
+		t.Fatalf("%d != %d", i, len(keys))
+	}
+}
+
+func testCodec(db *DB, t *testing.T) {
+	for i := 0; i < 200; i++ {
+		db.Put([]byte(fmt.Sprintf("codec_%04d", i)), codecValue(i))
+	}
+
+	// the dictionary is trained in background
+	for i := 0; i < 500; i++ {
+		db.c.m.RLock()
+		d := db.c.classDicts[2]
+		db.c.m.RUnlock()
+
+		if d != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := db.NewWriteBatch()
+	defer w.Close()
+
+	for i := 200; i < 400; i++ {
+		w.Put([]byte(fmt.Sprintf("codec_%04d", i)), codecValue(i))
+	}
+	w.Put([]byte("codec_escape"), append(append([]byte{}, codecMagic...), "escape"...))
+
+	// the batch data is plain for the replication
+	if kvs, err := w.BatchData().Items(); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 201 || !bytes.Equal(kvs[0].Value, codecValue(200)) {
+		t.Fatalf("invalid batch data %q", kvs)
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the values are compressed with the dictionary
+	for _, key := range []string{"codec_0000", "codec_0300"} {
+		v, err := db.db.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.HasPrefix(v, codecMagic) || len(v) >= len(codecValue(0)) {
+			t.Fatalf("value of %s is not compressed: %q", key, v)
+		}
+
+		if key == "codec_0300" && v[len(codecMagic)] == 0 {
+			t.Fatalf("value of %s is not compressed with the dictionary", key)
+		}
+	}
+
+	if v, err := db.db.Get([]byte("codec_escape")); err != nil {
+		t.Fatal(err)
+	} else if string(v) == string(codecMagic)+"escape" {
+		t.Fatal("value with the magic must be encoded")
+	}
+
+	checkCodecValues(db, t)
+
+	if db.st.CompressNum.Get() == 0 || db.st.DecompressNum.Get() == 0 {
+		t.Fatal("invalid compress stat")
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/testdb_cache"
+	cfg.LMDB.MapSize = 10 * 1024 * 1024
+	cfg.ReadCacheSize = 64 * 1024
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	for _, name := range []string{"goleveldb", "pebble", "bolt"} {
+		t.Logf("store %s with cache", name)
+		cfg.DBName = name
+
+		db, err := Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testStore(db, t)
+		testClear(db, t)
+		testCache(db, t)
+		db.Close()
+	}
+}
+
+func testCache(db *DB, t *testing.T) {
+	key := []byte("cache_a")
+	db.Put(key, []byte("1"))
+
+	hit := db.st.CacheHitNum.Get()
+	checkValue(db, t, "cache_a", "1")
+	checkValue(db, t, "cache_a", "1")
+	if n := db.st.CacheHitNum.Get() - hit; n != 1 {
+		t.Fatalf("%d != 1", n)
+	}
+
+	// the cached value can't be modified by the caller
+	v, _ := db.Get(key)
+	v[0] = '2'
+	checkValue(db, t, "cache_a", "1")
+
+	wb := db.NewWriteBatch()
+	wb.Put(key, []byte("2"))
+	checkValue(db, t, "cache_a", "1")
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkValue(db, t, "cache_a", "2")
+
+	wb.DeleteRange([]byte("cache_"), []byte("cache_z"))
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkValue(db, t, "cache_a", "")
+
+	db.Put(key, []byte("3"))
+	checkValue(db, t, "cache_a", "3")
+	db.Merge(key, []byte("1"))
+	checkValue(db, t, "cache_a", "4")
+	db.Delete(key)
+	checkValue(db, t, "cache_a", "")
+
+	// the value read before an invalidation is not cached
+	version := db.cache.version(key)
+	db.cache.invalidate(key)
+	db.cache.add(key, []byte("stale"), version)
+	if _, ok := db.cache.get(key); ok {
+		t.Fatal("stale value is cached")
+	}
+
+	// the cache is bounded
+	for i := 0; i < 1000; i++ {
+		db.Put([]byte(fmt.Sprintf("cache_%04d", i)), bytes.Repeat([]byte("v"), 100))
+		db.Get([]byte(fmt.Sprintf("cache_%04d", i)))
+	}
+
+	for i := range db.cache.shards {
+		s := &db.cache.shards[i]
+		if s.size > s.capacity || s.size != sizeOfShard(s) {
+			t.Fatalf("invalid shard size %d, capacity %d", s.size, s.capacity)
+		}
+	}
+	checkValue(db, t, "cache_0999", strings.Repeat("v", 100))
+	checkValue(db, t, "cache_0000", strings.Repeat("v", 100))
+
+	testClear(db, t)
+}
+
+func sizeOfShard(s *cacheShard) int {
+	n := 0
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		n += e.Value.(*cacheItem).size()
+	}
+	return n
+}
+
+func BenchmarkIterator(b *testing.B) {
+	cfg := config.NewConfigDefault()
+	cfg.DataDir = "/tmp/testdb_bench_iterator"
+	cfg.DBName = "goleveldb"
+
+	os.RemoveAll(cfg.DataDir)
+	defer os.RemoveAll(cfg.DataDir)
+
+	db, err := Open(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	wb := db.NewWriteBatch()
+	for i := 0; i < 10000; i++ {
+		wb.Put([]byte(fmt.Sprintf("key_%05d", i)), []byte("value"))
+	}
+	if err = wb.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	wb.Close()
+
+	b.ResetTimer()
+
+	// the iterators of the parallel scans share the store
+	b.RunParallel(func(pb *testing.PB) {
+		it := db.NewIterator()
+		defer it.Close()
+
+		it.SeekToFirst()
+		for pb.Next() {
+			if !it.Valid() {
+				it.SeekToFirst()
+			}
+			it.RawKey()
+			it.RawValue()
+			it.Next()
+		}
+	})
+}
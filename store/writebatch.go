@@ -1,43 +1,238 @@
 package store
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"time"
 
 	"github.com/ledisdb/ledisdb/store/driver"
-	"github.com/syndtr/goleveldb/leveldb"
 )
 
 type WriteBatch struct {
 	wb driver.IWriteBatch
 	st *Stat
 
-	putNum    int64
-	deleteNum int64
-	db        *DB
+	putNum         int64
+	deleteNum      int64
+	deleteRangeNum int64
+	mergeNum       int64
+	db             *DB
+
+	// the generation of the store the driver batch is created from
+	gen uint64
+
+	// the read error of the merge fallback, returned in committing
+	err error
 
 	data *BatchData
+
+	// the plain data for the replication if the values are encoded by the codec
+	plain *BatchData
+
+	// the keys to invalidate in the read cache after committing
+	cacheWrites cacheWrites
+}
+
+// lock holds the store from reopening, and creates the driver batch again
+// if the store is reopened after the batch is created.
+func (wb *WriteBatch) lock() {
+	if wb.db == nil {
+		return
+	}
+
+	wb.db.rw.RLock()
+	if wb.gen != wb.db.gen {
+		wb.wb.Close()
+		wb.wb = wb.db.db.NewWriteBatch()
+		wb.gen = wb.db.gen
+	}
+}
+
+func (wb *WriteBatch) unlock() {
+	if wb.db != nil {
+		wb.db.rw.RUnlock()
+	}
+}
+
+func (wb *WriteBatch) codec() *codec {
+	if wb.db == nil {
+		return nil
+	}
+	return wb.db.c
+}
+
+// record records the write in the plain data if the values are encoded,
+// and the written keys if the read cache is enabled.
+func (wb *WriteBatch) record(kind byte, key []byte, value []byte) {
+	if wb.db != nil && wb.db.cache != nil {
+		if kind == batchKindDeleteRange {
+			wb.cacheWrites.addRange(key, value)
+		} else {
+			wb.cacheWrites.addKey(key)
+		}
+	}
+
+	if wb.codec() == nil {
+		return
+	}
+
+	if wb.plain == nil {
+		wb.plain = new(BatchData)
+	}
+	wb.plain.append(kind, key, value)
 }
 
 func (wb *WriteBatch) Close() {
+	wb.lock()
+	defer wb.unlock()
+
 	wb.wb.Close()
 }
 
 func (wb *WriteBatch) Put(key []byte, value []byte) {
+	wb.lock()
+	defer wb.unlock()
+
+	wb.put(key, value)
+}
+
+func (wb *WriteBatch) put(key []byte, value []byte) {
 	wb.putNum++
+	wb.record(batchKindPut, key, value)
+
+	if c := wb.codec(); c != nil {
+		value = c.encode(key, value)
+	}
 	wb.wb.Put(key, value)
 }
 
 func (wb *WriteBatch) Delete(key []byte) {
+	wb.lock()
+	defer wb.unlock()
+
 	wb.deleteNum++
+	wb.record(batchKindDelete, key, nil)
 	wb.wb.Delete(key)
 }
 
+// DeleteRange deletes the keys in [start, end). If the driver doesn't support it natively,
+// the existing keys and the keys written in the batch before in the range are deleted one by one.
+func (wb *WriteBatch) DeleteRange(start []byte, end []byte) {
+	if wb.deleteRangeNative(start, end) {
+		return
+	}
+
+	// the batch data can't be appended while decoding
+	var keys [][]byte
+	wb.BatchData().decode(func(kind byte, key []byte, value []byte) error {
+		if bytes.Compare(start, key) <= 0 && bytes.Compare(key, end) < 0 {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return nil
+	})
+
+	for _, key := range keys {
+		wb.Delete(key)
+	}
+
+	it := wb.db.RangeIterator(start, end, RangeROpen)
+	for ; it.Valid(); it.Next() {
+		wb.Delete(it.RawKey())
+	}
+	it.Close()
+}
+
+func (wb *WriteBatch) deleteRangeNative(start []byte, end []byte) bool {
+	wb.lock()
+	defer wb.unlock()
+
+	d, ok := wb.wb.(driver.IBatchRangeDeleter)
+	if !ok {
+		return false
+	}
+
+	wb.deleteRangeNum++
+	wb.record(batchKindDeleteRange, start, end)
+	d.DeleteRange(start, end)
+	return true
+}
+
+// Merge adds the int64 delta in value to the value of key with the merge operator,
+// see driver.MergeInt64Add. If the driver doesn't support it natively, the value
+// written in the batch before or the existing value is read, and the sum is put.
+func (wb *WriteBatch) Merge(key []byte, value []byte) {
+	wb.lock()
+	defer wb.unlock()
+
+	if d, ok := wb.wb.(driver.IBatchMerger); ok {
+		wb.mergeNum++
+		wb.record(batchKindMerge, key, value)
+		d.Merge(key, value)
+		return
+	}
+
+	v, ok := wb.batchValue(key)
+	if !ok {
+		var err error
+		if v, err = wb.db.get(key); err != nil {
+			if wb.err == nil {
+				wb.err = err
+			}
+			return
+		}
+	}
+
+	if v != nil {
+		value = driver.MergeInt64Add(v, value)
+	}
+	wb.put(key, value)
+}
+
+// batchValue returns the last value of key written in the batch, nil if deleted,
+// and false if the key is not written.
+func (wb *WriteBatch) batchValue(key []byte) ([]byte, bool) {
+	var v []byte
+	written := false
+
+	// the batch has no merge or range deletion, they are put or deleted one by one
+	wb.batchData().decode(func(kind byte, k []byte, value []byte) error {
+		if bytes.Equal(k, key) {
+			v = value
+			written = true
+		}
+		return nil
+	})
+
+	if v != nil {
+		v = append([]byte{}, v...)
+	}
+	return v, written
+}
+
 func (wb *WriteBatch) Commit() error {
+	wb.lock()
+	defer wb.unlock()
+
+	if wb.err != nil {
+		err := wb.err
+		wb.rollback()
+		return err
+	}
+
 	wb.st.BatchCommitNum.Add(1)
 	wb.st.PutNum.Add(wb.putNum)
 	wb.st.DeleteNum.Add(wb.deleteNum)
+	wb.st.DeleteRangeNum.Add(wb.deleteRangeNum)
+	wb.st.MergeNum.Add(wb.mergeNum)
 	wb.putNum = 0
 	wb.deleteNum = 0
+	wb.deleteRangeNum = 0
+	wb.mergeNum = 0
+
+	if wb.plain != nil {
+		wb.plain.Reset()
+	}
 
 	var err error
 	t := time.Now()
@@ -47,20 +242,53 @@ func (wb *WriteBatch) Commit() error {
 		err = wb.wb.SyncCommit()
 	}
 
+	if wb.db != nil && wb.db.cache != nil {
+		wb.cacheWrites.invalidate(wb.db.cache)
+	}
+
 	wb.st.BatchCommitTotalTime.Add(time.Now().Sub(t))
 
 	return err
 }
 
 func (wb *WriteBatch) Rollback() error {
+	wb.lock()
+	defer wb.unlock()
+
+	return wb.rollback()
+}
+
+func (wb *WriteBatch) rollback() error {
 	wb.putNum = 0
 	wb.deleteNum = 0
+	wb.deleteRangeNum = 0
+	wb.mergeNum = 0
+	wb.err = nil
+
+	if wb.plain != nil {
+		wb.plain.Reset()
+	}
+	wb.cacheWrites.reset()
 
 	return wb.wb.Rollback()
 }
 
 // BatchData the data will be undefined after commit or rollback
 func (wb *WriteBatch) BatchData() *BatchData {
+	wb.lock()
+	defer wb.unlock()
+
+	return wb.batchData()
+}
+
+func (wb *WriteBatch) batchData() *BatchData {
+	if wb.codec() != nil {
+		if wb.plain == nil {
+			wb.plain = new(BatchData)
+		}
+		return wb.plain
+	}
+
 	data := wb.wb.Data()
 	if wb.data == nil {
 		wb.data = new(BatchData)
@@ -77,10 +305,30 @@ func (wb *WriteBatch) Data() []byte {
 
 /*
 	see leveldb batch data format for more information
+
+	the range deletion is saved like RocksDB, the record kind is 0xF,
+	and the end key is saved as the value
+
+	the merge is saved like RocksDB too, the record kind is 0x2
 */
 
+const (
+	batchHeaderLen = 12
+
+	batchKindDelete      byte = 0x0
+	batchKindPut         byte = 0x1
+	batchKindMerge       byte = 0x2
+	batchKindDeleteRange byte = 0xF
+)
+
+var (
+	errBatchCorrupted   = errors.New("batch data corrupted")
+	errBatchDeleteRange = errors.New("batch data replay doesn't support range deletion")
+	errBatchMerge       = errors.New("batch data replay doesn't support merge")
+)
+
 type BatchData struct {
-	leveldb.Batch
+	data []byte
 }
 
 func NewBatchData(data []byte) (*BatchData, error) {
@@ -93,12 +341,71 @@ func NewBatchData(data []byte) (*BatchData, error) {
 	return b, nil
 }
 
+// Load loads the data without copying it.
+func (d *BatchData) Load(data []byte) error {
+	if len(data) < batchHeaderLen {
+		return errBatchCorrupted
+	}
+
+	d.data = data
+	return nil
+}
+
 func (d *BatchData) Data() []byte {
-	return d.Dump()
+	if len(d.data) == 0 {
+		return make([]byte, batchHeaderLen)
+	}
+	return d.data
+}
+
+// Len returns the number of records.
+func (d *BatchData) Len() int {
+	if len(d.data) < batchHeaderLen {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(d.data[8:]))
+}
+
+// append appends the record, the value is ignored for the deletion.
+func (d *BatchData) append(kind byte, key []byte, value []byte) {
+	if len(d.data) < batchHeaderLen {
+		d.data = append(d.data[0:0], make([]byte, batchHeaderLen)...)
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	d.data = append(d.data, kind)
+	d.data = append(d.data, buf[0:binary.PutUvarint(buf[:], uint64(len(key)))]...)
+	d.data = append(d.data, key...)
+	if kind != batchKindDelete {
+		d.data = append(d.data, buf[0:binary.PutUvarint(buf[:], uint64(len(value)))]...)
+		d.data = append(d.data, value...)
+	}
+
+	binary.LittleEndian.PutUint32(d.data[8:], uint32(d.Len()+1))
 }
 
 func (d *BatchData) Reset() {
-	d.Batch.Reset()
+	d.data = d.data[0:0]
+}
+
+// Put appends the put record, the batch data is built by replaying another one to it.
+func (d *BatchData) Put(key, value []byte) {
+	d.append(batchKindPut, key, value)
+}
+
+// Delete appends the deletion record.
+func (d *BatchData) Delete(key []byte) {
+	d.append(batchKindDelete, key, nil)
+}
+
+// DeleteRange appends the range deletion record.
+func (d *BatchData) DeleteRange(start, end []byte) {
+	d.append(batchKindDeleteRange, start, end)
+}
+
+// Merge appends the merge record.
+func (d *BatchData) Merge(key, value []byte) {
+	d.append(batchKindMerge, key, value)
 }
 
 type BatchDataReplay interface {
@@ -106,6 +413,22 @@ type BatchDataReplay interface {
 	Delete(key []byte)
 }
 
+// BatchDataRangeReplay is the replay which supports the range deletion,
+// replaying the range deletion into a BatchDataReplay returns an error.
+type BatchDataRangeReplay interface {
+	BatchDataReplay
+
+	DeleteRange(start, end []byte)
+}
+
+// BatchDataMergeReplay is the replay which supports the merge,
+// replaying the merge into a BatchDataReplay returns an error.
+type BatchDataMergeReplay interface {
+	BatchDataReplay
+
+	Merge(key, value []byte)
+}
+
 type BatchItem struct {
 	Key   []byte
 	Value []byte
@@ -122,9 +445,80 @@ func (bs *batchItems) Delete(key []byte) {
 }
 
 func (d *BatchData) Replay(r BatchDataReplay) error {
-	return d.Batch.Replay(r)
+	rr, _ := r.(BatchDataRangeReplay)
+	mr, _ := r.(BatchDataMergeReplay)
+
+	return d.decode(func(kind byte, key []byte, value []byte) error {
+		switch kind {
+		case batchKindPut:
+			r.Put(key, value)
+		case batchKindDelete:
+			r.Delete(key)
+		case batchKindDeleteRange:
+			if rr == nil {
+				return errBatchDeleteRange
+			}
+			rr.DeleteRange(key, value)
+		case batchKindMerge:
+			if mr == nil {
+				return errBatchMerge
+			}
+			mr.Merge(key, value)
+		}
+		return nil
+	})
+}
+
+func (d *BatchData) decode(f func(kind byte, key []byte, value []byte) error) error {
+	pos := batchHeaderLen
+	for i := 0; i < d.Len(); i++ {
+		if pos >= len(d.data) {
+			return errBatchCorrupted
+		}
+
+		kind := d.data[pos]
+		pos++
+
+		switch kind {
+		case batchKindPut, batchKindDelete, batchKindDeleteRange, batchKindMerge:
+		default:
+			return errBatchCorrupted
+		}
+
+		key, n := decodeBatchSlice(d.data[pos:])
+		if n <= 0 {
+			return errBatchCorrupted
+		}
+		pos += n
+
+		var value []byte
+		if kind != batchKindDelete {
+			if value, n = decodeBatchSlice(d.data[pos:]); n <= 0 {
+				return errBatchCorrupted
+			}
+			pos += n
+		}
+
+		if err := f(kind, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeBatchSlice decodes the length prefixed slice, and returns the read size, or 0 if corrupted.
+func decodeBatchSlice(buf []byte) ([]byte, int) {
+	x, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < x {
+		return nil, 0
+	}
+
+	return buf[n : n+int(x)], n + int(x)
 }
 
+// Items returns the puts and deletes in the batch,
+// it returns an error if there is any range deletion or merge.
 func (d *BatchData) Items() ([]BatchItem, error) {
 	is := make(batchItems, 0, d.Len())
 